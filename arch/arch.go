@@ -0,0 +1,117 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package arch maps the many names used for CPU architectures, such as
+// those reported by uname -m, GOARCH and dpkg, onto a single canonical
+// name for each.
+package arch
+
+import (
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// The canonical architecture names. They are the names used by dpkg.
+const (
+	AMD64   = "amd64"
+	I386    = "i386"
+	ARM     = "armhf"
+	ARM64   = "arm64"
+	PPC64EL = "ppc64el"
+	S390X   = "s390x"
+	RISCV64 = "riscv64"
+)
+
+// AllSupportedArches holds all the canonical architecture names.
+var AllSupportedArches = []string{
+	AMD64,
+	I386,
+	ARM,
+	ARM64,
+	PPC64EL,
+	S390X,
+	RISCV64,
+}
+
+// archREs maps the raw names of architectures to canonical names.
+var archREs = []struct {
+	re   *regexp.Regexp
+	arch string
+}{
+	{regexp.MustCompile(`^(amd64|x86_64|x64|x86-64)$`), AMD64},
+	{regexp.MustCompile(`^(i[3-6]86|386|x86)$`), I386},
+	{regexp.MustCompile(`^(arm|armhf|armel|armv[6-8]l)$`), ARM},
+	{regexp.MustCompile(`^(arm64|aarch64|armv8b|arm64e)$`), ARM64},
+	{regexp.MustCompile(`^(ppc64el|ppc64le|ppc64)$`), PPC64EL},
+	{regexp.MustCompile(`^s390x$`), S390X},
+	{regexp.MustCompile(`^riscv64$`), RISCV64},
+}
+
+// HostArch returns the canonical name of the architecture that the
+// running program was built for. It is a variable so that tests can
+// replace it.
+var HostArch = func() string {
+	return NormaliseArch(runtime.GOARCH)
+}
+
+// NormaliseArch returns the canonical name for rawArch, which may be
+// any of the names in common use for an architecture. Names that are
+// not recognised are returned unchanged apart from being lower cased,
+// so IsSupportedArch should be used to check the result.
+func NormaliseArch(rawArch string) string {
+	rawArch = strings.ToLower(strings.TrimSpace(rawArch))
+	for _, m := range archREs {
+		if m.re.MatchString(rawArch) {
+			return m.arch
+		}
+	}
+	return rawArch
+}
+
+// IsSupportedArch reports whether arch is a canonical architecture
+// name.
+func IsSupportedArch(arch string) bool {
+	for _, a := range AllSupportedArches {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseArch returns the canonical name for rawArch, or an error
+// satisfying errors.IsNotValid if it names no known architecture.
+func ParseArch(rawArch string) (string, error) {
+	arch := NormaliseArch(rawArch)
+	if !IsSupportedArch(arch) {
+		return "", errors.NotValidf("architecture %q", rawArch)
+	}
+	return arch, nil
+}
+
+// Matches reports whether rawArch satisfies constraint, which is a
+// list of architectures separated by "|", such as "arm64|amd64". The
+// names in the constraint, and rawArch, may be any of the names in
+// common use. An empty constraint, or "*", matches any architecture.
+func Matches(constraint, rawArch string) (bool, error) {
+	arch, err := ParseArch(rawArch)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	constraint = strings.TrimSpace(constraint)
+	if constraint == "" || constraint == "*" {
+		return true, nil
+	}
+	match := false
+	for _, term := range strings.Split(constraint, "|") {
+		want, err := ParseArch(term)
+		if err != nil {
+			return false, errors.Annotatef(err, "invalid constraint %q", constraint)
+		}
+		match = match || want == arch
+	}
+	return match, nil
+}
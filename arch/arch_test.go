@@ -0,0 +1,87 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package arch_test
+
+import (
+	"runtime"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/arch"
+)
+
+type archSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&archSuite{})
+
+func (s *archSuite) TestNormaliseArch(c *gc.C) {
+	for _, test := range []struct {
+		raw  string
+		arch string
+	}{
+		{"amd64", arch.AMD64},
+		{"x86_64", arch.AMD64},
+		{"X86_64\n", arch.AMD64},
+		{"386", arch.I386},
+		{"i386", arch.I386},
+		{"i686", arch.I386},
+		{"arm", arch.ARM},
+		{"armv7l", arch.ARM},
+		{"armhf", arch.ARM},
+		{"aarch64", arch.ARM64},
+		{"arm64", arch.ARM64},
+		{"ppc64le", arch.PPC64EL},
+		{"ppc64el", arch.PPC64EL},
+		{"s390x", arch.S390X},
+		{"riscv64", arch.RISCV64},
+		{"mips", "mips"},
+	} {
+		c.Logf("%q", test.raw)
+		c.Check(arch.NormaliseArch(test.raw), gc.Equals, test.arch)
+	}
+}
+
+func (s *archSuite) TestHostArch(c *gc.C) {
+	host := arch.HostArch()
+	c.Assert(arch.IsSupportedArch(host), jc.IsTrue)
+	c.Assert(host, gc.Equals, arch.NormaliseArch(runtime.GOARCH))
+}
+
+func (s *archSuite) TestParseArch(c *gc.C) {
+	a, err := arch.ParseArch("x86_64")
+	c.Assert(err, gc.IsNil)
+	c.Assert(a, gc.Equals, arch.AMD64)
+	_, err = arch.ParseArch("vax")
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, `architecture "vax" not valid`)
+}
+
+func (s *archSuite) TestMatches(c *gc.C) {
+	for i, test := range []struct {
+		constraint string
+		arch       string
+		match      bool
+	}{
+		{"", "amd64", true},
+		{"*", "s390x", true},
+		{"arm64|amd64", "x86_64", true},
+		{"arm64|amd64", "aarch64", true},
+		{"arm64 | amd64", "ppc64le", false},
+		{"i386", "i686", true},
+	} {
+		c.Logf("test %d", i)
+		match, err := arch.Matches(test.constraint, test.arch)
+		c.Assert(err, gc.IsNil)
+		c.Assert(match, gc.Equals, test.match)
+	}
+	_, err := arch.Matches("amd64|vax", "amd64")
+	c.Assert(err, gc.ErrorMatches, `invalid constraint "amd64\|vax": architecture "vax" not valid`)
+	_, err = arch.Matches("amd64", "vax")
+	c.Assert(err, gc.ErrorMatches, `architecture "vax" not valid`)
+}
@@ -0,0 +1,186 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package bloom implements a Bloom filter, a set membership test that
+// may report false positives but never false negatives.
+package bloom
+
+import (
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+
+	"github.com/juju/errors"
+)
+
+// Filter is a Bloom filter. Its methods may be called concurrently and
+// do not allocate.
+type Filter struct {
+	m     uint64
+	k     uint32
+	words []uint64
+}
+
+// New returns a filter sized to hold n items with the given false
+// positive rate, which must be between 0 and 1 exclusive.
+func New(n uint64, rate float64) (*Filter, error) {
+	if n == 0 {
+		return nil, errors.NotValidf("capacity 0")
+	}
+	if rate <= 0 || rate >= 1 {
+		return nil, errors.NotValidf("false positive rate %v", rate)
+	}
+	m := math.Ceil(-float64(n) * math.Log(rate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	return NewWithSize(uint64(m), uint32(math.Max(k, 1))), nil
+}
+
+// NewWithSize returns a filter with m bits using k hash functions.
+func NewWithSize(m uint64, k uint32) *Filter {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &Filter{
+		m:     m,
+		k:     k,
+		words: make([]uint64, (m+63)/64),
+	}
+}
+
+// Bits returns the number of bits in the filter.
+func (f *Filter) Bits() uint64 {
+	return f.m
+}
+
+// Hashes returns the number of hash functions used by the filter.
+func (f *Filter) Hashes() uint32 {
+	return f.k
+}
+
+// Add adds data to the filter.
+func (f *Filter) Add(data []byte) {
+	h1, h2 := hashes(data)
+	for i := uint32(0); i < f.k; i++ {
+		f.set((h1 + uint64(i)*h2) % f.m)
+	}
+}
+
+// AddString adds s to the filter.
+func (f *Filter) AddString(s string) {
+	f.Add([]byte(s))
+}
+
+// Test reports whether data may have been added to the filter. It
+// returns false only if data has definitely not been added.
+func (f *Filter) Test(data []byte) bool {
+	h1, h2 := hashes(data)
+	for i := uint32(0); i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if atomic.LoadUint64(&f.words[bit/64])&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestString reports whether s may have been added to the filter.
+func (f *Filter) TestString(s string) bool {
+	return f.Test([]byte(s))
+}
+
+func (f *Filter) set(bit uint64) {
+	word := &f.words[bit/64]
+	mask := uint64(1) << (bit % 64)
+	for {
+		old := atomic.LoadUint64(word)
+		if old&mask != 0 || atomic.CompareAndSwapUint64(word, old, old|mask) {
+			return
+		}
+	}
+}
+
+// Merge adds all the items of other to f. Both filters must have the
+// same size and number of hash functions.
+func (f *Filter) Merge(other *Filter) error {
+	if f.m != other.m || f.k != other.k {
+		return errors.Errorf("cannot merge filters of different sizes")
+	}
+	for i := range other.words {
+		w := atomic.LoadUint64(&other.words[i])
+		for {
+			old := atomic.LoadUint64(&f.words[i])
+			if atomic.CompareAndSwapUint64(&f.words[i], old, old|w) {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	magic      = "BLM"
+	version    = 1
+	headerSize = len(magic) + 1 + 4 + 8
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, headerSize+8*len(f.words))
+	copy(data, magic)
+	data[3] = version
+	binary.LittleEndian.PutUint32(data[4:], f.k)
+	binary.LittleEndian.PutUint64(data[8:], f.m)
+	for i := range f.words {
+		binary.LittleEndian.PutUint64(data[headerSize+8*i:], atomic.LoadUint64(&f.words[i]))
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || string(data[:3]) != magic {
+		return errors.NotValidf("bloom filter data")
+	}
+	if data[3] != version {
+		return errors.NotSupportedf("bloom filter version %d", data[3])
+	}
+	k := binary.LittleEndian.Uint32(data[4:])
+	m := binary.LittleEndian.Uint64(data[8:])
+	nwords := (m + 63) / 64
+	if k == 0 || m == 0 || uint64(len(data)-headerSize) != 8*nwords {
+		return errors.NotValidf("bloom filter data")
+	}
+	words := make([]uint64, nwords)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(data[headerSize+8*i:])
+	}
+	f.m, f.k, f.words = m, k, words
+	return nil
+}
+
+// hashes returns two independent 64 bit hashes of data, combined by
+// the caller to derive the k bit positions.
+func hashes(data []byte) (uint64, uint64) {
+	// FNV-1a, written out to avoid allocating a hash.Hash64.
+	h := uint64(14695981039346656037)
+	for _, b := range data {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	h1 := mix(h)
+	h2 := mix(h1) | 1
+	return h1, h2
+}
+
+// mix is the 64 bit finalizer from MurmurHash3.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bloom_test
+
+import (
+	"fmt"
+	"sync"
+	stdtesting "testing"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/bloom"
+)
+
+type bloomSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&bloomSuite{})
+
+func (*bloomSuite) TestNoFalseNegatives(c *gc.C) {
+	f, err := bloom.New(1000, 0.01)
+	c.Assert(err, gc.IsNil)
+	for i := 0; i < 1000; i++ {
+		f.AddString(fmt.Sprint("item", i))
+	}
+	for i := 0; i < 1000; i++ {
+		c.Assert(f.TestString(fmt.Sprint("item", i)), jc.IsTrue)
+	}
+}
+
+func (*bloomSuite) TestFalsePositiveRate(c *gc.C) {
+	f, err := bloom.New(1000, 0.01)
+	c.Assert(err, gc.IsNil)
+	c.Assert(f.Bits(), gc.Equals, uint64(9586))
+	c.Assert(f.Hashes(), gc.Equals, uint32(7))
+	for i := 0; i < 1000; i++ {
+		f.AddString(fmt.Sprint("item", i))
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if f.TestString(fmt.Sprint("other", i)) {
+			falsePositives++
+		}
+	}
+	// Allow generous slack over the expected 100.
+	c.Assert(falsePositives < 200, jc.IsTrue, gc.Commentf("%d false positives", falsePositives))
+}
+
+func (*bloomSuite) TestNewErrors(c *gc.C) {
+	_, err := bloom.New(0, 0.1)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	_, err = bloom.New(10, 1)
+	c.Assert(err, gc.ErrorMatches, "false positive rate 1 not valid")
+}
+
+func (*bloomSuite) TestConcurrentAdd(c *gc.C) {
+	f := bloom.NewWithSize(1<<16, 4)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				f.AddString(fmt.Sprint(g, "-", i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	for g := 0; g < 4; g++ {
+		for i := 0; i < 500; i++ {
+			c.Assert(f.TestString(fmt.Sprint(g, "-", i)), jc.IsTrue)
+		}
+	}
+}
+
+func (*bloomSuite) TestMerge(c *gc.C) {
+	a := bloom.NewWithSize(1024, 3)
+	b := bloom.NewWithSize(1024, 3)
+	a.AddString("a")
+	b.AddString("b")
+	c.Assert(a.Merge(b), gc.IsNil)
+	c.Assert(a.TestString("a"), jc.IsTrue)
+	c.Assert(a.TestString("b"), jc.IsTrue)
+
+	err := a.Merge(bloom.NewWithSize(2048, 3))
+	c.Assert(err, gc.ErrorMatches, "cannot merge filters of different sizes")
+}
+
+func (*bloomSuite) TestMarshalBinary(c *gc.C) {
+	f := bloom.NewWithSize(1000, 5)
+	f.AddString("hello")
+	data, err := f.MarshalBinary()
+	c.Assert(err, gc.IsNil)
+
+	var g bloom.Filter
+	err = g.UnmarshalBinary(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(g.Bits(), gc.Equals, uint64(1000))
+	c.Assert(g.Hashes(), gc.Equals, uint32(5))
+	c.Assert(g.TestString("hello"), jc.IsTrue)
+	c.Assert(g.TestString("goodbye"), jc.IsFalse)
+
+	err = g.UnmarshalBinary(data[:len(data)-1])
+	c.Assert(err, gc.ErrorMatches, "bloom filter data not valid")
+	data[3] = 9
+	err = g.UnmarshalBinary(data)
+	c.Assert(err, gc.ErrorMatches, "bloom filter version 9 not supported")
+}
+
+func (*bloomSuite) TestAllocations(c *gc.C) {
+	f := bloom.NewWithSize(1024, 4)
+	data := []byte("data")
+	allocs := stdtesting.AllocsPerRun(100, func() {
+		f.Add(data)
+		f.Test(data)
+	})
+	c.Assert(allocs, gc.Equals, float64(0))
+}
@@ -0,0 +1,195 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package bufpool provides pools of reusable byte buffers grouped into
+// size classes.
+package bufpool
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSizes holds the size classes used by New when none are given.
+var DefaultSizes = []int{512, 4 * 1024, 32 * 1024, 256 * 1024}
+
+// Default is the pool used by the package level functions.
+var Default = New()
+
+// Pool holds buffers in a set of size classes. A buffer returned by Get
+// has a capacity of at least its size class; buffers returned with Put
+// are filed under the largest class they can hold. Buffers much larger
+// than the largest class are dropped rather than retained.
+type Pool struct {
+	classes     []*sizeClass
+	outstanding int64
+
+	mu     sync.Mutex
+	track  bool
+	stacks map[*bytes.Buffer][]byte
+}
+
+type sizeClass struct {
+	size int
+	pool sync.Pool
+}
+
+// New returns a new pool with the given size classes. If no sizes are
+// given, DefaultSizes is used.
+func New(sizes ...int) *Pool {
+	if len(sizes) == 0 {
+		sizes = DefaultSizes
+	}
+	sizes = append([]int(nil), sizes...)
+	sort.Ints(sizes)
+	p := &Pool{}
+	for _, size := range sizes {
+		if size <= 0 || (len(p.classes) > 0 && p.classes[len(p.classes)-1].size == size) {
+			continue
+		}
+		p.classes = append(p.classes, &sizeClass{size: size})
+	}
+	return p
+}
+
+// Get returns an empty buffer with a capacity of at least hint bytes.
+// The buffer should be returned with Put when it is no longer needed.
+func (p *Pool) Get(hint int) *bytes.Buffer {
+	var buf *bytes.Buffer
+	for _, class := range p.classes {
+		if class.size < hint {
+			continue
+		}
+		if b, ok := class.pool.Get().(*bytes.Buffer); ok {
+			buf = b
+		} else {
+			buf = bytes.NewBuffer(make([]byte, 0, class.size))
+		}
+		break
+	}
+	if buf == nil {
+		buf = bytes.NewBuffer(make([]byte, 0, hint))
+	}
+	atomic.AddInt64(&p.outstanding, 1)
+	p.mu.Lock()
+	if p.track {
+		p.stacks[buf] = stack()
+	}
+	p.mu.Unlock()
+	return buf
+}
+
+// Put returns a buffer to the pool. The buffer must not be used after
+// it has been put.
+func (p *Pool) Put(buf *bytes.Buffer) {
+	if buf == nil {
+		return
+	}
+	atomic.AddInt64(&p.outstanding, -1)
+	p.mu.Lock()
+	if p.track {
+		delete(p.stacks, buf)
+	}
+	p.mu.Unlock()
+
+	capacity := buf.Cap()
+	if len(p.classes) == 0 || capacity > 2*p.classes[len(p.classes)-1].size {
+		return
+	}
+	for i := len(p.classes) - 1; i >= 0; i-- {
+		if class := p.classes[i]; class.size <= capacity {
+			buf.Reset()
+			class.pool.Put(buf)
+			return
+		}
+	}
+}
+
+// WithBuffer calls f with a buffer from the pool, returning the buffer
+// to the pool when f returns. The buffer must not be retained by f.
+func (p *Pool) WithBuffer(f func(*bytes.Buffer)) {
+	buf := p.Get(0)
+	defer p.Put(buf)
+	f(buf)
+}
+
+// copyBufferSize is the size of the buffers used by Copy, as used by
+// io.Copy.
+const copyBufferSize = 32 * 1024
+
+// Copy copies from src to dst until EOF or an error, as io.Copy does,
+// but with a buffer from the pool rather than a newly allocated one.
+// Any WriteTo method of src or ReadFrom method of dst is not used, as
+// those may allocate buffers of their own.
+func (p *Pool) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := p.Get(copyBufferSize)
+	defer p.Put(buf)
+	return io.CopyBuffer(writerOnly{dst}, readerOnly{src}, buf.Bytes()[:copyBufferSize])
+}
+
+// readerOnly and writerOnly hide all but the Read and Write methods.
+type readerOnly struct{ io.Reader }
+type writerOnly struct{ io.Writer }
+
+// Outstanding returns the number of buffers obtained with Get that have
+// not yet been returned with Put.
+func (p *Pool) Outstanding() int {
+	return int(atomic.LoadInt64(&p.outstanding))
+}
+
+// TrackLeaks enables or disables recording of the call stack of each
+// outstanding buffer, reported by Leaks. It is intended for use in
+// tests; tracking is expensive. Disabling tracking discards any
+// recorded stacks.
+func (p *Pool) TrackLeaks(enable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.track = enable
+	if enable {
+		p.stacks = make(map[*bytes.Buffer][]byte)
+	} else {
+		p.stacks = nil
+	}
+}
+
+// Leaks returns the call stacks of the Get calls whose buffers have not
+// been returned since leak tracking was enabled.
+func (p *Pool) Leaks() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	leaks := make([]string, 0, len(p.stacks))
+	for _, s := range p.stacks {
+		leaks = append(leaks, string(s))
+	}
+	sort.Strings(leaks)
+	return leaks
+}
+
+func stack() []byte {
+	buf := make([]byte, 4096)
+	return buf[:runtime.Stack(buf, false)]
+}
+
+// Get returns a buffer from the Default pool.
+func Get(hint int) *bytes.Buffer {
+	return Default.Get(hint)
+}
+
+// Put returns a buffer to the Default pool.
+func Put(buf *bytes.Buffer) {
+	Default.Put(buf)
+}
+
+// WithBuffer calls f with a buffer from the Default pool.
+func WithBuffer(f func(*bytes.Buffer)) {
+	Default.WithBuffer(f)
+}
+
+// Copy copies from src to dst using a buffer from the Default pool.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	return Default.Copy(dst, src)
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package bufpool_test
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/bufpool"
+)
+
+type bufpoolSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&bufpoolSuite{})
+
+func (*bufpoolSuite) TestGetSizeClasses(c *gc.C) {
+	p := bufpool.New(1024, 64)
+	for i, test := range []struct {
+		hint   int
+		minCap int
+		maxCap int
+	}{
+		{0, 64, 64},
+		{64, 64, 64},
+		{65, 1024, 1024},
+		{1024, 1024, 1024},
+		{5000, 5000, 5000},
+	} {
+		c.Logf("test %d: hint %d", i, test.hint)
+		buf := p.Get(test.hint)
+		c.Check(buf.Len(), gc.Equals, 0)
+		c.Check(buf.Cap() >= test.minCap, jc.IsTrue)
+		c.Check(buf.Cap() <= test.maxCap, jc.IsTrue)
+		p.Put(buf)
+	}
+}
+
+func (*bufpoolSuite) TestPutResets(c *gc.C) {
+	p := bufpool.New(64)
+	buf := p.Get(0)
+	buf.WriteString("hello")
+	p.Put(buf)
+	// Whether or not the same buffer is handed back, it must be empty.
+	c.Assert(p.Get(0).Len(), gc.Equals, 0)
+}
+
+func (*bufpoolSuite) TestOutstanding(c *gc.C) {
+	p := bufpool.New()
+	a := p.Get(0)
+	b := p.Get(100000)
+	c.Assert(p.Outstanding(), gc.Equals, 2)
+	p.Put(a)
+	c.Assert(p.Outstanding(), gc.Equals, 1)
+	p.Put(b)
+	c.Assert(p.Outstanding(), gc.Equals, 0)
+	p.Put(nil)
+	c.Assert(p.Outstanding(), gc.Equals, 0)
+}
+
+func (*bufpoolSuite) TestWithBuffer(c *gc.C) {
+	p := bufpool.New()
+	var got *bytes.Buffer
+	p.WithBuffer(func(buf *bytes.Buffer) {
+		c.Assert(p.Outstanding(), gc.Equals, 1)
+		buf.WriteString("data")
+		got = buf
+	})
+	c.Assert(got, gc.NotNil)
+	c.Assert(p.Outstanding(), gc.Equals, 0)
+}
+
+func (*bufpoolSuite) TestWithBufferPanic(c *gc.C) {
+	p := bufpool.New()
+	func() {
+		defer func() {
+			c.Assert(recover(), gc.Equals, "oops")
+		}()
+		p.WithBuffer(func(*bytes.Buffer) {
+			panic("oops")
+		})
+	}()
+	c.Assert(p.Outstanding(), gc.Equals, 0)
+}
+
+func (*bufpoolSuite) TestLeaks(c *gc.C) {
+	p := bufpool.New()
+	p.TrackLeaks(true)
+	a := leakyGet(p)
+	b := p.Get(0)
+	p.Put(b)
+	leaks := p.Leaks()
+	c.Assert(leaks, gc.HasLen, 1)
+	c.Assert(leaks[0], jc.Contains, "leakyGet")
+	p.Put(a)
+	c.Assert(p.Leaks(), gc.HasLen, 0)
+
+	p.Get(0)
+	p.TrackLeaks(false)
+	c.Assert(p.Leaks(), gc.HasLen, 0)
+}
+
+func leakyGet(p *bufpool.Pool) *bytes.Buffer {
+	return p.Get(0)
+}
+
+func (*bufpoolSuite) TestDefault(c *gc.C) {
+	before := bufpool.Default.Outstanding()
+	buf := bufpool.Get(10)
+	c.Assert(bufpool.Default.Outstanding(), gc.Equals, before+1)
+	bufpool.Put(buf)
+	bufpool.WithBuffer(func(buf *bytes.Buffer) {
+		c.Assert(bufpool.Default.Outstanding(), gc.Equals, before+1)
+	})
+	c.Assert(bufpool.Default.Outstanding(), gc.Equals, before)
+}
+
+func (*bufpoolSuite) TestCopy(c *gc.C) {
+	p := bufpool.New()
+	data := strings.Repeat("0123456789", 10000)
+	var dst bytes.Buffer
+	n, err := p.Copy(&dst, strings.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(n, gc.Equals, int64(len(data)))
+	c.Assert(dst.String(), gc.Equals, data)
+	c.Assert(p.Outstanding(), gc.Equals, 0)
+}
@@ -0,0 +1,296 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package cas implements a content-addressable blob store on the local
+// file system.
+//
+// Each blob is identified by the hex-encoded SHA256 digest of its
+// content and stored under a two-level fan-out of directories named
+// after the first four characters of the digest, so that blob
+// "abcdef..." is stored at "ab/cd/abcdef...". Storing the same content
+// twice stores it once.
+//
+// Blobs carry a reference count, maintained with Ref and Unref. GC
+// removes blobs that are no longer referenced.
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// ErrCorrupt is the cause of errors returned when the content of a
+// stored blob no longer matches its digest.
+var ErrCorrupt = errors.New("blob content does not match digest")
+
+const (
+	tmpDir    = "tmp"
+	refSuffix = ".refs"
+)
+
+// Store is a content-addressable blob store rooted at a directory. Its
+// methods may be called concurrently, but the directory must not be
+// shared with other processes.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// New returns a store keeping blobs in dir, which is created if
+// necessary.
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, tmpDir), 0755); err != nil {
+		return nil, errors.Annotate(err, "cannot create blob store")
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Put stores the content read from r and returns its digest and size.
+func (s *Store) Put(r io.Reader) (digest string, size int64, err error) {
+	f, err := ioutil.TempFile(filepath.Join(s.dir, tmpDir), "blob")
+	if err != nil {
+		return "", 0, errors.Annotate(err, "cannot create blob")
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	h := sha256.New()
+	size, err = io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return "", 0, errors.Annotate(err, "cannot write blob")
+	}
+	if err := f.Close(); err != nil {
+		return "", 0, errors.Annotate(err, "cannot write blob")
+	}
+	digest = hex.EncodeToString(h.Sum(nil))
+	path := s.path(digest)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(path); err == nil {
+		// Already stored; touch it so that a concurrent GC
+		// grace period starts afresh.
+		os.Remove(f.Name())
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return digest, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, errors.Annotate(err, "cannot store blob")
+	}
+	if err := os.Chmod(f.Name(), 0444); err != nil {
+		return "", 0, errors.Annotate(err, "cannot store blob")
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", 0, errors.Annotate(err, "cannot store blob")
+	}
+	return digest, size, nil
+}
+
+// Get returns a reader for the blob with the given digest. The content
+// is verified as it is read: if it does not match the digest, the read
+// that would have returned io.EOF fails with an error whose cause is
+// ErrCorrupt instead.
+func (s *Store) Get(digest string) (io.ReadCloser, error) {
+	if err := checkDigest(digest); err != nil {
+		return nil, errors.Trace(err)
+	}
+	f, err := os.Open(s.path(digest))
+	if os.IsNotExist(err) {
+		return nil, errors.NotFoundf("blob %s", digest)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot open blob")
+	}
+	return &verifyingReader{
+		f:      f,
+		hash:   sha256.New(),
+		digest: digest,
+	}, nil
+}
+
+// Has reports whether the blob with the given digest is stored.
+func (s *Store) Has(digest string) bool {
+	if checkDigest(digest) != nil {
+		return false
+	}
+	_, err := os.Stat(s.path(digest))
+	return err == nil
+}
+
+// Verify reads the whole blob with the given digest, returning an
+// error with cause ErrCorrupt if its content does not match.
+func (s *Store) Verify(digest string) error {
+	r, err := s.Get(digest)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer r.Close()
+	_, err = io.Copy(ioutil.Discard, r)
+	return errors.Trace(err)
+}
+
+// Refs returns the reference count of the blob with the given digest.
+func (s *Store) Refs(digest string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refs(digest)
+}
+
+// Ref increments the reference count of the blob with the given
+// digest, which must be stored.
+func (s *Store) Ref(digest string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.refs(digest)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return s.setRefs(digest, n+1)
+}
+
+// Unref decrements the reference count of the blob with the given
+// digest. The blob is not removed until GC is called.
+func (s *Store) Unref(digest string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := s.refs(digest)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if n == 0 {
+		return errors.Errorf("blob %s not referenced", digest)
+	}
+	return s.setRefs(digest, n-1)
+}
+
+// GC removes the blobs that are not referenced and were stored more
+// than grace ago, and returns their digests. The grace period protects
+// blobs that have been stored but not yet referenced.
+func (s *Store) GC(grace time.Duration) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed []string
+	cutoff := time.Now().Add(-grace)
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == filepath.Join(s.dir, tmpDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		digest := info.Name()
+		if checkDigest(digest) != nil || info.ModTime().After(cutoff) {
+			return nil
+		}
+		n, err := s.refs(digest)
+		if err != nil || n > 0 {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		os.Remove(path + refSuffix)
+		removed = append(removed, digest)
+		return nil
+	})
+	if err != nil {
+		return removed, errors.Annotate(err, "cannot collect blobs")
+	}
+	return removed, nil
+}
+
+// refs returns the reference count of the blob. It must be called with
+// s.mu held.
+func (s *Store) refs(digest string) (int, error) {
+	if err := checkDigest(digest); err != nil {
+		return 0, errors.Trace(err)
+	}
+	path := s.path(digest)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, errors.NotFoundf("blob %s", digest)
+	}
+	data, err := ioutil.ReadFile(path + refSuffix)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Annotate(err, "cannot read reference count")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, errors.Errorf("reference count of blob %s not valid", digest)
+	}
+	return n, nil
+}
+
+// setRefs records the reference count of the blob, replacing the
+// count file atomically. It must be called with s.mu held.
+func (s *Store) setRefs(digest string, n int) error {
+	path := s.path(digest) + refSuffix
+	if n == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Annotate(err, "cannot write reference count")
+		}
+		return nil
+	}
+	tmp := filepath.Join(s.dir, tmpDir, digest+refSuffix)
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(n)+"\n"), 0644); err != nil {
+		return errors.Annotate(err, "cannot write reference count")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Annotate(err, "cannot write reference count")
+	}
+	return nil
+}
+
+func (s *Store) path(digest string) string {
+	return filepath.Join(s.dir, digest[0:2], digest[2:4], digest)
+}
+
+func checkDigest(digest string) error {
+	if len(digest) != sha256.Size*2 {
+		return errors.NotValidf("digest %q", digest)
+	}
+	if _, err := hex.DecodeString(digest); err != nil || strings.ToLower(digest) != digest {
+		return errors.NotValidf("digest %q", digest)
+	}
+	return nil
+}
+
+type verifyingReader struct {
+	f      *os.File
+	hash   hash.Hash
+	digest string
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if got := hex.EncodeToString(r.hash.Sum(nil)); got != r.digest {
+			return n, errors.Annotatef(ErrCorrupt, "blob %s has digest %s", r.digest, got)
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.f.Close()
+}
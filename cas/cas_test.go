@@ -0,0 +1,142 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cas_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/cas"
+)
+
+type casSuite struct {
+	testing.IsolationSuite
+	dir   string
+	store *cas.Store
+}
+
+var _ = gc.Suite(&casSuite{})
+
+// helloDigest is the SHA256 digest of "hello".
+const helloDigest = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func (s *casSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+	var err error
+	s.store, err = cas.New(s.dir)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *casSuite) read(c *gc.C, digest string) (string, error) {
+	r, err := s.store.Get(digest)
+	c.Assert(err, gc.IsNil)
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	return string(data), err
+}
+
+func (s *casSuite) TestPutGet(c *gc.C) {
+	digest, size, err := s.store.Put(strings.NewReader("hello"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(digest, gc.Equals, helloDigest)
+	c.Assert(size, gc.Equals, int64(5))
+	c.Assert(s.store.Has(digest), jc.IsTrue)
+
+	_, err = os.Stat(filepath.Join(s.dir, "2c", "f2", helloDigest))
+	c.Assert(err, gc.IsNil)
+
+	data, err := s.read(c, digest)
+	c.Assert(err, gc.IsNil)
+	c.Assert(data, gc.Equals, "hello")
+	c.Assert(s.store.Verify(digest), gc.IsNil)
+}
+
+func (s *casSuite) TestPutDeduplicates(c *gc.C) {
+	d1, _, err := s.store.Put(strings.NewReader("hello"))
+	c.Assert(err, gc.IsNil)
+	d2, _, err := s.store.Put(strings.NewReader("hello"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(d1, gc.Equals, d2)
+	tmp, err := ioutil.ReadDir(filepath.Join(s.dir, "tmp"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(tmp, gc.HasLen, 0)
+}
+
+func (s *casSuite) TestGetErrors(c *gc.C) {
+	_, err := s.store.Get("nonsense")
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	_, err = s.store.Get(helloDigest)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(s.store.Has(helloDigest), jc.IsFalse)
+	c.Assert(s.store.Has("nonsense"), jc.IsFalse)
+}
+
+func (s *casSuite) TestCorruption(c *gc.C) {
+	digest, _, err := s.store.Put(strings.NewReader("hello"))
+	c.Assert(err, gc.IsNil)
+	path := filepath.Join(s.dir, "2c", "f2", helloDigest)
+	err = os.Chmod(path, 0644)
+	c.Assert(err, gc.IsNil)
+	err = ioutil.WriteFile(path, []byte("jello"), 0644)
+	c.Assert(err, gc.IsNil)
+
+	data, err := s.read(c, digest)
+	c.Assert(data, gc.Equals, "jello")
+	c.Assert(errors.Cause(err), gc.Equals, cas.ErrCorrupt)
+	c.Assert(errors.Cause(s.store.Verify(digest)), gc.Equals, cas.ErrCorrupt)
+}
+
+func (s *casSuite) TestRefs(c *gc.C) {
+	digest, _, err := s.store.Put(strings.NewReader("hello"))
+	c.Assert(err, gc.IsNil)
+	n, err := s.store.Refs(digest)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 0)
+
+	c.Assert(s.store.Ref(digest), gc.IsNil)
+	c.Assert(s.store.Ref(digest), gc.IsNil)
+	n, err = s.store.Refs(digest)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 2)
+
+	c.Assert(s.store.Unref(digest), gc.IsNil)
+	c.Assert(s.store.Unref(digest), gc.IsNil)
+	c.Assert(s.store.Unref(digest), gc.ErrorMatches, "blob .* not referenced")
+
+	err = s.store.Ref(strings.Repeat("0", 64))
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *casSuite) TestGC(c *gc.C) {
+	kept, _, err := s.store.Put(strings.NewReader("kept"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.store.Ref(kept), gc.IsNil)
+	dropped, _, err := s.store.Put(strings.NewReader("dropped"))
+	c.Assert(err, gc.IsNil)
+
+	// Recently stored blobs survive within the grace period.
+	removed, err := s.store.GC(time.Hour)
+	c.Assert(err, gc.IsNil)
+	c.Assert(removed, gc.HasLen, 0)
+
+	removed, err = s.store.GC(-time.Second)
+	c.Assert(err, gc.IsNil)
+	c.Assert(removed, jc.DeepEquals, []string{dropped})
+	c.Assert(s.store.Has(kept), jc.IsTrue)
+	c.Assert(s.store.Has(dropped), jc.IsFalse)
+
+	c.Assert(s.store.Unref(kept), gc.IsNil)
+	removed, err = s.store.GC(-time.Second)
+	c.Assert(err, gc.IsNil)
+	c.Assert(removed, jc.DeepEquals, []string{kept})
+}
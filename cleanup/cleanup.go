@@ -0,0 +1,163 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package cleanup provides a Stack of teardown functions for rolling
+// back multi-step operations that fail part of the way through.
+//
+// Setup code pushes a teardown function after each step succeeds. If
+// a later step fails, unwinding the stack runs the teardowns in reverse
+// order; if every step succeeds, committing the stack keeps the
+// resources that were created:
+//
+//	func provision() (err error) {
+//		var stack cleanup.Stack
+//		defer stack.UnwindOnError(&err)
+//		if err := os.Mkdir(dir, 0755); err != nil {
+//			return err
+//		}
+//		stack.Add("remove "+dir, func() error {
+//			return os.RemoveAll(dir)
+//		})
+//		...
+//		stack.Commit()
+//		return nil
+//	}
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/errs"
+)
+
+// Func is a teardown function. It should return promptly when ctx is
+// done.
+type Func func(ctx context.Context) error
+
+type entry struct {
+	name string
+	fn   Func
+}
+
+// Stack holds teardown functions to be run in last-in, first-out
+// order. The zero value is an empty stack ready for use. It is safe to
+// use from multiple goroutines.
+type Stack struct {
+	// Timeout bounds the time allowed for each teardown function.
+	// If it is zero, teardowns are bounded only by the context
+	// passed to Unwind.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	entries []entry
+	done    bool
+}
+
+// Push adds a teardown function to the top of the stack. The name
+// identifies it in any error returned by Unwind.
+//
+// Push panics if the stack has already been committed or unwound.
+func (s *Stack) Push(name string, fn Func) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		panic("cleanup: push to finished stack")
+	}
+	s.entries = append(s.entries, entry{name, fn})
+}
+
+// Add is like Push, for teardown functions that take no context.
+func (s *Stack) Add(name string, fn func() error) {
+	s.Push(name, func(context.Context) error {
+		return fn()
+	})
+}
+
+// Len returns the number of teardown functions on the stack.
+func (s *Stack) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Commit discards the teardown functions without running them, so
+// that the resources they would have removed are kept. Later calls to
+// Unwind do nothing.
+func (s *Stack) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = nil
+	s.done = true
+}
+
+// Unwind runs the teardown functions, most recently pushed first,
+// and empties the stack. Every function is run even if earlier ones
+// fail; the failures are returned together as an *errs.Multi. A
+// function that does not return within the stack's Timeout, or before
+// ctx is done, is abandoned and reported as failed.
+//
+// Unwind does nothing if the stack has already been committed or
+// unwound.
+func (s *Stack) Unwind(ctx context.Context) error {
+	s.mu.Lock()
+	entries := s.entries
+	s.entries = nil
+	s.done = true
+	s.mu.Unlock()
+
+	var failed errs.Multi
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		failed.AddItem(e.name, s.run(ctx, e.fn))
+	}
+	return failed.ErrorOrNil()
+}
+
+// UnwindOnError unwinds the stack if *errp is not nil, and is
+// intended to be deferred. Any teardown errors are combined with the
+// original error in *errp. If *errp is nil, the stack is left alone,
+// so a function that succeeds without committing keeps its teardowns
+// for the caller to run.
+func (s *Stack) UnwindOnError(errp *error) {
+	if *errp == nil {
+		return
+	}
+	if err := s.Unwind(context.Background()); err != nil {
+		var combined errs.Multi
+		combined.Add(*errp)
+		combined.Add(errors.Annotate(err, "cleanup failed"))
+		*errp = &combined
+	}
+}
+
+// run runs fn, bounded by ctx and the stack's timeout.
+func (s *Stack) run(ctx context.Context, fn Func) error {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Annotate(err, "not run")
+	}
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		result <- fn(ctx)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return errors.Annotate(ctx.Err(), "abandoned")
+	}
+}
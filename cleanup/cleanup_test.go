@@ -0,0 +1,150 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package cleanup_test
+
+import (
+	"context"
+	stderrors "errors"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/cleanup"
+)
+
+type stackSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&stackSuite{})
+
+func (s *stackSuite) TestUnwindLIFO(c *gc.C) {
+	var stack cleanup.Stack
+	var order []string
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		stack.Add(name, func() error {
+			order = append(order, name)
+			return nil
+		})
+	}
+	c.Assert(stack.Len(), gc.Equals, 3)
+	err := stack.Unwind(context.Background())
+	c.Assert(err, gc.IsNil)
+	c.Assert(order, jc.DeepEquals, []string{"c", "b", "a"})
+	c.Assert(stack.Len(), gc.Equals, 0)
+
+	// A second unwind does nothing.
+	c.Assert(stack.Unwind(context.Background()), gc.IsNil)
+	c.Assert(order, gc.HasLen, 3)
+}
+
+func (s *stackSuite) TestUnwindAggregatesErrors(c *gc.C) {
+	var stack cleanup.Stack
+	ran := 0
+	stack.Add("first", func() error {
+		ran++
+		return errors.New("first failed")
+	})
+	stack.Add("second", func() error {
+		ran++
+		return nil
+	})
+	stack.Add("third", func() error {
+		ran++
+		panic("oops")
+	})
+	err := stack.Unwind(context.Background())
+	c.Assert(ran, gc.Equals, 3)
+	c.Assert(err, gc.ErrorMatches, "2 errors:\n\tthird: panic: oops\n\tfirst: first failed")
+}
+
+func (s *stackSuite) TestCommit(c *gc.C) {
+	var stack cleanup.Stack
+	stack.Add("a", func() error {
+		c.Fatalf("teardown run after commit")
+		return nil
+	})
+	stack.Commit()
+	c.Assert(stack.Unwind(context.Background()), gc.IsNil)
+	c.Assert(func() {
+		stack.Add("b", func() error { return nil })
+	}, gc.PanicMatches, "cleanup: push to finished stack")
+}
+
+func (s *stackSuite) TestTimeout(c *gc.C) {
+	stack := cleanup.Stack{Timeout: 10 * time.Millisecond}
+	ranAfter := false
+	stack.Add("after", func() error {
+		ranAfter = true
+		return nil
+	})
+	block := make(chan struct{})
+	defer close(block)
+	stack.Add("stuck", func() error {
+		<-block
+		return nil
+	})
+	err := stack.Unwind(context.Background())
+	c.Assert(err, gc.ErrorMatches, "stuck: abandoned: context deadline exceeded")
+	c.Assert(ranAfter, jc.IsTrue)
+}
+
+func (s *stackSuite) TestContextPassedToTeardown(c *gc.C) {
+	stack := cleanup.Stack{Timeout: time.Minute}
+	stack.Push("ctx", func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		c.Check(ok, jc.IsTrue)
+		return nil
+	})
+	c.Assert(stack.Unwind(context.Background()), gc.IsNil)
+}
+
+func (s *stackSuite) TestCancelledContext(c *gc.C) {
+	var stack cleanup.Stack
+	stack.Add("a", func() error {
+		c.Fatalf("teardown run with cancelled context")
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := stack.Unwind(ctx)
+	c.Assert(err, gc.ErrorMatches, "a: not run: context canceled")
+}
+
+func (s *stackSuite) TestUnwindOnError(c *gc.C) {
+	errBoom := errors.New("boom")
+	removed := false
+	f := func(fail, failCleanup bool) (err error) {
+		var stack cleanup.Stack
+		defer stack.UnwindOnError(&err)
+		stack.Add("remove", func() error {
+			removed = true
+			if failCleanup {
+				return errors.New("cannot remove")
+			}
+			return nil
+		})
+		if fail {
+			return errBoom
+		}
+		stack.Commit()
+		return nil
+	}
+
+	c.Assert(f(false, false), gc.IsNil)
+	c.Assert(removed, jc.IsFalse)
+
+	c.Assert(f(true, false), gc.Equals, errBoom)
+	c.Assert(removed, jc.IsTrue)
+
+	removed = false
+	err := f(true, true)
+	c.Assert(removed, jc.IsTrue)
+	c.Assert(err, gc.ErrorMatches, "2 errors:\n\tboom\n\tcleanup failed: remove: cannot remove")
+	c.Assert(stderrors.Is(err, errBoom), jc.IsTrue)
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package clock defines an interface to the passage of time so that
+// code waiting for timeouts and intervals can be tested without real
+// delays. See the testing/testclock package for a clock that can be
+// advanced by hand.
+package clock
+
+import "time"
+
+// Clock provides the current time and notification of elapsed time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the
+	// current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// WallClock is a Clock backed by the time package.
+var WallClock Clock = wallClock{}
+
+type wallClock struct{}
+
+// Now implements Clock.
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements Clock.
+func (wallClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,33 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package clock_test
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/clock"
+)
+
+type clockSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&clockSuite{})
+
+func (*clockSuite) TestWallClock(c *gc.C) {
+	before := time.Now()
+	now := clock.WallClock.Now()
+	c.Assert(now.Before(before), jc.IsFalse)
+
+	select {
+	case t := <-clock.WallClock.After(time.Millisecond):
+		c.Assert(t.After(now), jc.IsTrue)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timed out")
+	}
+}
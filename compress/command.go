@@ -0,0 +1,150 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package compress
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// lookPath is overridden in tests.
+var lookPath = exec.LookPath
+
+func command(name string, args ...string) (*exec.Cmd, *bytes.Buffer, error) {
+	path, err := lookPath(name)
+	if err != nil {
+		return nil, nil, errors.NotSupportedf("%s compression without the %s command", name, name)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = &stderr
+	return cmd, &stderr, nil
+}
+
+func commandError(name string, err error, stderr *bytes.Buffer) error {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return errors.Errorf("%s failed: %s", name, msg)
+	}
+	return errors.Annotatef(err, "%s failed", name)
+}
+
+// commandReader reads the output of a command that reads from another
+// reader.
+type commandReader struct {
+	name   string
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *bytes.Buffer
+	err    error
+}
+
+func newCommandReader(r io.Reader, name string, args ...string) (io.ReadCloser, error) {
+	cmd, stderr, err := command(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = r
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Annotatef(err, "cannot start %s", name)
+	}
+	return &commandReader{name: name, cmd: cmd, stdout: stdout, stderr: stderr}, nil
+}
+
+// Read implements io.Reader. A command that fails is reported as an
+// error in place of io.EOF.
+func (r *commandReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		r.err = io.EOF
+		if werr := r.wait(); werr != nil {
+			r.err = werr
+		}
+		err = r.err
+	}
+	return n, err
+}
+
+func (r *commandReader) wait() error {
+	if err := r.cmd.Wait(); err != nil {
+		return commandError(r.name, err, r.stderr)
+	}
+	return nil
+}
+
+// Close implements io.Closer. Closing the reader before the end of the
+// data stops the command.
+func (r *commandReader) Close() error {
+	if r.err != nil {
+		if r.err == io.EOF {
+			return nil
+		}
+		return r.err
+	}
+	r.err = errors.New("reader closed")
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
+
+// commandWriter writes to a command that writes to another writer.
+type commandWriter struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *bytes.Buffer
+	closed bool
+}
+
+func newCommandWriter(w io.Writer, name string, args ...string) (io.WriteCloser, error) {
+	cmd, stderr, err := command(name, args...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = w
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Annotatef(err, "cannot start %s", name)
+	}
+	return &commandWriter{name: name, cmd: cmd, stdin: stdin, stderr: stderr}, nil
+}
+
+// Write implements io.Writer.
+func (w *commandWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("writer closed")
+	}
+	n, err := w.stdin.Write(p)
+	if err != nil {
+		return n, errors.Annotatef(err, "cannot write to %s", w.name)
+	}
+	return n, nil
+}
+
+// Close implements io.Closer. It returns once all of the compressed
+// data has been written.
+func (w *commandWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return commandError(w.name, err, w.stderr)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package compress provides streaming compression and decompression
+// with a single interface over the gzip, zstd and xz formats.
+//
+// Gzip is handled in-process. Zstd and xz are handled by the zstd and
+// xz commands, which must be installed to use those formats; an error
+// satisfying errors.IsNotSupported is returned if they are not.
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/ioutils"
+)
+
+// Format identifies a compression format.
+type Format int
+
+const (
+	// None is no compression at all.
+	None Format = iota
+	Gzip
+	Zstd
+	Xz
+)
+
+var formatNames = map[Format]string{
+	None: "none",
+	Gzip: "gzip",
+	Zstd: "zstd",
+	Xz:   "xz",
+}
+
+var formatExtensions = map[Format]string{
+	None: "",
+	Gzip: ".gz",
+	Zstd: ".zst",
+	Xz:   ".xz",
+}
+
+// magic holds the bytes that each compressed stream starts with.
+var magic = map[Format][]byte{
+	Gzip: {0x1f, 0x8b},
+	Zstd: {0x28, 0xb5, 0x2f, 0xfd},
+	Xz:   {0xfd, '7', 'z', 'X', 'Z', 0x00},
+}
+
+const maxMagic = 6
+
+// String returns the name of the format, such as "gzip".
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Extension returns the file name extension conventionally used for
+// the format, such as ".gz". It returns "" for None.
+func (f Format) Extension() string {
+	return formatExtensions[f]
+}
+
+// ParseFormat returns the format with the given name, as returned by
+// Format.String.
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return None, errors.NotValidf("compression format %q", name)
+}
+
+// Level specifies how hard to try to compress. Levels range from
+// BestSpeed to BestCompression and are mapped onto the native levels
+// of each format.
+type Level int
+
+const (
+	DefaultCompression Level = 0
+	BestSpeed          Level = 1
+	BestCompression    Level = 9
+)
+
+func (l Level) validate() error {
+	if l < DefaultCompression || l > BestCompression {
+		return errors.NotValidf("compression level %d", l)
+	}
+	return nil
+}
+
+// Sniff returns the format of the data read from r, judged by its
+// first few bytes, and a reader that returns all the data including
+// those bytes. Data in no recognised format is reported as None.
+func Sniff(r io.Reader) (Format, io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(maxMagic)
+	if err != nil && err != io.EOF {
+		return None, nil, errors.Trace(err)
+	}
+	for f, m := range magic {
+		if bytes.HasPrefix(head, m) {
+			return f, br, nil
+		}
+	}
+	return None, br, nil
+}
+
+// NewReader returns a reader that decompresses the data read from r,
+// detecting its format with Sniff. Data in no recognised format is
+// returned unchanged. Concatenated compressed streams are read as one.
+// The returned reader must be closed to release its resources; closing
+// it does not close r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	f, r, err := Sniff(r)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return NewFormatReader(r, f)
+}
+
+// NewFormatReader returns a reader that decompresses the data read
+// from r, which must be in the given format.
+func NewFormatReader(r io.Reader, f Format) (io.ReadCloser, error) {
+	switch f {
+	case None:
+		return ioutil.NopCloser(r), nil
+	case Gzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot read gzip stream")
+		}
+		zr.Multistream(true)
+		return zr, nil
+	case Zstd:
+		return newCommandReader(r, "zstd", "-d", "-c", "-q")
+	case Xz:
+		return newCommandReader(r, "xz", "-d", "-c", "-q")
+	}
+	return nil, errors.NotValidf("compression format %d", int(f))
+}
+
+// gzipOSUnknown is the gzip header's operating system value for
+// "unknown", recorded so that output does not vary by platform.
+const gzipOSUnknown = 255
+
+// NewWriter returns a writer that compresses the data written to it in
+// the given format and level, writing the result to w. The writer must
+// be closed to flush the compressed stream; closing it does not close
+// w.
+//
+// The compressed stream depends only on the data and the level, so
+// that identical input produces byte-identical output: gzip headers
+// record no file name or modification time, and the external
+// compressors are run single-threaded, as their output otherwise
+// depends on the number of CPUs.
+func NewWriter(w io.Writer, f Format, level Level) (io.WriteCloser, error) {
+	if err := level.validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	switch f {
+	case None:
+		return ioutils.NopWriteCloser(w), nil
+	case Gzip:
+		gzLevel := gzip.DefaultCompression
+		if level != DefaultCompression {
+			gzLevel = int(level)
+		}
+		zw, err := gzip.NewWriterLevel(w, gzLevel)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		zw.Header = gzip.Header{OS: gzipOSUnknown}
+		return zw, nil
+	case Zstd:
+		args := []string{"-c", "-q", "-T1"}
+		if level != DefaultCompression {
+			// zstd levels run from 1 to 19.
+			args = append(args, "-"+strconv.Itoa(1+(int(level)-1)*18/8))
+		}
+		return newCommandWriter(w, "zstd", args...)
+	case Xz:
+		args := []string{"-c", "-q", "-T1"}
+		if level != DefaultCompression {
+			// xz levels run from 0 to 9.
+			args = append(args, "-"+strconv.Itoa(int(level)))
+		}
+		return newCommandWriter(w, "xz", args...)
+	}
+	return nil, errors.NotValidf("compression format %d", int(f))
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package compress_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/compress"
+)
+
+type compressSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&compressSuite{})
+
+var data = strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+
+// available reports whether the command needed for f is installed.
+func available(f compress.Format) bool {
+	if f == compress.Zstd || f == compress.Xz {
+		_, err := exec.LookPath(f.String())
+		return err == nil
+	}
+	return true
+}
+
+func requireCommand(c *gc.C, f compress.Format) {
+	if !available(f) {
+		c.Skip(f.String() + " command not installed")
+	}
+}
+
+func compressData(c *gc.C, f compress.Format, level compress.Level, text string) []byte {
+	var buf bytes.Buffer
+	w, err := compress.NewWriter(&buf, f, level)
+	c.Assert(err, gc.IsNil)
+	_, err = io.WriteString(w, text)
+	c.Assert(err, gc.IsNil)
+	c.Assert(w.Close(), gc.IsNil)
+	return buf.Bytes()
+}
+
+func decompressData(c *gc.C, compressed []byte) string {
+	r, err := compress.NewReader(bytes.NewReader(compressed))
+	c.Assert(err, gc.IsNil)
+	defer r.Close()
+	out, err := ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	return string(out)
+}
+
+func (s *compressSuite) TestRoundTrip(c *gc.C) {
+	for _, f := range []compress.Format{compress.None, compress.Gzip, compress.Zstd, compress.Xz} {
+		c.Logf("format %v", f)
+		if !available(f) {
+			c.Logf("skipping: %v command not installed", f)
+			continue
+		}
+		for _, level := range []compress.Level{compress.DefaultCompression, compress.BestSpeed, compress.BestCompression} {
+			compressed := compressData(c, f, level, data)
+			if f != compress.None {
+				c.Assert(len(compressed) < len(data), jc.IsTrue)
+			}
+			sniffed, _, err := compress.Sniff(bytes.NewReader(compressed))
+			c.Assert(err, gc.IsNil)
+			c.Assert(sniffed, gc.Equals, f)
+			c.Assert(decompressData(c, compressed), gc.Equals, data)
+		}
+	}
+}
+
+func (s *compressSuite) TestConcatenatedStreams(c *gc.C) {
+	for _, f := range []compress.Format{compress.Gzip, compress.Zstd, compress.Xz} {
+		c.Logf("format %v", f)
+		if !available(f) {
+			continue
+		}
+		compressed := append(compressData(c, f, 0, "first\n"), compressData(c, f, 0, "second\n")...)
+		c.Assert(decompressData(c, compressed), gc.Equals, "first\nsecond\n")
+	}
+}
+
+func (s *compressSuite) TestSniffPreservesData(c *gc.C) {
+	f, r, err := compress.Sniff(strings.NewReader("abc"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(f, gc.Equals, compress.None)
+	out, err := ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(out), gc.Equals, "abc")
+
+	f, _, err = compress.Sniff(strings.NewReader(""))
+	c.Assert(err, gc.IsNil)
+	c.Assert(f, gc.Equals, compress.None)
+}
+
+func (s *compressSuite) TestCorruptData(c *gc.C) {
+	compressed := compressData(c, compress.Gzip, 0, data)
+	compressed[len(compressed)/2] ^= 0xff
+	r, err := compress.NewReader(bytes.NewReader(compressed))
+	c.Assert(err, gc.IsNil)
+	_, err = ioutil.ReadAll(r)
+	c.Assert(err, gc.NotNil)
+}
+
+func (s *compressSuite) TestCommandFailure(c *gc.C) {
+	requireCommand(c, compress.Xz)
+	r, err := compress.NewFormatReader(strings.NewReader("not xz data"), compress.Xz)
+	c.Assert(err, gc.IsNil)
+	defer r.Close()
+	_, err = ioutil.ReadAll(r)
+	c.Assert(err, gc.ErrorMatches, "xz failed: .*")
+}
+
+func (s *compressSuite) TestCloseEarly(c *gc.C) {
+	requireCommand(c, compress.Zstd)
+	compressed := compressData(c, compress.Zstd, 0, data)
+	r, err := compress.NewReader(bytes.NewReader(compressed))
+	c.Assert(err, gc.IsNil)
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(r, buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(r.Close(), gc.IsNil)
+}
+
+func (s *compressSuite) TestMissingCommand(c *gc.C) {
+	s.PatchValue(compress.LookPath, func(name string) (string, error) {
+		return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+	})
+	_, err := compress.NewWriter(ioutil.Discard, compress.Zstd, 0)
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+	c.Assert(err, gc.ErrorMatches, "zstd compression without the zstd command not supported")
+	_, err = compress.NewFormatReader(strings.NewReader(""), compress.Xz)
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (s *compressSuite) TestInteroperatesWithGzip(c *gc.C) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	io.WriteString(w, "hello")
+	w.Close()
+	c.Assert(decompressData(c, buf.Bytes()), gc.Equals, "hello")
+}
+
+func (s *compressSuite) TestFormats(c *gc.C) {
+	for _, f := range []compress.Format{compress.None, compress.Gzip, compress.Zstd, compress.Xz} {
+		parsed, err := compress.ParseFormat(f.String())
+		c.Assert(err, gc.IsNil)
+		c.Assert(parsed, gc.Equals, f)
+	}
+	c.Assert(compress.Gzip.Extension(), gc.Equals, ".gz")
+	c.Assert(compress.Zstd.Extension(), gc.Equals, ".zst")
+	_, err := compress.ParseFormat("lzma")
+	c.Assert(err, gc.ErrorMatches, `compression format "lzma" not valid`)
+	_, err = compress.NewWriter(ioutil.Discard, compress.Gzip, 10)
+	c.Assert(err, gc.ErrorMatches, "compression level 10 not valid")
+}
+
+func (s *compressSuite) TestDeterministicOutput(c *gc.C) {
+	for _, f := range []compress.Format{compress.Gzip, compress.Zstd, compress.Xz} {
+		c.Logf("format %v", f)
+		if !available(f) {
+			c.Logf("%v command not installed", f)
+			continue
+		}
+		first := compressData(c, f, compress.DefaultCompression, data)
+		second := compressData(c, f, compress.DefaultCompression, data)
+		c.Check(second, jc.DeepEquals, first)
+	}
+}
+
+func (s *compressSuite) TestGzipHeader(c *gc.C) {
+	compressed := compressData(c, compress.Gzip, compress.BestSpeed, data)
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	c.Assert(err, gc.IsNil)
+	c.Assert(r.Header.Name, gc.Equals, "")
+	c.Assert(r.Header.ModTime.IsZero(), jc.IsTrue)
+	c.Assert(r.Header.OS, gc.Equals, byte(255))
+}
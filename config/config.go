@@ -0,0 +1,352 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package config loads configuration from several layers and records
+// where each value came from.
+//
+// Layers are applied in increasing order of precedence:
+//
+//  1. defaults, which also determine the keys that can be set from the
+//     environment and the types that environment values are parsed as;
+//  2. files, in the order given;
+//  3. environment variables;
+//  4. explicit overrides, typically taken from command line flags.
+//
+// Keys are addressed by dotted paths such as "server.port", formed from
+// the keys of nested maps.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Kind identifies the kind of layer a value came from.
+type Kind string
+
+const (
+	KindDefault  Kind = "default"
+	KindFile     Kind = "file"
+	KindEnv      Kind = "env"
+	KindOverride Kind = "override"
+)
+
+// Origin describes where a configuration value came from.
+type Origin struct {
+	Kind Kind
+
+	// Name holds the file path for KindFile and the variable name for
+	// KindEnv. It is empty otherwise.
+	Name string
+}
+
+// String returns a description of the origin suitable for showing to
+// users.
+func (o Origin) String() string {
+	switch o.Kind {
+	case KindFile:
+		return "file " + o.Name
+	case KindEnv:
+		return "env var " + o.Name
+	}
+	return string(o.Kind)
+}
+
+// Loader specifies how configuration is loaded.
+type Loader struct {
+	// Defaults holds the default configuration.
+	Defaults map[string]interface{}
+
+	// Files holds the paths of configuration files to read. The format
+	// of each file is chosen by its extension; see Formats.
+	Files []string
+
+	// AllowMissing specifies that files that do not exist are skipped
+	// rather than causing Load to fail.
+	AllowMissing bool
+
+	// EnvPrefix, if not empty, enables reading configuration from the
+	// environment. The variable for a key is formed by upper-casing
+	// the key, replacing dots and dashes with underscores and adding
+	// the prefix; with prefix "APP_", "server.port" is read from
+	// APP_SERVER_PORT. Only keys that have a value from the defaults
+	// or files are read.
+	EnvPrefix string
+
+	// Overrides holds values, keyed by dotted path, that take
+	// precedence over all other layers.
+	Overrides map[string]interface{}
+}
+
+// Config holds loaded configuration.
+type Config struct {
+	values  map[string]interface{}
+	origins map[string]Origin
+}
+
+// Load reads and merges all the configuration layers.
+func (l *Loader) Load() (*Config, error) {
+	c := &Config{
+		values:  make(map[string]interface{}),
+		origins: make(map[string]Origin),
+	}
+	c.merge(normalize(l.Defaults), Origin{Kind: KindDefault})
+	for _, path := range l.Files {
+		values, err := readFile(path)
+		if os.IsNotExist(errors.Cause(err)) && l.AllowMissing {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		c.merge(values, Origin{Kind: KindFile, Name: path})
+	}
+	if l.EnvPrefix != "" {
+		if err := c.mergeEnv(l.EnvPrefix); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	for _, key := range sortedKeys(l.Overrides) {
+		c.set(key, normalizeValue(l.Overrides[key]), Origin{Kind: KindOverride})
+	}
+	return c, nil
+}
+
+func (c *Config) merge(values map[string]interface{}, origin Origin) {
+	for path, v := range flatten(values, "") {
+		c.set(path, v, origin)
+	}
+}
+
+func (c *Config) mergeEnv(prefix string) error {
+	for _, path := range sortedKeys(c.values) {
+		name := EnvName(prefix, path)
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		v, err := parseAs(s, c.values[path])
+		if err != nil {
+			return errors.Annotatef(err, "environment variable %s", name)
+		}
+		c.set(path, v, Origin{Kind: KindEnv, Name: name})
+	}
+	return nil
+}
+
+// set records the leaf value at path, replacing any values it shadows:
+// setting "a" removes "a.b", and setting "a.b" removes "a".
+func (c *Config) set(path string, v interface{}, origin Origin) {
+	for existing := range c.values {
+		if strings.HasPrefix(existing, path+".") || strings.HasPrefix(path, existing+".") {
+			delete(c.values, existing)
+			delete(c.origins, existing)
+		}
+	}
+	c.values[path] = v
+	c.origins[path] = origin
+}
+
+// EnvName returns the environment variable consulted for the given
+// key when using the given prefix.
+func EnvName(prefix, path string) string {
+	name := strings.NewReplacer(".", "_", "-", "_").Replace(strings.ToUpper(path))
+	return prefix + name
+}
+
+// Get returns the value at the given dotted path. The value is a map
+// if the path names a section rather than a single value.
+func (c *Config) Get(path string) (interface{}, bool) {
+	if v, ok := c.values[path]; ok {
+		return v, true
+	}
+	section := make(map[string]interface{})
+	for existing, v := range c.values {
+		if strings.HasPrefix(existing, path+".") {
+			section[strings.TrimPrefix(existing, path+".")] = v
+		}
+	}
+	if len(section) == 0 {
+		return nil, false
+	}
+	return unflatten(section), true
+}
+
+// Origin returns the origin of the value at the given dotted path.
+func (c *Config) Origin(path string) (Origin, bool) {
+	o, ok := c.origins[path]
+	return o, ok
+}
+
+// Map returns the configuration as nested maps.
+func (c *Config) Map() map[string]interface{} {
+	return unflatten(c.values)
+}
+
+// Decode stores the configuration in the value pointed to by v, using
+// the same rules as encoding/json.
+func (c *Config) Decode(v interface{}) error {
+	data, err := json.Marshal(c.Map())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Annotate(err, "cannot decode configuration")
+	}
+	return nil
+}
+
+// Provenance records the value of a single key and where it came from.
+type Provenance struct {
+	Key    string
+	Value  interface{}
+	Origin Origin
+}
+
+// Provenance returns the origin of every value, sorted by key.
+func (c *Config) Provenance() []Provenance {
+	keys := sortedKeys(c.values)
+	p := make([]Provenance, len(keys))
+	for i, key := range keys {
+		p[i] = Provenance{
+			Key:    key,
+			Value:  c.values[key],
+			Origin: c.origins[key],
+		}
+	}
+	return p
+}
+
+// WriteProvenance writes a report of every value and its origin to w,
+// one key per line.
+func (c *Config) WriteProvenance(w io.Writer) error {
+	for _, p := range c.Provenance() {
+		if _, err := fmt.Fprintf(w, "%s = %v (from %s)\n", p.Key, p.Value, p.Origin); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// parseAs parses the environment value s as the type of the existing
+// value.
+func parseAs(s string, existing interface{}) (interface{}, error) {
+	var v interface{}
+	var err error
+	switch reflect.ValueOf(existing).Kind() {
+	case reflect.Bool:
+		v, err = strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		// Formats differ in how they decode numbers, so parse
+		// integers as integers whatever the type of the existing
+		// value.
+		if v, err = strconv.ParseInt(s, 10, 64); err != nil {
+			v, err = strconv.ParseFloat(s, 64)
+		}
+	case reflect.Slice:
+		items := []interface{}{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v = items
+	default:
+		v = s
+	}
+	if err != nil {
+		return nil, errors.Errorf("cannot parse %q as %T", s, existing)
+	}
+	return v, nil
+}
+
+// flatten returns the leaf values of the nested maps in values keyed
+// by dotted path.
+func flatten(values map[string]interface{}, prefix string) map[string]interface{} {
+	flat := make(map[string]interface{})
+	for k, v := range values {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			for fk, fv := range flatten(m, path) {
+				flat[fk] = fv
+			}
+			continue
+		}
+		flat[path] = v
+	}
+	return flat
+}
+
+// unflatten is the inverse of flatten.
+func unflatten(flat map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	for path, v := range flat {
+		m := values
+		parts := strings.Split(path, ".")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := m[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				m[part] = child
+			}
+			m = child
+		}
+		m[parts[len(parts)-1]] = v
+	}
+	return values
+}
+
+// normalize converts the maps decoded by the various formats to
+// map[string]interface{}.
+func normalize(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	return normalizeValue(values).(map[string]interface{})
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = normalizeValue(val)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalizeValue(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = normalizeValue(val)
+		}
+		return s
+	}
+	return v
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
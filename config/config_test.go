@@ -0,0 +1,189 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package config_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/config"
+)
+
+type configSuite struct {
+	testing.IsolationSuite
+	dir string
+}
+
+var _ = gc.Suite(&configSuite{})
+
+func (s *configSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+}
+
+func (s *configSuite) writeFile(c *gc.C, name, content string) string {
+	path := filepath.Join(s.dir, name)
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	c.Assert(err, gc.IsNil)
+	return path
+}
+
+var defaults = map[string]interface{}{
+	"name": "app",
+	"server": map[string]interface{}{
+		"host":    "localhost",
+		"port":    8080,
+		"verbose": false,
+	},
+	"tags": []interface{}{},
+}
+
+func (s *configSuite) TestPrecedence(c *gc.C) {
+	yamlPath := s.writeFile(c, "base.yaml", `
+server:
+  host: example.com
+  port: 80
+`)
+	jsonPath := s.writeFile(c, "local.json", `{"server": {"port": 8000}, "name": "local"}`)
+	s.PatchEnvironment("APP_SERVER_PORT", "9000")
+	s.PatchEnvironment("APP_SERVER_VERBOSE", "true")
+	s.PatchEnvironment("APP_TAGS", "a, b")
+	s.PatchEnvironment("APP_UNKNOWN", "ignored")
+
+	loader := &config.Loader{
+		Defaults:  defaults,
+		Files:     []string{yamlPath, jsonPath},
+		EnvPrefix: "APP_",
+		Overrides: map[string]interface{}{"name": "flag"},
+	}
+	cfg, err := loader.Load()
+	c.Assert(err, gc.IsNil)
+	c.Assert(cfg.Map(), jc.DeepEquals, map[string]interface{}{
+		"name": "flag",
+		"server": map[string]interface{}{
+			"host":    "example.com",
+			"port":    int64(9000),
+			"verbose": true,
+		},
+		"tags": []interface{}{"a", "b"},
+	})
+
+	var buf bytes.Buffer
+	err = cfg.WriteProvenance(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf.String(), gc.Equals, ""+
+		"name = flag (from override)\n"+
+		"server.host = example.com (from file "+yamlPath+")\n"+
+		"server.port = 9000 (from env var APP_SERVER_PORT)\n"+
+		"server.verbose = true (from env var APP_SERVER_VERBOSE)\n"+
+		"tags = [a b] (from env var APP_TAGS)\n",
+	)
+
+	origin, ok := cfg.Origin("server.host")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(origin, gc.Equals, config.Origin{Kind: config.KindFile, Name: yamlPath})
+}
+
+func (s *configSuite) TestTOML(c *gc.C) {
+	path := s.writeFile(c, "app.toml", `
+name = "toml"
+
+[server]
+port = 81
+`)
+	cfg, err := (&config.Loader{
+		Defaults: defaults,
+		Files:    []string{path},
+	}).Load()
+	c.Assert(err, gc.IsNil)
+	v, ok := cfg.Get("server.port")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(fmt.Sprint(v), gc.Equals, "81")
+	v, ok = cfg.Get("name")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(v, gc.Equals, "toml")
+}
+
+func (s *configSuite) TestGetSection(c *gc.C) {
+	cfg, err := (&config.Loader{Defaults: defaults}).Load()
+	c.Assert(err, gc.IsNil)
+	v, ok := cfg.Get("server")
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(v, jc.DeepEquals, map[string]interface{}{
+		"host":    "localhost",
+		"port":    8080,
+		"verbose": false,
+	})
+	_, ok = cfg.Get("missing")
+	c.Assert(ok, jc.IsFalse)
+}
+
+func (s *configSuite) TestOverrideReplacesSection(c *gc.C) {
+	cfg, err := (&config.Loader{
+		Defaults:  defaults,
+		Overrides: map[string]interface{}{"server": "none", "extra.value": 1},
+	}).Load()
+	c.Assert(err, gc.IsNil)
+	c.Assert(cfg.Map(), jc.DeepEquals, map[string]interface{}{
+		"name":   "app",
+		"server": "none",
+		"tags":   []interface{}{},
+		"extra":  map[string]interface{}{"value": 1},
+	})
+}
+
+func (s *configSuite) TestDecode(c *gc.C) {
+	var target struct {
+		Name   string `json:"name"`
+		Server struct {
+			Host string `json:"host"`
+			Port int    `json:"port"`
+		} `json:"server"`
+	}
+	cfg, err := (&config.Loader{Defaults: defaults}).Load()
+	c.Assert(err, gc.IsNil)
+	err = cfg.Decode(&target)
+	c.Assert(err, gc.IsNil)
+	c.Assert(target.Name, gc.Equals, "app")
+	c.Assert(target.Server.Host, gc.Equals, "localhost")
+	c.Assert(target.Server.Port, gc.Equals, 8080)
+}
+
+func (s *configSuite) TestMissingFiles(c *gc.C) {
+	missing := filepath.Join(s.dir, "missing.yaml")
+	_, err := (&config.Loader{Files: []string{missing}}).Load()
+	c.Assert(err, gc.ErrorMatches, `cannot load ".*missing.yaml": .*`)
+
+	cfg, err := (&config.Loader{
+		Defaults:     defaults,
+		Files:        []string{missing},
+		AllowMissing: true,
+	}).Load()
+	c.Assert(err, gc.IsNil)
+	c.Assert(cfg.Map()["name"], gc.Equals, "app")
+}
+
+func (s *configSuite) TestErrors(c *gc.C) {
+	path := s.writeFile(c, "app.ini", "")
+	_, err := (&config.Loader{Files: []string{path}}).Load()
+	c.Assert(err, gc.ErrorMatches, `cannot load ".*app.ini": unknown configuration format ".ini"`)
+
+	path = s.writeFile(c, "bad.json", "{")
+	_, err = (&config.Loader{Files: []string{path}}).Load()
+	c.Assert(err, gc.ErrorMatches, `cannot parse ".*bad.json": .*`)
+
+	s.PatchEnvironment("APP_SERVER_PORT", "eighty")
+	_, err = (&config.Loader{Defaults: defaults, EnvPrefix: "APP_"}).Load()
+	c.Assert(err, gc.ErrorMatches, `environment variable APP_SERVER_PORT: cannot parse "eighty" as int`)
+}
+
+func (*configSuite) TestEnvName(c *gc.C) {
+	c.Assert(config.EnvName("APP_", "server.max-conns"), gc.Equals, "APP_SERVER_MAX_CONNS")
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/juju/errors"
+	goyaml "gopkg.in/yaml.v1"
+)
+
+// Formats maps file extensions to the functions used to parse files
+// with that extension. It may be extended with other formats.
+var Formats = map[string]func(data []byte, v interface{}) error{
+	".yaml": goyaml.Unmarshal,
+	".yml":  goyaml.Unmarshal,
+	".json": json.Unmarshal,
+	".toml": toml.Unmarshal,
+}
+
+func readFile(path string) (map[string]interface{}, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	unmarshal, ok := Formats[ext]
+	if !ok {
+		return nil, errors.Errorf("cannot load %q: unknown configuration format %q", path, ext)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot load %q", path)
+	}
+	var values map[string]interface{}
+	if err := unmarshal(data, &values); err != nil {
+		return nil, errors.Annotatef(err, "cannot parse %q", path)
+	}
+	return normalize(values), nil
+}
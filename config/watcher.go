@@ -0,0 +1,186 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	"launchpad.net/tomb"
+
+	"github.com/juju/utils/voyeur"
+)
+
+var logger = loggo.GetLogger("juju.utils.config")
+
+// PollInterval holds how often a Watcher checks its configuration
+// files for changes.
+var PollInterval = time.Second
+
+// Watcher reloads configuration when its files change and publishes
+// each new valid configuration through a voyeur.Value. If a reloaded
+// configuration cannot be loaded or fails validation, the previous
+// configuration remains current.
+type Watcher struct {
+	loader   Loader
+	validate func(*Config) error
+	value    *voyeur.Value
+	tomb     tomb.Tomb
+
+	mu     sync.Mutex
+	err    error
+	stamps map[string]fileStamp
+}
+
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher loads the configuration described by loader and starts
+// watching its files. If validate is not nil, it is called on each
+// loaded configuration, and configurations for which it returns an
+// error are rejected. An error is returned if the initial configuration
+// cannot be loaded or is not valid.
+func NewWatcher(loader *Loader, validate func(*Config) error) (*Watcher, error) {
+	w := &Watcher{
+		loader:   *loader,
+		validate: validate,
+	}
+	w.stamps = w.statFiles()
+	cfg, err := w.load()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	w.value = voyeur.NewValue(cfg)
+	go func() {
+		defer w.tomb.Done()
+		defer w.value.Close()
+		w.tomb.Kill(w.loop())
+	}()
+	return w, nil
+}
+
+// Value returns the value through which configurations are published.
+// Its contents are always of type *Config. It is closed when the
+// watcher stops.
+func (w *Watcher) Value() *voyeur.Value {
+	return w.value
+}
+
+// Config returns the current configuration.
+func (w *Watcher) Config() *Config {
+	return w.value.Get().(*Config)
+}
+
+// Err returns the error that caused the most recent reload to be
+// rejected, or nil if it succeeded.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Reload reloads the configuration immediately, whether or not its
+// files have changed, and returns any error that caused the new
+// configuration to be rejected.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stamps = w.statFiles()
+	return w.reload()
+}
+
+// Kill asks the watcher to stop without waiting for it to do so.
+func (w *Watcher) Kill() {
+	w.tomb.Kill(nil)
+}
+
+// Wait waits for the watcher to stop and returns any error encountered.
+func (w *Watcher) Wait() error {
+	return w.tomb.Wait()
+}
+
+// Stop stops the watcher and waits for it to finish.
+func (w *Watcher) Stop() error {
+	w.Kill()
+	return w.Wait()
+}
+
+func (w *Watcher) loop() error {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.tomb.Dying():
+			return tomb.ErrDying
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check reloads the configuration if any of the files have changed.
+func (w *Watcher) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stamps := w.statFiles()
+	if reflect.DeepEqual(stamps, w.stamps) {
+		return
+	}
+	w.stamps = stamps
+	w.reload()
+}
+
+// reload loads and publishes the configuration. It must be called with
+// w.mu held.
+func (w *Watcher) reload() error {
+	cfg, err := w.load()
+	w.err = err
+	if err != nil {
+		logger.Warningf("keeping previous configuration: %v", err)
+		return err
+	}
+	if old := w.Config(); reflect.DeepEqual(old.values, cfg.values) && reflect.DeepEqual(old.origins, cfg.origins) {
+		return nil
+	}
+	logger.Debugf("configuration reloaded")
+	w.value.Set(cfg)
+	return nil
+}
+
+func (w *Watcher) load() (*Config, error) {
+	cfg, err := w.loader.Load()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if w.validate != nil {
+		if err := w.validate(cfg); err != nil {
+			return nil, errors.Annotate(err, "invalid configuration")
+		}
+	}
+	return cfg, nil
+}
+
+func (w *Watcher) statFiles() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, path := range w.loader.Files {
+		info, err := os.Stat(path)
+		if err != nil {
+			stamps[path] = fileStamp{}
+			continue
+		}
+		stamps[path] = fileStamp{
+			exists:  true,
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+	}
+	return stamps
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package config_test
+
+import (
+	"fmt"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/config"
+	"github.com/juju/utils/testing/leaktest"
+)
+
+type watcherSuite struct {
+	configSuite
+}
+
+var _ = gc.Suite(&watcherSuite{})
+
+func (s *watcherSuite) SetUpTest(c *gc.C) {
+	s.configSuite.SetUpTest(c)
+	s.PatchValue(&config.PollInterval, 10*time.Millisecond)
+}
+
+// validPort rejects configurations with a non-positive port.
+func validPort(cfg *config.Config) error {
+	port, _ := cfg.Get("port")
+	if n, ok := port.(float64); !ok || n <= 0 {
+		return fmt.Errorf("port %v not valid", port)
+	}
+	return nil
+}
+
+func (s *watcherSuite) port(c *gc.C, cfg *config.Config) interface{} {
+	port, ok := cfg.Get("port")
+	c.Assert(ok, jc.IsTrue)
+	return port
+}
+
+// next waits for the next configuration published to vw.
+func next(c *gc.C, vw interface {
+	Next() bool
+	Value() interface{}
+}) *config.Config {
+	done := make(chan bool)
+	go func() {
+		done <- vw.Next()
+	}()
+	select {
+	case ok := <-done:
+		c.Assert(ok, jc.IsTrue)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("no configuration published")
+	}
+	return vw.Value().(*config.Config)
+}
+
+func (s *watcherSuite) TestReloadOnChange(c *gc.C) {
+	defer leaktest.Check(c)()
+	path := s.writeFile(c, "app.json", `{"port": 1}`)
+	w, err := config.NewWatcher(&config.Loader{Files: []string{path}}, validPort)
+	c.Assert(err, gc.IsNil)
+	defer w.Stop()
+	c.Assert(s.port(c, w.Config()), gc.Equals, float64(1))
+
+	vw := w.Value().Watch()
+	defer vw.Close()
+	c.Assert(s.port(c, next(c, vw)), gc.Equals, float64(1))
+
+	s.writeFile(c, "app.json", `{"port": 1000}`)
+	c.Assert(s.port(c, next(c, vw)), gc.Equals, float64(1000))
+	c.Assert(w.Err(), gc.IsNil)
+}
+
+func (s *watcherSuite) TestInvalidConfigKeepsPrevious(c *gc.C) {
+	defer leaktest.Check(c)()
+	path := s.writeFile(c, "app.json", `{"port": 1}`)
+	w, err := config.NewWatcher(&config.Loader{Files: []string{path}}, validPort)
+	c.Assert(err, gc.IsNil)
+	defer w.Stop()
+
+	s.writeFile(c, "app.json", `{"port": -100}`)
+	err = w.Reload()
+	c.Assert(err, gc.ErrorMatches, "invalid configuration: port -100 not valid")
+	c.Assert(w.Err(), gc.Equals, err)
+	c.Assert(s.port(c, w.Config()), gc.Equals, float64(1))
+
+	s.writeFile(c, "app.json", `{"port": `)
+	err = w.Reload()
+	c.Assert(err, gc.ErrorMatches, `cannot parse ".*app.json": .*`)
+	c.Assert(s.port(c, w.Config()), gc.Equals, float64(1))
+
+	s.writeFile(c, "app.json", `{"port": 2}`)
+	c.Assert(w.Reload(), gc.IsNil)
+	c.Assert(w.Err(), gc.IsNil)
+	c.Assert(s.port(c, w.Config()), gc.Equals, float64(2))
+}
+
+func (s *watcherSuite) TestInitialConfigInvalid(c *gc.C) {
+	defer leaktest.Check(c)()
+	path := s.writeFile(c, "app.json", `{"port": 0}`)
+	_, err := config.NewWatcher(&config.Loader{Files: []string{path}}, validPort)
+	c.Assert(err, gc.ErrorMatches, "invalid configuration: port 0 not valid")
+}
+
+func (s *watcherSuite) TestStopClosesValue(c *gc.C) {
+	defer leaktest.Check(c)()
+	path := s.writeFile(c, "app.json", `{"port": 1}`)
+	w, err := config.NewWatcher(&config.Loader{Files: []string{path}}, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(w.Stop(), gc.IsNil)
+	c.Assert(w.Value().Closed(), jc.IsTrue)
+	c.Assert(s.port(c, w.Config()), gc.Equals, float64(1))
+}
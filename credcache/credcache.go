@@ -0,0 +1,208 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package credcache caches short-lived credentials, such as API tokens
+// and SSH certificates, and renews them before they expire.
+//
+// Each credential is identified by a scope and obtained by calling a
+// mint function. Concurrent requests for a scope share a single call
+// to the mint function; a credential nearing expiry is renewed in the
+// background while the current one is still handed out; and failures
+// are retried with exponential backoff. An expired credential is never
+// returned.
+package credcache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+
+	"github.com/juju/utils/clock"
+	"github.com/juju/utils/retry"
+)
+
+var logger = loggo.GetLogger("juju.utils.credcache")
+
+// Credential holds a credential and the time it expires.
+type Credential struct {
+	Value   interface{}
+	Expires time.Time
+}
+
+// MintFunc obtains a new credential for a scope.
+type MintFunc func(scope string) (Credential, error)
+
+// Config holds the configuration for a cache.
+type Config struct {
+	// Mint obtains new credentials.
+	Mint MintFunc
+
+	// RefreshAhead holds how long before a credential expires it is
+	// renewed. If zero, one minute is used.
+	RefreshAhead time.Duration
+
+	// MinBackoff and MaxBackoff bound the delay before retrying
+	// after Mint fails. The delay doubles with each consecutive
+	// failure. If zero, one second and one minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Clock provides the current time. If nil, clock.WallClock is
+	// used.
+	Clock clock.Clock
+}
+
+// Validate returns an error if the configuration is not valid.
+func (config Config) Validate() error {
+	if config.Mint == nil {
+		return errors.NotValidf("nil Mint")
+	}
+	if config.RefreshAhead < 0 {
+		return errors.NotValidf("negative RefreshAhead")
+	}
+	if config.MinBackoff < 0 || config.MaxBackoff < 0 {
+		return errors.NotValidf("negative backoff")
+	}
+	return nil
+}
+
+// Cache is a credential cache. Its methods may be called concurrently.
+type Cache struct {
+	config Config
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	cred     *Credential
+	call     *call
+	err      error
+	failures int
+	retryAt  time.Time
+}
+
+// call represents a call to Mint in progress.
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+// New returns a new cache.
+func New(config Config) (*Cache, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if config.RefreshAhead == 0 {
+		config.RefreshAhead = time.Minute
+	}
+	if config.MinBackoff == 0 {
+		config.MinBackoff = time.Second
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = time.Minute
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+	if config.Clock == nil {
+		config.Clock = clock.WallClock
+	}
+	return &Cache{
+		config:  config,
+		entries: make(map[string]*entry),
+	}, nil
+}
+
+// Get returns the credential for scope, minting one if there is no
+// unexpired credential cached. If minting has failed recently and the
+// backoff delay has not yet elapsed, Get returns the error from the
+// last attempt without trying again.
+func (c *Cache) Get(scope string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[scope]
+	if e == nil {
+		e = &entry{}
+		c.entries[scope] = e
+	}
+	for {
+		now := c.config.Clock.Now()
+		if e.cred != nil && now.Before(e.cred.Expires) {
+			if e.call == nil && !now.Before(e.cred.Expires.Add(-c.config.RefreshAhead)) && !now.Before(e.retryAt) {
+				logger.Debugf("refreshing credential for %q ahead of expiry", scope)
+				c.start(scope, e)
+			}
+			return e.cred.Value, nil
+		}
+		if e.call == nil {
+			if now.Before(e.retryAt) {
+				return nil, errors.Annotatef(e.err, "cannot get credential for %q", scope)
+			}
+			c.start(scope, e)
+		}
+		call := e.call
+		c.mu.Unlock()
+		<-call.done
+		c.mu.Lock()
+		if call.err != nil {
+			return nil, errors.Annotatef(call.err, "cannot get credential for %q", scope)
+		}
+	}
+}
+
+// start starts a call to Mint for scope. It must be called with c.mu
+// held.
+func (c *Cache) start(scope string, e *entry) {
+	call := &call{done: make(chan struct{})}
+	e.call = call
+	go func() {
+		cred, err := c.config.Mint(scope)
+		if err == nil && !c.config.Clock.Now().Before(cred.Expires) {
+			err = errors.Errorf("minted credential expired at %v", cred.Expires)
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		e.call = nil
+		call.err = err
+		close(call.done)
+		if err != nil {
+			e.err = err
+			e.failures++
+			delay := c.backoff(e.failures)
+			e.retryAt = c.config.Clock.Now().Add(delay)
+			logger.Warningf("cannot mint credential for %q (retrying in %v): %v", scope, delay, err)
+			return
+		}
+		e.cred = &cred
+		e.err = nil
+		e.failures = 0
+		e.retryAt = time.Time{}
+	}()
+}
+
+// backoff returns the delay after the given number of consecutive
+// failures, with random jitter so that many clients do not retry in
+// step.
+func (c *Cache) backoff(failures int) time.Duration {
+	return retry.Strategy{
+		Delay:    c.config.MinBackoff,
+		Backoff:  retry.Exponential(2),
+		MaxDelay: c.config.MaxBackoff,
+		Jitter:   true,
+	}.DelayAfter(failures)
+}
+
+// Invalidate discards the credential cached for scope, for instance
+// because it has been revoked, and forgets any recent failure. The
+// next call to Get mints a new one.
+func (c *Cache) Invalidate(scope string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[scope]; e != nil {
+		e.cred = nil
+		e.retryAt = time.Time{}
+	}
+}
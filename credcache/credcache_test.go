@@ -0,0 +1,197 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package credcache_test
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/credcache"
+	"github.com/juju/utils/testing/leaktest"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type credcacheSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+
+	mu     sync.Mutex
+	calls  int
+	err    error
+	ttl    time.Duration
+	minted chan string
+	block  chan struct{}
+}
+
+var _ = gc.Suite(&credcacheSuite{})
+
+func (s *credcacheSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.New(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+	s.calls = 0
+	s.err = nil
+	s.ttl = 5 * time.Minute
+	s.minted = make(chan string, 100)
+	s.block = nil
+}
+
+func (s *credcacheSuite) mint(scope string) (credcache.Credential, error) {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	value := fmt.Sprintf("%s-%d", scope, s.calls)
+	s.minted <- value
+	if s.err != nil {
+		return credcache.Credential{}, s.err
+	}
+	return credcache.Credential{Value: value, Expires: s.clock.Now().Add(s.ttl)}, nil
+}
+
+func (s *credcacheSuite) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *credcacheSuite) newCache(c *gc.C) *credcache.Cache {
+	cache, err := credcache.New(credcache.Config{
+		Mint:         s.mint,
+		RefreshAhead: time.Minute,
+		MinBackoff:   10 * time.Second,
+		MaxBackoff:   40 * time.Second,
+		Clock:        s.clock,
+	})
+	c.Assert(err, gc.IsNil)
+	return cache
+}
+
+func (s *credcacheSuite) waitMinted(c *gc.C) string {
+	select {
+	case v := <-s.minted:
+		return v
+	case <-time.After(5 * time.Second):
+		c.Fatalf("credential never minted")
+	}
+	panic("unreachable")
+}
+
+func (s *credcacheSuite) TestCaching(c *gc.C) {
+	defer leaktest.Check(c)()
+	cache := s.newCache(c)
+	for i := 0; i < 3; i++ {
+		v, err := cache.Get("api")
+		c.Assert(err, gc.IsNil)
+		c.Assert(v, gc.Equals, "api-1")
+	}
+	v, err := cache.Get("ssh")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, "ssh-2")
+
+	cache.Invalidate("api")
+	v, err = cache.Get("api")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, "api-3")
+}
+
+func (s *credcacheSuite) TestSingleFlight(c *gc.C) {
+	defer leaktest.Check(c)()
+	s.block = make(chan struct{})
+	cache := s.newCache(c)
+	var wg sync.WaitGroup
+	results := make(chan interface{}, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.Get("api")
+			c.Check(err, gc.IsNil)
+			results <- v
+		}()
+	}
+	close(s.block)
+	wg.Wait()
+	close(results)
+	for v := range results {
+		c.Assert(v, gc.Equals, "api-1")
+	}
+	c.Assert(s.calls, gc.Equals, 1)
+}
+
+func (s *credcacheSuite) TestRefreshAhead(c *gc.C) {
+	defer leaktest.Check(c)()
+	cache := s.newCache(c)
+	v, err := cache.Get("api")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.waitMinted(c), gc.Equals, "api-1")
+
+	s.clock.Advance(4*time.Minute + 30*time.Second)
+	// The current credential is returned while a new one is minted.
+	v, err = cache.Get("api")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, "api-1")
+	c.Assert(s.waitMinted(c), gc.Equals, "api-2")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if v, _ = cache.Get("api"); v == "api-2" {
+			break
+		}
+	}
+	c.Assert(v, gc.Equals, "api-2")
+}
+
+func (s *credcacheSuite) TestBackoff(c *gc.C) {
+	defer leaktest.Check(c)()
+	s.setErr(fmt.Errorf("mint failed"))
+	cache := s.newCache(c)
+	_, err := cache.Get("api")
+	c.Assert(err, gc.ErrorMatches, `cannot get credential for "api": mint failed`)
+	s.waitMinted(c)
+
+	// Within the backoff delay the error is returned without
+	// minting again.
+	_, err = cache.Get("api")
+	c.Assert(err, gc.ErrorMatches, `cannot get credential for "api": mint failed`)
+	c.Assert(s.calls, gc.Equals, 1)
+
+	s.setErr(nil)
+	s.clock.Advance(10 * time.Second)
+	v, err := cache.Get("api")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, "api-2")
+}
+
+func (s *credcacheSuite) TestNeverReturnsExpired(c *gc.C) {
+	defer leaktest.Check(c)()
+	cache := s.newCache(c)
+	_, err := cache.Get("api")
+	c.Assert(err, gc.IsNil)
+	s.waitMinted(c)
+
+	s.setErr(fmt.Errorf("mint failed"))
+	s.clock.Advance(5 * time.Minute)
+	_, err = cache.Get("api")
+	c.Assert(err, gc.ErrorMatches, `cannot get credential for "api": mint failed`)
+}
+
+func (s *credcacheSuite) TestMintedExpired(c *gc.C) {
+	defer leaktest.Check(c)()
+	s.ttl = 0
+	cache := s.newCache(c)
+	_, err := cache.Get("api")
+	c.Assert(err, gc.ErrorMatches, `cannot get credential for "api": minted credential expired at .*`)
+}
+
+func (s *credcacheSuite) TestValidate(c *gc.C) {
+	defer leaktest.Check(c)()
+	_, err := credcache.New(credcache.Config{})
+	c.Assert(err, gc.ErrorMatches, "nil Mint not valid")
+	_, err = credcache.New(credcache.Config{Mint: s.mint, RefreshAhead: -1})
+	c.Assert(err, gc.ErrorMatches, "negative RefreshAhead not valid")
+}
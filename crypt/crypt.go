@@ -0,0 +1,274 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package crypt encrypts files and streams at rest with AES-256-GCM.
+//
+// Encrypted data starts with a versioned header recording how the key
+// was obtained, followed by the data sealed in chunks so that streams
+// of any size can be encrypted and authenticated without holding them
+// in memory. Chunks are numbered and the last one is marked, so
+// reordering, removing or truncating chunks is detected as well as
+// modifying them.
+//
+// The key is either supplied directly or derived from a passphrase
+// with argon2id or scrypt. Each stream is encrypted with its own key,
+// derived from that key and a random salt stored in the header.
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/juju/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeySize is the size in bytes of keys.
+const KeySize = 32
+
+var (
+	// ErrWrongKey is the cause of errors returned when data was
+	// encrypted with a different key or passphrase.
+	ErrWrongKey = errors.New("wrong key or passphrase")
+
+	// ErrAuthentication is the cause of errors returned when
+	// encrypted data has been modified or truncated.
+	ErrAuthentication = errors.New("message authentication failed")
+)
+
+// Algorithm identifies how the key for some data is obtained.
+type Algorithm byte
+
+const (
+	// RawKey means the key is supplied directly.
+	RawKey Algorithm = iota
+
+	// Argon2id means the key is derived from a passphrase with
+	// argon2id.
+	Argon2id
+
+	// Scrypt means the key is derived from a passphrase with scrypt.
+	Scrypt
+)
+
+// KDF holds the parameters for deriving a key from a passphrase.
+type KDF struct {
+	// Algorithm holds Argon2id or Scrypt.
+	Algorithm Algorithm
+
+	// Time, Memory (in KiB) and Threads are the argon2id
+	// parameters.
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+
+	// LogN, R and P are the scrypt parameters: the cost is 2^LogN.
+	LogN uint8
+	R    uint32
+	P    uint32
+}
+
+// DefaultArgon2id holds the argon2id parameters recommended by RFC 9106
+// for memory-constrained environments.
+var DefaultArgon2id = KDF{Algorithm: Argon2id, Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// DefaultScrypt holds the scrypt parameters recommended for interactive
+// use.
+var DefaultScrypt = KDF{Algorithm: Scrypt, LogN: 15, R: 8, P: 1}
+
+// maxArgon2Memory limits the memory, in KiB, that decrypting data may
+// demand.
+const maxArgon2Memory = 4 * 1024 * 1024
+
+func (k KDF) validate() error {
+	switch k.Algorithm {
+	case Argon2id:
+		if k.Time < 1 || k.Threads < 1 || k.Memory < 8*uint32(k.Threads) || k.Memory > maxArgon2Memory {
+			return errors.NotValidf("argon2id parameters t=%d m=%d p=%d", k.Time, k.Memory, k.Threads)
+		}
+	case Scrypt:
+		if k.LogN < 1 || k.LogN > 30 || k.R < 1 || k.P < 1 || uint64(k.R)*uint64(k.P) >= 1<<30 {
+			return errors.NotValidf("scrypt parameters N=2^%d r=%d p=%d", k.LogN, k.R, k.P)
+		}
+	default:
+		return errors.NotValidf("key derivation algorithm %d", k.Algorithm)
+	}
+	return nil
+}
+
+func (k KDF) derive(passphrase string, salt []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case Argon2id:
+		return argon2.IDKey([]byte(passphrase), salt, k.Time, k.Memory, k.Threads, KeySize), nil
+	case Scrypt:
+		key, err := scrypt.Key([]byte(passphrase), salt, 1<<k.LogN, int(k.R), int(k.P), KeySize)
+		return key, errors.Trace(err)
+	}
+	return nil, errors.NotValidf("key derivation algorithm %d", k.Algorithm)
+}
+
+// Secret supplies the key used to encrypt or decrypt data.
+type Secret struct {
+	key        []byte
+	passphrase string
+	kdf        KDF
+}
+
+// Key returns a secret that uses the given key, which must be KeySize
+// bytes long.
+func Key(key []byte) Secret {
+	return Secret{key: key}
+}
+
+// Passphrase returns a secret that derives its key from the given
+// passphrase. When encrypting, the key is derived with kdf; when
+// decrypting, the parameters recorded in the data are used instead.
+func Passphrase(passphrase string, kdf KDF) Secret {
+	return Secret{passphrase: passphrase, kdf: kdf}
+}
+
+// NewKey returns a new random key.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Annotate(err, "cannot generate key")
+	}
+	return key, nil
+}
+
+const (
+	version    = 1
+	saltSize   = 16
+	checkSize  = 8
+	headerSize = len(magic) + 2 + saltSize + 12 + checkSize
+)
+
+const magic = "JCRYPT"
+
+// header holds the header of some encrypted data.
+type header struct {
+	kdf   KDF
+	salt  []byte
+	check []byte
+}
+
+// newHeader returns a header for encrypting data with s, and the key
+// for the data.
+func newHeader(s Secret) (*header, []byte, error) {
+	h := &header{salt: make([]byte, saltSize)}
+	if _, err := io.ReadFull(rand.Reader, h.salt); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot generate salt")
+	}
+	if s.key == nil {
+		if err := s.kdf.validate(); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		h.kdf = s.kdf
+	}
+	key, err := h.key(s)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return h, key, nil
+}
+
+// key returns the key for the data, and sets or verifies h.check.
+func (h *header) key(s Secret) ([]byte, error) {
+	master := s.key
+	if master == nil {
+		if h.kdf.Algorithm == RawKey {
+			return nil, errors.Annotate(ErrWrongKey, "data encrypted with a key, not a passphrase")
+		}
+		var err error
+		if master, err = h.kdf.derive(s.passphrase, h.salt); err != nil {
+			return nil, errors.Annotate(err, "cannot derive key")
+		}
+	} else if len(master) != KeySize {
+		return nil, errors.NotValidf("%d byte key", len(master))
+	} else if h.kdf.Algorithm != RawKey {
+		return nil, errors.Annotate(ErrWrongKey, "data encrypted with a passphrase, not a key")
+	}
+	key := mac(master, []byte("crypt data key"), h.salt)
+	check := mac(key, []byte("crypt key check"))[:checkSize]
+	if h.check == nil {
+		h.check = check
+	} else if !hmac.Equal(h.check, check) {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
+
+func mac(key []byte, data ...[]byte) []byte {
+	m := hmac.New(sha256.New, key)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+func (h *header) marshal() []byte {
+	b := make([]byte, 0, headerSize)
+	b = append(b, magic...)
+	b = append(b, version, byte(h.kdf.Algorithm))
+	b = append(b, h.salt...)
+	var params [12]byte
+	switch h.kdf.Algorithm {
+	case Argon2id:
+		binary.BigEndian.PutUint32(params[0:], h.kdf.Time)
+		binary.BigEndian.PutUint32(params[4:], h.kdf.Memory)
+		binary.BigEndian.PutUint32(params[8:], uint32(h.kdf.Threads))
+	case Scrypt:
+		binary.BigEndian.PutUint32(params[0:], uint32(h.kdf.LogN))
+		binary.BigEndian.PutUint32(params[4:], h.kdf.R)
+		binary.BigEndian.PutUint32(params[8:], h.kdf.P)
+	}
+	b = append(b, params[:]...)
+	return append(b, h.check...)
+}
+
+func readHeader(r io.Reader) (*header, []byte, error) {
+	b := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil, errors.New("data not encrypted: header too short")
+		}
+		return nil, nil, errors.Trace(err)
+	}
+	if string(b[:len(magic)]) != string(magic) {
+		return nil, nil, errors.New("data not encrypted: bad magic")
+	}
+	p := b[len(magic):]
+	if p[0] != version {
+		return nil, nil, errors.NotSupportedf("encryption format version %d", p[0])
+	}
+	h := &header{kdf: KDF{Algorithm: Algorithm(p[1])}}
+	p = p[2:]
+	h.salt, p = p[:saltSize], p[saltSize:]
+	p0, p1, p2 := binary.BigEndian.Uint32(p[0:]), binary.BigEndian.Uint32(p[4:]), binary.BigEndian.Uint32(p[8:])
+	switch h.kdf.Algorithm {
+	case RawKey:
+	case Argon2id:
+		if p2 > 255 {
+			return nil, nil, errors.NotValidf("argon2id threads %d", p2)
+		}
+		h.kdf.Time, h.kdf.Memory, h.kdf.Threads = p0, p1, uint8(p2)
+	case Scrypt:
+		if p0 > 255 {
+			return nil, nil, errors.NotValidf("scrypt cost 2^%d", p0)
+		}
+		h.kdf.LogN, h.kdf.R, h.kdf.P = uint8(p0), p1, p2
+	default:
+		return nil, nil, errors.NotSupportedf("key derivation algorithm %d", h.kdf.Algorithm)
+	}
+	if h.kdf.Algorithm != RawKey {
+		if err := h.kdf.validate(); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+	}
+	h.check = p[12:]
+	return h, b, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package crypt_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/crypt"
+)
+
+type cryptSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&cryptSuite{})
+
+// Cheap parameters keep the tests fast.
+var (
+	testArgon2id = crypt.KDF{Algorithm: crypt.Argon2id, Time: 1, Memory: 64, Threads: 1}
+	testScrypt   = crypt.KDF{Algorithm: crypt.Scrypt, LogN: 4, R: 8, P: 1}
+)
+
+func newKey(c *gc.C) []byte {
+	key, err := crypt.NewKey()
+	c.Assert(err, gc.IsNil)
+	c.Assert(key, gc.HasLen, crypt.KeySize)
+	return key
+}
+
+func encrypt(c *gc.C, s crypt.Secret, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := crypt.NewWriter(&buf, s)
+	c.Assert(err, gc.IsNil)
+	_, err = w.Write(data)
+	c.Assert(err, gc.IsNil)
+	c.Assert(w.Close(), gc.IsNil)
+	return buf.Bytes()
+}
+
+func decrypt(s crypt.Secret, data []byte) ([]byte, error) {
+	r, err := crypt.NewReader(bytes.NewReader(data), s)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func (s *cryptSuite) TestRoundTrip(c *gc.C) {
+	secrets := []crypt.Secret{
+		crypt.Key(newKey(c)),
+		crypt.Passphrase("correct horse", testArgon2id),
+		crypt.Passphrase("battery staple", testScrypt),
+	}
+	sizes := []int{0, 1, crypt.ChunkSize - 1, crypt.ChunkSize, 2*crypt.ChunkSize + 5}
+	for i, secret := range secrets {
+		for _, size := range sizes {
+			c.Logf("secret %d, size %d", i, size)
+			data := bytes.Repeat([]byte{byte(size)}, size)
+			sealed := encrypt(c, secret, data)
+			if size > 32 {
+				c.Assert(bytes.Contains(sealed, data[:32]), jc.IsFalse)
+			}
+			out, err := decrypt(secret, sealed)
+			c.Assert(err, gc.IsNil)
+			c.Assert(out, jc.DeepEquals, data)
+		}
+	}
+}
+
+func (s *cryptSuite) TestUniqueCiphertext(c *gc.C) {
+	secret := crypt.Key(newKey(c))
+	a := encrypt(c, secret, []byte("hello"))
+	b := encrypt(c, secret, []byte("hello"))
+	c.Assert(bytes.Equal(a, b), jc.IsFalse)
+}
+
+func (s *cryptSuite) TestWrongKey(c *gc.C) {
+	sealed := encrypt(c, crypt.Key(newKey(c)), []byte("secret"))
+	_, err := decrypt(crypt.Key(newKey(c)), sealed)
+	c.Assert(errors.Cause(err), gc.Equals, crypt.ErrWrongKey)
+
+	sealed = encrypt(c, crypt.Passphrase("right", testScrypt), []byte("secret"))
+	_, err = decrypt(crypt.Passphrase("wrong", testScrypt), sealed)
+	c.Assert(errors.Cause(err), gc.Equals, crypt.ErrWrongKey)
+	_, err = decrypt(crypt.Key(newKey(c)), sealed)
+	c.Assert(err, gc.ErrorMatches, "data encrypted with a passphrase, not a key: wrong key or passphrase")
+	c.Assert(errors.Cause(err), gc.Equals, crypt.ErrWrongKey)
+
+	// The parameters recorded in the data are used.
+	out, err := decrypt(crypt.Passphrase("right", crypt.DefaultScrypt), sealed)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(out), gc.Equals, "secret")
+}
+
+func (s *cryptSuite) TestTampering(c *gc.C) {
+	secret := crypt.Key(newKey(c))
+	data := bytes.Repeat([]byte("x"), 2*crypt.ChunkSize+10)
+	sealed := encrypt(c, secret, data)
+	chunk := crypt.ChunkSize + 16
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[crypt.HeaderSize+chunk+3] ^= 1
+	for i, bad := range [][]byte{
+		flipped,
+		// Truncated at a chunk boundary.
+		sealed[:crypt.HeaderSize+2*chunk],
+		// Truncated in the middle of a chunk.
+		sealed[:len(sealed)-3],
+		// Chunks swapped.
+		append(append(append([]byte(nil), sealed[:crypt.HeaderSize]...),
+			sealed[crypt.HeaderSize+chunk:crypt.HeaderSize+2*chunk]...),
+			append(sealed[crypt.HeaderSize:crypt.HeaderSize+chunk], sealed[crypt.HeaderSize+2*chunk:]...)...),
+	} {
+		c.Logf("test %d", i)
+		_, err := decrypt(secret, bad)
+		c.Assert(errors.Cause(err), gc.Equals, crypt.ErrAuthentication)
+	}
+}
+
+func (s *cryptSuite) TestHeaderErrors(c *gc.C) {
+	_, err := decrypt(crypt.Key(newKey(c)), []byte("short"))
+	c.Assert(err, gc.ErrorMatches, "data not encrypted: header too short")
+	_, err = decrypt(crypt.Key(newKey(c)), bytes.Repeat([]byte("x"), 100))
+	c.Assert(err, gc.ErrorMatches, "data not encrypted: bad magic")
+
+	sealed := encrypt(c, crypt.Key(newKey(c)), nil)
+	sealed[len("JCRYPT")] = 99
+	_, err = decrypt(crypt.Key(newKey(c)), sealed)
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+
+	_, err = crypt.NewWriter(ioutil.Discard, crypt.Key([]byte("short")))
+	c.Assert(err, gc.ErrorMatches, "5 byte key not valid")
+	_, err = crypt.NewWriter(ioutil.Discard, crypt.Passphrase("p", crypt.KDF{Algorithm: crypt.Scrypt}))
+	c.Assert(err, gc.ErrorMatches, `scrypt parameters N=2\^0 r=0 p=0 not valid`)
+}
+
+func (s *cryptSuite) TestFiles(c *gc.C) {
+	dir := c.MkDir()
+	plain := filepath.Join(dir, "creds")
+	sealed := filepath.Join(dir, "creds.enc")
+	c.Assert(ioutil.WriteFile(plain, []byte("token"), 0600), gc.IsNil)
+
+	oldKey, newSecret := crypt.Key(newKey(c)), crypt.Passphrase("new", testArgon2id)
+	c.Assert(crypt.EncryptFile(sealed, plain, oldKey), gc.IsNil)
+	info, err := os.Stat(sealed)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+
+	c.Assert(crypt.Rekey(sealed, oldKey, newSecret), gc.IsNil)
+	err = crypt.DecryptFile(plain, sealed, oldKey)
+	c.Assert(err, gc.ErrorMatches, `cannot decrypt ".*creds.enc": data encrypted with a passphrase, not a key: wrong key or passphrase`)
+	c.Assert(crypt.Rekey(sealed, oldKey, newSecret), gc.NotNil)
+
+	out := filepath.Join(dir, "out")
+	c.Assert(crypt.DecryptFile(out, sealed, newSecret), gc.IsNil)
+	data, err := ioutil.ReadFile(out)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "token")
+
+	// Failures leave no temporary files behind.
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(names, gc.HasLen, 3)
+}
@@ -0,0 +1,102 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package crypt
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils"
+)
+
+// EncryptFile writes the contents of src, encrypted with s, to dst.
+// The file at dst is replaced atomically, so it is never left partly
+// written. Its permissions are those of src.
+func EncryptFile(dst, src string, s Secret) error {
+	return errors.Annotatef(transform(dst, src, func(w io.Writer, r io.Reader) error {
+		cw, err := NewWriter(w, s)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := io.Copy(cw, r); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(cw.Close())
+	}), "cannot encrypt %q", src)
+}
+
+// DecryptFile writes the contents of src, which must have been
+// encrypted with s, to dst. The file at dst is replaced atomically and
+// only once all of src has been authenticated.
+func DecryptFile(dst, src string, s Secret) error {
+	return errors.Annotatef(transform(dst, src, func(w io.Writer, r io.Reader) error {
+		cr, err := NewReader(r, s)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		_, err = io.Copy(w, cr)
+		return errors.Trace(err)
+	}), "cannot decrypt %q", src)
+}
+
+// Rekey re-encrypts the file at path, which must have been encrypted
+// with from, using to. The file is replaced atomically, so a failure
+// leaves it encrypted with from.
+func Rekey(path string, from, to Secret) error {
+	return errors.Annotatef(transform(path, path, func(w io.Writer, r io.Reader) error {
+		cr, err := NewReader(r, from)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		cw, err := NewWriter(w, to)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if _, err := io.Copy(cw, cr); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(cw.Close())
+	}), "cannot rekey %q", path)
+}
+
+// transform writes the result of applying f to the contents of src to
+// a temporary file and then moves it to dst.
+func transform(dst, src string, f func(w io.Writer, r io.Reader) error) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	out, err := ioutil.TempFile(filepath.Dir(dst), "crypt")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+	if err := f(out, in); err != nil {
+		return errors.Trace(err)
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		return errors.Trace(err)
+	}
+	if err := out.Sync(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := out.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(utils.ReplaceFile(out.Name(), dst))
+}
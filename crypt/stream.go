@@ -0,0 +1,201 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package crypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+
+	"github.com/juju/errors"
+)
+
+// chunkSize is the size of the plaintext in each sealed chunk except
+// the last.
+const chunkSize = 64 * 1024
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the nonce for the given chunk. Keys are never reused
+// across streams, so the chunk number is enough to make it unique.
+func nonce(n uint64, last bool) []byte {
+	var b [12]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	if last {
+		b[8] = 1
+	}
+	return b[:]
+}
+
+// Writer encrypts the data written to it.
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	ad     []byte
+	buf    []byte
+	chunk  uint64
+	err    error
+	closed bool
+}
+
+// NewWriter returns a writer that encrypts the data written to it with
+// the key supplied by s and writes the result to w. The writer must be
+// closed to write the final chunk; closing it does not close w.
+func NewWriter(w io.Writer, s Secret) (*Writer, error) {
+	h, key, err := newHeader(s)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	ad := h.marshal()
+	if _, err := w.Write(ad); err != nil {
+		return nil, errors.Annotate(err, "cannot write header")
+	}
+	return &Writer{
+		w:    w,
+		aead: aead,
+		ad:   ad,
+		buf:  make([]byte, 0, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("writer closed")
+	}
+	written := 0
+	for len(p) > 0 && w.err == nil {
+		// A full chunk is only sealed once more data arrives, so
+		// that the final chunk is never empty unless the stream
+		// is.
+		if len(w.buf) == chunkSize {
+			w.err = w.seal(false)
+			continue
+		}
+		n := chunkSize - len(w.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+	}
+	return written, w.err
+}
+
+func (w *Writer) seal(last bool) error {
+	sealed := w.aead.Seal(w.buf[:0], nonce(w.chunk, last), w.buf, w.ad)
+	w.chunk++
+	w.buf = w.buf[:0]
+	if _, err := w.w.Write(sealed); err != nil {
+		return errors.Annotate(err, "cannot write encrypted data")
+	}
+	return nil
+}
+
+// Close writes the final chunk.
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err == nil {
+		w.err = w.seal(true)
+	}
+	return w.err
+}
+
+// Reader decrypts data written by a Writer.
+type Reader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	ad    []byte
+	buf   []byte
+	plain []byte
+	chunk uint64
+	done  bool
+	err   error
+}
+
+// NewReader returns a reader that decrypts the data read from r with
+// the key supplied by s. It returns an error with the cause ErrWrongKey
+// if the data was encrypted with a different key. Reading returns an
+// error with the cause ErrAuthentication if the data has been modified
+// or truncated; no data is returned from a chunk that fails to
+// authenticate.
+func NewReader(r io.Reader, s Secret) (*Reader, error) {
+	h, ad, err := readHeader(r)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	key, err := h.key(s)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Reader{
+		r:    bufio.NewReader(r),
+		aead: aead,
+		ad:   ad,
+		buf:  make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// open reads and authenticates the next chunk.
+func (r *Reader) open() error {
+	n, err := io.ReadFull(r.r, r.buf)
+	last := false
+	switch err {
+	case nil:
+		// A full chunk is the last one if nothing follows it.
+		if _, err := r.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return errors.Annotate(err, "cannot read encrypted data")
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return errors.Annotate(err, "cannot read encrypted data")
+	}
+	plain, err := r.aead.Open(r.buf[:0], nonce(r.chunk, last), r.buf[:n], r.ad)
+	if err != nil {
+		return errors.Annotatef(ErrAuthentication, "chunk %d", r.chunk)
+	}
+	r.chunk++
+	r.plain = plain
+	r.done = last
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package debugstatus provides an introspection endpoint that reports
+// what a process is currently doing: the commands being run through
+// the exec package, the state of any registered workers and pools,
+// and recently recorded errors.
+package debugstatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/exec"
+)
+
+// MaxErrors holds the number of recent errors retained by RecordError.
+var MaxErrors = 50
+
+// Source returns the current state of a subsystem. The returned value
+// must be marshalable as JSON.
+type Source func() interface{}
+
+var (
+	mu      sync.Mutex
+	sources = make(map[string]Source)
+	recent  []ErrorRecord
+)
+
+// now is overridden in tests.
+var now = time.Now
+
+// Register adds a named source of status information to the report,
+// replacing any source previously registered with the same name.
+// Callers register the state of their worker pools, watchers and
+// supervisors here.
+func Register(name string, source Source) {
+	mu.Lock()
+	defer mu.Unlock()
+	sources[name] = source
+}
+
+// Unregister removes the named source from the report.
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(sources, name)
+}
+
+// ErrorRecord holds an error recorded by RecordError.
+type ErrorRecord struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Error  string    `json:"error"`
+}
+
+// RecordError records that the named source encountered err. Only the
+// most recent MaxErrors errors are retained. Recording a nil error
+// does nothing.
+func RecordError(source string, err error) {
+	if err == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	recent = append(recent, ErrorRecord{
+		Time:   now(),
+		Source: source,
+		Error:  err.Error(),
+	})
+	if over := len(recent) - MaxErrors; over > 0 {
+		recent = append([]ErrorRecord(nil), recent[over:]...)
+	}
+}
+
+// Command describes a running command in a Report.
+type Command struct {
+	PID        int           `json:"pid"`
+	Commands   string        `json:"commands"`
+	Args       []string      `json:"args,omitempty"`
+	WorkingDir string        `json:"working-dir,omitempty"`
+	Started    time.Time     `json:"started"`
+	Running    time.Duration `json:"running"`
+}
+
+// Report holds a snapshot of the process status.
+type Report struct {
+	Time     time.Time              `json:"time"`
+	PID      int                    `json:"pid"`
+	Commands []Command              `json:"commands"`
+	Sources  map[string]interface{} `json:"sources,omitempty"`
+	Errors   []ErrorRecord          `json:"errors,omitempty"`
+}
+
+// Collect gathers the current status from the exec package and from
+// all registered sources.
+func Collect() Report {
+	report := Report{
+		Time:     now(),
+		PID:      os.Getpid(),
+		Commands: []Command{},
+	}
+	for _, cmd := range exec.Running() {
+		report.Commands = append(report.Commands, Command{
+			PID:        cmd.PID,
+			Commands:   cmd.Commands,
+			Args:       cmd.Args,
+			WorkingDir: cmd.WorkingDir,
+			Started:    cmd.Started,
+			Running:    report.Time.Sub(cmd.Started),
+		})
+	}
+	mu.Lock()
+	current := make(map[string]Source, len(sources))
+	for name, source := range sources {
+		current[name] = source
+	}
+	report.Errors = append(report.Errors, recent...)
+	mu.Unlock()
+
+	// Sources are called without holding the lock so that they
+	// are free to record errors themselves.
+	if len(current) > 0 {
+		report.Sources = make(map[string]interface{}, len(current))
+		for name, source := range current {
+			report.Sources[name] = source()
+		}
+	}
+	return report
+}
+
+// WriteText writes a human readable rendering of the report to w.
+func (r Report) WriteText(w io.Writer) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "status of process %d at %s\n", r.PID, r.Time.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "\nrunning commands: %d\n", len(r.Commands))
+	for _, cmd := range r.Commands {
+		fmt.Fprintf(&buf, "  pid %d, started %s (%s ago)", cmd.PID, cmd.Started.Format(time.RFC3339), cmd.Running)
+		if cmd.WorkingDir != "" {
+			fmt.Fprintf(&buf, " in %s", cmd.WorkingDir)
+		}
+		buf.WriteString("\n")
+		if len(cmd.Args) > 0 {
+			fmt.Fprintf(&buf, "    %s\n", exec.QuotePOSIX(cmd.Args...))
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimRight(cmd.Commands, "\n"), "\n") {
+			fmt.Fprintf(&buf, "    %s\n", line)
+		}
+	}
+	names := make([]string, 0, len(r.Sources))
+	for name := range r.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := json.MarshalIndent(r.Sources[name], "  ", "  ")
+		if err != nil {
+			return errors.Annotatef(err, "cannot render %q", name)
+		}
+		fmt.Fprintf(&buf, "\n%s:\n  %s\n", name, data)
+	}
+	fmt.Fprintf(&buf, "\nrecent errors: %d\n", len(r.Errors))
+	for _, e := range r.Errors {
+		fmt.Fprintf(&buf, "  %s %s: %s\n", e.Time.Format(time.RFC3339), e.Source, e.Error)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// Handler returns an http.Handler that serves the current Report. The
+// report is rendered as JSON if the request has a "format=json" query
+// parameter or accepts "application/json", and as plain text
+// otherwise.
+func Handler() http.Handler {
+	return http.HandlerFunc(serveHTTP)
+}
+
+func serveHTTP(w http.ResponseWriter, req *http.Request) {
+	report := Collect()
+	if wantsJSON(req) {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	report.WriteText(w)
+}
+
+func wantsJSON(req *http.Request) bool {
+	if req.URL.Query().Get("format") == "json" {
+		return true
+	}
+	return strings.Contains(req.Header.Get("Accept"), "application/json")
+}
+
+// ServeUnix starts serving the status Handler on a unix domain socket
+// at the given path, replacing any stale socket left there. As the
+// status includes the commands being run, the socket is only
+// accessible to its owner. Closing the returned listener stops the
+// server.
+func ServeUnix(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Trace(err)
+	}
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	go http.Serve(listener, Handler())
+	return listener, nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package debugstatus_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/debugstatus"
+	"github.com/juju/utils/exec"
+)
+
+type statusSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&statusSuite{})
+
+var fixedTime = time.Date(2015, 3, 4, 5, 6, 7, 0, time.UTC)
+
+func (s *statusSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	debugstatus.Reset()
+	s.AddCleanup(func(*gc.C) { debugstatus.Reset() })
+	s.PatchValue(debugstatus.Now, func() time.Time { return fixedTime })
+}
+
+func (s *statusSuite) TestCollect(c *gc.C) {
+	debugstatus.Register("pool", func() interface{} {
+		return map[string]int{"queued": 3}
+	})
+	debugstatus.RecordError("worker", errors.New("boom"))
+	debugstatus.RecordError("worker", nil)
+
+	report := debugstatus.Collect()
+	c.Assert(report.Time, gc.Equals, fixedTime)
+	c.Assert(report.Sources, gc.DeepEquals, map[string]interface{}{
+		"pool": map[string]int{"queued": 3},
+	})
+	c.Assert(report.Errors, gc.DeepEquals, []debugstatus.ErrorRecord{{
+		Time:   fixedTime,
+		Source: "worker",
+		Error:  "boom",
+	}})
+
+	debugstatus.Unregister("pool")
+	c.Assert(debugstatus.Collect().Sources, gc.HasLen, 0)
+}
+
+func (s *statusSuite) TestRecentErrorsBounded(c *gc.C) {
+	s.PatchValue(&debugstatus.MaxErrors, 2)
+	for i := 0; i < 5; i++ {
+		debugstatus.RecordError("worker", fmt.Errorf("error %d", i))
+	}
+	report := debugstatus.Collect()
+	c.Assert(report.Errors, gc.HasLen, 2)
+	c.Assert(report.Errors[0].Error, gc.Equals, "error 3")
+	c.Assert(report.Errors[1].Error, gc.Equals, "error 4")
+}
+
+func (s *statusSuite) TestRunningCommands(c *gc.C) {
+	params := exec.RunParams{Commands: "sleep 1"}
+	err := params.Run()
+	c.Assert(err, gc.IsNil)
+	defer params.Wait()
+
+	var found bool
+	for _, cmd := range debugstatus.Collect().Commands {
+		if cmd.PID == params.Process().Pid {
+			found = true
+			c.Check(cmd.Commands, gc.Equals, "sleep 1")
+		}
+	}
+	c.Assert(found, jc.IsTrue)
+}
+
+func (s *statusSuite) TestRunningArgs(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("test runs /bin/sleep")
+	}
+	params := exec.RunParams{Args: []string{"/bin/sleep", "1"}}
+	err := params.Run()
+	c.Assert(err, gc.IsNil)
+	defer params.Wait()
+
+	report := debugstatus.Collect()
+	var found bool
+	for _, cmd := range report.Commands {
+		if cmd.PID == params.Process().Pid {
+			found = true
+			c.Check(cmd.Args, gc.DeepEquals, []string{"/bin/sleep", "1"})
+		}
+	}
+	c.Assert(found, jc.IsTrue)
+
+	var buf bytes.Buffer
+	err = report.WriteText(&buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf.String(), jc.Contains, "\n    /bin/sleep 1\n")
+}
+
+func (s *statusSuite) TestHandlerJSON(c *gc.C) {
+	debugstatus.Register("pool", func() interface{} {
+		return map[string]int{"queued": 3}
+	})
+	server := httptest.NewServer(debugstatus.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?format=json")
+	c.Assert(err, gc.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.Header.Get("Content-Type"), gc.Equals, "application/json")
+	var report struct {
+		Sources map[string]map[string]int
+	}
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	c.Assert(err, gc.IsNil)
+	c.Assert(report.Sources["pool"]["queued"], gc.Equals, 3)
+}
+
+func (s *statusSuite) TestHandlerText(c *gc.C) {
+	debugstatus.Register("pool", func() interface{} {
+		return map[string]int{"queued": 3}
+	})
+	debugstatus.RecordError("worker", errors.New("boom"))
+	server := httptest.NewServer(debugstatus.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	c.Assert(err, gc.IsNil)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), jc.Contains, "\npool:\n  {\n    \"queued\": 3\n  }\n")
+	c.Assert(string(data), jc.Contains, "recent errors: 1\n  2015-03-04T05:06:07Z worker: boom\n")
+}
+
+func (s *statusSuite) TestServeUnix(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "status.socket")
+	listener, err := debugstatus.ServeUnix(path)
+	c.Assert(err, gc.IsNil)
+	defer listener.Close()
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		c.Assert(err, gc.IsNil)
+		c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Dial: func(string, string) (net.Conn, error) {
+				return net.Dial("unix", path)
+			},
+		},
+	}
+	resp, err := client.Get("http://localhost/")
+	c.Assert(err, gc.IsNil)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), jc.Contains, "running commands:")
+}
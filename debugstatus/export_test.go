@@ -0,0 +1,14 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package debugstatus
+
+var Now = &now
+
+// Reset clears all registered sources and recorded errors.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	sources = make(map[string]Source)
+	recent = nil
+}
@@ -0,0 +1,29 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package debugstatus
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umaskMutex serialises the umask changes made by listenPrivate.
+var umaskMutex sync.Mutex
+
+// listenPrivate listens on a unix domain socket at path that only its
+// owner can connect to. The socket is created under a restrictive
+// umask rather than changed afterwards, so that there is no window in
+// which other users can connect. As the umask is process wide, files
+// created concurrently by other goroutines are also restricted while
+// the socket is being created.
+func listenPrivate(path string) (net.Listener, error) {
+	umaskMutex.Lock()
+	defer umaskMutex.Unlock()
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,14 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package debugstatus
+
+import (
+	"net"
+)
+
+// listenPrivate listens on a unix domain socket at path. Access to the
+// socket is governed by the ACL of the directory holding it.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,267 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/juju/errors"
+)
+
+// DeepCopy returns a deep copy of v. Pointers, maps, slices, arrays,
+// interfaces and the exported fields of structs are copied
+// recursively; shared and cyclic references are preserved in the copy.
+// Unexported struct fields, channels and functions are copied
+// shallowly.
+func DeepCopy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	c := &copier{seen: make(map[copyKey]reflect.Value)}
+	return c.copy(reflect.ValueOf(v)).Interface()
+}
+
+type copyKey struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+type copier struct {
+	seen map[copyKey]reflect.Value
+}
+
+func (c *copier) copy(v reflect.Value) reflect.Value {
+	t := v.Type()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		key := copyKey{v.Pointer(), t}
+		if n, ok := c.seen[key]; ok {
+			return n
+		}
+		n := reflect.New(t.Elem())
+		c.seen[key] = n
+		n.Elem().Set(c.copy(v.Elem()))
+		return n
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		key := copyKey{v.Pointer(), t}
+		if n, ok := c.seen[key]; ok {
+			return n
+		}
+		n := reflect.MakeMapWithSize(t, v.Len())
+		c.seen[key] = n
+		for _, k := range v.MapKeys() {
+			n.SetMapIndex(k, c.copy(v.MapIndex(k)))
+		}
+		return n
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		n := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(c.copy(v.Index(i)))
+		}
+		return n
+	case reflect.Array:
+		n := reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(c.copy(v.Index(i)))
+		}
+		return n
+	case reflect.Struct:
+		n := reflect.New(t).Elem()
+		n.Set(v)
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			n.Field(i).Set(c.copy(v.Field(i)))
+		}
+		return n
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		n := reflect.New(t).Elem()
+		n.Set(c.copy(v.Elem()))
+		return n
+	}
+	return v
+}
+
+// SliceStrategy specifies how DeepMerge combines slices.
+type SliceStrategy int
+
+const (
+	// SliceReplace replaces the destination slice with the source.
+	SliceReplace SliceStrategy = iota
+
+	// SliceAppend appends the source elements to the destination.
+	SliceAppend
+
+	// SliceUnique appends the source elements that are not already
+	// present in the destination, as determined by reflect.DeepEqual.
+	SliceUnique
+)
+
+// DeepMerge merges src into dst, which must be a non-nil pointer or a
+// non-nil map. Maps and structs are merged recursively; pointers are
+// followed; slices are combined according to the given strategy; any
+// other value in src replaces the corresponding value in dst. Values
+// taken from src are deep copied.
+//
+// Zero-valued struct fields and nil map values in src are ignored, so
+// src can hold just the values to override. An error is returned if a
+// value in src has a different type from the value it would be merged
+// into.
+func DeepMerge(dst, src interface{}, strategy SliceStrategy) error {
+	d := reflect.ValueOf(dst)
+	switch {
+	case d.Kind() == reflect.Ptr && !d.IsNil():
+		d = d.Elem()
+	case d.Kind() == reflect.Map && !d.IsNil():
+	default:
+		return errors.Errorf("cannot merge into %T: destination must be a non-nil pointer or map", dst)
+	}
+	s := reflect.ValueOf(src)
+	for s.Kind() == reflect.Ptr {
+		if s.IsNil() {
+			return nil
+		}
+		s = s.Elem()
+	}
+	if !s.IsValid() {
+		return nil
+	}
+	m := &merger{
+		strategy: strategy,
+		copier:   copier{seen: make(map[copyKey]reflect.Value)},
+	}
+	n, err := m.merge(d, s, "")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if d.CanSet() {
+		d.Set(n)
+	}
+	return nil
+}
+
+type merger struct {
+	copier
+	strategy SliceStrategy
+}
+
+// merge returns the result of merging s into d. Maps and pointees in d
+// are updated in place.
+func (m *merger) merge(d, s reflect.Value, path string) (reflect.Value, error) {
+	if s.Kind() == reflect.Interface {
+		if s.IsNil() {
+			return d, nil
+		}
+		s = s.Elem()
+	}
+	if !d.IsValid() {
+		return m.copy(s), nil
+	}
+	if d.Kind() == reflect.Interface {
+		if d.IsNil() {
+			return m.copy(s), nil
+		}
+		return m.merge(d.Elem(), s, path)
+	}
+	if d.Type() != s.Type() {
+		if path == "" {
+			return d, errors.Errorf("cannot merge %s into %s", s.Type(), d.Type())
+		}
+		return d, errors.Errorf("cannot merge %s into %s at %q", s.Type(), d.Type(), path)
+	}
+	switch d.Kind() {
+	case reflect.Map:
+		if s.IsNil() {
+			return d, nil
+		}
+		if d.IsNil() {
+			return m.copy(s), nil
+		}
+		for _, k := range s.MapKeys() {
+			n, err := m.merge(d.MapIndex(k), s.MapIndex(k), joinPath(path, fmt.Sprint(k.Interface())))
+			if err != nil {
+				return d, err
+			}
+			d.SetMapIndex(k, n)
+		}
+		return d, nil
+	case reflect.Struct:
+		n := reflect.New(d.Type()).Elem()
+		n.Set(d)
+		t := d.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" || s.Field(i).IsZero() {
+				continue
+			}
+			f, err := m.merge(n.Field(i), s.Field(i), joinPath(path, t.Field(i).Name))
+			if err != nil {
+				return d, err
+			}
+			n.Field(i).Set(f)
+		}
+		return n, nil
+	case reflect.Ptr:
+		if s.IsNil() {
+			return d, nil
+		}
+		if d.IsNil() {
+			return m.copy(s), nil
+		}
+		n, err := m.merge(d.Elem(), s.Elem(), path)
+		if err != nil {
+			return d, err
+		}
+		d.Elem().Set(n)
+		return d, nil
+	case reflect.Slice:
+		return m.mergeSlice(d, s), nil
+	}
+	return m.copy(s), nil
+}
+
+func (m *merger) mergeSlice(d, s reflect.Value) reflect.Value {
+	if m.strategy == SliceReplace || d.IsNil() {
+		return m.copy(s)
+	}
+	n := reflect.MakeSlice(d.Type(), 0, d.Len()+s.Len())
+	n = reflect.AppendSlice(n, d)
+	for i := 0; i < s.Len(); i++ {
+		elem := s.Index(i)
+		if m.strategy == SliceUnique && containsValue(n, elem) {
+			continue
+		}
+		n = reflect.Append(n, m.copy(elem))
+	}
+	return n
+}
+
+func containsValue(slice, v reflect.Value) bool {
+	for i := 0; i < slice.Len(); i++ {
+		if reflect.DeepEqual(slice.Index(i).Interface(), v.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, elem string) string {
+	if path == "" {
+		return elem
+	}
+	return path + "." + elem
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils"
+)
+
+type deepSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&deepSuite{})
+
+type deepInner struct {
+	Names []string
+	Count int
+}
+
+type deepOuter struct {
+	Name    string
+	Enabled bool
+	Inner   *deepInner
+	Attrs   map[string]interface{}
+	When    time.Time
+	private int
+}
+
+func (*deepSuite) TestDeepCopy(c *gc.C) {
+	orig := &deepOuter{
+		Name:  "x",
+		Inner: &deepInner{Names: []string{"a", "b"}, Count: 2},
+		Attrs: map[string]interface{}{
+			"list": []interface{}{1, "two"},
+			"map":  map[string]interface{}{"k": "v"},
+		},
+		When:    time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC),
+		private: 7,
+	}
+	copied := utils.DeepCopy(orig).(*deepOuter)
+	c.Assert(copied, jc.DeepEquals, orig)
+
+	copied.Inner.Names[0] = "changed"
+	copied.Attrs["list"].([]interface{})[0] = 99
+	copied.Attrs["map"].(map[string]interface{})["k"] = "changed"
+	c.Assert(orig.Inner.Names[0], gc.Equals, "a")
+	c.Assert(orig.Attrs["list"].([]interface{})[0], gc.Equals, 1)
+	c.Assert(orig.Attrs["map"].(map[string]interface{})["k"], gc.Equals, "v")
+
+	c.Assert(utils.DeepCopy(nil), gc.IsNil)
+	c.Assert(utils.DeepCopy(3), gc.Equals, 3)
+}
+
+type deepNode struct {
+	Next *deepNode
+	Val  int
+}
+
+func (*deepSuite) TestDeepCopyCycle(c *gc.C) {
+	n := &deepNode{Val: 1}
+	n.Next = &deepNode{Val: 2, Next: n}
+	copied := utils.DeepCopy(n).(*deepNode)
+	c.Assert(copied, gc.Not(gc.Equals), n)
+	c.Assert(copied.Next.Next, gc.Equals, copied)
+	c.Assert(copied.Next.Val, gc.Equals, 2)
+}
+
+func (*deepSuite) TestDeepMergeMaps(c *gc.C) {
+	dst := map[string]interface{}{
+		"name": "base",
+		"nested": map[string]interface{}{
+			"a": 1,
+			"b": 2,
+		},
+		"list": []interface{}{"x"},
+	}
+	src := map[string]interface{}{
+		"nested": map[string]interface{}{
+			"b": 20,
+			"c": 30,
+		},
+		"list":  []interface{}{"x", "y"},
+		"extra": true,
+		"skip":  nil,
+	}
+	err := utils.DeepMerge(dst, src, utils.SliceUnique)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dst, jc.DeepEquals, map[string]interface{}{
+		"name": "base",
+		"nested": map[string]interface{}{
+			"a": 1,
+			"b": 20,
+			"c": 30,
+		},
+		"list":  []interface{}{"x", "y"},
+		"extra": true,
+	})
+
+	// Values are copied from src.
+	src["nested"].(map[string]interface{})["c"] = 300
+	c.Assert(dst["nested"].(map[string]interface{})["c"], gc.Equals, 30)
+}
+
+func (*deepSuite) TestDeepMergeSliceStrategies(c *gc.C) {
+	for i, test := range []struct {
+		strategy utils.SliceStrategy
+		expect   []string
+	}{
+		{utils.SliceReplace, []string{"b", "c"}},
+		{utils.SliceAppend, []string{"a", "b", "b", "c"}},
+		{utils.SliceUnique, []string{"a", "b", "c"}},
+	} {
+		c.Logf("test %d", i)
+		dst := deepInner{Names: []string{"a", "b"}}
+		err := utils.DeepMerge(&dst, deepInner{Names: []string{"b", "c"}}, test.strategy)
+		c.Assert(err, gc.IsNil)
+		c.Assert(dst.Names, jc.DeepEquals, test.expect)
+	}
+}
+
+func (*deepSuite) TestDeepMergeStructs(c *gc.C) {
+	dst := &deepOuter{
+		Name:  "base",
+		Inner: &deepInner{Names: []string{"a"}, Count: 1},
+	}
+	src := &deepOuter{
+		Enabled: true,
+		Inner:   &deepInner{Count: 5},
+		Attrs:   map[string]interface{}{"k": "v"},
+	}
+	err := utils.DeepMerge(dst, src, utils.SliceReplace)
+	c.Assert(err, gc.IsNil)
+	c.Assert(dst, jc.DeepEquals, &deepOuter{
+		Name:    "base",
+		Enabled: true,
+		Inner:   &deepInner{Names: []string{"a"}, Count: 5},
+		Attrs:   map[string]interface{}{"k": "v"},
+	})
+}
+
+func (*deepSuite) TestDeepMergeTypeMismatch(c *gc.C) {
+	dst := map[string]interface{}{
+		"nested": map[string]interface{}{"a": 1},
+	}
+	src := map[string]interface{}{
+		"nested": map[string]interface{}{"a": "one"},
+	}
+	err := utils.DeepMerge(dst, src, utils.SliceReplace)
+	c.Assert(err, gc.ErrorMatches, `cannot merge string into int at "nested.a"`)
+
+	err = utils.DeepMerge(&deepInner{}, deepOuter{}, utils.SliceReplace)
+	c.Assert(err, gc.ErrorMatches, `cannot merge utils_test.deepOuter into utils_test.deepInner`)
+}
+
+func (*deepSuite) TestDeepMergeInvalidDestination(c *gc.C) {
+	err := utils.DeepMerge(deepInner{}, deepInner{}, utils.SliceReplace)
+	c.Assert(err, gc.ErrorMatches, `cannot merge into utils_test.deepInner: destination must be a non-nil pointer or map`)
+
+	var m map[string]int
+	err = utils.DeepMerge(m, map[string]int{}, utils.SliceReplace)
+	c.Assert(err, gc.ErrorMatches, `cannot merge into map\[string\]int: .*`)
+
+	// A pointer to a nil map is fine.
+	err = utils.DeepMerge(&m, map[string]int{"a": 1}, utils.SliceReplace)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m, jc.DeepEquals, map[string]int{"a": 1})
+}
@@ -0,0 +1,385 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package dqueue implements a crash-safe FIFO queue stored on disk.
+//
+// Messages are appended to a write-ahead log (see package wal), so a
+// message torn by a crash is detected and discarded when the queue is
+// reopened. Consumption is at-least-once:
+// a popped message must be acknowledged, and messages that were popped
+// but not acknowledged before the queue was closed are delivered again
+// when it is reopened. Segments are removed once all of their messages
+// have been acknowledged, or earlier if they exceed the retention
+// limits.
+package dqueue
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+
+	"github.com/juju/utils"
+	"github.com/juju/utils/clock"
+	"github.com/juju/utils/wal"
+)
+
+var logger = loggo.GetLogger("juju.utils.dqueue")
+
+// ErrEmpty is returned by Pop when there are no messages to deliver.
+var ErrEmpty = errors.New("queue empty")
+
+// SyncPolicy specifies when pushed messages are flushed to stable
+// storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways flushes after every push.
+	SyncAlways SyncPolicy = iota
+
+	// SyncBatch flushes after every Options.SyncEvery pushes.
+	SyncBatch
+
+	// SyncNever leaves flushing to the operating system and to
+	// explicit calls to Queue.Sync.
+	SyncNever
+)
+
+const ackFile = "ack"
+
+// Options holds the options for a queue.
+type Options struct {
+	// SegmentSize holds the size in bytes beyond which a new segment
+	// file is started. If zero, 16MiB is used.
+	SegmentSize int64
+
+	// Sync holds the sync policy.
+	Sync SyncPolicy
+
+	// SyncEvery holds the number of pushes between flushes when Sync
+	// is SyncBatch. If zero, 100 is used.
+	SyncEvery int
+
+	// MaxSize, if non-zero, limits the total size in bytes of the
+	// segment files. When it is exceeded, the oldest segments are
+	// discarded, including any unacknowledged messages they hold.
+	MaxSize int64
+
+	// MaxAge, if non-zero, limits how long a segment is kept after it
+	// was last written to. Older segments are discarded, including any
+	// unacknowledged messages they hold.
+	MaxAge time.Duration
+
+	// Clock is used to compare segment ages with MaxAge. If nil,
+	// clock.WallClock is used.
+	Clock clock.Clock
+}
+
+// ID identifies a message by its position in the queue.
+type ID struct {
+	Segment uint64
+	Offset  int64
+}
+
+// String returns the ID in the form "segment:offset".
+func (id ID) String() string {
+	return fmt.Sprintf("%d:%d", id.Segment, id.Offset)
+}
+
+// Message holds a message popped from the queue.
+type Message struct {
+	ID   ID
+	Data []byte
+}
+
+type inflight struct {
+	id    ID
+	next  ID
+	acked bool
+}
+
+// Queue is a persistent FIFO queue. Its methods may be called
+// concurrently, but a queue directory must only be opened once at a
+// time.
+type Queue struct {
+	dir  string
+	opts Options
+	log  *wal.Log
+
+	mu     sync.Mutex
+	closed bool
+	count  int
+
+	r *wal.Reader
+
+	committed ID
+	inflight  []*inflight
+}
+
+// Open opens the queue stored in dir, creating it if necessary.
+func Open(dir string, opts Options) (*Queue, error) {
+	if opts.Clock == nil {
+		opts.Clock = clock.WallClock
+	}
+	log, err := wal.Open(dir, wal.Options{
+		SegmentSize: opts.SegmentSize,
+		Sync:        wal.SyncPolicy(opts.Sync),
+		SyncEvery:   opts.SyncEvery,
+	})
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot open queue")
+	}
+	q := &Queue{dir: dir, opts: opts, log: log}
+	if err := q.recover(); err != nil {
+		log.Close()
+		return nil, errors.Annotate(err, "cannot open queue")
+	}
+	return q, nil
+}
+
+// recover loads the acknowledgement state of the queue and counts the
+// messages that remain to be delivered.
+func (q *Queue) recover() error {
+	q.committed = ID(q.log.Start())
+	if err := q.readAck(); err != nil {
+		return errors.Trace(err)
+	}
+	err := q.log.Replay(wal.Position(q.committed), func(wal.Position, []byte) error {
+		q.count++
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	q.r = q.log.NewReader(wal.Position(q.committed))
+	if err := q.removeAcked(); err != nil {
+		return errors.Trace(err)
+	}
+	return q.enforceRetention()
+}
+
+func (q *Queue) readAck() error {
+	data, err := ioutil.ReadFile(filepath.Join(q.dir, ackFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return errors.Errorf("acknowledgement file not valid")
+	}
+	seq, err1 := strconv.ParseUint(fields[0], 10, 64)
+	offset, err2 := strconv.ParseInt(fields[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return errors.Errorf("acknowledgement file not valid")
+	}
+	if seq >= q.committed.Segment {
+		q.committed = ID{Segment: seq, Offset: offset}
+	}
+	return nil
+}
+
+func (q *Queue) writeAck() error {
+	data := fmt.Sprintf("%d %d\n", q.committed.Segment, q.committed.Offset)
+	return utils.AtomicWriteFile(filepath.Join(q.dir, ackFile), []byte(data), 0644)
+}
+
+// Push appends a message to the queue. Once the message has been
+// appended, Push succeeds even if discarding segments beyond the
+// retention limits fails; that is tried again by the next Push.
+func (q *Queue) Push(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("queue closed")
+	}
+	if _, err := q.log.Append(data); err != nil {
+		return errors.Annotate(err, "cannot write message")
+	}
+	q.count++
+	if err := q.enforceRetention(); err != nil {
+		logger.Warningf("cannot enforce retention limits: %v", err)
+	}
+	return nil
+}
+
+// Sync flushes pushed messages to stable storage.
+func (q *Queue) Sync() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("queue closed")
+	}
+	return errors.Annotate(q.log.Sync(), "cannot sync queue")
+}
+
+// Pop returns the next message to be delivered, or ErrEmpty if there
+// is none. The message must be acknowledged with Ack once it has been
+// processed; otherwise it will be delivered again after the queue is
+// reopened.
+func (q *Queue) Pop() (Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return Message{}, errors.New("queue closed")
+	}
+	pos, data, err := q.r.Next()
+	if err == io.EOF {
+		return Message{}, ErrEmpty
+	}
+	if err != nil {
+		return Message{}, errors.Annotate(err, "cannot read queue")
+	}
+	id := ID(pos)
+	q.inflight = append(q.inflight, &inflight{id: id, next: ID(q.r.Position())})
+	return Message{ID: id, Data: data}, nil
+}
+
+// Ack acknowledges the message with the given ID, which must have been
+// returned by Pop. Messages may be acknowledged in any order.
+func (q *Queue) Ack(id ID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("queue closed")
+	}
+	var found *inflight
+	for _, m := range q.inflight {
+		if m.id == id && !m.acked {
+			found = m
+			break
+		}
+	}
+	if found == nil {
+		return errors.NotFoundf("unacknowledged message %v", id)
+	}
+	found.acked = true
+	q.count--
+	advanced := false
+	for len(q.inflight) > 0 && q.inflight[0].acked {
+		q.committed = q.inflight[0].next
+		q.inflight = q.inflight[1:]
+		advanced = true
+	}
+	if !advanced {
+		return nil
+	}
+	if err := q.writeAck(); err != nil {
+		return errors.Annotate(err, "cannot record acknowledgement")
+	}
+	return errors.Trace(q.removeAcked())
+}
+
+// removeAcked removes the segments before the committed position.
+func (q *Queue) removeAcked() error {
+	return q.log.TruncateBefore(wal.Position(q.committed))
+}
+
+// enforceRetention discards the oldest segments, other than the one
+// being written, while they exceed the retention limits.
+func (q *Queue) enforceRetention() error {
+	if q.opts.MaxSize <= 0 && q.opts.MaxAge <= 0 {
+		return nil
+	}
+	for {
+		segments, err := q.log.Segments()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if len(segments) < 2 || !q.exceedsRetention(segments) {
+			return nil
+		}
+		if err := q.discard(segments[0].Segment, segments[1].Segment); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+func (q *Queue) exceedsRetention(segments []wal.SegmentInfo) bool {
+	if q.opts.MaxAge > 0 && q.opts.Clock.Now().Sub(segments[0].ModTime) > q.opts.MaxAge {
+		return true
+	}
+	if q.opts.MaxSize > 0 {
+		var total int64
+		for _, s := range segments {
+			total += s.Size
+		}
+		return total > q.opts.MaxSize
+	}
+	return false
+}
+
+// discard removes the oldest segment, seq, whether or not its messages
+// have been acknowledged. The segment after it is next.
+func (q *Queue) discard(seq, next uint64) error {
+	lost := 0
+	if q.committed.Segment == seq {
+		r := q.log.NewReader(wal.Position(q.committed))
+		for {
+			pos, _, err := r.Next()
+			if err != nil || pos.Segment != seq {
+				break
+			}
+			lost++
+		}
+		r.Close()
+		// Messages in flight are already counted above.
+		for _, m := range q.inflight {
+			if m.id.Segment == seq && m.acked {
+				lost--
+			}
+		}
+	}
+	if lost > 0 {
+		logger.Warningf("retention limit reached: discarding %d unacknowledged messages", lost)
+	}
+	q.count -= lost
+	inflight := q.inflight[:0]
+	for _, m := range q.inflight {
+		if m.id.Segment != seq {
+			inflight = append(inflight, m)
+		}
+	}
+	q.inflight = inflight
+	if q.committed.Segment == seq {
+		q.committed = ID{Segment: next}
+		if err := q.writeAck(); err != nil {
+			return errors.Annotate(err, "cannot record acknowledgement")
+		}
+	}
+	// A reader positioned in the discarded segment moves on to the
+	// start of the log by itself.
+	return errors.Trace(q.log.TruncateBefore(wal.Position{Segment: next}))
+}
+
+// Len returns the number of messages that have not been acknowledged,
+// including those that have been popped.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Close flushes and closes the queue.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	if q.r != nil {
+		q.r.Close()
+	}
+	return errors.Trace(q.log.Close())
+}
@@ -0,0 +1,218 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package dqueue_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/dqueue"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type dqueueSuite struct {
+	testing.IsolationSuite
+	dir string
+}
+
+var _ = gc.Suite(&dqueueSuite{})
+
+func (s *dqueueSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+}
+
+func (s *dqueueSuite) open(c *gc.C, opts dqueue.Options) *dqueue.Queue {
+	q, err := dqueue.Open(s.dir, opts)
+	c.Assert(err, gc.IsNil)
+	return q
+}
+
+func push(c *gc.C, q *dqueue.Queue, msgs ...string) {
+	for _, m := range msgs {
+		c.Assert(q.Push([]byte(m)), gc.IsNil)
+	}
+}
+
+func pop(c *gc.C, q *dqueue.Queue) dqueue.Message {
+	m, err := q.Pop()
+	c.Assert(err, gc.IsNil)
+	return m
+}
+
+func (s *dqueueSuite) segments(c *gc.C) []string {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*.wal"))
+	c.Assert(err, gc.IsNil)
+	return names
+}
+
+func (s *dqueueSuite) TestFIFO(c *gc.C) {
+	q := s.open(c, dqueue.Options{})
+	defer q.Close()
+	_, err := q.Pop()
+	c.Assert(err, gc.Equals, dqueue.ErrEmpty)
+
+	push(c, q, "one", "two")
+	c.Assert(q.Len(), gc.Equals, 2)
+	m := pop(c, q)
+	c.Assert(string(m.Data), gc.Equals, "one")
+	c.Assert(q.Ack(m.ID), gc.IsNil)
+	c.Assert(q.Len(), gc.Equals, 1)
+
+	push(c, q, "three")
+	c.Assert(string(pop(c, q).Data), gc.Equals, "two")
+	c.Assert(string(pop(c, q).Data), gc.Equals, "three")
+	_, err = q.Pop()
+	c.Assert(err, gc.Equals, dqueue.ErrEmpty)
+}
+
+func (s *dqueueSuite) TestRedeliveryAfterReopen(c *gc.C) {
+	q := s.open(c, dqueue.Options{})
+	push(c, q, "a", "b", "c")
+	a := pop(c, q)
+	b := pop(c, q)
+	// Acknowledge out of order: only a is committed once b is.
+	c.Assert(q.Ack(b.ID), gc.IsNil)
+	c.Assert(q.Ack(b.ID), jc.Satisfies, errors.IsNotFound)
+	c.Assert(q.Close(), gc.IsNil)
+
+	q = s.open(c, dqueue.Options{})
+	c.Assert(q.Len(), gc.Equals, 3)
+	c.Assert(string(pop(c, q).Data), gc.Equals, "a")
+	c.Assert(q.Close(), gc.IsNil)
+
+	q = s.open(c, dqueue.Options{})
+	m := pop(c, q)
+	c.Assert(m.ID, gc.Equals, a.ID)
+	c.Assert(q.Ack(m.ID), gc.IsNil)
+	c.Assert(q.Close(), gc.IsNil)
+
+	q = s.open(c, dqueue.Options{})
+	defer q.Close()
+	c.Assert(q.Len(), gc.Equals, 2)
+	c.Assert(string(pop(c, q).Data), gc.Equals, "b")
+	c.Assert(string(pop(c, q).Data), gc.Equals, "c")
+}
+
+func (s *dqueueSuite) TestTornWrite(c *gc.C) {
+	q := s.open(c, dqueue.Options{})
+	push(c, q, "complete")
+	c.Assert(q.Close(), gc.IsNil)
+
+	segs := s.segments(c)
+	c.Assert(segs, gc.HasLen, 1)
+	f, err := os.OpenFile(segs[0], os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, gc.IsNil)
+	_, err = f.Write([]byte{100, 0, 0, 0, 1, 2})
+	c.Assert(err, gc.IsNil)
+	f.Close()
+
+	q = s.open(c, dqueue.Options{})
+	defer q.Close()
+	c.Assert(q.Len(), gc.Equals, 1)
+	push(c, q, "after")
+	c.Assert(string(pop(c, q).Data), gc.Equals, "complete")
+	c.Assert(string(pop(c, q).Data), gc.Equals, "after")
+}
+
+func (s *dqueueSuite) TestSegments(c *gc.C) {
+	q := s.open(c, dqueue.Options{SegmentSize: 64, Sync: dqueue.SyncNever})
+	defer q.Close()
+	for i := 0; i < 10; i++ {
+		push(c, q, fmt.Sprintf("message %d", i))
+	}
+	c.Assert(len(s.segments(c)) > 2, jc.IsTrue)
+	for i := 0; i < 10; i++ {
+		m := pop(c, q)
+		c.Assert(string(m.Data), gc.Equals, fmt.Sprintf("message %d", i))
+		c.Assert(q.Ack(m.ID), gc.IsNil)
+	}
+	// Fully acknowledged segments are removed.
+	c.Assert(s.segments(c), gc.HasLen, 1)
+	c.Assert(q.Len(), gc.Equals, 0)
+}
+
+func (s *dqueueSuite) TestMaxSize(c *gc.C) {
+	q := s.open(c, dqueue.Options{SegmentSize: 64, MaxSize: 128})
+	defer q.Close()
+	for i := 0; i < 20; i++ {
+		push(c, q, fmt.Sprintf("message %02d", i))
+	}
+	c.Assert(q.Len() < 20, jc.IsTrue)
+	c.Assert(len(s.segments(c)) <= 3, jc.IsTrue)
+	// The newest messages survive.
+	var last string
+	for {
+		m, err := q.Pop()
+		if err == dqueue.ErrEmpty {
+			break
+		}
+		c.Assert(err, gc.IsNil)
+		last = string(m.Data)
+	}
+	c.Assert(last, gc.Equals, "message 19")
+}
+
+func (s *dqueueSuite) TestMaxAge(c *gc.C) {
+	q := s.open(c, dqueue.Options{SegmentSize: 32, MaxAge: time.Hour})
+	push(c, q, "old message 1", "old message 2")
+	c.Assert(q.Close(), gc.IsNil)
+	old := time.Now().Add(-2 * time.Hour)
+	for _, seg := range s.segments(c) {
+		c.Assert(os.Chtimes(seg, old, old), gc.IsNil)
+	}
+
+	q = s.open(c, dqueue.Options{SegmentSize: 32, MaxAge: time.Hour})
+	defer q.Close()
+	push(c, q, "new message 1")
+	c.Assert(q.Len(), gc.Equals, 1)
+	c.Assert(string(pop(c, q).Data), gc.Equals, "new message 1")
+}
+
+func (s *dqueueSuite) TestMaxAgeClock(c *gc.C) {
+	q := s.open(c, dqueue.Options{SegmentSize: 32, MaxAge: time.Hour})
+	push(c, q, "old message 1", "old message 2")
+	c.Assert(q.Close(), gc.IsNil)
+
+	clock := testclock.New(time.Now().Add(2 * time.Hour))
+	q = s.open(c, dqueue.Options{SegmentSize: 32, MaxAge: time.Hour, Clock: clock})
+	defer q.Close()
+	push(c, q, "new message 1")
+	c.Assert(q.Len(), gc.Equals, 1)
+	c.Assert(string(pop(c, q).Data), gc.Equals, "new message 1")
+}
+
+func (s *dqueueSuite) TestPushSucceedsWhenRetentionFails(c *gc.C) {
+	q := s.open(c, dqueue.Options{SegmentSize: 64, MaxSize: 128})
+	defer q.Close()
+	// Recording the new acknowledgement position fails while the ack
+	// file is replaced by a non-empty directory.
+	err := os.MkdirAll(filepath.Join(s.dir, "ack", "blocked"), 0755)
+	c.Assert(err, gc.IsNil)
+	for i := 0; i < 20; i++ {
+		err := q.Push([]byte(fmt.Sprintf("message %02d", i)))
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(q.Len() > 0, jc.IsTrue)
+}
+
+func (s *dqueueSuite) TestSync(c *gc.C) {
+	q := s.open(c, dqueue.Options{Sync: dqueue.SyncBatch, SyncEvery: 2})
+	push(c, q, "a", "b", "c")
+	c.Assert(q.Sync(), gc.IsNil)
+	c.Assert(q.Close(), gc.IsNil)
+	c.Assert(q.Push([]byte("d")), gc.ErrorMatches, "queue closed")
+
+	data, err := ioutil.ReadFile(s.segments(c)[0])
+	c.Assert(err, gc.IsNil)
+	c.Assert(data, gc.HasLen, 3*(8+1))
+}
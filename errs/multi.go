@@ -0,0 +1,129 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package errs provides error types for aggregating the errors of
+// several operations.
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Multi collects the errors of several operations. It is safe to add
+// errors concurrently. The zero value is an empty collection ready for
+// use.
+//
+// Multi supports errors.Is and errors.As: they succeed when any of the
+// collected errors matches.
+type Multi struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// ItemError associates an error with the item on which the operation
+// that produced it was acting.
+type ItemError struct {
+	Item string
+	Err  error
+}
+
+// Error implements error.
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Item, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// Add adds err to the collection. Nil errors are ignored.
+func (m *Multi) Add(err error) {
+	if err == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errs = append(m.errs, err)
+}
+
+// AddItem adds err to the collection as an *ItemError recording the
+// given item. Nil errors are ignored.
+func (m *Multi) AddItem(item string, err error) {
+	if err == nil {
+		return
+	}
+	m.Add(&ItemError{Item: item, Err: err})
+}
+
+// Errors returns the collected errors in the order in which they were
+// added.
+func (m *Multi) Errors() []error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]error(nil), m.errs...)
+}
+
+// Len returns the number of collected errors.
+func (m *Multi) Len() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.errs)
+}
+
+// ErrorOrNil returns m as an error, or nil if no errors have been
+// collected. It should be used when returning a Multi from a function
+// so that callers can check the result against nil.
+func (m *Multi) ErrorOrNil() error {
+	if m.Len() == 0 {
+		return nil
+	}
+	return m
+}
+
+// Error implements error. A single error is reported as is; several
+// are listed one per line.
+func (m *Multi) Error() string {
+	errs := m.Errors()
+	switch len(errs) {
+	case 0:
+		return "no error"
+	case 1:
+		return errs[0].Error()
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = "\n\t" + strings.Replace(err.Error(), "\n", "\n\t", -1)
+	}
+	return fmt.Sprintf("%d errors:%s", len(errs), strings.Join(msgs, ""))
+}
+
+// Is reports whether any of the collected errors matches target.
+func (m *Multi) Is(target error) bool {
+	for _, err := range m.Errors() {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first collected error that matches target, as defined
+// by errors.As, and if so sets target to that error and returns true.
+func (m *Multi) As(target interface{}) bool {
+	for _, err := range m.Errors() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
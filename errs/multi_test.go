@@ -0,0 +1,98 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package errs_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/errs"
+)
+
+type multiSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&multiSuite{})
+
+func (*multiSuite) TestEmpty(c *gc.C) {
+	var m errs.Multi
+	c.Assert(m.Len(), gc.Equals, 0)
+	c.Assert(m.ErrorOrNil(), gc.IsNil)
+	m.Add(nil)
+	m.AddItem("x", nil)
+	c.Assert(m.ErrorOrNil(), gc.IsNil)
+
+	var nilMulti *errs.Multi
+	c.Assert(nilMulti.ErrorOrNil(), gc.IsNil)
+	c.Assert(nilMulti.Errors(), gc.HasLen, 0)
+}
+
+func (*multiSuite) TestSingle(c *gc.C) {
+	var m errs.Multi
+	m.Add(errors.New("boom"))
+	c.Assert(m.ErrorOrNil(), gc.ErrorMatches, "boom")
+}
+
+func (*multiSuite) TestFormat(c *gc.C) {
+	var m errs.Multi
+	m.Add(errors.New("first"))
+	m.AddItem("machine-0", errors.New("second\nline"))
+	c.Assert(m.Len(), gc.Equals, 2)
+	c.Assert(m.Error(), gc.Equals, "2 errors:\n\tfirst\n\tmachine-0: second\n\tline")
+	c.Assert(m.Errors(), gc.HasLen, 2)
+}
+
+func (*multiSuite) TestItemError(c *gc.C) {
+	var m errs.Multi
+	m.AddItem("machine-0", os.ErrNotExist)
+	var itemErr *errs.ItemError
+	c.Assert(errors.As(m.ErrorOrNil(), &itemErr), jc.IsTrue)
+	c.Assert(itemErr.Item, gc.Equals, "machine-0")
+	c.Assert(itemErr.Err, gc.Equals, os.ErrNotExist)
+}
+
+type codeError int
+
+func (e codeError) Error() string {
+	return fmt.Sprintf("code %d", int(e))
+}
+
+func (*multiSuite) TestIsAs(c *gc.C) {
+	var m errs.Multi
+	m.Add(errors.New("other"))
+	m.Add(fmt.Errorf("wrapped: %w", os.ErrPermission))
+	m.AddItem("x", codeError(3))
+	err := m.ErrorOrNil()
+
+	c.Assert(errors.Is(err, os.ErrPermission), jc.IsTrue)
+	c.Assert(errors.Is(err, os.ErrNotExist), jc.IsFalse)
+
+	var code codeError
+	c.Assert(errors.As(err, &code), jc.IsTrue)
+	c.Assert(code, gc.Equals, codeError(3))
+
+	var pathErr *os.PathError
+	c.Assert(errors.As(err, &pathErr), jc.IsFalse)
+}
+
+func (*multiSuite) TestConcurrentAdd(c *gc.C) {
+	var m errs.Multi
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.AddItem(fmt.Sprint(i), errors.New("failed"))
+		}(i)
+	}
+	wg.Wait()
+	c.Assert(m.Len(), gc.Equals, 20)
+}
@@ -0,0 +1,42 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/utils/clock"
+)
+
+// activityMonitor is an io.Writer that records when output was last
+// written to it, for RunParams.InactivityTimeout.
+type activityMonitor struct {
+	clock clock.Clock
+	mu    sync.Mutex
+	last  time.Time
+}
+
+func newActivityMonitor(clk clock.Clock) *activityMonitor {
+	return &activityMonitor{
+		clock: clk,
+		last:  clk.Now(),
+	}
+}
+
+// Write implements io.Writer.
+func (m *activityMonitor) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = m.clock.Now()
+	return len(p), nil
+}
+
+// idleFor returns how long it is since output was last written, or
+// since the monitor was created if none has been.
+func (m *activityMonitor) idleFor() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clock.Now().Sub(m.last)
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type argsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&argsSuite{})
+
+func (*argsSuite) TestArgsNotInterpreted(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args: []string{"/usr/bin/printf", "%s|", "it's", "$HOME", "a b", "; rm -rf /"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(string(resp.Stdout), gc.Equals, "it's|$HOME|a b|; rm -rf /|")
+}
+
+func (*argsSuite) TestArgsWithEnvironmentAndDir(c *gc.C) {
+	dir := c.MkDir()
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:        []string{"/bin/sh", "-c", "echo $GREETING; pwd; exit 4"},
+		Environment: []string{"GREETING=hello"},
+		WorkingDir:  dir,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Code, gc.Equals, 4)
+	c.Assert(string(resp.Stdout), gc.Equals, "hello\n"+dir+"\n")
+}
+
+func (*argsSuite) TestArgsStdin(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:  []string{"/usr/bin/tr", "a-z", "A-Z"},
+		Stdin: strings.NewReader("shout\n"),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "SHOUT\n")
+}
+
+func (*argsSuite) TestArgsExpandVariables(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:            []string{"/bin/echo", "${NAME}"},
+		Environment:     []string{"NAME=value with spaces"},
+		ExpandVariables: true,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "value with spaces\n")
+}
+
+func (*argsSuite) TestArgsWithCommands(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Args:     []string{"true"},
+		Commands: "true",
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (*argsSuite) TestArgsNotFound(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Args: []string{"no-such-program-anywhere"},
+	})
+	c.Assert(err, gc.ErrorMatches, `exec: "no-such-program-anywhere": executable file not found in \$PATH`)
+}
+
+func (s *argsSuite) TestShellFallback(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{Commands: "true"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Shell, gc.Equals, exec.Bash.Path)
+
+	s.PatchValue(&exec.Bash.Path, "/no/such/bash")
+	resp, err = exec.RunCommands(exec.RunParams{Commands: "echo hello"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Shell, gc.Equals, "/bin/sh")
+	c.Assert(string(resp.Stdout), gc.Equals, "hello\n")
+
+	_, err = exec.RunCommands(exec.RunParams{
+		Commands:    "true",
+		RequireBash: true,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `bash at "/no/such/bash" not found`)
+}
+
+func (*argsSuite) TestShellReported(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:    "true",
+		Interpreter: &exec.Sh,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Shell, gc.Equals, "/bin/sh")
+
+	resp, err = exec.RunCommands(exec.RunParams{
+		Args: []string{"/bin/true"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Shell, gc.Equals, "")
+}
+
+func (*argsSuite) TestDefaultRunner(c *gc.C) {
+	resp, err := exec.DefaultRunner.RunCommands(exec.RunParams{
+		Args: []string{"/bin/echo", "hello"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "hello\n")
+}
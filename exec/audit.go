@@ -0,0 +1,161 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// AuditRecord describes a command run by the package, for an Auditor.
+type AuditRecord struct {
+	// Commands and Args hold the command as given in RunParams.
+	Commands string   `json:"commands,omitempty"`
+	Args     []string `json:"args,omitempty"`
+
+	// User holds the user that the command ran as.
+	User       string `json:"user"`
+	WorkingDir string `json:"working-dir,omitempty"`
+
+	// PID holds the process ID, if the command was started.
+	PID int `json:"pid,omitempty"`
+
+	// Start and End hold when the command started and finished. End
+	// is zero for a command started with Detach.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Code holds the exit code of the command.
+	Code int `json:"code"`
+
+	// Error holds the text of any error from starting or waiting for
+	// the command.
+	Error string `json:"error,omitempty"`
+
+	// Detached reports that the command was started with Detach, so
+	// that its completion is not recorded.
+	Detached bool `json:"detached,omitempty"`
+}
+
+// Auditor records the commands run by the package. See SetAuditor.
+type Auditor interface {
+	Audit(record AuditRecord) error
+}
+
+var (
+	auditorMutex sync.Mutex
+	auditor      Auditor
+)
+
+// SetAuditor sets the auditor that is given a record of every command
+// run by the package once it has finished, or has failed to start,
+// and returns the previous one. Commands started with Detach are
+// recorded once started. A nil auditor disables auditing. Errors from
+// the auditor are logged.
+func SetAuditor(a Auditor) Auditor {
+	auditorMutex.Lock()
+	defer auditorMutex.Unlock()
+	previous := auditor
+	auditor = a
+	return previous
+}
+
+// audit records the command with the result and error from waiting for
+// it, or the error from starting it.
+func (r *RunParams) audit(result *ExecResponse, err error) {
+	auditorMutex.Lock()
+	a := auditor
+	auditorMutex.Unlock()
+	if a == nil {
+		return
+	}
+	now := r.getClock().Now()
+	record := AuditRecord{
+		Commands:   r.redact(r.Commands),
+		Args:       r.redactArgs(r.Args),
+		User:       r.auditUser(),
+		WorkingDir: r.WorkingDir,
+		Start:      r.started,
+		End:        now,
+		Detached:   r.Detach,
+	}
+	if record.Start.IsZero() {
+		record.Start = now
+	}
+	if r.Detach {
+		record.End = time.Time{}
+	}
+	if p := r.Process(); p != nil {
+		record.PID = p.Pid
+	}
+	if result != nil {
+		record.Code = result.Code
+	}
+	if err != nil {
+		record.Error = r.redact(err.Error())
+	}
+	if err := a.Audit(record); err != nil {
+		logger.Errorf("cannot audit command: %v", err)
+	}
+}
+
+// auditUser returns the name of the user that the command runs as.
+func (r *RunParams) auditUser() string {
+	switch {
+	case r.User != "":
+		return r.User
+	case r.Elevate:
+		return "root"
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// FileAuditor is an Auditor that appends each record to a file as a
+// line of JSON.
+type FileAuditor struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ Auditor = (*FileAuditor)(nil)
+
+// NewFileAuditor returns an auditor that appends to the file at path,
+// creating it, readable only by its owner, if it does not exist.
+func NewFileAuditor(path string) (*FileAuditor, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot open audit log")
+	}
+	return &FileAuditor{file: f}, nil
+}
+
+// Audit implements Auditor. Each record is written with a single
+// write, so that records from several processes do not interleave.
+func (a *FileAuditor) Audit(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		return errors.Annotate(err, "cannot write audit log")
+	}
+	return nil
+}
+
+// Close closes the audit log.
+func (a *FileAuditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
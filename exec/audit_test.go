@@ -0,0 +1,94 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type auditSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&auditSuite{})
+
+func readAuditLog(c *gc.C, path string) []exec.AuditRecord {
+	f, err := os.Open(path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Close()
+	var records []exec.AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record exec.AuditRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		c.Assert(err, jc.ErrorIsNil)
+		records = append(records, record)
+	}
+	c.Assert(scanner.Err(), jc.ErrorIsNil)
+	return records
+}
+
+func (*auditSuite) TestFileAuditor(c *gc.C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "audit.log")
+	a, err := exec.NewFileAuditor(path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer exec.SetAuditor(exec.SetAuditor(a))
+
+	clk := testclock.New(time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC))
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:   "exit 3",
+		WorkingDir: dir,
+		Clock:      clk,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = exec.RunCommands(exec.RunParams{
+		Args:  []string{"/no/such/program", "arg"},
+		Clock: clk,
+	})
+	c.Assert(err, gc.NotNil)
+	pid, err := exec.StartDetached(exec.RunParams{
+		Commands: "true",
+		Clock:    clk,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(a.Close(), jc.ErrorIsNil)
+
+	info, err := os.Stat(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+
+	records := readAuditLog(c, path)
+	c.Assert(records, gc.HasLen, 3)
+	c.Assert(records[0].Commands, gc.Equals, "exit 3")
+	c.Assert(records[0].Code, gc.Equals, 3)
+	c.Assert(records[0].WorkingDir, gc.Equals, dir)
+	c.Assert(records[0].PID, gc.Equals, resp.PID)
+	c.Assert(records[0].User, gc.Not(gc.Equals), "")
+	c.Assert(records[0].Start.Equal(clk.Now()), jc.IsTrue)
+	c.Assert(records[0].End.Equal(clk.Now()), jc.IsTrue)
+	c.Assert(records[0].Error, gc.Equals, "")
+
+	c.Assert(records[1].Args, jc.DeepEquals, []string{"/no/such/program", "arg"})
+	c.Assert(records[1].PID, gc.Equals, 0)
+	c.Assert(records[1].Error, gc.Matches, ".*no such file or directory")
+
+	c.Assert(records[2].Detached, jc.IsTrue)
+	c.Assert(records[2].User, gc.Equals, records[0].User)
+	c.Assert(records[2].PID, gc.Equals, pid)
+	c.Assert(records[2].End.IsZero(), jc.IsTrue)
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/errs"
+	"github.com/juju/utils/parallel"
+)
+
+// BatchMode determines how RunAll deals with commands that fail.
+type BatchMode int
+
+const (
+	// CollectErrors runs every command regardless of the others
+	// failing and reports all the failures.
+	CollectErrors BatchMode = iota
+
+	// FailFast stops the batch at the first failure: commands that
+	// are still running are killed, commands not yet started are not
+	// run, and only the first failure is reported.
+	FailFast
+)
+
+// RunAll runs each of the commands in runs, as RunCommands would, with
+// at most concurrency of them running at once, and returns their
+// responses in the same order as runs. A command fails if it cannot
+// be run or exits with a non-zero code, which is reported as an
+// *ExitError; failures are reported as an *errs.Multi holding an
+// *errs.ItemError for each, whose Item is "command <index>". The
+// response of a command that was not run is nil.
+func RunAll(runs []RunParams, concurrency int, mode BatchMode) ([]*ExecResponse, error) {
+	return RunAllContext(context.Background(), runs, concurrency, mode)
+}
+
+// RunAllContext is like RunAll, but commands still running when ctx
+// is done are killed and no more are started. The failure of each
+// command that is not started is ctx.Err(); in FailFast mode, that is
+// returned if no command failed.
+func RunAllContext(ctx context.Context, runs []RunParams, concurrency int, mode BatchMode) ([]*ExecResponse, error) {
+	if concurrency < 1 {
+		return nil, errors.NotValidf("concurrency %d", concurrency)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses := make([]*ExecResponse, len(runs))
+	failures := make([]error, len(runs))
+	first := make(chan int, 1)
+	pool := parallel.NewRun(concurrency)
+	for i := range runs {
+		i := i
+		pool.Do(func() error {
+			if err := ctx.Err(); err != nil {
+				failures[i] = err
+				return nil
+			}
+			resp, err := RunCommandsContext(ctx, runs[i])
+			if err == nil && resp.Code != 0 {
+				err = newExitError(resp)
+			}
+			responses[i] = resp
+			if err == nil {
+				return nil
+			}
+			failures[i] = err
+			if mode == FailFast {
+				select {
+				case first <- i:
+					cancel()
+				default:
+				}
+			}
+			return nil
+		})
+	}
+	pool.Wait()
+
+	var result errs.Multi
+	if mode == FailFast {
+		select {
+		case i := <-first:
+			result.AddItem(commandItem(i), failures[i])
+		default:
+			// No command failed, but some may not have been
+			// started because ctx was done.
+			for _, err := range failures {
+				if err != nil {
+					return responses, err
+				}
+			}
+		}
+		return responses, result.ErrorOrNil()
+	}
+	for i, err := range failures {
+		result.AddItem(commandItem(i), err)
+	}
+	return responses, result.ErrorOrNil()
+}
+
+func commandItem(i int) string {
+	return fmt.Sprintf("command %d", i)
+}
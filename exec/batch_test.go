@@ -0,0 +1,103 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/errs"
+	"github.com/juju/utils/exec"
+)
+
+type batchSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&batchSuite{})
+
+func (*batchSuite) TestRunAllInOrder(c *gc.C) {
+	var runs []exec.RunParams
+	for i := 0; i < 6; i++ {
+		// Later commands finish first.
+		runs = append(runs, exec.RunParams{
+			Commands: "sleep 0." + strconv.Itoa(6-i) + "; echo " + strconv.Itoa(i),
+		})
+	}
+	start := time.Now()
+	responses, err := exec.RunAll(runs, 3, exec.CollectErrors)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(time.Since(start) < 1500*time.Millisecond, jc.IsTrue)
+	c.Assert(responses, gc.HasLen, 6)
+	for i, resp := range responses {
+		c.Check(string(resp.Stdout), gc.Equals, strconv.Itoa(i)+"\n")
+	}
+}
+
+func (*batchSuite) TestCollectErrors(c *gc.C) {
+	responses, err := exec.RunAll([]exec.RunParams{
+		{Commands: "exit 3"},
+		{Commands: "echo ok"},
+		{Args: []string{"/no/such/program"}},
+	}, 2, exec.CollectErrors)
+	c.Assert(responses, gc.HasLen, 3)
+	c.Assert(responses[0].Code, gc.Equals, 3)
+	c.Assert(string(responses[1].Stdout), gc.Equals, "ok\n")
+	c.Assert(responses[2], gc.IsNil)
+
+	multi, ok := err.(*errs.Multi)
+	c.Assert(ok, jc.IsTrue)
+	failures := multi.Errors()
+	c.Assert(failures, gc.HasLen, 2)
+	c.Assert(failures[0], gc.ErrorMatches, "command 0: exited with code 3")
+	c.Assert(failures[1], gc.ErrorMatches, "command 2: .*no such file or directory")
+}
+
+func (*batchSuite) TestFailFast(c *gc.C) {
+	start := time.Now()
+	responses, err := exec.RunAll([]exec.RunParams{
+		{Commands: "exec sleep 10"},
+		{Commands: "sleep 0.1; exit 4"},
+		{Commands: "echo never"},
+	}, 2, exec.FailFast)
+	c.Assert(err, gc.ErrorMatches, "command 1: exited with code 4")
+	c.Assert(time.Since(start) < 5*time.Second, jc.IsTrue)
+	c.Assert(responses[1].Code, gc.Equals, 4)
+	c.Assert(responses[2], gc.IsNil)
+}
+
+func (*batchSuite) TestCancelled(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runs := []exec.RunParams{
+		{Commands: "echo never"},
+		{Commands: "echo never"},
+	}
+
+	responses, err := exec.RunAllContext(ctx, runs, 1, exec.CollectErrors)
+	c.Assert(responses, jc.DeepEquals, []*exec.ExecResponse{nil, nil})
+	multi, ok := err.(*errs.Multi)
+	c.Assert(ok, jc.IsTrue)
+	failures := multi.Errors()
+	c.Assert(failures, gc.HasLen, 2)
+	c.Assert(failures[0], gc.ErrorMatches, "command 0: context canceled")
+	c.Assert(failures[1], gc.ErrorMatches, "command 1: context canceled")
+
+	responses, err = exec.RunAllContext(ctx, runs, 1, exec.FailFast)
+	c.Assert(responses, jc.DeepEquals, []*exec.ExecResponse{nil, nil})
+	c.Assert(err, gc.Equals, context.Canceled)
+}
+
+func (*batchSuite) TestConcurrencyNotValid(c *gc.C) {
+	_, err := exec.RunAll(nil, 0, exec.CollectErrors)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
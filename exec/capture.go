@@ -0,0 +1,22 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+// CaptureMode determines how the output of a command is captured in
+// ExecResponse.
+type CaptureMode int
+
+const (
+	// CaptureSeparate captures standard output and standard error
+	// separately, in ExecResponse.Stdout and Stderr.
+	CaptureSeparate CaptureMode = iota
+
+	// CaptureCombined captures both streams together, in the order
+	// they were written, in ExecResponse.Combined, as
+	// exec.Cmd.CombinedOutput does.
+	CaptureCombined
+
+	// CaptureBoth captures the streams separately and combined.
+	CaptureBoth
+)
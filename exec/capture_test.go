@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"regexp"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type captureSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&captureSuite{})
+
+const interleavedCommands = "echo one\necho two >&2\necho three\necho four >&2\n"
+
+func (*captureSuite) TestCaptureSeparate(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: interleavedCommands,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "one\nthree\n")
+	c.Assert(string(resp.Stderr), gc.Equals, "two\nfour\n")
+	c.Assert(resp.Combined, gc.IsNil)
+}
+
+func (*captureSuite) TestCaptureCombined(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: interleavedCommands,
+		Capture:  exec.CaptureCombined,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Combined), gc.Equals, "one\ntwo\nthree\nfour\n")
+	c.Assert(resp.Stdout, gc.HasLen, 0)
+	c.Assert(resp.Stderr, gc.HasLen, 0)
+}
+
+func (*captureSuite) TestCaptureBoth(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		// Pausing between the writes lets them be read in order
+		// from the separate pipes.
+		Commands: "echo one\nsleep 0.1\necho two >&2\nsleep 0.1\necho three\n",
+		Capture:  exec.CaptureBoth,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "one\nthree\n")
+	c.Assert(string(resp.Stderr), gc.Equals, "two\n")
+	c.Assert(string(resp.Combined), gc.Equals, "one\ntwo\nthree\n")
+}
+
+func (*captureSuite) TestCaptureCombinedLimit(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:       interleavedCommands,
+		Capture:        exec.CaptureCombined,
+		MaxOutputBytes: 8,
+		KeepOutputTail: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Combined), gc.Equals, "ee\nfour\n")
+	c.Assert(resp.CombinedTruncated, jc.IsTrue)
+}
+
+func (*captureSuite) TestCaptureCombinedRedacted(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:     "echo secret >&2",
+		Capture:      exec.CaptureCombined,
+		Redactions:   []*regexp.Regexp{exec.RedactString("secret")},
+		RedactOutput: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Combined), gc.Equals, exec.Redacted+"\n")
+}
+
+func (*captureSuite) TestCaptureDetachNotValid(c *gc.C) {
+	_, err := exec.StartDetached(exec.RunParams{
+		Commands: "true",
+		Capture:  exec.CaptureCombined,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, "setting Capture with Detach not valid")
+}
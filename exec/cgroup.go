@@ -0,0 +1,51 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"github.com/juju/errors"
+)
+
+// CgroupLimits describes a transient cgroup, in the unified (v2)
+// hierarchy, in which a command and every process it starts are run.
+// The cgroup is created when the command is started and removed,
+// killing any processes left in it, once it has finished. Cgroups are
+// only supported on Linux.
+type CgroupLimits struct {
+	// Parent holds the path, relative to the root of the unified
+	// hierarchy, of the cgroup in which the transient cgroup is
+	// created. The memory, cpu and pids controllers must be available
+	// to it; in particular it cannot contain processes itself unless
+	// it is the root. If it is empty, the agent's own cgroup is used,
+	// which is rarely possible unless the agent runs in a cgroup of
+	// its own, such as one delegated to it by systemd.
+	Parent string
+
+	// Memory, if positive, limits the memory used by the processes
+	// in the cgroup to that many bytes (memory.max).
+	Memory int64
+
+	// CPU, if positive, limits the processes in the cgroup to that
+	// number of CPUs' worth of time, which may be fractional
+	// (cpu.max).
+	CPU float64
+
+	// Pids, if positive, limits the number of processes and threads
+	// in the cgroup (pids.max).
+	Pids int64
+}
+
+// Validate returns an error if the limits are not valid.
+func (l *CgroupLimits) Validate() error {
+	if l.Memory < 0 {
+		return errors.NotValidf("negative cgroup memory limit")
+	}
+	if l.CPU < 0 {
+		return errors.NotValidf("negative cgroup CPU limit")
+	}
+	if l.Pids < 0 {
+		return errors.NotValidf("negative cgroup process limit")
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// cloneIntoCgroup reports whether the kernel can create a process
+// directly in a cgroup, as it can since Linux 5.7. Otherwise processes
+// are moved into their cgroup once started, so the first instructions
+// of a command run outside it. It is overridden in tests.
+var cloneIntoCgroup = kernelAtLeast(5, 7)
+
+// removeCgroupDir removes an empty cgroup. It is overridden in tests,
+// as a directory in an ordinary file system holding the cgroup's files
+// cannot be removed.
+var removeCgroupDir = os.Remove
+
+// cgroupSeq distinguishes the cgroups created by the agent.
+var cgroupSeq int64
+
+// cgroup holds the transient cgroup created for a command.
+type cgroup struct {
+	// path holds the path of the cgroup's directory.
+	path string
+	dir  *os.File
+}
+
+// createCgroup creates the cgroup described by r.Cgroup and arranges
+// for the command prepared in r.ps to be run in it.
+func createCgroup(r *RunParams) error {
+	if err := r.Cgroup.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	root := unifiedCgroupRoot()
+	if root == "" {
+		return errors.NotSupportedf("cgroup v2 hierarchy")
+	}
+	parent := r.Cgroup.Parent
+	if parent == "" {
+		var err error
+		if parent, err = agentCgroup(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	parentPath := filepath.Join(root, parent)
+	if err := enableControllers(parentPath, r.Cgroup); err != nil {
+		return errors.Trace(err)
+	}
+	path := filepath.Join(parentPath, fmt.Sprintf("juju-exec-%d-%d", os.Getpid(), atomic.AddInt64(&cgroupSeq, 1)))
+	if err := os.Mkdir(path, 0755); err != nil {
+		return errors.Annotate(err, "cannot create cgroup")
+	}
+	cg := &cgroup{path: path}
+	if err := cg.configure(r.Cgroup); err != nil {
+		cg.remove()
+		return errors.Trace(err)
+	}
+	if cloneIntoCgroup {
+		dir, err := os.Open(path)
+		if err != nil {
+			cg.remove()
+			return errors.Annotate(err, "cannot open cgroup")
+		}
+		cg.dir = dir
+		r.ps.SysProcAttr.UseCgroupFD = true
+		r.ps.SysProcAttr.CgroupFD = int(dir.Fd())
+	}
+	r.cgroup = cg
+	return nil
+}
+
+// enableControllers makes the controllers needed for l available to
+// the children of the cgroup at path.
+func enableControllers(path string, l *CgroupLimits) error {
+	var enable []string
+	if l.Memory > 0 {
+		enable = append(enable, "+memory")
+	}
+	if l.CPU > 0 {
+		enable = append(enable, "+cpu")
+	}
+	if l.Pids > 0 {
+		enable = append(enable, "+pids")
+	}
+	if len(enable) == 0 {
+		return nil
+	}
+	control := filepath.Join(path, "cgroup.subtree_control")
+	if err := ioutil.WriteFile(control, []byte(strings.Join(enable, " ")), 0644); err != nil {
+		return errors.Annotatef(err, "cannot enable cgroup controllers in %q", path)
+	}
+	return nil
+}
+
+// cpuPeriod is the period over which cpu.max limits CPU time.
+const cpuPeriod = 100 * time.Millisecond
+
+// configure writes the limits l to the cgroup.
+func (cg *cgroup) configure(l *CgroupLimits) error {
+	write := func(name, value string) error {
+		if err := ioutil.WriteFile(filepath.Join(cg.path, name), []byte(value), 0644); err != nil {
+			return errors.Annotatef(err, "cannot set %s", name)
+		}
+		return nil
+	}
+	if l.Memory > 0 {
+		if err := write("memory.max", strconv.FormatInt(l.Memory, 10)); err != nil {
+			return err
+		}
+	}
+	if l.CPU > 0 {
+		period := int64(cpuPeriod / time.Microsecond)
+		quota := int64(l.CPU * float64(period))
+		if quota < 1000 {
+			// The kernel's minimum quota is 1ms.
+			quota = 1000
+		}
+		if err := write("cpu.max", fmt.Sprintf("%d %d", quota, period)); err != nil {
+			return err
+		}
+	}
+	if l.Pids > 0 {
+		if err := write("pids.max", strconv.FormatInt(l.Pids, 10)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// started is called once the process with the given ID has been
+// started in, or is to be moved into, the cgroup.
+func (cg *cgroup) started(pid int) error {
+	if cg.dir != nil {
+		cg.dir.Close()
+		cg.dir = nil
+		return nil
+	}
+	procs := filepath.Join(cg.path, "cgroup.procs")
+	if err := ioutil.WriteFile(procs, []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return errors.Annotate(err, "cannot move process into cgroup")
+	}
+	return nil
+}
+
+// finish returns the number of processes in the cgroup killed by the
+// OOM killer, or -1 if this cannot be determined, and removes the
+// cgroup.
+func (cg *cgroup) finish() int {
+	n := readOOMKill(filepath.Join(cg.path, "memory.events"))
+	cg.remove()
+	return n
+}
+
+// remove kills any processes left in the cgroup and removes it.
+func (cg *cgroup) remove() {
+	if cg.dir != nil {
+		cg.dir.Close()
+		cg.dir = nil
+	}
+	err := removeCgroupDir(cg.path)
+	if err == nil || os.IsNotExist(err) {
+		return
+	}
+	// Processes remain in the cgroup, perhaps having been started in
+	// the background by the command.
+	if err := ioutil.WriteFile(filepath.Join(cg.path, "cgroup.kill"), []byte("1"), 0644); err != nil {
+		logger.Warningf("cannot kill processes in cgroup %q: %v", cg.path, err)
+		return
+	}
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if err = removeCgroupDir(cg.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+	}
+	logger.Warningf("cannot remove cgroup %q: %v", cg.path, err)
+}
+
+// unifiedCgroupRoot returns the root of the unified cgroup hierarchy,
+// which is mounted within cgroupRoot on hosts that also have the
+// legacy hierarchies, or "" if there is none.
+func unifiedCgroupRoot() string {
+	for _, root := range []string{cgroupRoot, filepath.Join(cgroupRoot, "unified")} {
+		if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+			return root
+		}
+	}
+	return ""
+}
+
+// agentCgroup returns the path of the agent's cgroup in the unified
+// hierarchy.
+func agentCgroup() (string, error) {
+	data, err := ioutil.ReadFile(procSelfCgroup)
+	if err != nil {
+		return "", errors.Annotate(err, "cannot determine agent cgroup")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return line[len("0::"):], nil
+		}
+	}
+	return "", errors.NotFoundf("agent cgroup v2")
+}
+
+// kernelAtLeast reports whether the running kernel's version is at
+// least major.minor.
+func kernelAtLeast(major, minor int) bool {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return false
+	}
+	var release []byte
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	var maj, min int
+	if _, err := fmt.Sscanf(string(release), "%d.%d", &maj, &min); err != nil {
+		return false
+	}
+	return maj > major || maj == major && min >= minor
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type cgroupSuite struct {
+	testing.IsolationSuite
+	root    string
+	removed map[string]map[string]string
+}
+
+var _ = gc.Suite(&cgroupSuite{})
+
+func (s *cgroupSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	// A fake unified hierarchy, into which processes are moved
+	// by writing to cgroup.procs once they have started.
+	s.root = c.MkDir()
+	s.writeFile(c, filepath.Join(s.root, "cgroup.controllers"), "cpu memory pids")
+	c.Assert(os.MkdirAll(filepath.Join(s.root, "agent.slice", "delegated"), 0755), jc.ErrorIsNil)
+	procSelfCgroup := filepath.Join(c.MkDir(), "cgroup")
+	s.writeFile(c, procSelfCgroup, "0::/agent.slice\n")
+	s.PatchValue(exec.CgroupRoot, s.root)
+	s.PatchValue(exec.ProcSelfCgroup, procSelfCgroup)
+	s.PatchValue(exec.CloneIntoCgroup, false)
+
+	s.removed = make(map[string]map[string]string)
+	s.PatchValue(exec.RemoveCgroupDir, func(path string) error {
+		files := make(map[string]string)
+		infos, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			data, err := ioutil.ReadFile(filepath.Join(path, info.Name()))
+			c.Check(err, jc.ErrorIsNil)
+			files[info.Name()] = string(data)
+		}
+		s.removed[path] = files
+		return os.RemoveAll(path)
+	})
+}
+
+func (s *cgroupSuite) writeFile(c *gc.C, path, content string) {
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *cgroupSuite) TestCgroup(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo $$",
+		Cgroup: &exec.CgroupLimits{
+			Memory: 64 << 20,
+			CPU:    0.5,
+			Pids:   10,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(filepath.Dir(resp.CgroupPath), gc.Equals, filepath.Join(s.root, "agent.slice"))
+	c.Assert(filepath.Base(resp.CgroupPath), gc.Matches, "juju-exec-[0-9]+-[0-9]+")
+	_, err = os.Stat(resp.CgroupPath)
+	c.Assert(os.IsNotExist(err), jc.IsTrue)
+	c.Assert(s.removed[resp.CgroupPath], jc.DeepEquals, map[string]string{
+		"memory.max":   "67108864",
+		"cpu.max":      "50000 100000",
+		"pids.max":     "10",
+		"cgroup.procs": strings.TrimSpace(string(resp.Stdout)),
+	})
+	control, err := ioutil.ReadFile(filepath.Join(s.root, "agent.slice", "cgroup.subtree_control"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(control), gc.Equals, "+memory +cpu +pids")
+}
+
+func (s *cgroupSuite) TestCgroupParent(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		Cgroup: &exec.CgroupLimits{
+			Parent: "/agent.slice/delegated",
+			Pids:   5,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(filepath.Dir(resp.CgroupPath), gc.Equals, filepath.Join(s.root, "agent.slice", "delegated"))
+	c.Assert(s.removed[resp.CgroupPath]["pids.max"], gc.Equals, "5")
+	control, err := ioutil.ReadFile(filepath.Join(s.root, "agent.slice", "delegated", "cgroup.subtree_control"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(control), gc.Equals, "+pids")
+}
+
+func (s *cgroupSuite) TestCgroupRemovedOnStartFailure(c *gc.C) {
+	err := (&exec.RunParams{
+		Args:   []string{"/no/such/program"},
+		Cgroup: &exec.CgroupLimits{Pids: 5},
+	}).Run()
+	c.Assert(err, gc.NotNil)
+	c.Assert(s.removed, gc.HasLen, 1)
+	infos, err := ioutil.ReadDir(filepath.Join(s.root, "agent.slice"))
+	c.Assert(err, jc.ErrorIsNil)
+	for _, info := range infos {
+		c.Check(info.Name(), gc.Not(gc.Matches), "juju-exec-.*")
+	}
+}
+
+func (s *cgroupSuite) TestNoUnifiedHierarchy(c *gc.C) {
+	s.PatchValue(exec.CgroupRoot, c.MkDir())
+	err := (&exec.RunParams{
+		Commands: "true",
+		Cgroup:   &exec.CgroupLimits{Pids: 5},
+	}).Run()
+	c.Assert(err, gc.ErrorMatches, "cgroup v2 hierarchy not supported")
+	c.Assert(errors.IsNotSupported(err), jc.IsTrue)
+}
+
+func (s *cgroupSuite) TestInvalid(c *gc.C) {
+	err := (&exec.RunParams{
+		Commands: "true",
+		Cgroup:   &exec.CgroupLimits{Memory: -1},
+	}).Run()
+	c.Assert(err, gc.ErrorMatches, "invalid run parameters: Cgroup: negative cgroup memory limit not valid")
+	c.Assert(s.removed, gc.HasLen, 0)
+}
+
+func (s *cgroupSuite) TestDetach(c *gc.C) {
+	_, err := exec.StartDetached(exec.RunParams{
+		Commands: "true",
+		Cgroup:   &exec.CgroupLimits{Pids: 5},
+	})
+	c.Assert(err, gc.ErrorMatches, "setting Cgroup with Detach not valid")
+}
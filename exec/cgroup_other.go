@@ -0,0 +1,25 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !linux
+
+package exec
+
+import (
+	"github.com/juju/errors"
+)
+
+// createCgroup always fails as cgroups are not supported on this
+// platform.
+func createCgroup(r *RunParams) error {
+	return errors.NotSupportedf("cgroups on this platform")
+}
+
+// cgroup is never created on this platform.
+type cgroup struct {
+	path string
+}
+
+func (*cgroup) started(pid int) error { return nil }
+func (*cgroup) finish() int           { return -1 }
+func (*cgroup) remove()               {}
@@ -0,0 +1,60 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// chrootCommand resolves the program run by cmd within root, whose
+// directories are searched in place of the agent's for a program
+// named without a path.
+func chrootCommand(cmd *exec.Cmd, root string) error {
+	name := cmd.Args[0]
+	var candidates []string
+	if strings.Contains(name, "/") {
+		candidates = []string{name}
+	} else {
+		env := cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		path := ""
+		for _, kv := range env {
+			if strings.HasPrefix(kv, "PATH=") {
+				path = kv[len("PATH="):]
+			}
+		}
+		for _, dir := range filepath.SplitList(path) {
+			if filepath.IsAbs(dir) {
+				candidates = append(candidates, filepath.Join(dir, name))
+			}
+		}
+	}
+	for _, path := range candidates {
+		info, err := os.Stat(filepath.Join(root, path))
+		if err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			cmd.Path = path
+			// Any failure to find the program in the agent's
+			// file system is irrelevant.
+			cmd.Err = nil
+			return nil
+		}
+	}
+	return errors.NotFoundf("%q in %q", name, root)
+}
+
+// hostPath returns the path in the agent's file system of path as
+// seen by the command.
+func (r *RunParams) hostPath(path string) string {
+	if r.Chroot == "" {
+		return path
+	}
+	return filepath.Join(r.Chroot, path)
+}
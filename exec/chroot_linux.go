@@ -0,0 +1,16 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"syscall"
+)
+
+// newMountNamespace arranges for the command to be run in a new mount
+// namespace. The os/exec package makes all mounts in the namespace
+// private, so that they are not propagated back to the agent's.
+func newMountNamespace(attr *syscall.SysProcAttr) error {
+	attr.Unshareflags |= syscall.CLONE_NEWNS
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type chrootSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&chrootSuite{})
+
+// makeRoot returns a directory holding /bin/sh and the libraries it
+// needs, which can be used as a root directory.
+func makeRoot(c *gc.C) string {
+	sh, err := filepath.EvalSymlinks("/bin/sh")
+	c.Assert(err, jc.ErrorIsNil)
+	out, err := osexec.Command("ldd", sh).Output()
+	if err != nil {
+		c.Skip("cannot find libraries used by /bin/sh: " + err.Error())
+	}
+	root := c.MkDir()
+	files := map[string]string{"/bin/sh": sh}
+	for _, lib := range regexp.MustCompile(`/\S+`).FindAllString(string(out), -1) {
+		files[lib] = lib
+	}
+	for dst, src := range files {
+		data, err := ioutil.ReadFile(src)
+		c.Assert(err, jc.ErrorIsNil)
+		path := filepath.Join(root, dst)
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0755), jc.ErrorIsNil)
+		c.Assert(ioutil.WriteFile(path, data, 0755), jc.ErrorIsNil)
+	}
+	return root
+}
+
+func (*chrootSuite) TestChroot(c *gc.C) {
+	requireRoot(c)
+	root := makeRoot(c)
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:         "echo $0; pwd; echo *",
+		Chroot:           root,
+		WorkingDir:       "/work",
+		CreateWorkingDir: &exec.DirParams{},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stderr), gc.Equals, "")
+	c.Assert(string(resp.Stdout), gc.Equals, "/bin/sh\n/work\n*\n")
+	c.Assert(resp.Shell, gc.Equals, "/bin/sh")
+	info, err := os.Stat(filepath.Join(root, "work"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.IsDir(), jc.IsTrue)
+}
+
+func (*chrootSuite) TestChrootArgs(c *gc.C) {
+	requireRoot(c)
+	root := makeRoot(c)
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:        []string{"sh", "-c", "echo *"},
+		Environment: []string{"PATH=/usr/bin:/bin"},
+		Chroot:      root,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	dirs, err := ioutil.ReadDir(root)
+	c.Assert(err, jc.ErrorIsNil)
+	var names []string
+	for _, info := range dirs {
+		names = append(names, info.Name())
+	}
+	c.Assert(string(resp.Stdout), gc.Equals, strings.Join(names, " ")+"\n")
+}
+
+func (*chrootSuite) TestChrootProgramNotFound(c *gc.C) {
+	root := c.MkDir()
+	err := (&exec.RunParams{
+		Args:   []string{"ls"},
+		Chroot: root,
+	}).Run()
+	c.Assert(err, gc.ErrorMatches, `"ls" in ".*" not found`)
+	c.Assert(errors.IsNotFound(err), jc.IsTrue)
+}
+
+func (*chrootSuite) TestChrootNotValid(c *gc.C) {
+	for _, run := range []exec.RunParams{
+		{Commands: "true", Chroot: "/", Elevate: true},
+		{Commands: "true", Chroot: "/", ScriptFile: true},
+		{Commands: "true", Chroot: "/", Limits: &exec.ResourceLimits{Nice: 1}},
+	} {
+		run := run
+		err := run.Run()
+		c.Check(err, gc.ErrorMatches, "setting Chroot with .* not valid")
+	}
+}
+
+func (*chrootSuite) TestNewMountNamespace(c *gc.C) {
+	requireRoot(c)
+	if _, err := osexec.LookPath("mount"); err != nil {
+		c.Skip("mount not available")
+	}
+	dir := c.MkDir()
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:          `mount -t tmpfs none "$DIR" && grep -c " $DIR " /proc/self/mounts`,
+		Environment:       []string{"DIR=" + dir},
+		NewMountNamespace: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	if resp.Code != 0 {
+		c.Skip("cannot mount file systems: " + string(resp.Stderr))
+	}
+	c.Assert(string(resp.Stdout), gc.Equals, "1\n")
+	mounts, err := ioutil.ReadFile("/proc/self/mounts")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(mounts), gc.Not(jc.Contains), " "+dir+" ")
+}
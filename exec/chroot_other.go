@@ -0,0 +1,18 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !linux,!windows
+
+package exec
+
+import (
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// newMountNamespace always fails as mount namespaces are not supported
+// on this platform.
+func newMountNamespace(attr *syscall.SysProcAttr) error {
+	return errors.NotSupportedf("mount namespaces on this platform")
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type clockSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+}
+
+var _ = gc.Suite(&clockSuite{})
+
+var epoch = time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func (s *clockSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.New(epoch)
+}
+
+type runResult struct {
+	resp *exec.ExecResponse
+	err  error
+}
+
+// runAsync runs RunCommands in the background with the suite's clock,
+// returning a channel that receives its result.
+func (s *clockSuite) runAsync(run exec.RunParams) <-chan runResult {
+	run.Clock = s.clock
+	done := make(chan runResult, 1)
+	go func() {
+		resp, err := exec.RunCommands(run)
+		done <- runResult{resp, err}
+	}()
+	return done
+}
+
+func (s *clockSuite) advance(c *gc.C, d time.Duration) {
+	err := s.clock.WaitAdvance(d, 5*time.Second, 1)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *clockSuite) TestTimeout(c *gc.C) {
+	done := s.runAsync(exec.RunParams{
+		Commands: "exec sleep 60",
+		Timeout:  time.Hour,
+	})
+	s.advance(c, time.Hour)
+	result := <-done
+	c.Assert(result.err, gc.Equals, exec.ErrTimedOut)
+	c.Assert(result.resp.StartTime, gc.Equals, epoch)
+	c.Assert(result.resp.Duration, gc.Equals, time.Hour)
+}
+
+func (s *clockSuite) TestGracePeriod(c *gc.C) {
+	done := s.runAsync(exec.RunParams{
+		// The ignored signal stays ignored in sleep.
+		Commands:    "trap '' TERM; exec sleep 60",
+		Timeout:     time.Hour,
+		GracePeriod: 10 * time.Minute,
+	})
+	s.advance(c, time.Hour)
+	s.advance(c, 10*time.Minute)
+	result := <-done
+	c.Assert(result.err, gc.Equals, exec.ErrTimedOut)
+	c.Assert(result.resp.Duration, gc.Equals, 70*time.Minute)
+}
+
+func (s *clockSuite) TestInactivityTimeout(c *gc.C) {
+	done := s.runAsync(exec.RunParams{
+		Commands:          "exec sleep 60",
+		InactivityTimeout: time.Minute,
+	})
+	s.advance(c, time.Minute)
+	result := <-done
+	c.Assert(result.err, gc.Equals, exec.ErrInactivityTimeout)
+}
+
+func (s *clockSuite) TestRetryDelay(c *gc.C) {
+	done := s.runAsync(exec.RunParams{
+		Commands: "exit 1",
+		Retry: &exec.RetryPolicy{
+			MaxAttempts: 2,
+			Delay:       time.Hour,
+		},
+	})
+	s.advance(c, time.Hour)
+	result := <-done
+	c.Assert(result.err, jc.ErrorIsNil)
+	c.Assert(result.resp.Attempts, gc.Equals, 2)
+	c.Assert(result.resp.StartTime, gc.Equals, epoch.Add(time.Hour))
+}
+
+func (s *clockSuite) TestRunningStarted(c *gc.C) {
+	params := exec.RunParams{
+		Args:  []string{"/bin/sleep", "60"},
+		Clock: s.clock,
+	}
+	err := params.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	defer func() {
+		params.Process().Kill()
+		params.Wait()
+	}()
+	var started []time.Time
+	for _, cmd := range exec.Running() {
+		if cmd.PID == params.Process().Pid {
+			started = append(started, cmd.Started)
+		}
+	}
+	c.Assert(started, jc.DeepEquals, []time.Time{epoch})
+}
+
+func (s *clockSuite) TestStreamStarted(c *gc.C) {
+	events, err := exec.RunStream(context.Background(), exec.RunParams{
+		Commands: "exit 0",
+		Clock:    s.clock,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	var all []exec.Event
+	for e := range events {
+		all = append(all, e)
+	}
+	c.Assert(all, gc.Not(gc.HasLen), 0)
+	started, ok := all[0].(exec.Started)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(started.Time, gc.Equals, epoch)
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// ErrTooManyCommands is returned by Run when the limit set with
+// SetConcurrencyLimit has been reached and the limit fails fast.
+var ErrTooManyCommands = errors.New("too many commands running")
+
+// ConcurrencyLimit restricts how many commands the package runs at
+// once.
+type ConcurrencyLimit struct {
+	// Max holds the number of commands that may run at once. Zero
+	// or less means that there is no limit.
+	Max int
+
+	// FailFast causes Run to fail with ErrTooManyCommands when Max
+	// commands are already running. Otherwise Run waits for one of
+	// them to finish, or for the context passed to
+	// RunCommandsContext or StartSession to be done.
+	FailFast bool
+}
+
+// semaphore holds the slots of a ConcurrencyLimit.
+type semaphore struct {
+	slots    chan struct{}
+	failFast bool
+}
+
+var (
+	limitMutex sync.Mutex
+	limit      ConcurrencyLimit
+	limitSlots *semaphore
+)
+
+// SetConcurrencyLimit sets the limit on the number of commands run by
+// the package at once, and returns the previous one. A command holds
+// its place from the time Run is called until it has been waited for,
+// so a session holds one place until it is closed. A Pipeline holds one
+// place for all of its stages. Commands started with Detach or DryRun
+// are not counted. Commands that are already
+// running are counted against the limit they started under, so a new
+// limit may briefly be exceeded.
+func SetConcurrencyLimit(l ConcurrencyLimit) ConcurrencyLimit {
+	limitMutex.Lock()
+	defer limitMutex.Unlock()
+	previous := limit
+	limit = l
+	limitSlots = nil
+	if l.Max > 0 {
+		limitSlots = &semaphore{
+			slots:    make(chan struct{}, l.Max),
+			failFast: l.FailFast,
+		}
+	}
+	return previous
+}
+
+func currentSlots() *semaphore {
+	limitMutex.Lock()
+	defer limitMutex.Unlock()
+	return limitSlots
+}
+
+// acquireSlot takes a place for r under the current concurrency
+// limit, waiting for one if necessary. The place is retained to be
+// given back by releaseSlot.
+func (r *RunParams) acquireSlot() error {
+	if r.Detach || r.DryRun || r.slotHeld {
+		return nil
+	}
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	sem, err := acquireSlot(ctx)
+	if err != nil {
+		return err
+	}
+	r.slot = sem
+	return nil
+}
+
+// releaseSlot gives back the place taken by acquireSlot, if any.
+func (r *RunParams) releaseSlot() {
+	r.slot.release()
+	r.slot = nil
+}
+
+// acquireSlot takes a place under the current concurrency limit,
+// waiting for one until ctx is done unless the limit fails fast. It
+// returns the semaphore to release the place to, which is nil if there
+// is no limit.
+func acquireSlot(ctx context.Context) (*semaphore, error) {
+	sem := currentSlots()
+	if sem == nil {
+		return nil, nil
+	}
+	select {
+	case sem.slots <- struct{}{}:
+		return sem, nil
+	default:
+	}
+	if sem.failFast {
+		return nil, ErrTooManyCommands
+	}
+	logger.Debugf("waiting for one of %d running commands to finish", cap(sem.slots))
+	select {
+	case sem.slots <- struct{}{}:
+		return sem, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release gives back a place taken by acquireSlot. It does nothing if
+// sem is nil.
+func (sem *semaphore) release() {
+	if sem != nil {
+		<-sem.slots
+	}
+}
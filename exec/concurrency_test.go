@@ -0,0 +1,153 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type concurrencySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&concurrencySuite{})
+
+func (s *concurrencySuite) setLimit(c *gc.C, limit exec.ConcurrencyLimit) {
+	previous := exec.SetConcurrencyLimit(limit)
+	s.AddCleanup(func(*gc.C) { exec.SetConcurrencyLimit(previous) })
+}
+
+// startSleep starts a command that runs until it is killed.
+func startSleep(c *gc.C) *exec.RunParams {
+	params := &exec.RunParams{Args: []string{"/bin/sleep", "60"}}
+	err := params.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	return params
+}
+
+func stopSleep(c *gc.C, params *exec.RunParams) {
+	err := params.Process().Kill()
+	c.Assert(err, jc.ErrorIsNil)
+	params.Wait()
+}
+
+func (s *concurrencySuite) TestFailFast(c *gc.C) {
+	s.setLimit(c, exec.ConcurrencyLimit{Max: 1, FailFast: true})
+	sleep := startSleep(c)
+
+	_, err := exec.RunCommands(exec.RunParams{Commands: "exit 0"})
+	c.Assert(err, gc.Equals, exec.ErrTooManyCommands)
+
+	// Detached commands and dry runs are not counted.
+	detached := exec.RunParams{Commands: "exit 0", Detach: true}
+	c.Assert(detached.Run(), jc.ErrorIsNil)
+	_, err = exec.RunCommands(exec.RunParams{Commands: "exit 0", DryRun: true})
+	c.Assert(err, jc.ErrorIsNil)
+
+	stopSleep(c, sleep)
+	result, err := exec.RunCommands(exec.RunParams{Commands: "exit 3"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(result.Code, gc.Equals, 3)
+}
+
+func (s *concurrencySuite) TestWait(c *gc.C) {
+	s.setLimit(c, exec.ConcurrencyLimit{Max: 1})
+	sleep := startSleep(c)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := exec.RunCommandsContext(context.Background(), exec.RunParams{Commands: "exit 0"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		c.Fatalf("command ran while the limit was reached: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	stopSleep(c, sleep)
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(10 * time.Second):
+		c.Fatalf("command did not run after the limit was freed")
+	}
+}
+
+func (s *concurrencySuite) TestWaitCancelled(c *gc.C) {
+	s.setLimit(c, exec.ConcurrencyLimit{Max: 1})
+	sleep := startSleep(c)
+	defer stopSleep(c, sleep)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := exec.RunCommandsContext(ctx, exec.RunParams{Commands: "exit 0"})
+	c.Assert(err, gc.Equals, context.DeadlineExceeded)
+}
+
+func (s *concurrencySuite) TestSessionHoldsSlot(c *gc.C) {
+	s.setLimit(c, exec.ConcurrencyLimit{Max: 1, FailFast: true})
+	session, err := exec.StartSession(context.Background(), exec.RunParams{})
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = exec.RunCommands(exec.RunParams{Commands: "exit 0"})
+	c.Assert(err, gc.Equals, exec.ErrTooManyCommands)
+
+	_, err = session.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = exec.RunCommands(exec.RunParams{Commands: "exit 0"})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *concurrencySuite) TestPipelineHoldsOneSlot(c *gc.C) {
+	s.setLimit(c, exec.ConcurrencyLimit{Max: 2})
+	done := make(chan error, 1)
+	var responses []*exec.ExecResponse
+	go func() {
+		var err error
+		responses, err = exec.NewPipeline("/bin/echo", "hi").Pipe("/bin/cat").Pipe("/bin/cat").Run()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		c.Assert(err, jc.ErrorIsNil)
+	case <-time.After(10 * time.Second):
+		c.Fatalf("pipeline with more stages than the limit did not finish")
+	}
+	c.Assert(responses, gc.HasLen, 3)
+	c.Assert(string(responses[2].Stdout), gc.Equals, "hi\n")
+
+	// The slot is given back once the pipeline has finished.
+	_, err := exec.RunCommands(exec.RunParams{Commands: "exit 0"})
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *concurrencySuite) TestPipelineWaitCancelled(c *gc.C) {
+	s.setLimit(c, exec.ConcurrencyLimit{Max: 1})
+	sleep := startSleep(c)
+	defer stopSleep(c, sleep)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := exec.NewPipeline("/bin/echo", "hi").Pipe("/bin/cat").RunContext(ctx)
+	c.Assert(err, gc.Equals, context.DeadlineExceeded)
+}
+
+func (s *concurrencySuite) TestPipelineFailFast(c *gc.C) {
+	s.setLimit(c, exec.ConcurrencyLimit{Max: 1, FailFast: true})
+	sleep := startSleep(c)
+	defer stopSleep(c, sleep)
+
+	_, err := exec.NewPipeline("/bin/echo", "hi").Pipe("/bin/cat").Run()
+	c.Assert(err, gc.Equals, exec.ErrTooManyCommands)
+}
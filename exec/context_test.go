@@ -0,0 +1,168 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type contextSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&contextSuite{})
+
+func (*contextSuite) TestRunCommandsContext(c *gc.C) {
+	resp, err := exec.RunCommandsContext(context.Background(), exec.RunParams{
+		Commands: "echo hello; exit 2",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Code, gc.Equals, 2)
+	c.Assert(string(resp.Stdout), gc.Equals, "hello\n")
+}
+
+func (*contextSuite) TestRunCommandsContextCancelled(c *gc.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	resp, err := exec.RunCommandsContext(ctx, exec.RunParams{
+		Commands: "echo partial; exec sleep 60",
+	})
+	c.Assert(err, gc.Equals, context.DeadlineExceeded)
+	c.Assert(time.Since(start) < 30*time.Second, gc.Equals, true)
+	c.Assert(string(resp.Stdout), gc.Equals, "partial\n")
+	c.Assert(resp.Signal, gc.Equals, syscall.SIGKILL)
+}
+
+func (*contextSuite) TestRunCommandsContextAlreadyDone(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp, err := exec.RunCommandsContext(ctx, exec.RunParams{
+		Commands: "echo should not run",
+	})
+	c.Assert(err, gc.Equals, context.Canceled)
+	c.Assert(resp, gc.IsNil)
+}
+
+func (*contextSuite) TestWaitWithContextNotStarted(c *gc.C) {
+	var run exec.RunParams
+	_, err := run.WaitWithContext(context.Background())
+	c.Assert(err, gc.ErrorMatches, "No process has been started yet")
+}
+
+func (*contextSuite) TestTimeout(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo partial; echo oops >&2; exec sleep 60",
+		Timeout:  200 * time.Millisecond,
+	})
+	c.Assert(err, gc.Equals, exec.ErrTimedOut)
+	c.Assert(string(resp.Stdout), gc.Equals, "partial\n")
+	c.Assert(string(resp.Stderr), gc.Equals, "oops\n")
+	c.Assert(resp.Signal, gc.Equals, syscall.SIGKILL)
+}
+
+func (*contextSuite) TestTimeoutNotReached(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo done",
+		Timeout:  time.Minute,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "done\n")
+}
+
+func (*contextSuite) TestGracePeriod(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:    "trap 'echo cleaning up; exit 3' TERM; echo ready; while true; do sleep 0.05; done",
+		Timeout:     300 * time.Millisecond,
+		GracePeriod: 10 * time.Second,
+	})
+	c.Assert(err, gc.Equals, exec.ErrTimedOut)
+	c.Assert(resp.Code, gc.Equals, 3)
+	c.Assert(string(resp.Stdout), gc.Equals, "ready\ncleaning up\n")
+}
+
+func (*contextSuite) TestGracePeriodEscalates(c *gc.C) {
+	start := time.Now()
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:    "trap '' TERM; echo ready; while true; do sleep 0.05; done",
+		Timeout:     200 * time.Millisecond,
+		GracePeriod: 200 * time.Millisecond,
+	})
+	c.Assert(err, gc.Equals, exec.ErrTimedOut)
+	c.Assert(resp.Signal, gc.Equals, syscall.SIGKILL)
+	c.Assert(time.Since(start) >= 400*time.Millisecond, gc.Equals, true)
+}
+
+func (*contextSuite) TestKillAll(c *gc.C) {
+	// The background sleep keeps the output pipes open, so Wait
+	// only returns once it has been killed too.
+	run := exec.RunParams{
+		Commands: "sleep 60 & echo started; wait",
+	}
+	err := run.Run()
+	c.Assert(err, gc.IsNil)
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	c.Assert(run.KillAll(), gc.IsNil)
+	resp, err := run.Wait()
+	c.Assert(err, gc.ErrorMatches, "signal: killed")
+	c.Assert(resp.Signal, gc.Equals, syscall.SIGKILL)
+	c.Assert(time.Since(start) < 30*time.Second, gc.Equals, true)
+}
+
+func (*contextSuite) TestTimeoutKillsBackgroundProcesses(c *gc.C) {
+	start := time.Now()
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "sleep 60 & sleep 60",
+		Timeout:  100 * time.Millisecond,
+	})
+	c.Assert(err, gc.Equals, exec.ErrTimedOut)
+	c.Assert(resp.Signal, gc.Equals, syscall.SIGKILL)
+	c.Assert(time.Since(start) < 30*time.Second, gc.Equals, true)
+}
+
+func (*contextSuite) TestResponseDetails(c *gc.C) {
+	before := time.Now()
+	run := exec.RunParams{
+		Commands: "sleep 0.1",
+	}
+	err := run.Run()
+	c.Assert(err, gc.IsNil)
+	pid := run.Process().Pid
+	resp, err := run.Wait()
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.PID, gc.Equals, pid)
+	c.Assert(resp.StartTime.Before(before), gc.Equals, false)
+	c.Assert(resp.Duration >= 100*time.Millisecond, gc.Equals, true)
+	c.Assert(resp.Duration < time.Since(before)+time.Millisecond, gc.Equals, true)
+	c.Assert(resp.Signal, gc.Equals, syscall.Signal(0))
+}
+
+func (*contextSuite) TestInactivityTimeout(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:          "echo partial; exec sleep 60",
+		InactivityTimeout: 200 * time.Millisecond,
+	})
+	c.Assert(err, gc.Equals, exec.ErrInactivityTimeout)
+	c.Assert(string(resp.Stdout), gc.Equals, "partial\n")
+}
+
+func (*contextSuite) TestInactivityTimeoutReset(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:          "for i in 1 2 3 4 5 6; do sleep 0.1; echo $i >&2; done",
+		InactivityTimeout: 300 * time.Millisecond,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(string(resp.Stderr), gc.Equals, "1\n2\n3\n4\n5\n6\n")
+}
@@ -0,0 +1,135 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// StartDetached starts the command described by run in the manner of
+// RunParams.Detach and returns its process ID.
+func StartDetached(run RunParams) (int, error) {
+	run.Detach = true
+	if err := run.Run(); err != nil {
+		return 0, err
+	}
+	return run.Process().Pid, nil
+}
+
+// validateDetach checks that no option that needs the agent to wait
+// for the command is set with Detach.
+func (r *RunParams) validateDetach() error {
+	for _, opt := range []struct {
+		name string
+		set  bool
+	}{
+		{"Stdout", r.Stdout != nil},
+		{"Stderr", r.Stderr != nil},
+		{"OnStdoutLine", r.OnStdoutLine != nil},
+		{"OnStderrLine", r.OnStderrLine != nil},
+		{"Transcript", r.Transcript != nil || r.TranscriptSize > 0},
+		{"Timeout", r.Timeout > 0},
+		{"InactivityTimeout", r.InactivityTimeout > 0},
+		{"Heartbeat", r.Heartbeat != nil},
+		{"AllocatePTY", r.AllocatePTY},
+		{"Foreground", r.Foreground},
+		{"Cgroup", r.Cgroup != nil},
+		{"StripANSI", r.StripANSI},
+		{"LogOutput", r.LogOutput},
+		{"Capture", r.Capture != CaptureSeparate},
+		{"TimestampOutput", r.TimestampOutput},
+	} {
+		if opt.set {
+			return errors.NotValidf("setting %s with Detach", opt.name)
+		}
+	}
+	return nil
+}
+
+// startDetached starts the command prepared in r.ps for Detach.
+func (r *RunParams) startDetached() error {
+	if err := configureCommand(r, r.ps); err != nil {
+		return err
+	}
+	detachCommand(r.ps)
+
+	files, err := r.openDetachedOutput()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// The child has its own copies of the files once started.
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	startMutex.RLock()
+	defer startMutex.RUnlock()
+	if err := r.ps.Start(); err != nil {
+		return err
+	}
+	r.started = r.getClock().Now()
+	trackRunning(r.ps, r)
+	ps, script := r.ps, r.script
+	r.script = ""
+	go func() {
+		// The process is reaped so that it does not linger as a
+		// zombie, but nothing is done with its result.
+		err := ps.Wait()
+		untrackRunning(ps)
+		if script != "" {
+			os.Remove(script)
+		}
+		logger.Debugf("detached process %d finished: %v", ps.Process.Pid, err)
+	}()
+	return nil
+}
+
+// openDetachedOutput opens the files named by r.StdoutPath and
+// r.StderrPath, if any, and connects them to the command. Detached
+// output is always written in place, as the command may run
+// indefinitely, using the flags for r.OutputWrite: the files are
+// truncated for TruncateOutput and appended to otherwise, so
+// ReplaceOutput means appending.
+func (r *RunParams) openDetachedOutput() ([]*os.File, error) {
+	mode := r.OutputFileMode
+	if mode == 0 {
+		mode = 0644
+	}
+	var files []*os.File
+	open := func(path string) (*os.File, error) {
+		f, err := openInPlace(path, mode, r.OutputWrite.openFlags())
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, errors.Trace(err)
+		}
+		files = append(files, f)
+		return f, nil
+	}
+	r.ps.Stdout, r.ps.Stderr = nil, nil
+	if r.StdoutPath != "" {
+		f, err := open(r.StdoutPath)
+		if err != nil {
+			return nil, err
+		}
+		r.ps.Stdout = f
+	}
+	if r.StderrPath != "" {
+		if r.StderrPath == r.StdoutPath {
+			r.ps.Stderr = r.ps.Stdout
+		} else {
+			f, err := open(r.StderrPath)
+			if err != nil {
+				return nil, err
+			}
+			r.ps.Stderr = f
+		}
+	}
+	return files, nil
+}
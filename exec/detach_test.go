@@ -0,0 +1,87 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type detachSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&detachSuite{})
+
+// waitForFile waits for the file at path to have the given content.
+func waitForFile(c *gc.C, path, content string) {
+	var data []byte
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		data, _ = ioutil.ReadFile(path)
+		if string(data) == content {
+			return
+		}
+	}
+	c.Fatalf("file %q has content %q, expected %q", path, data, content)
+}
+
+func (*detachSuite) TestStartDetached(c *gc.C) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		c.Skip("/proc not available")
+	}
+	dir := c.MkDir()
+	out := filepath.Join(dir, "out")
+	start := time.Now()
+	pid, err := exec.StartDetached(exec.RunParams{
+		Commands: "read -r _ _ _ _ _ sid _ < /proc/$$/stat\n" +
+			"[ \"$sid\" = \"$$\" ] && echo leader\n" +
+			"echo oops >&2\n" +
+			"sleep 0.2\n" +
+			"echo $$\n",
+		StdoutPath: out,
+		StderrPath: out,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(time.Since(start) < 200*time.Millisecond, jc.IsTrue)
+	waitForFile(c, out, "leader\noops\n"+strconv.Itoa(pid)+"\n")
+}
+
+func (*detachSuite) TestDetachWait(c *gc.C) {
+	run := exec.RunParams{
+		Commands: "true",
+		Detach:   true,
+	}
+	err := run.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(run.Process(), gc.NotNil)
+	_, err = run.Wait()
+	c.Assert(err, gc.ErrorMatches, "cannot wait for a detached process")
+}
+
+func (*detachSuite) TestDetachNotValid(c *gc.C) {
+	_, err := exec.StartDetached(exec.RunParams{
+		Commands: "true",
+		Stdout:   ioutil.Discard,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, "setting Stdout with Detach not valid")
+
+	_, err = exec.StartDetached(exec.RunParams{
+		Commands: "true",
+		Timeout:  time.Second,
+	})
+	c.Assert(err, gc.ErrorMatches, "setting Timeout with Detach not valid")
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"os"
+)
+
+// Plan describes a command prepared with RunParams.DryRun.
+type Plan struct {
+	// Path holds the resolved path of the program, and Args its
+	// arguments, starting with the program name.
+	Path string
+	Args []string
+
+	// Env holds the complete environment of the process.
+	Env []string
+
+	// Dir holds the working directory, or "" for the agent's.
+	Dir string
+
+	// Input holds the text, including any interpreter prelude, that
+	// would have been written to the program's standard input, before
+	// anything read from RunParams.Stdin.
+	Input string
+
+	// Script holds the contents of the script file, including any
+	// interpreter prelude, when RunParams.ScriptFile is set. The file
+	// named in Args is not kept.
+	Script string
+}
+
+// newPlan describes the command prepared in r.ps, with the given input.
+func (r *RunParams) newPlan(input string) *Plan {
+	env := r.ps.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	return &Plan{
+		Path:  r.ps.Path,
+		Args:  append([]string(nil), r.ps.Args...),
+		Env:   append([]string(nil), env...),
+		Dir:   r.ps.Dir,
+		Input: input,
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type dryRunSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&dryRunSuite{})
+
+func (*dryRunSuite) TestDryRunCommands(c *gc.C) {
+	dir := c.MkDir()
+	marker := filepath.Join(dir, "marker")
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:        "touch " + marker,
+		WorkingDir:      dir,
+		Environment:     []string{"A=b"},
+		EnvironmentMode: exec.ReplaceEnvironment,
+		Interpreter:     &exec.Sh,
+		DryRun:          true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Shell, gc.Equals, "/bin/sh")
+	c.Assert(resp.Plan, jc.DeepEquals, &exec.Plan{
+		Path:  "/bin/sh",
+		Args:  []string{"/bin/sh", "-s"},
+		Env:   []string{"A=b"},
+		Dir:   dir,
+		Input: "touch " + marker,
+	})
+	_, err = os.Stat(marker)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+}
+
+func (s *dryRunSuite) TestDryRunArgs(c *gc.C) {
+	s.PatchEnvironment("PATH", "/bin")
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:   []string{"sh", "-c", "exit 1"},
+		DryRun: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(resp.Plan.Path, gc.Equals, "/bin/sh")
+	c.Assert(resp.Plan.Args, jc.DeepEquals, []string{"sh", "-c", "exit 1"})
+	c.Assert(resp.Plan.Env, jc.DeepEquals, os.Environ())
+}
+
+func (*dryRunSuite) TestDryRunCreatesNothing(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "new")
+	out := filepath.Join(c.MkDir(), "out")
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:         "true",
+		WorkingDir:       dir,
+		CreateWorkingDir: &exec.DirParams{},
+		StdoutPath:       out,
+		DryRun:           true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Plan.Dir, gc.Equals, dir)
+	_, err = os.Stat(dir)
+	c.Assert(err, jc.Satisfies, os.IsNotExist)
+	entries, err := filepath.Glob(filepath.Join(filepath.Dir(out), "*"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(entries, gc.HasLen, 0)
+}
+
+func (*dryRunSuite) TestDryRunChecksWorkingDir(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:         "true",
+		WorkingDir:       filepath.Join(c.MkDir(), "missing"),
+		EnsureWorkingDir: true,
+		DryRun:           true,
+	})
+	c.Assert(err, gc.ErrorMatches, `working directory ".*missing" not found`)
+}
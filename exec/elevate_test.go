@@ -0,0 +1,111 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type elevateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&elevateSuite{})
+
+// fakeSudo is a stand-in for sudo that allows any command to be run,
+// announcing that it did so.
+const fakeSudo = `#!/bin/sh
+[ "$1" = -n ] || exit 2
+shift
+if [ "$1" = -l ]; then
+	shift 2
+	echo "$@"
+	exit 0
+fi
+shift
+echo "via sudo"
+exec "$@"
+`
+
+// refusingSudo is a stand-in for sudo that requires a password.
+const refusingSudo = `#!/bin/sh
+echo "sudo: a password is required" >&2
+exit 1
+`
+
+func (s *elevateSuite) patchSudo(c *gc.C, script string) {
+	path := filepath.Join(c.MkDir(), "sudo")
+	err := ioutil.WriteFile(path, []byte(script), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	s.PatchValue(exec.SudoPath, path)
+	s.PatchValue(exec.Geteuid, func() int { return 1000 })
+}
+
+func (s *elevateSuite) TestElevateThroughSudo(c *gc.C) {
+	s.patchSudo(c, fakeSudo)
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:    []string{"/bin/echo", "hello"},
+		Elevate: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "via sudo\nhello\n")
+
+	resp, err = exec.RunCommands(exec.RunParams{
+		Commands: "echo hello",
+		Elevate:  true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "via sudo\nhello\n")
+}
+
+func (s *elevateSuite) TestElevateRefused(c *gc.C) {
+	s.patchSudo(c, refusingSudo)
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo hello",
+		Elevate:  true,
+	})
+	c.Assert(errors.Cause(err), gc.Equals, exec.ErrElevationUnavailable)
+	c.Assert(err, gc.ErrorMatches, "sudo: a password is required: privilege elevation not available")
+}
+
+func (s *elevateSuite) TestElevateNoSudo(c *gc.C) {
+	s.PatchValue(exec.SudoPath, filepath.Join(c.MkDir(), "sudo"))
+	s.PatchValue(exec.Geteuid, func() int { return 1000 })
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo hello",
+		Elevate:  true,
+	})
+	c.Assert(errors.Cause(err), gc.Equals, exec.ErrElevationUnavailable)
+	c.Assert(err, gc.ErrorMatches, "sudo not found: privilege elevation not available")
+}
+
+func (s *elevateSuite) TestElevateAsRoot(c *gc.C) {
+	s.PatchValue(exec.SudoPath, filepath.Join(c.MkDir(), "sudo"))
+	s.PatchValue(exec.Geteuid, func() int { return 0 })
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo hello",
+		Elevate:  true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "hello\n")
+}
+
+func (s *elevateSuite) TestElevateWithUser(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		Elevate:  true,
+		User:     "nobody",
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
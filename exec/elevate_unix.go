@@ -0,0 +1,47 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+var (
+	geteuid  = os.Geteuid
+	sudoPath = "sudo"
+)
+
+// elevate arranges for cmd to be run as root through "sudo -n",
+// unless the agent is already running as root. Before doing so it
+// asks sudo whether the command may be run without a password, so
+// that a refusal is reported as ErrElevationUnavailable rather than
+// as the command failing.
+func elevate(cmd *exec.Cmd) error {
+	if geteuid() == 0 || cmd.Err != nil {
+		return nil
+	}
+	sudo, err := exec.LookPath(sudoPath)
+	if err != nil {
+		return errors.Annotate(ErrElevationUnavailable, "sudo not found")
+	}
+	argv := append([]string{cmd.Path}, cmd.Args[1:]...)
+	check := exec.Command(sudo, append([]string{"-n", "-l", "--"}, argv...)...)
+	check.Env = cmd.Env
+	if out, err := check.CombinedOutput(); err != nil {
+		reason := strings.TrimSpace(string(out))
+		if reason == "" {
+			reason = err.Error()
+		}
+		return errors.Annotate(ErrElevationUnavailable, reason)
+	}
+	cmd.Path = sudo
+	cmd.Args = append([]string{sudo, "-n", "--"}, argv...)
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"github.com/juju/errors"
+)
+
+// tokenElevation is the TOKEN_INFORMATION_CLASS value that reports
+// whether a token is elevated.
+const tokenElevation = 20
+
+// elevate checks that cmd will run with an elevated token. A process
+// can only be elevated without user interaction if the agent itself
+// is elevated, as otherwise UAC asks for consent, so in that case
+// ErrElevationUnavailable is returned.
+func elevate(cmd *exec.Cmd) error {
+	elevated, err := isElevated()
+	if err != nil {
+		return errors.Annotate(ErrElevationUnavailable, err.Error())
+	}
+	if !elevated {
+		return errors.Annotate(ErrElevationUnavailable, "agent is not running elevated")
+	}
+	return nil
+}
+
+// isElevated reports whether the agent's process token is elevated.
+func isElevated() (bool, error) {
+	proc, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(proc, syscall.TOKEN_QUERY, &token); err != nil {
+		return false, errors.Annotate(err, "cannot open process token")
+	}
+	defer token.Close()
+	var elevation uint32
+	var n uint32
+	err = syscall.GetTokenInformation(token, tokenElevation, (*byte)(unsafe.Pointer(&elevation)), uint32(unsafe.Sizeof(elevation)), &n)
+	if err != nil {
+		return false, errors.Annotate(err, "cannot query token elevation")
+	}
+	return elevation != 0, nil
+}
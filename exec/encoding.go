@@ -0,0 +1,64 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// decodeOutput returns data converted to UTF-8. Data that starts with
+// a UTF-16 byte order mark, or that looks like UTF-16 text, is decoded
+// as little-endian UTF-16, which is what Windows programs that write
+// "Unicode" produce. Otherwise data that is not valid UTF-8 is decoded
+// by decodeCodePage, and returned unchanged if that fails.
+func decodeOutput(data []byte, decodeCodePage func([]byte) ([]byte, error)) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	if len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe {
+		return decodeUTF16(data[2:])
+	}
+	if looksLikeUTF16(data) {
+		return decodeUTF16(data)
+	}
+	if utf8.Valid(data) {
+		return data
+	}
+	decoded, err := decodeCodePage(data)
+	if err != nil {
+		logger.Debugf("cannot decode output: %v", err)
+		return data
+	}
+	return decoded
+}
+
+// looksLikeUTF16 reports whether data is likely to be text encoded as
+// little-endian UTF-16. Text in UTF-8 or a code page never contains
+// zero bytes, whereas in UTF-16 the ASCII characters, not least line
+// endings, have a zero in their second byte.
+func looksLikeUTF16(data []byte) bool {
+	if len(data)%2 != 0 {
+		return false
+	}
+	zeros := false
+	for i := 0; i < len(data); i += 2 {
+		if data[i] == 0 {
+			return false
+		}
+		if data[i+1] == 0 {
+			zeros = true
+		}
+	}
+	return zeros
+}
+
+// decodeUTF16 decodes little-endian UTF-16 data as UTF-8.
+func decodeUTF16(data []byte) []byte {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	return []byte(string(utf16.Decode(units)))
+}
@@ -0,0 +1,12 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec
+
+// decodeConsoleOutput returns data unchanged, as the output of
+// commands is only decoded on Windows.
+func decodeConsoleOutput(data []byte) []byte {
+	return data
+}
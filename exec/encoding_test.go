@@ -0,0 +1,77 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"errors"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type encodingSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&encodingSuite{})
+
+// decodeLatin1 decodes ISO 8859-1, standing in for a code page.
+func decodeLatin1(data []byte) ([]byte, error) {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return []byte(string(runes)), nil
+}
+
+func failDecode([]byte) ([]byte, error) {
+	return nil, errors.New("cannot decode")
+}
+
+func (*encodingSuite) TestDecodeOutput(c *gc.C) {
+	for i, test := range []struct {
+		about  string
+		data   string
+		decode func([]byte) ([]byte, error)
+		expect string
+	}{{
+		about:  "empty",
+		data:   "",
+		expect: "",
+	}, {
+		about:  "UTF-8 left unchanged",
+		data:   "café П\r\n",
+		expect: "café П\r\n",
+	}, {
+		about:  "UTF-16 with byte order mark",
+		data:   "\xff\xfeh\x00\xe9\x00\x1f\x04",
+		expect: "héП",
+	}, {
+		about:  "UTF-16 without byte order mark",
+		data:   "o\x00k\x00\r\x00\n\x00",
+		expect: "ok\r\n",
+	}, {
+		about:  "UTF-16 mostly outside ASCII",
+		data:   "\x1f\x04\x40\x04\n\x00",
+		expect: "Пр\n",
+	}, {
+		about:  "code page",
+		data:   "caf\xe9\r\n",
+		expect: "café\r\n",
+	}, {
+		about:  "undecodable",
+		data:   "caf\xe9",
+		decode: failDecode,
+		expect: "caf\xe9",
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		decode := test.decode
+		if decode == nil {
+			decode = decodeLatin1
+		}
+		c.Check(string(exec.DecodeOutput([]byte(test.data), decode)), gc.Equals, test.expect)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/juju/errors"
+)
+
+var (
+	procGetOEMCP            = syscall.NewLazyDLL("kernel32.dll").NewProc("GetOEMCP")
+	procMultiByteToWideChar = syscall.NewLazyDLL("kernel32.dll").NewProc("MultiByteToWideChar")
+)
+
+// decodeConsoleOutput returns output written by a console program
+// converted to UTF-8, decoding it from the OEM code page, in which
+// console programs write by default, if it is not UTF-16 or UTF-8.
+func decodeConsoleOutput(data []byte) []byte {
+	return decodeOutput(data, decodeOEMCodePage)
+}
+
+// decodeOEMCodePage decodes data from the OEM code page.
+func decodeOEMCodePage(data []byte) ([]byte, error) {
+	cp, _, _ := procGetOEMCP.Call()
+	n, _, err := procMultiByteToWideChar.Call(cp, 0, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), 0, 0)
+	if n == 0 {
+		return nil, errors.Annotatef(err, "cannot decode code page %d", cp)
+	}
+	wide := make([]uint16, n)
+	n, _, err = procMultiByteToWideChar.Call(cp, 0, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&wide[0])), n)
+	if n == 0 {
+		return nil, errors.Annotatef(err, "cannot decode code page %d", cp)
+	}
+	return []byte(string(utf16.Decode(wide[:n]))), nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type environmentSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&environmentSuite{})
+
+func (s *environmentSuite) TestInheritEnvironment(c *gc.C) {
+	s.PatchEnvironment("EXEC_TEST_INHERITED", "inherited")
+	s.PatchEnvironment("EXEC_TEST_REPLACED", "old")
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:    "echo $EXEC_TEST_INHERITED $EXEC_TEST_REPLACED $EXEC_TEST_ADDED; command -v sh",
+		Environment: []string{"EXEC_TEST_REPLACED=new", "EXEC_TEST_ADDED=added"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Matches, "inherited new added\n.*sh\n")
+}
+
+func (s *environmentSuite) TestReplaceEnvironment(c *gc.C) {
+	s.PatchEnvironment("EXEC_TEST_INHERITED", "inherited")
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:            []string{"/usr/bin/env"},
+		Environment:     []string{"ONLY=this"},
+		EnvironmentMode: exec.ReplaceEnvironment,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "ONLY=this\n")
+}
+
+func (*environmentSuite) TestMergeEnvironment(c *gc.C) {
+	merged := exec.MergeEnvironment(
+		[]string{"A=1", "B=2", "C=3"},
+		[]string{"B=two", "D=4", "A=one"},
+	)
+	c.Assert(merged, jc.DeepEquals, []string{"A=one", "B=two", "C=3", "D=4"})
+	c.Assert(exec.MergeEnvironment([]string{"A=1"}, nil), gc.IsNil)
+}
@@ -5,121 +5,1098 @@ package exec
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/juju/errors"
 
 	"github.com/juju/loggo"
+
+	"github.com/juju/utils/clock"
+	"github.com/juju/utils/ioutils"
+	"github.com/juju/utils/term"
+	"github.com/juju/utils/winjob"
 )
 
 var logger = loggo.GetLogger("juju.util.exec")
 
+// ErrTimedOut is returned by Wait when the command was killed because
+// it ran for longer than RunParams.Timeout.
+var ErrTimedOut = errors.New("command timed out")
+
+// ErrInactivityTimeout is returned by Wait when the command was
+// killed because it produced no output for RunParams.InactivityTimeout.
+var ErrInactivityTimeout = errors.New("command produced no output within inactivity timeout")
+
+// ErrNotStarted is returned by the methods of RunParams that act on
+// the running process when Run has not started one.
+var ErrNotStarted = errors.New("No process has been started yet")
+
+// ErrElevationUnavailable is the cause of the error returned by Run
+// when RunParams.Elevate is set but the command cannot be run with
+// elevated privileges without user interaction.
+var ErrElevationUnavailable = errors.New("privilege elevation not available")
+
 // Parameters for RunCommands.  Commands contains one or more commands to be
 // executed using '/bin/bash -s'.  If WorkingDir is set, this is passed
-// through to bash.  Similarly if the Environment is specified, this is used
-// for executing the command.
+// through to bash.  Similarly if the Environment is specified, its variables
+// are added to those of the agent for executing the command; see
+// EnvironmentMode.
 type RunParams struct {
 	Commands    string
 	WorkingDir  string
 	Environment []string
 
-	stdout *bytes.Buffer
-	stderr *bytes.Buffer
-	ps     *exec.Cmd
+	// EnvironmentMode determines whether Environment is merged into
+	// the agent's environment, the default, or replaces it.
+	EnvironmentMode EnvironmentMode
+
+	// NormalizeLocale causes the command to run in Locale, or
+	// DefaultLocale if that is empty, regardless of the locale of the
+	// agent or of Environment, so that output meant to be parsed is
+	// not translated. The variables that select the locale are set
+	// accordingly. On Windows, where the language of messages is not
+	// chosen by environment variables, it has no effect.
+	NormalizeLocale bool
+	Locale          string
+
+	// Args, if set, holds the program to run and its arguments,
+	// which are passed to it directly rather than through a shell, so
+	// that they need no quoting. Commands must be empty and no
+	// Interpreter may be set; Stdin, if set, is the program's standard
+	// input. If ExpandVariables is set, variables are expanded in each
+	// argument.
+	Args []string
+
+	// Sequence, if set, holds commands that are run one after another
+	// by a single POSIX shell, such as the default Bash, so that they
+	// share state such as the working directory and shell variables,
+	// stopping at the first that exits with a non-zero code. The
+	// result of each command run is reported in ExecResponse.Steps,
+	// and the response's Code is that of the command that failed.
+	// Sequences are run by RunCommands and RunCommandsContext, not by
+	// Run. Commands, Args, Stdin, ScriptFile, Detach, DryRun and the
+	// output writers and files cannot be set with it, and the other
+	// consumers of the output see markers that the package uses to
+	// separate the commands' output.
+	Sequence []string
+
+	// Path, if set, holds the path of the program in Args, which is
+	// run from there rather than being looked up in PATH. Args[0] is
+	// still passed to the program as its name. LookPath returns a
+	// suitable path. With Chroot, it is the path within the root.
+	Path string
+
+	// Stdin, if set, is read after Commands has been sent to the
+	// shell, so that it can supply further commands or data for the
+	// commands to read. With bash, which reads its script a line at a
+	// time, Commands such as "exec sort" work on the data read from
+	// Stdin; powershell reads all of its input as the script. If
+	// Commands is empty, the script is taken entirely from Stdin.
+	//
+	// Wait does not return until the command has closed its standard
+	// input or run to the end of Stdin.
+	Stdin io.Reader
+
+	// Interpreter, if set, specifies the program that runs Commands
+	// in place of the default platform shell, Bash or on Windows
+	// PowerShell. Other shells, such as Sh and Pwsh, are predefined.
+	Interpreter *Interpreter
+
+	// RequireBash causes Run to fail if bash is not installed when it
+	// would be the default shell. Otherwise Sh is used in its place.
+	RequireBash bool
+
+	// ScriptFile causes Commands to be written to a temporary file,
+	// readable only by the user that runs them, which is given to the
+	// interpreter to run in place of sending the commands to its
+	// standard input; see Interpreter.ScriptArgs. Stdin, if set, is
+	// then the standard input of the commands. The file is removed
+	// once the command has finished.
+	ScriptFile bool
+
+	// ExpandVariables causes ${NAME} references in Commands to be
+	// replaced with values from Environment before the commands are
+	// run. See ExpandVariables for details.
+	ExpandVariables bool
+
+	// StrictVariables, when ExpandVariables is set, causes references
+	// to variables not defined in Environment to be an error.
+	StrictVariables bool
+
+	// EnsureWorkingDir checks that WorkingDir exists and is an
+	// accessible directory before the process is started, so that a
+	// problem is reported as a clear error rather than as a failure
+	// from the shell.
+	EnsureWorkingDir bool
+
+	// CreateWorkingDir, if set, causes a missing WorkingDir to be
+	// created as described before the process is started. It implies
+	// EnsureWorkingDir.
+	CreateWorkingDir *DirParams
+
+	// User and Group, if set, name the user and group, by name or
+	// numeric ID, that the command runs as. The agent must have the
+	// privilege to switch to them. When User is set, the command is
+	// given the user's supplementary groups, and its primary group
+	// unless Group is set. The environment is not changed, so HOME and
+	// similar variables should be set in Environment if needed. They
+	// are not supported on Windows; see WindowsOptions.Token.
+	User  string
+	Group string
+
+	// Elevate runs the command with administrative privileges. On
+	// Unix, unless the agent is already running as root, the command
+	// is run through "sudo -n", which must allow it to be run without
+	// a password; sudo applies its own policy to the environment. On
+	// Windows the agent must itself be running elevated. If elevation
+	// is not possible, Run returns an error whose cause is
+	// ErrElevationUnavailable. It cannot be combined with User or
+	// Group.
+	Elevate bool
+
+	// Limits, if set, restricts the resources available to the
+	// command. Setting any limit on Windows causes Run to return an
+	// error satisfying errors.IsNotSupported.
+	Limits *ResourceLimits
+
+	// Umask, if set, holds the file mode creation mask (see umask(2))
+	// that the command runs with, in place of the agent's, so that
+	// the files it creates have predictable permissions. It is set by
+	// a shell that then executes the command. It is not supported on
+	// Windows.
+	Umask *os.FileMode
+
+	// Cgroup, if set, causes the command to be run in a transient
+	// cgroup with the given limits. Setting it on platforms other than
+	// Linux causes Run to return an error satisfying
+	// errors.IsNotSupported.
+	Cgroup *CgroupLimits
+
+	// Chroot, if set, holds the directory used as the root directory
+	// of the command (see chroot(2)), which requires privilege. The
+	// program, the default shell and WorkingDir, which defaults to
+	// its root, are found within it, programs named without a path
+	// being looked for in the directories in its PATH. It cannot be
+	// set with Elevate, ScriptFile, Limits or Umask, and is not
+	// supported on Windows.
+	Chroot string
+
+	// NewMountNamespace runs the command in a new mount namespace,
+	// so that the file systems it mounts, such as /proc within Chroot,
+	// are not visible to the agent and are unmounted once it and the
+	// processes it starts have exited. It requires privilege and is
+	// only supported on Linux.
+	NewMountNamespace bool
+
+	// NewSession runs the command in a new session (see setsid(2)),
+	// detaching it from the agent's controlling terminal so that
+	// terminal generated signals are not delivered to it. It is
+	// ignored on Windows.
+	NewSession bool
+
+	// ReapOrphans allows a reaper started by the reaper package as a
+	// subreaper to collect the exit status of processes that the
+	// command leaves behind in its process group once they are
+	// orphaned and exit. Processes that leave the group, as daemons
+	// usually do, are not collected, and nor are any other children
+	// of the agent. A reaper running as PID 1 collects every orphan
+	// regardless. It is only supported on Linux.
+	ReapOrphans bool
+
+	// Foreground places the command's process group in the foreground
+	// of the terminal attached to the agent's stdin, for tools that
+	// must own the terminal. It cannot be combined with NewSession and
+	// is ignored on Windows.
+	Foreground bool
+
+	// DryRun causes Run to prepare the command without starting it.
+	// Wait then returns a response whose Plan describes what would
+	// have been run, and Shell the shell that would have run it. The
+	// working directory is checked, and Elevate consults sudo, but
+	// nothing is created and AfterWait hooks and the auditor are not
+	// called.
+	DryRun bool
+
+	// Detach starts the command fully detached from the agent, for
+	// long-lived background services: it runs in a new session, or on
+	// Windows without a console, and Run returns as soon as it has
+	// started; Process or StartDetached give its process ID. Its
+	// standard output and standard error are appended to StdoutPath
+	// and StderrPath, which are written in place, or discarded if they
+	// are not set. The process is neither timed out nor killed with
+	// the agent, and Wait must not be called; it is reaped in the
+	// background once it exits. Options that capture or process the
+	// output, the timeouts, AllocatePTY and Foreground cannot be combined
+	// with it.
+	Detach bool
+
+	// AllocatePTY connects the command's standard output and standard
+	// error to a new pseudo-terminal, which becomes its controlling
+	// terminal, for tools that behave differently or refuse to run
+	// without one. The commands, and Stdin, are still written to its
+	// standard input, so that the shell does not run interactively.
+	// The terminal output is captured in ExecResponse.Stdout, or
+	// sent wherever standard output is directed, with the line
+	// endings written by the terminal, usually "\r\n"; nothing is
+	// reported as standard error. The terminal is 80 columns by 24
+	// rows. It is only supported on Linux and implies NewSession.
+	AllocatePTY bool
+
+	// StdoutPath and StderrPath, if set, name files that receive the
+	// command's standard output and standard error instead of them
+	// being captured in memory. Unless OutputWrite says otherwise,
+	// each file is written under a temporary name and only moved into
+	// place once the command has finished. Both may name the same
+	// file. When nothing else, such as OnStdoutLine or a Transcript,
+	// consumes the output, the command writes to the file directly,
+	// without the output passing through the agent.
+	StdoutPath string
+	StderrPath string
+
+	// OutputWrite determines how StdoutPath and StderrPath are
+	// written.
+	OutputWrite OutputWriteMode
+
+	// Stdout and Stderr, if set, receive the command's standard
+	// output and standard error as it is produced, instead of it
+	// being captured in memory; the corresponding ExecResponse field
+	// is then left empty. They may be the same writer, in which case
+	// it is never written to concurrently. Neither may be combined
+	// with the corresponding output path.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// MaxOutputBytes, if positive, limits the output of each stream
+	// captured in ExecResponse, so that a command producing a great
+	// deal of output cannot exhaust the agent's memory. The first
+	// MaxOutputBytes bytes are kept, or the last if KeepOutputTail is
+	// set, and the rest are discarded; ExecResponse.StdoutTruncated
+	// and StderrTruncated record whether that happened. The limit
+	// does not apply to output sent to writers or files. It applies
+	// to the combined output as a whole.
+	MaxOutputBytes int
+	KeepOutputTail bool
+
+	// Capture determines whether the output is captured separately,
+	// combined into a single stream, or both. The combined output
+	// preserves the order in which the command wrote to the two
+	// streams exactly when nothing but the capture consumes it;
+	// otherwise the streams are merged as they are read, which may
+	// reorder writes made close together. Output sent to writers or
+	// files is not captured in either form. It cannot be set with
+	// Detach.
+	Capture CaptureMode
+
+	// StripANSI removes ANSI escape sequences, such as colors, from
+	// the command's output before it is captured, written to Stdout,
+	// Stderr or the output files, or passed to any other consumer of
+	// the output. It cannot be set with Detach.
+	StripANSI bool
+
+	// OnStdoutLine and OnStderrLine, if set, are called with each
+	// line the command writes to standard output or standard error,
+	// without the line ending, as soon as the line is complete. A
+	// final line without a newline is passed on once the command has
+	// exited, before Wait returns. The two may be called concurrently
+	// with each other, but each is called for one line at a time.
+	OnStdoutLine func(line string)
+	OnStderrLine func(line string)
+
+	// LogOutput causes each line of the command's output to be logged
+	// as soon as it is complete, so that long-running commands can be
+	// followed in the logs. Standard output is logged at
+	// StdoutLogLevel, DEBUG if unspecified, and standard error at
+	// StderrLogLevel, WARNING if unspecified. Redactions are applied
+	// to the logged lines. It cannot be set with Detach.
+	LogOutput      bool
+	StdoutLogLevel loggo.Level
+	StderrLogLevel loggo.Level
+
+	// TimestampOutput causes each line of the output to be recorded,
+	// with the time it was read and the stream it was written to, in
+	// ExecResponse.OutputLines, so that it can be seen where a slow
+	// command spent its time. MaxOutputBytes and KeepOutputTail limit
+	// the total length of the lines recorded. The lines are recorded
+	// as the command wrote them, even when Windows.DecodeOutput is
+	// set. It cannot be set with Detach.
+	TimestampOutput bool
+
+	// OutputFileMode holds the permissions of files created for
+	// StdoutPath and StderrPath. If zero, 0644 is used. Existing files
+	// written in place keep their permissions.
+	OutputFileMode os.FileMode
+
+	// Transcript, if set, receives a merged transcript of the
+	// command's output as it is produced. Each line is prefixed with
+	// the time elapsed since the command started and a tag (StdoutTag
+	// or StderrTag) identifying the stream it was written to.
+	Transcript io.Writer
+
+	// TranscriptSize, if positive, causes up to that many bytes of the
+	// most recent transcript lines to be returned in
+	// ExecResponse.Transcript.
+	TranscriptSize int
+
+	// Timeout, if positive, bounds the time the command may run,
+	// measured from when it is started. A command still running when
+	// it expires is killed, and Wait returns ErrTimedOut along with the
+	// output captured until then.
+	Timeout time.Duration
+
+	// InactivityTimeout, if positive, bounds the time the command may
+	// run without writing anything to standard output or standard
+	// error, so that a command that has hung can be told apart from
+	// one that is merely slow. A command that is silent for longer is
+	// killed, and Wait returns ErrInactivityTimeout along with the
+	// output captured until then.
+	InactivityTimeout time.Duration
+
+	// Heartbeat, if set, causes a function to be called at regular
+	// intervals while the command is waited for. It cannot be set with
+	// Detach.
+	Heartbeat *Heartbeat
+
+	// GracePeriod, if positive, gives a command that is being killed
+	// because its context is done or a timeout has expired a chance
+	// to clean up: it is first sent SIGTERM, or on Windows a
+	// CTRL_BREAK event, and only killed if it is still running after
+	// this long. On Windows the event is only delivered to commands
+	// started with WindowsOptions.NewProcessGroup.
+	GracePeriod time.Duration
+
+	// Retry, if set, causes RunCommands and RunCommandsContext to run
+	// the command again if it fails in a way that the policy deems
+	// retryable. It cannot be combined with Stdin, which can only be
+	// read once.
+	Retry *RetryPolicy
+
+	// Redactions holds patterns matching secrets, such as passwords
+	// in Commands, that are replaced with Redacted in log messages,
+	// in the text of errors returned for the command, in audit
+	// records and in the commands reported by Running. RedactString
+	// makes a pattern from a literal string.
+	// RedactEnv names variables in Environment whose values are
+	// redacted in the same way. If RedactOutput is set, redactions are
+	// also applied to the output captured in ExecResponse, but not to
+	// output sent to writers, files or callbacks.
+	Redactions   []*regexp.Regexp
+	RedactEnv    []string
+	RedactOutput bool
+
+	// TraceContext, if set, holds the span, if any, that is the
+	// parent of the span created for the command by the Tracer set
+	// with SetTracer. RunCommandsContext uses its context if this is
+	// not set.
+	TraceContext context.Context
+
+	// MetricName, if set, is the name by which the command is
+	// reported to the Metrics set with SetMetrics, in place of the
+	// name of the program that is run. Callers running varied
+	// commands with the same program, such as shell scripts, can use
+	// it to tell them apart.
+	MetricName string
+
+	// Hooks, if set, are called around this command in addition to
+	// those added with AddHooks, after them before it starts and
+	// before them once it has been waited for.
+	Hooks *Hooks
+
+	// Clock is used to measure the timeouts, the grace period and the
+	// delay between retries, and to record when the command started
+	// and when lines of output were read. If nil, clock.WallClock is used.
+	Clock clock.Clock
+
+	// Windows holds process creation options that only apply on
+	// Windows. They are ignored on other platforms.
+	Windows WindowsOptions
+
+	transcript   *transcript
+	stdoutTap    io.Writer
+	stderrTap    io.Writer
+	lines        []*lineWriter
+	plan         *Plan
+	activeHooks  []*Hooks
+	metrics      Metrics
+	slot         *semaphore
+	slotHeld     bool
+	ctx          context.Context
+	span         CommandSpan
+	activity     *activityMonitor
+	outputBytes  *ioutils.CountingWriter
+	pty          *pty
+	cgroup       *cgroup
+	openStdin    bool
+	stdinPipe    io.WriteCloser
+	pendingInput string
+	oomBefore    int
+	script       string
+	started      time.Time
+	shell        string
+	job          *winjob.Job
+	stdout       *ioutils.LimitedBuffer
+	stderr       *ioutils.LimitedBuffer
+	combined     *ioutils.LimitedBuffer
+	outputLines  *lineRecorder
+	stdoutFile   *outputFile
+	stderrFile   *outputFile
+	ps           *exec.Cmd
+}
+
+// WindowsOptions holds Windows specific options controlling how the
+// powershell process is created.
+type WindowsOptions struct {
+	// NewProcessGroup creates the process in a new process group
+	// (CREATE_NEW_PROCESS_GROUP), so that console control events such
+	// as Ctrl-C sent to the agent are not delivered to it.
+	NewProcessGroup bool
+
+	// HideWindow prevents a console window from being shown for the
+	// process and any GUI tools it starts.
+	HideWindow bool
+
+	// DetachConsole starts the process without inheriting the parent's
+	// console (DETACHED_PROCESS).
+	DetachConsole bool
+
+	// UTF8 switches the console code page and the powershell output
+	// encoding to UTF-8 before the commands are run. It has no effect
+	// when RunParams.Args is set.
+	UTF8 bool
+
+	// DecodeOutput converts the output captured in ExecResponse to
+	// UTF-8 from UTF-16, as written by some programs, or from the OEM
+	// code page, in which console programs write by default and
+	// powershell itself writes unless UTF8 is set. Output that is
+	// already valid UTF-8 is left unchanged, as is output copied to
+	// RunParams.Stdout and Stderr.
+	DecodeOutput bool
+
+	// Token, if not zero, holds the handle of an access token, such
+	// as one obtained from LogonUser, for the user the process runs
+	// as.
+	Token uintptr
+
+	// Job, if set, holds a job object that the process is assigned to
+	// once started, so that it and all its descendants can be limited
+	// and terminated together. If it is not set, the process is
+	// assigned to a job created for it, which is closed, killing any
+	// processes left in it, when the process exits. Killing the
+	// command terminates the whole job.
+	Job *winjob.Job
 }
 
 // ExecResponse contains the return code and output generated by executing a
-// command.
+// command. When output was written to a file rather than captured, the
+// file's path is recorded instead.
 type ExecResponse struct {
 	Code   int
 	Stdout []byte
 	Stderr []byte
+
+	// StdoutTruncated and StderrTruncated report whether output was
+	// discarded because of RunParams.MaxOutputBytes.
+	StdoutTruncated bool
+	StderrTruncated bool
+
+	// Combined holds the standard output and standard error
+	// interleaved, when RunParams.Capture asks for it;
+	// CombinedTruncated reports whether any of it was discarded
+	// because of RunParams.MaxOutputBytes.
+	Combined          []byte
+	CombinedTruncated bool
+
+	// OutputLines holds the lines of output recorded when
+	// RunParams.TimestampOutput is set, in the order they were read;
+	// OutputLinesTruncated reports whether any were discarded because
+	// of RunParams.MaxOutputBytes.
+	OutputLines          []OutputLine
+	OutputLinesTruncated bool
+
+	StdoutPath string
+	StderrPath string
+
+	// Shell holds the path of the shell or interpreter that ran the
+	// commands. It is empty when RunParams.Args was set.
+	Shell string
+
+	// PID holds the process ID of the command, StartTime when it was
+	// started and Duration how long it ran for.
+	PID       int
+	StartTime time.Time
+	Duration  time.Duration
+
+	// Plan describes the command that would have been run when
+	// RunParams.DryRun is set.
+	Plan *Plan
+
+	// Attempts holds the number of times the command was run, which
+	// is more than one if RunCommands or RunCommandsContext retried it
+	// according to RunParams.Retry.
+	Attempts int
+
+	// Signal holds the signal that terminated the process, if it did
+	// not exit normally, and CoreDumped reports whether it produced a
+	// core dump. These are never set on Windows.
+	Signal     syscall.Signal
+	CoreDumped bool
+
+	// OOMKilled reports that the process, or a command run by it,
+	// was killed by SIGKILL while the kernel's OOM killer recorded a
+	// kill in the agent's memory cgroup, or that the OOM killer killed
+	// a process in the cgroup created for RunParams.Cgroup. It is only
+	// detected on Linux.
+	OOMKilled bool
+
+	// CgroupPath holds the path of the cgroup created for
+	// RunParams.Cgroup, which has been removed by the time the
+	// response is returned.
+	CgroupPath string
+
+	// Steps holds the results of the commands run for
+	// RunParams.Sequence, in order, up to and including any that
+	// failed, as reported by FirstFailure.
+	Steps []StepResult
+
+	// Transcript holds the most recent transcript lines when
+	// RunParams.TranscriptSize is set; TranscriptTruncated reports
+	// whether earlier lines were discarded.
+	Transcript          []byte
+	TranscriptTruncated bool
 }
 
-// mergeEnvironment takes in a string array representing the desired environment
-// and merges it with the current environment. On Windows, clearing the environment,
-// or having missing environment variables, may lead to standard go packages not working
-// (os.TempDir relies on $env:TEMP), and powershell erroring out
-// Currently this function is only used for windows
-func mergeEnvironment(env []string) []string {
-	if env == nil {
-		return nil
+// RunningCommand describes a command that has been started by Run and
+// has not yet been waited for.
+type RunningCommand struct {
+	Commands   string
+	Args       []string
+	WorkingDir string
+	PID        int
+	Started    time.Time
+}
+
+var (
+	// startMutex is held for reading while a command is being started
+	// and tracked, so that WithOwnedProcesses never observes a child
+	// that has been forked but not yet recorded.
+	startMutex   sync.RWMutex
+	runningMutex sync.Mutex
+	running      = make(map[*exec.Cmd]RunningCommand)
+
+	// orphanGroups holds the process groups of the commands started
+	// with ReapOrphans that may still hold orphaned processes. It is
+	// guarded by runningMutex.
+	orphanGroups = make(map[int]bool)
+
+	// reapers holds the number of reapers that have called
+	// StartReaping and not StopReaping. While it is zero, nothing
+	// collects the orphans in orphanGroups, so each group is dropped
+	// once the command leading it has been waited for. It is guarded
+	// by runningMutex.
+	reapers int
+)
+
+// Running returns the commands currently being executed through this
+// package, ordered by their start time.
+func Running() []RunningCommand {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	result := make([]RunningCommand, 0, len(running))
+	for _, cmd := range running {
+		result = append(result, cmd)
+	}
+	sort.Sort(byStarted(result))
+	return result
+}
+
+type byStarted []RunningCommand
+
+func (b byStarted) Len() int           { return len(b) }
+func (b byStarted) Less(i, j int) bool { return b[i].Started.Before(b[j].Started) }
+func (b byStarted) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// WithOwnedProcesses calls f with the set of process IDs started by Run
+// that have not yet been collected by Wait, and with the set of process
+// groups of the commands started with ReapOrphans, whose other members
+// may be collected. No new commands are started until f returns. This
+// allows code that reaps child processes, such as the reaper package,
+// to collect only the orphans it was asked to and to avoid stealing
+// exit statuses from Wait.
+func WithOwnedProcesses(f func(owned, reapable map[int]bool)) {
+	startMutex.Lock()
+	defer startMutex.Unlock()
+	runningMutex.Lock()
+	owned := make(map[int]bool, len(running))
+	for _, cmd := range running {
+		owned[cmd.PID] = true
+	}
+	reapable := make(map[int]bool, len(orphanGroups))
+	for pgid := range orphanGroups {
+		reapable[pgid] = true
+	}
+	runningMutex.Unlock()
+	f(owned, reapable)
+}
+
+// ReleaseOrphanGroup removes the process group pgid from the groups
+// passed to WithOwnedProcesses. It should be called by a reaper once
+// the command leading the group has been waited for and no process
+// remains in it.
+func ReleaseOrphanGroup(pgid int) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	delete(orphanGroups, pgid)
+}
+
+// StartReaping records that the caller has started collecting the
+// orphans in the process groups passed to WithOwnedProcesses, which it
+// must release with ReleaseOrphanGroup. StopReaping must be called
+// once it stops. While no reaper is running, a group is released as
+// soon as the command leading it has been waited for.
+func StartReaping() {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	reapers++
+}
+
+// StopReaping records that a reaper started with StartReaping has
+// stopped. When the last one stops, the groups of the commands that
+// have already been waited for are released.
+func StopReaping() {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	if reapers--; reapers > 0 {
+		return
 	}
-	m := make(map[string]string)
-	var tmpEnv []string
-	for _, val := range os.Environ() {
-		varSplit := strings.SplitN(val, "=", 2)
-		m[varSplit[0]] = varSplit[1]
+	reapers = 0
+	leaders := make(map[int]bool, len(running))
+	for _, cmd := range running {
+		leaders[cmd.PID] = true
+	}
+	for pgid := range orphanGroups {
+		if !leaders[pgid] {
+			delete(orphanGroups, pgid)
+		}
 	}
+}
 
-	for _, val := range env {
-		varSplit := strings.SplitN(val, "=", 2)
-		m[varSplit[0]] = varSplit[1]
+func trackRunning(ps *exec.Cmd, r *RunParams) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	running[ps] = RunningCommand{
+		Commands:   r.redact(r.Commands),
+		Args:       r.redactArgs(r.Args),
+		WorkingDir: r.WorkingDir,
+		PID:        ps.Process.Pid,
+		Started:    r.started,
+	}
+	if r.ReapOrphans && runtime.GOOS == "linux" {
+		// Every command leads its own process group, which the
+		// processes it starts join.
+		orphanGroups[ps.Process.Pid] = true
 	}
+}
 
-	for key, val := range m {
-		tmpEnv = append(tmpEnv, key+"="+val)
+func untrackRunning(ps *exec.Cmd) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	delete(running, ps)
+	if reapers == 0 {
+		delete(orphanGroups, ps.Process.Pid)
 	}
+}
+
+// EnvironmentMode determines how RunParams.Environment is applied.
+type EnvironmentMode int
+
+const (
+	// InheritEnvironment merges the variables in Environment into the
+	// agent's own environment, replacing those with the same names.
+	InheritEnvironment EnvironmentMode = iota
+
+	// ReplaceEnvironment uses Environment, if it is not nil, as the
+	// complete environment of the command. On Windows, a command
+	// without variables such as SystemRoot and TEMP may not work.
+	ReplaceEnvironment
+)
 
-	return tmpEnv
+// environment returns the environment for the command, or nil if it
+// should inherit the agent's environment unchanged.
+func (r *RunParams) environment() []string {
+	var env []string
+	if r.EnvironmentMode == ReplaceEnvironment {
+		env = r.Environment
+	} else {
+		env = mergeEnvironment(os.Environ(), r.Environment)
+	}
+	if r.NormalizeLocale && runtime.GOOS != "windows" {
+		if env == nil {
+			env = os.Environ()
+		}
+		env = mergeEnvironment(env, localeVariables(r.Locale))
+	}
+	return env
 }
 
-// shellAndArgs is a helper function that returns an OS specific
-// shell and arguments for that particular shell
-func shellAndArgs() (string, []string) {
-	var com []string
-	switch runtime.GOOS {
-	case "windows":
-		com = []string{
-			"powershell.exe",
-			"-noprofile",
-			"-noninteractive",
-			"-command",
-			"try{$input|iex; exit $LastExitCode}catch{Write-Error -Message $Error[0]; exit 1}",
+// mergeEnvironment returns base with the variables in env added to it,
+// replacing any with the same names, which are compared without
+// regard to case on Windows. The order of the variables in base is
+// kept. It returns nil if env is nil.
+func mergeEnvironment(base, env []string) []string {
+	if env == nil {
+		return nil
+	}
+	key := func(kv string) string {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if runtime.GOOS == "windows" {
+			return strings.ToUpper(name)
 		}
-	default:
-		com = []string{
-			"/bin/bash",
-			"-s",
+		return name
+	}
+	merged := make([]string, 0, len(base)+len(env))
+	index := make(map[string]int)
+	for _, kv := range append(append([]string(nil), base...), env...) {
+		k := key(kv)
+		if i, ok := index[k]; ok {
+			merged[i] = kv
+			continue
 		}
+		index[k] = len(merged)
+		merged = append(merged, kv)
 	}
-	return com[0], com[1:]
+	return merged
 }
 
 // Run sets up the command environment (environment variables, working dir)
 // and starts the process. The commands are passed into '/bin/bash -s' through stdin
 // on Linux machines and to powershell on Windows machines.
 func (r *RunParams) Run() error {
-	if runtime.GOOS == "windows" {
-		r.Environment = mergeEnvironment(r.Environment)
+	err := r.acquireSlot()
+	if err == nil {
+		err = r.redactError(r.run())
+	}
+	if err != nil {
+		r.releaseSlot()
+	}
+	if err != nil || r.DryRun {
+		r.removeScript()
+		if r.cgroup != nil {
+			r.cgroup.remove()
+			r.cgroup = nil
+		}
+	}
+	if r.DryRun {
+		return err
 	}
-	shell, args := shellAndArgs()
-	r.ps = exec.Command(shell, args...)
-	if r.Environment != nil {
-		r.ps.Env = r.Environment
+	if err != nil {
+		r.endSpan(nil, err)
+		r.audit(nil, err)
+	} else if r.Detach {
+		r.endSpan(nil, nil)
+		r.audit(nil, nil)
+	}
+	return err
+}
+
+// run implements Run.
+func (r *RunParams) run() error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	r.started = time.Time{}
+	r.plan = nil
+	r.activeHooks = collectHooks(r.Hooks)
+	for _, h := range r.activeHooks {
+		if h.BeforeStart != nil {
+			if err := h.BeforeStart(r); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	if len(r.activeHooks) > 0 {
+		// The hooks may have changed the parameters.
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	env := r.environment()
+	commands := r.Commands
+	args := r.Args
+	if r.ExpandVariables {
+		var err error
+		commands, err = ExpandVariables(r.Commands, env, r.StrictVariables)
+		if err != nil {
+			return errors.Annotate(err, "cannot expand commands")
+		}
+		args = make([]string, len(r.Args))
+		for i, arg := range r.Args {
+			args[i], err = ExpandVariables(arg, env, r.StrictVariables)
+			if err != nil {
+				return errors.Annotate(err, "cannot expand arguments")
+			}
+		}
+	}
+	if err := r.ensureWorkingDir(); err != nil {
+		return err
+	}
+	env = r.startSpan(env)
+	r.shell = ""
+	var script string
+	if len(args) > 0 && r.Path != "" {
+		r.ps = &exec.Cmd{
+			Path: r.Path,
+			Args: args,
+			Env:  env,
+		}
+	} else if len(args) > 0 {
+		r.ps = exec.Command(args[0], args[1:]...)
+		r.ps.Env = env
+	} else {
+		shell := r.Interpreter
+		if shell == nil {
+			var err error
+			shell, err = defaultShell(r.RequireBash, r.Chroot)
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if r.ScriptFile {
+			var err error
+			r.ps, r.script, err = shell.scriptCommand(commands, env)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			script, commands = shell.Prelude+commands, ""
+		} else {
+			r.ps, commands = shell.command(commands, env)
+		}
+		r.shell = shell.Path
+	}
+	if r.Chroot != "" && r.Path == "" {
+		if err := chrootCommand(r.ps, r.Chroot); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if r.Limits != nil {
+		if err := limitCommand(r.ps, r.Limits); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if r.Umask != nil {
+		if err := umaskCommand(r.ps, *r.Umask); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if r.Elevate {
+		if err := elevate(r.ps); err != nil {
+			return err
+		}
 	}
 	if r.WorkingDir != "" {
 		r.ps.Dir = r.WorkingDir
+	} else if r.Chroot != "" {
+		// The command must not be left in a directory outside its
+		// root.
+		r.ps.Dir = "/"
+	}
+	r.ps.Stdin = bytes.NewBufferString(commands)
+	if r.openStdin {
+		// The caller writes the commands, and further input,
+		// to stdinPipe, which is closed by Wait once the process
+		// has exited.
+		r.ps.Stdin = nil
+		r.pendingInput = commands
+		stdin, err := r.ps.StdinPipe()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		r.stdinPipe = stdin
+	} else if r.Stdin != nil && commands == "" {
+		// Passing Stdin on directly lets a file, such as the read
+		// end of a pipe, be given to the process as it is.
+		r.ps.Stdin = r.Stdin
+	} else if r.Stdin != nil {
+		if !strings.HasSuffix(commands, "\n") {
+			// Ensure the last command is complete before the
+			// shell starts reading from Stdin.
+			commands += "\n"
+		}
+		r.ps.Stdin = io.MultiReader(strings.NewReader(commands), r.Stdin)
+	}
+
+	if r.DryRun {
+		r.plan = r.newPlan(commands)
+		r.plan.Script = script
+		return nil
+	}
+	if r.Detach {
+		return r.startDetached()
 	}
-	r.ps.Stdin = bytes.NewBufferString(r.Commands)
 
-	r.stdout = &bytes.Buffer{}
-	r.stderr = &bytes.Buffer{}
+	r.stdout = ioutils.NewLimitedBuffer(r.MaxOutputBytes, r.KeepOutputTail)
+	r.stderr = ioutils.NewLimitedBuffer(r.MaxOutputBytes, r.KeepOutputTail)
+	r.combined = nil
 
-	r.ps.Stdout = r.stdout
-	r.ps.Stderr = r.stderr
+	switch r.Capture {
+	case CaptureCombined, CaptureBoth:
+		r.combined = ioutils.NewLimitedBuffer(r.MaxOutputBytes, r.KeepOutputTail)
+		// Giving the command the same writer for both streams lets
+		// them share a pipe, which preserves their order.
+		w := &lockedWriter{w: r.combined}
+		r.ps.Stdout, r.ps.Stderr = w, w
+		if r.Capture == CaptureBoth {
+			r.ps.Stdout = io.MultiWriter(r.stdout, w)
+			r.ps.Stderr = io.MultiWriter(r.stderr, w)
+		}
+	default:
+		r.ps.Stdout = r.stdout
+		r.ps.Stderr = r.stderr
+	}
+	if err := configureCommand(r, r.ps); err != nil {
+		return err
+	}
+	r.cgroup = nil
+	if r.Cgroup != nil {
+		if err := createCgroup(r); err != nil {
+			return err
+		}
+	}
+	if err := r.openOutputFiles(); err != nil {
+		return err
+	}
+	if r.stdoutFile != nil {
+		r.ps.Stdout = r.stdoutFile.file
+	}
+	if r.stderrFile != nil {
+		r.ps.Stderr = r.stderrFile.file
+	}
+	if r.Stdout != nil && r.Stdout == r.Stderr {
+		w := &lockedWriter{w: r.Stdout}
+		r.ps.Stdout, r.ps.Stderr = w, w
+	} else {
+		if r.Stdout != nil {
+			r.ps.Stdout = r.Stdout
+		}
+		if r.Stderr != nil {
+			r.ps.Stderr = r.Stderr
+		}
+	}
+	r.transcript = nil
+	if r.Transcript != nil || r.TranscriptSize > 0 {
+		r.transcript = newTranscript(r.Transcript, r.TranscriptSize)
+		r.ps.Stdout = io.MultiWriter(r.ps.Stdout, r.transcript.stream(StdoutTag))
+		r.ps.Stderr = io.MultiWriter(r.ps.Stderr, r.transcript.stream(StderrTag))
+	}
+	r.lines = nil
+	if r.OnStdoutLine != nil {
+		r.ps.Stdout = io.MultiWriter(r.ps.Stdout, r.lineCallback(r.OnStdoutLine))
+	}
+	if r.OnStderrLine != nil {
+		r.ps.Stderr = io.MultiWriter(r.ps.Stderr, r.lineCallback(r.OnStderrLine))
+	}
+	if r.LogOutput {
+		stdoutLevel, stderrLevel := r.outputLogLevels()
+		r.ps.Stdout = io.MultiWriter(r.ps.Stdout, r.lineCallback(r.logLines("stdout", stdoutLevel)))
+		r.ps.Stderr = io.MultiWriter(r.ps.Stderr, r.lineCallback(r.logLines("stderr", stderrLevel)))
+	}
+	r.outputLines = nil
+	if r.TimestampOutput {
+		r.outputLines = newLineRecorder(r.getClock(), r.MaxOutputBytes, r.KeepOutputTail)
+		r.ps.Stdout = io.MultiWriter(r.ps.Stdout, r.lineCallback(r.outputLines.record(StdoutTag)))
+		r.ps.Stderr = io.MultiWriter(r.ps.Stderr, r.lineCallback(r.outputLines.record(StderrTag)))
+	}
+	if r.stdoutTap != nil {
+		r.ps.Stdout = io.MultiWriter(r.ps.Stdout, r.stdoutTap)
+	}
+	if r.stderrTap != nil {
+		r.ps.Stderr = io.MultiWriter(r.ps.Stderr, r.stderrTap)
+	}
+	if r.StripANSI {
+		r.ps.Stdout = term.NewStripWriter(r.ps.Stdout)
+		r.ps.Stderr = term.NewStripWriter(r.ps.Stderr)
+	}
+	r.activity = nil
+	if r.InactivityTimeout > 0 {
+		r.activity = newActivityMonitor(r.getClock())
+		r.ps.Stdout = io.MultiWriter(r.ps.Stdout, r.activity)
+		r.ps.Stderr = io.MultiWriter(r.ps.Stderr, r.activity)
+	}
+	r.outputBytes = nil
+	if r.Heartbeat != nil {
+		r.outputBytes = ioutils.NewCountingWriter(ioutil.Discard)
+		r.ps.Stdout = io.MultiWriter(r.ps.Stdout, r.outputBytes)
+		r.ps.Stderr = io.MultiWriter(r.ps.Stderr, r.outputBytes)
+	}
+	r.pty = nil
+	if r.AllocatePTY {
+		if err := allocatePTY(r); err != nil {
+			r.abortOutputFiles()
+			return err
+		}
+	}
 
+	r.oomBefore = oomKillCount()
+	startMutex.RLock()
+	defer startMutex.RUnlock()
 	err := r.ps.Start()
 	if err != nil {
+		if r.pty != nil {
+			r.pty.abort()
+		}
+		r.abortOutputFiles()
 		return err
 	}
+	if r.pty != nil {
+		r.pty.started()
+	}
+	if r.cgroup != nil {
+		if err := r.cgroup.started(r.ps.Process.Pid); err != nil {
+			r.ps.Process.Kill()
+			r.ps.Wait()
+			r.abortOutputFiles()
+			return err
+		}
+	}
+	if err := commandStarted(r, r.ps); err != nil {
+		r.ps.Process.Kill()
+		r.ps.Wait()
+		r.abortOutputFiles()
+		return err
+	}
+	r.started = r.getClock().Now()
+	trackRunning(r.ps, r)
+	r.metricsStarted()
 	return nil
 }
 
+// getClock returns the clock to use for r.
+func (r *RunParams) getClock() clock.Clock {
+	if r.Clock != nil {
+		return r.Clock
+	}
+	return clock.WallClock
+}
+
+// lineCallback returns a writer that calls f for each line written to
+// it, to be flushed when the command finishes.
+func (r *RunParams) lineCallback(f func(line string)) io.Writer {
+	lw := newLineWriter(func(line []byte) {
+		f(string(bytes.TrimSuffix(line, []byte("\r"))))
+	})
+	r.lines = append(r.lines, lw)
+	return lw
+}
+
 // Process returns the *os.Process instance of the current running process
 // This will allow us to kill the process if needed, or get more information
 // on the process
@@ -135,17 +1112,160 @@ func (r *RunParams) Process() *os.Process {
 // return code is returned, this is collected as the code for the response and
 // this does not classify as an error.
 func (r *RunParams) Wait() (*ExecResponse, error) {
-	var err error
+	return r.WaitWithContext(context.Background())
+}
+
+// WaitWithContext is like Wait, but kills the process if ctx is done
+// before it exits. In that case the response holds the output
+// captured up to that point and the error is ctx.Err().
+func (r *RunParams) WaitWithContext(ctx context.Context) (*ExecResponse, error) {
 	if r.ps == nil {
-		return nil, errors.New("No process has been started yet")
+		return nil, ErrNotStarted
+	}
+	if r.Detach {
+		return nil, errors.New("cannot wait for a detached process")
+	}
+	if r.plan != nil {
+		return &ExecResponse{
+			Shell: r.shell,
+			Plan:  r.plan,
+		}, nil
+	}
+	result, err := r.waitWithContext(ctx)
+	err = r.redactError(err)
+	if result != nil && r.RedactOutput {
+		result.Stdout = r.redactBytes(result.Stdout)
+		result.Stderr = r.redactBytes(result.Stderr)
+		result.Combined = r.redactBytes(result.Combined)
+		for i := range result.OutputLines {
+			result.OutputLines[i].Text = r.redact(result.OutputLines[i].Text)
+		}
+		result.Transcript = r.redactBytes(result.Transcript)
+	}
+	for i := len(r.activeHooks) - 1; i >= 0; i-- {
+		if h := r.activeHooks[i]; h.AfterWait != nil {
+			h.AfterWait(r, result, err)
+		}
+	}
+	r.metricsFinished(result)
+	r.endSpan(result, err)
+	r.audit(result, err)
+	return result, err
+}
+
+// waitWithContext implements WaitWithContext.
+func (r *RunParams) waitWithContext(ctx context.Context) (*ExecResponse, error) {
+	clk := r.getClock()
+	var timeout <-chan time.Time
+	if r.Timeout > 0 {
+		timeout = clk.After(r.Timeout - clk.Now().Sub(r.started))
+	}
+	if ctx.Done() == nil && timeout == nil && r.activity == nil && r.Heartbeat == nil {
+		return r.wait()
+	}
+	exited := make(chan struct{})
+	killed := make(chan error, 1)
+	go func() {
+		var idle <-chan time.Time
+		if r.activity != nil {
+			idle = clk.After(r.InactivityTimeout - r.activity.idleFor())
+		}
+		var beat <-chan time.Time
+		if r.Heartbeat != nil {
+			beat = clk.After(r.Heartbeat.Interval)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				r.stop(exited)
+				killed <- ctx.Err()
+			case <-timeout:
+				r.stop(exited)
+				killed <- ErrTimedOut
+			case <-idle:
+				if remaining := r.InactivityTimeout - r.activity.idleFor(); remaining > 0 {
+					idle = clk.After(remaining)
+					continue
+				}
+				r.stop(exited)
+				killed <- ErrInactivityTimeout
+			case <-beat:
+				r.Heartbeat.Func(clk.Now().Sub(r.started), r.outputBytes.Count())
+				beat = clk.After(r.Heartbeat.Interval)
+				continue
+			case <-exited:
+				killed <- nil
+			}
+			return
+		}
+	}()
+	result, err := r.wait()
+	close(exited)
+	if killErr := <-killed; killErr != nil {
+		return result, killErr
+	}
+	return result, err
+}
+
+// wait waits for the process to exit and collects its results.
+func (r *RunParams) wait() (*ExecResponse, error) {
+	err := r.ps.Wait()
+	r.removeScript()
+	cgroupOOMKills := -1
+	var cgroupPath string
+	if r.cgroup != nil {
+		cgroupPath = r.cgroup.path
+		cgroupOOMKills = r.cgroup.finish()
+		r.cgroup = nil
+	}
+	// The times from the wall clock carry monotonic clock readings, so
+	// the duration is not disturbed by changes to the system time.
+	duration := r.getClock().Now().Sub(r.started)
+	untrackRunning(r.ps)
+	r.releaseSlot()
+	commandFinished(r)
+	if r.pty != nil {
+		r.pty.wait()
+	}
+	for _, lw := range r.lines {
+		lw.Flush()
 	}
-	err = r.ps.Wait()
 
 	result := &ExecResponse{
-		Stdout: r.stdout.Bytes(),
-		Stderr: r.stderr.Bytes(),
+		Attempts:   1,
+		Shell:      r.shell,
+		PID:        r.ps.Process.Pid,
+		StartTime:  r.started,
+		Duration:   duration,
+		CgroupPath: cgroupPath,
+	}
+	result.Stdout, result.StdoutTruncated = r.stdout.Bytes()
+	result.Stderr, result.StderrTruncated = r.stderr.Bytes()
+	if r.combined != nil {
+		result.Combined, result.CombinedTruncated = r.combined.Bytes()
+	}
+	if r.outputLines != nil {
+		result.OutputLines, result.OutputLinesTruncated = r.outputLines.finish()
+	}
+	if r.Windows.DecodeOutput {
+		result.Stdout = decodeConsoleOutput(result.Stdout)
+		result.Stderr = decodeConsoleOutput(result.Stderr)
+		result.Combined = decodeConsoleOutput(result.Combined)
+	}
+	if commitErr := r.commitOutputFiles(result); commitErr != nil && err == nil {
+		return nil, commitErr
+	}
+	if r.transcript != nil {
+		result.Transcript, result.TranscriptTruncated = r.transcript.finish()
 	}
 
+	if r.ps.ProcessState != nil {
+		status := r.ps.ProcessState.Sys().(syscall.WaitStatus)
+		setTerminationDetails(result, status, r.oomBefore)
+	}
+	if cgroupOOMKills > 0 {
+		result.OOMKilled = true
+	}
 	if ee, ok := err.(*exec.ExitError); ok && err != nil {
 		status := ee.ProcessState.Sys().(syscall.WaitStatus)
 		if status.Exited() {
@@ -153,21 +1273,93 @@ func (r *RunParams) Wait() (*ExecResponse, error) {
 			result.Code = status.ExitStatus()
 			err = nil
 		}
-		logger.Infof("run result: %v", ee)
+		logger.Infof("run result: %v", r.redact(ee.Error()))
 	}
 	return result, err
 }
 
+// stop stops the running process, allowing it the grace period to
+// exit, as signalled by exited being closed, before killing it.
+func (r *RunParams) stop(exited <-chan struct{}) {
+	if r.GracePeriod > 0 {
+		if err := interruptAll(r); err != nil {
+			logger.Debugf("cannot interrupt process %d: %v", r.ps.Process.Pid, err)
+		} else {
+			select {
+			case <-exited:
+				return
+			case <-r.getClock().After(r.GracePeriod):
+			}
+		}
+	}
+	if err := r.KillAll(); err != nil {
+		logger.Debugf("cannot kill process %d: %v", r.ps.Process.Pid, err)
+	}
+}
+
+// KillAll kills the process and any processes it started that are
+// still in its process group, such as commands run in the background
+// by the shell. On Unix every command is started in a process group of
+// its own for this purpose; on Windows it is assigned to a job object,
+// either WindowsOptions.Job or one created for it. Cancellation and
+// timeouts kill the processes in the same way.
+func (r *RunParams) KillAll() error {
+	if r.ps == nil || r.ps.Process == nil {
+		return ErrNotStarted
+	}
+	return killAll(r)
+}
+
+// Signal sends sig to the process started by Run, but not to any
+// processes it started. On Windows only os.Kill and os.Interrupt are
+// supported; the latter is sent as a CTRL_BREAK event, which is only
+// delivered to commands started with WindowsOptions.NewProcessGroup,
+// and any other signal results in an error satisfying
+// errors.IsNotSupported. Signal returns ErrNotStarted if no process
+// has been started, and os.ErrProcessDone if it has been waited for.
+func (r *RunParams) Signal(sig os.Signal) error {
+	if r.ps == nil || r.ps.Process == nil {
+		return ErrNotStarted
+	}
+	return signalProcess(r, sig)
+}
+
+// Kill kills the process started by Run, but not any processes it
+// started; see KillAll. It returns the same errors as Signal.
+func (r *RunParams) Kill() error {
+	return r.Signal(os.Kill)
+}
+
+// lockedWriter serializes writes to w, which receives both output
+// streams of a command.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Write implements io.Writer.
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
 // RunCommands executes the Commands specified in the RunParams using
 // powershell on windows, and '/bin/bash -s' on everything else,
 // passing the commands through as stdin, and collecting
 // stdout and stderr.  If a non-zero return code is returned, this is
 // collected as the code for the response and this does not classify as an
-// error.
+// error. If run.Retry is set, the command is run again as it directs.
 func RunCommands(run RunParams) (*ExecResponse, error) {
-	err := run.Run()
-	if err != nil {
+	return runWithRetry(context.Background(), run)
+}
+
+// RunCommandsContext is like RunCommands, but kills the process if
+// ctx is done before it exits, returning the output captured so far
+// along with ctx.Err(). No further attempt is made once ctx is done.
+func RunCommandsContext(ctx context.Context, run RunParams) (*ExecResponse, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	return run.Wait()
+	return runWithRetry(ctx, run)
 }
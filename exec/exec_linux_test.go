@@ -4,6 +4,13 @@
 package exec_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -91,3 +98,121 @@ func (*execSuite) TestExecUnknownCommand(c *gc.C) {
 	// 127 is a special bash return code meaning command not found.
 	c.Assert(result.Code, gc.Equals, 127)
 }
+
+func (*execSuite) TestRunningCommands(c *gc.C) {
+	params := exec.RunParams{
+		Commands:   "sleep 1",
+		WorkingDir: c.MkDir(),
+	}
+	err := params.Run()
+	c.Assert(err, gc.IsNil)
+
+	var found bool
+	for _, cmd := range exec.Running() {
+		if cmd.PID == params.Process().Pid {
+			found = true
+			c.Check(cmd.Commands, gc.Equals, "sleep 1")
+			c.Check(cmd.WorkingDir, gc.Equals, params.WorkingDir)
+			c.Check(cmd.Started.IsZero(), jc.IsFalse)
+		}
+	}
+	c.Assert(found, jc.IsTrue)
+
+	_, err = params.Wait()
+	c.Assert(err, gc.IsNil)
+	for _, cmd := range exec.Running() {
+		c.Check(cmd.PID, gc.Not(gc.Equals), params.Process().Pid)
+	}
+}
+
+func (*execSuite) TestNewSession(c *gc.C) {
+	// The sixth field of /proc/<pid>/stat holds the session ID.
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:   "echo $$ $(cut -d' ' -f6 /proc/$$/stat)",
+		NewSession: true,
+	})
+	c.Assert(err, gc.IsNil)
+	fields := strings.Fields(string(result.Stdout))
+	c.Assert(fields, gc.HasLen, 2)
+	c.Assert(fields[0], gc.Equals, fields[1])
+
+	result, err = exec.RunCommands(exec.RunParams{
+		Commands: "echo $$ $(cut -d' ' -f6 /proc/$$/stat)",
+	})
+	c.Assert(err, gc.IsNil)
+	fields = strings.Fields(string(result.Stdout))
+	c.Assert(fields, gc.HasLen, 2)
+	c.Assert(fields[0], gc.Not(gc.Equals), fields[1])
+}
+
+func (*execSuite) TestNewSessionAndForeground(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:   "true",
+		NewSession: true,
+		Foreground: true,
+	})
+	c.Assert(err, gc.ErrorMatches, "cannot run command in a new session and in the foreground")
+}
+
+func (*execSuite) TestCreateWorkingDirOwner(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "work")
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:   "exit 0",
+		WorkingDir: dir,
+		CreateWorkingDir: &exec.DirParams{
+			Owner: strconv.Itoa(os.Getuid()),
+			Group: strconv.Itoa(os.Getgid()),
+		},
+	})
+	c.Assert(err, gc.IsNil)
+
+	_, err = exec.RunCommands(exec.RunParams{
+		Commands:   "exit 0",
+		WorkingDir: filepath.Join(c.MkDir(), "work"),
+		CreateWorkingDir: &exec.DirParams{
+			Owner: "no-such-user-exists",
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot create working directory .*: cannot find user "no-such-user-exists": .*`)
+}
+
+func (*execSuite) TestSignalDetails(c *gc.C) {
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands: "kill -TERM $$",
+	})
+	c.Assert(err, gc.ErrorMatches, "signal: terminated")
+	c.Assert(result.Signal, gc.Equals, syscall.SIGTERM)
+	c.Assert(result.CoreDumped, jc.IsFalse)
+	c.Assert(result.OOMKilled, jc.IsFalse)
+
+	result, err = exec.RunCommands(exec.RunParams{
+		Commands: "exit 0",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Signal, gc.Equals, syscall.Signal(0))
+}
+
+func (s *execSuite) TestOOMKillCount(c *gc.C) {
+	dir := c.MkDir()
+	cgroupFile := filepath.Join(dir, "cgroup")
+	s.PatchValue(exec.CgroupRoot, dir)
+	s.PatchValue(exec.ProcSelfCgroup, cgroupFile)
+
+	writeFile := func(path, content string) {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		c.Assert(err, gc.IsNil)
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		c.Assert(err, gc.IsNil)
+	}
+
+	c.Assert(exec.OOMKillCount(), gc.Equals, -1)
+
+	writeFile(cgroupFile, "0::/agent.slice\n")
+	c.Assert(exec.OOMKillCount(), gc.Equals, -1)
+	writeFile(filepath.Join(dir, "agent.slice", "memory.events"), "low 0\nhigh 0\noom 3\noom_kill 2\n")
+	c.Assert(exec.OOMKillCount(), gc.Equals, 2)
+
+	writeFile(cgroupFile, "4:memory:/agent\n1:cpu:/\n0::/\n")
+	writeFile(filepath.Join(dir, "memory", "agent", "memory.oom_control"), "oom_kill_disable 0\nunder_oom 0\noom_kill 5\n")
+	c.Assert(exec.OOMKillCount(), gc.Equals, 5)
+}
@@ -0,0 +1,213 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// configureCommand applies the platform specific options in r to cmd.
+func configureCommand(r *RunParams, cmd *exec.Cmd) error {
+	if r.NewSession && r.Foreground {
+		return errors.New("cannot run command in a new session and in the foreground")
+	}
+	attr := &syscall.SysProcAttr{
+		Setsid: r.NewSession,
+		// A foreground process group and a new session both lead
+		// to the process leading its own process group already.
+		Setpgid: !r.NewSession && !r.Foreground,
+	}
+	if r.Foreground {
+		attr.Foreground = true
+		attr.Ctty = int(os.Stdin.Fd())
+	}
+	if r.User != "" || r.Group != "" {
+		cred, err := credential(r.User, r.Group)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		attr.Credential = cred
+		if r.script != "" {
+			// The script must be readable by the user that runs it.
+			if err := os.Chown(r.script, int(cred.Uid), int(cred.Gid)); err != nil {
+				return errors.Annotate(err, "cannot change owner of script file")
+			}
+		}
+	}
+	attr.Chroot = r.Chroot
+	if r.NewMountNamespace {
+		if err := newMountNamespace(attr); err != nil {
+			return err
+		}
+	}
+	cmd.SysProcAttr = attr
+	return nil
+}
+
+// credential returns the credential for running a command as the
+// given user and group, either of which may be empty.
+func credential(owner, group string) (*syscall.Credential, error) {
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+		// Without a user the agent's supplementary groups are
+		// retained.
+		NoSetGroups: true,
+	}
+	if owner != "" {
+		u, err := lookupUser(owner)
+		if err != nil {
+			return nil, errors.Annotatef(err, "cannot find user %q", owner)
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid uid for user %q", owner)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid gid for user %q", owner)
+		}
+		groupIds, err := u.GroupIds()
+		if err != nil {
+			return nil, errors.Annotatef(err, "cannot find groups of user %q", owner)
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+		cred.NoSetGroups = false
+		cred.Groups = nil
+		for _, id := range groupIds {
+			gid, err := strconv.ParseUint(id, 10, 32)
+			if err != nil {
+				return nil, errors.Annotatef(err, "invalid group %q of user %q", id, owner)
+			}
+			cred.Groups = append(cred.Groups, uint32(gid))
+		}
+	}
+	if group != "" {
+		gid, err := lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, errors.Annotatef(err, "cannot find group %q", group)
+		}
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+// lookupUser finds the user with the given name or numeric ID.
+func lookupUser(nameOrID string) (*user.User, error) {
+	if _, err := strconv.Atoi(nameOrID); err == nil {
+		return user.LookupId(nameOrID)
+	}
+	return user.Lookup(nameOrID)
+}
+
+// commandStarted is called once cmd has been successfully started.
+func commandStarted(r *RunParams, cmd *exec.Cmd) error {
+	return nil
+}
+
+// commandFinished is called once the process started for r has
+// been waited for.
+func commandFinished(r *RunParams) {}
+
+// interruptAll sends SIGTERM to the process group of the command
+// started by r.
+func interruptAll(r *RunParams) error {
+	return signalGroup(r.ps.Process, syscall.SIGTERM)
+}
+
+// killAll sends SIGKILL to the process group of the command started
+// by r.
+func killAll(r *RunParams) error {
+	return signalGroup(r.ps.Process, syscall.SIGKILL)
+}
+
+// signalGroup sends sig to the process group led by p. It is not an
+// error if the group no longer exists.
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	err := syscall.Kill(-p.Pid, sig)
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
+
+// checkDirAccess checks that the agent can search the given directory.
+func checkDirAccess(dir string) error {
+	const searchOK = 0x1
+	return syscall.Access(dir, searchOK)
+}
+
+// chownDir changes the ownership of dir to the given user and group,
+// each of which may be a name or a numeric ID. An empty value leaves
+// that part of the ownership unchanged.
+func chownDir(dir, owner, group string) error {
+	uid, gid := -1, -1
+	if owner != "" {
+		id, err := lookupID(owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return errors.Annotatef(err, "cannot find user %q", owner)
+		}
+		uid = id
+	}
+	if group != "" {
+		id, err := lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return errors.Annotatef(err, "cannot find group %q", group)
+		}
+		gid = id
+	}
+	return os.Chown(dir, uid, gid)
+}
+
+// lookupID returns the numeric ID for nameOrID, using lookup to
+// resolve names.
+func lookupID(nameOrID string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+	id, err := lookup(nameOrID)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// detachCommand starts cmd in a new session, so that it has no
+// controlling terminal and is not affected by signals sent to the
+// agent's process group.
+func detachCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setpgid = false
+}
+
+// signalProcess sends sig to the process started by r.
+func signalProcess(r *RunParams, sig os.Signal) error {
+	return r.ps.Process.Signal(sig)
+}
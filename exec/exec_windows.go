@@ -0,0 +1,153 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/winjob"
+)
+
+const (
+	ctrlBreakEvent = 1
+
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+	createNoWindow        = 0x08000000
+)
+
+// utf8Preamble is run before the commands when WindowsOptions.UTF8 is
+// set. chcp affects native console programs while OutputEncoding
+// affects how powershell itself writes to stdout.
+const utf8Preamble = "chcp 65001 | Out-Null\n" +
+	"[Console]::OutputEncoding = [System.Text.Encoding]::UTF8\n" +
+	"$OutputEncoding = [System.Text.Encoding]::UTF8\n"
+
+// configureCommand applies the platform specific options in r to cmd.
+func configureCommand(r *RunParams, cmd *exec.Cmd) error {
+	if r.User != "" || r.Group != "" {
+		return errors.NotSupportedf("running commands as another user or group by name")
+	}
+	if r.Chroot != "" {
+		return errors.NotSupportedf("changing the root directory on windows")
+	}
+	if r.NewMountNamespace {
+		return errors.NotSupportedf("mount namespaces on windows")
+	}
+	attr := &syscall.SysProcAttr{
+		HideWindow: r.Windows.HideWindow,
+		Token:      syscall.Token(r.Windows.Token),
+	}
+	if r.Windows.NewProcessGroup {
+		attr.CreationFlags |= createNewProcessGroup
+	}
+	if r.Windows.DetachConsole {
+		attr.CreationFlags |= detachedProcess
+	} else if r.Windows.HideWindow {
+		attr.CreationFlags |= createNoWindow
+	}
+	cmd.SysProcAttr = attr
+	if r.Windows.UTF8 && len(r.Args) == 0 {
+		cmd.Stdin = io.MultiReader(strings.NewReader(utf8Preamble), cmd.Stdin)
+	}
+	return nil
+}
+
+// commandStarted is called once cmd has been successfully started.
+func commandStarted(r *RunParams, cmd *exec.Cmd) error {
+	r.job = nil
+	if r.Windows.Job != nil {
+		r.job = r.Windows.Job
+		return r.Windows.Job.Assign(cmd.Process)
+	}
+	job, err := winjob.New(winjob.Limits{})
+	if err != nil {
+		logger.Debugf("cannot create job object: %v", err)
+		return nil
+	}
+	if err := job.Assign(cmd.Process); err != nil {
+		// Assignment fails on older versions of Windows when the
+		// agent is itself in a job, so the command is run without
+		// one and only the process itself can be killed.
+		logger.Debugf("cannot assign process %d to job object: %v", cmd.Process.Pid, err)
+		job.Close()
+		return nil
+	}
+	r.job = job
+	return nil
+}
+
+// commandFinished is called once the process started for r has
+// been waited for. It closes the job created for the process, if
+// any.
+func commandFinished(r *RunParams) {
+	if r.job != nil && r.job != r.Windows.Job {
+		if err := r.job.Close(); err != nil {
+			logger.Debugf("cannot close job object: %v", err)
+		}
+	}
+}
+
+var procGenerateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// interruptAll sends a CTRL_BREAK event to the process group of the
+// command started by r.
+func interruptAll(r *RunParams) error {
+	ok, _, err := procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(r.ps.Process.Pid))
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
+
+// killAll kills the command started by r by terminating its job, or
+// just the process if it has no job.
+func killAll(r *RunParams) error {
+	if r.job != nil {
+		return r.job.Terminate(1)
+	}
+	return r.ps.Process.Kill()
+}
+
+// checkDirAccess checks that the agent can read the given directory.
+func checkDirAccess(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// chownDir is not supported on Windows.
+func chownDir(dir, owner, group string) error {
+	return errors.NotSupportedf("setting directory ownership")
+}
+
+// detachCommand starts cmd without a console and in a process group
+// of its own, so that console events sent to the agent do not reach
+// it.
+func detachCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr.CreationFlags |= detachedProcess | createNewProcessGroup
+}
+
+// signalProcess sends sig to the process started by r. Windows has no
+// signals, so os.Interrupt is sent as a console event.
+func signalProcess(r *RunParams, sig os.Signal) error {
+	switch sig {
+	case os.Kill:
+		return r.ps.Process.Kill()
+	case os.Interrupt:
+		if r.ps.ProcessState != nil {
+			return os.ErrProcessDone
+		}
+		return interruptAll(r)
+	}
+	return errors.NotSupportedf("sending signal %v on Windows", sig)
+}
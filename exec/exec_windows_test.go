@@ -6,12 +6,14 @@ package exec_test
 import (
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/utils/exec"
+	"github.com/juju/utils/winjob"
 )
 
 type execSuite struct {
@@ -127,3 +129,54 @@ func (*execSuite) TestExecUnknownCommand(c *gc.C) {
 	// 1 is returned by RunCommands when powershell commands throw exceptions
 	c.Assert(result.Code, gc.Equals, 1)
 }
+
+func (*execSuite) TestWindowsOptions(c *gc.C) {
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands: "[Console]::OutputEncoding.CodePage",
+		Windows: exec.WindowsOptions{
+			NewProcessGroup: true,
+			HideWindow:      true,
+			UTF8:            true,
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 0)
+	c.Assert(string(result.Stdout), gc.Equals, "65001\r\n")
+}
+
+func (*execSuite) TestJob(c *gc.C) {
+	job, err := winjob.New(winjob.Limits{})
+	c.Assert(err, gc.IsNil)
+	defer job.Close()
+
+	params := exec.RunParams{
+		Commands: "Start-Sleep 30",
+		Windows: exec.WindowsOptions{
+			Job: job,
+		},
+	}
+	err = params.Run()
+	c.Assert(err, gc.IsNil)
+	err = job.Terminate(7)
+	c.Assert(err, gc.IsNil)
+	result, err := params.Wait()
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 7)
+}
+
+func (*execSuite) TestKillAllTerminatesProcessTree(c *gc.C) {
+	// The child powershell holds the output pipe open, so Wait only
+	// returns once it has been killed along with its parent.
+	params := exec.RunParams{
+		Commands: "Start-Process -NoNewWindow powershell.exe -ArgumentList '-command','Start-Sleep 60'; Start-Sleep 60",
+	}
+	err := params.Run()
+	c.Assert(err, gc.IsNil)
+	start := time.Now()
+	err = params.KillAll()
+	c.Assert(err, gc.IsNil)
+	result, err := params.Wait()
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 1)
+	c.Assert(time.Since(start) < 30*time.Second, jc.IsTrue)
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// ExitErrorStderrSize holds the maximum number of bytes of standard
+// error kept by an ExitError.
+const ExitErrorStderrSize = 4 * 1024
+
+// ExitError is returned by RunCommandsStrict when a command exits with
+// a non-zero code or is killed by a signal.
+type ExitError struct {
+	// Code holds the exit code of the command.
+	Code int
+
+	// Signal holds the signal that terminated the command, if it did
+	// not exit normally.
+	Signal syscall.Signal
+
+	// Stderr holds the last ExitErrorStderrSize bytes of the
+	// command's standard error.
+	Stderr []byte
+}
+
+// Error implements error. The message includes the last line
+// written to standard error, if any.
+func (e *ExitError) Error() string {
+	var msg string
+	if e.Signal != 0 {
+		msg = fmt.Sprintf("killed by signal %d (%v)", int(e.Signal), e.Signal)
+	} else {
+		msg = fmt.Sprintf("exited with code %d", e.Code)
+	}
+	if line := lastLine(e.Stderr); line != "" {
+		msg += ": " + line
+	}
+	return msg
+}
+
+// newExitError returns an ExitError describing resp.
+func newExitError(resp *ExecResponse) *ExitError {
+	stderr := resp.Stderr
+	if len(stderr) > ExitErrorStderrSize {
+		stderr = stderr[len(stderr)-ExitErrorStderrSize:]
+	}
+	return &ExitError{
+		Code:   resp.Code,
+		Signal: resp.Signal,
+		Stderr: append([]byte(nil), stderr...),
+	}
+}
+
+// lastLine returns the last non-blank line of data.
+func lastLine(data []byte) string {
+	data = bytes.TrimRight(data, " \t\r\n")
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return string(bytes.TrimSpace(data))
+}
+
+// RunCommandsStrict is like RunCommands, but a command that exits with
+// a non-zero code, or is killed by a signal, is treated as a failure:
+// the response is returned along with an *ExitError describing it.
+func RunCommandsStrict(run RunParams) (*ExecResponse, error) {
+	return strict(runWithRetry(context.Background(), run))
+}
+
+// strict converts an unsuccessful exit reported by resp and err to an
+// *ExitError.
+func strict(resp *ExecResponse, err error) (*ExecResponse, error) {
+	if resp == nil {
+		return resp, err
+	}
+	if _, ok := errors.Cause(err).(*exec.ExitError); ok && resp.Signal != 0 {
+		return resp, newExitError(resp)
+	}
+	if err == nil && resp.Code != 0 {
+		return resp, newExitError(resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"strings"
+	"syscall"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type exitErrorSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&exitErrorSuite{})
+
+func (*exitErrorSuite) TestSuccess(c *gc.C) {
+	resp, err := exec.RunCommandsStrict(exec.RunParams{Commands: "echo ok"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "ok\n")
+}
+
+func (*exitErrorSuite) TestNonZeroExit(c *gc.C) {
+	resp, err := exec.RunCommandsStrict(exec.RunParams{
+		Commands: "echo first >&2; echo 'no such file' >&2; exit 3",
+	})
+	c.Assert(err, gc.ErrorMatches, "exited with code 3: no such file")
+	c.Assert(resp.Code, gc.Equals, 3)
+	exitErr, ok := err.(*exec.ExitError)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(exitErr.Code, gc.Equals, 3)
+	c.Assert(exitErr.Signal, gc.Equals, syscall.Signal(0))
+	c.Assert(string(exitErr.Stderr), gc.Equals, "first\nno such file\n")
+}
+
+func (*exitErrorSuite) TestSignal(c *gc.C) {
+	resp, err := exec.RunCommandsStrict(exec.RunParams{
+		Args: []string{"/bin/sh", "-c", "kill -TERM $$"},
+	})
+	c.Assert(err, gc.ErrorMatches, `killed by signal 15 \(terminated\)`)
+	c.Assert(resp.Signal, gc.Equals, syscall.SIGTERM)
+	exitErr, ok := err.(*exec.ExitError)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(exitErr.Signal, gc.Equals, syscall.SIGTERM)
+}
+
+func (*exitErrorSuite) TestStderrTail(c *gc.C) {
+	resp, err := exec.RunCommandsStrict(exec.RunParams{
+		Commands: "head -c 10000 /dev/zero | tr '\\0' x >&2; echo >&2; echo >&2 last; exit 1",
+	})
+	c.Assert(err, gc.ErrorMatches, "exited with code 1: last")
+	c.Assert(resp.Stderr, gc.HasLen, 10006)
+	stderr := err.(*exec.ExitError).Stderr
+	c.Assert(stderr, gc.HasLen, exec.ExitErrorStderrSize)
+	c.Assert(strings.HasSuffix(string(stderr), "xxx\nlast\n"), jc.IsTrue)
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// ExpandVariables replaces each ${NAME} reference in script with the
+// value of NAME from env, a list of "NAME=value" entries as used by
+// RunParams.Environment. Only the braced form is recognised, so shell
+// syntax such as $1 or $HOME is left untouched. A literal "${" may be
+// written as "$${".
+//
+// If strict is true, references to variables not defined in env and
+// malformed references are reported as an error; otherwise undefined
+// variables expand to the empty string and malformed references are
+// left as they are.
+func ExpandVariables(script string, env []string, strict bool) (string, error) {
+	values := make(map[string]string)
+	for _, entry := range env {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	var buf strings.Builder
+	undefined := make(map[string]bool)
+	for {
+		i := strings.Index(script, "${")
+		if i < 0 {
+			buf.WriteString(script)
+			break
+		}
+		if i > 0 && script[i-1] == '$' {
+			// An escaped reference: drop one dollar sign.
+			buf.WriteString(script[:i])
+			buf.WriteString("{")
+			script = script[i+2:]
+			continue
+		}
+		buf.WriteString(script[:i])
+		end := strings.Index(script[i:], "}")
+		if end < 0 || !validName(script[i+2:i+end]) {
+			if strict {
+				return "", errors.NotValidf("variable reference %q", reference(script[i:], end))
+			}
+			buf.WriteString("${")
+			script = script[i+2:]
+			continue
+		}
+		name := script[i+2 : i+end]
+		value, ok := values[name]
+		if !ok {
+			undefined[name] = true
+		}
+		buf.WriteString(value)
+		script = script[i+end+1:]
+	}
+	if strict && len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", errors.NotFoundf("variables %s", strings.Join(names, ", "))
+	}
+	return buf.String(), nil
+}
+
+// reference returns the text of a malformed reference starting at the
+// beginning of s, for use in error messages.
+func reference(s string, end int) string {
+	if end >= 0 {
+		return s[:end+1]
+	}
+	if nl := strings.IndexByte(s, '\n'); nl >= 0 {
+		return s[:nl]
+	}
+	return s
+}
+
+// validName reports whether name is a valid shell variable name.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type expandSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&expandSuite{})
+
+var expandTests = []struct {
+	about  string
+	script string
+	expect string
+	err    string
+}{{
+	about:  "no references",
+	script: "echo hello $HOME $1",
+	expect: "echo hello $HOME $1",
+}, {
+	about:  "simple reference",
+	script: "apt-get install ${PACKAGE}",
+	expect: "apt-get install juju",
+}, {
+	about:  "several references",
+	script: "${GREETING}, ${PACKAGE}${PACKAGE}!",
+	expect: "hello world, jujujuju!",
+}, {
+	about:  "escaped reference",
+	script: "echo $${PACKAGE} ${PACKAGE}",
+	expect: "echo ${PACKAGE} juju",
+}, {
+	about:  "value containing equals",
+	script: "${EQUALS}",
+	expect: "a=b",
+}, {
+	about:  "undefined variable",
+	script: "echo [${MISSING}]",
+	expect: "echo []",
+	err:    "variables MISSING not found",
+}, {
+	about:  "several undefined variables",
+	script: "${B} ${A} ${B}",
+	expect: "  ",
+	err:    "variables A, B not found",
+}, {
+	about:  "unterminated reference",
+	script: "echo ${PACKAGE\nnext",
+	expect: "echo ${PACKAGE\nnext",
+	err:    `variable reference "\${PACKAGE" not valid`,
+}, {
+	about:  "invalid name",
+	script: "echo ${1BAD} ${PACKAGE}",
+	expect: "echo ${1BAD} juju",
+	err:    `variable reference "\${1BAD}" not valid`,
+}}
+
+func (*expandSuite) TestExpandVariables(c *gc.C) {
+	env := []string{
+		"PACKAGE=juju",
+		"GREETING=hello world",
+		"EQUALS=a=b",
+	}
+	for i, test := range expandTests {
+		c.Logf("test %d: %s", i, test.about)
+		result, err := exec.ExpandVariables(test.script, env, false)
+		c.Check(err, gc.IsNil)
+		c.Check(result, gc.Equals, test.expect)
+
+		result, err = exec.ExpandVariables(test.script, env, true)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+		} else {
+			c.Check(err, gc.IsNil)
+			c.Check(result, gc.Equals, test.expect)
+		}
+	}
+}
+
+func (*expandSuite) TestRunParamsExpandVariables(c *gc.C) {
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:        "echo ${MESSAGE}",
+		Environment:     []string{"MESSAGE=expanded"},
+		ExpandVariables: true,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result.Stdout), gc.Matches, "expanded\r?\n")
+
+	_, err = exec.RunCommands(exec.RunParams{
+		Commands:        "echo ${UNDEFINED}",
+		ExpandVariables: true,
+		StrictVariables: true,
+	})
+	c.Assert(err, gc.ErrorMatches, "cannot expand commands: variables UNDEFINED not found")
+}
@@ -0,0 +1,13 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+var (
+	CgroupRoot     = &cgroupRoot
+	ProcSelfCgroup = &procSelfCgroup
+	OOMKillCount   = oomKillCount
+
+	CloneIntoCgroup = &cloneIntoCgroup
+	RemoveCgroupDir = &removeCgroupDir
+)
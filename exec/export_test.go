@@ -0,0 +1,16 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+var PasswdFile = &passwdFile
+
+var RetryDelay = (*RetryPolicy).delay
+
+var MergeEnvironment = mergeEnvironment
+
+var DecodeOutput = decodeOutput
+
+var Logf = &logf
+
+var CreateDir = createDir
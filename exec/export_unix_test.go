@@ -0,0 +1,11 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec
+
+var (
+	Geteuid  = &geteuid
+	SudoPath = &sudoPath
+)
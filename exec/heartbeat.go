@@ -0,0 +1,35 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Heartbeat describes a function called at regular intervals while a
+// command is being waited for, so that callers can report progress or
+// reset a watchdog during a long-running command.
+type Heartbeat struct {
+	// Interval holds the time between calls. It must be positive.
+	Interval time.Duration
+
+	// Func is called with the time since the command was started and
+	// the number of bytes it has written to standard output and
+	// standard error together. It is called from a goroutine of its
+	// own, never concurrently with itself, and should return promptly:
+	// timeouts and cancellation are not acted on while it runs.
+	Func func(elapsed time.Duration, bytesOut int64)
+}
+
+func (h *Heartbeat) validate() error {
+	if h.Interval <= 0 {
+		return errors.NotValidf("heartbeat interval %v", h.Interval)
+	}
+	if h.Func == nil {
+		return errors.NotValidf("nil heartbeat function")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/testing/leaktest"
+)
+
+type heartbeatSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&heartbeatSuite{})
+
+type beat struct {
+	elapsed  time.Duration
+	bytesOut int64
+}
+
+type beatRecorder struct {
+	mu    sync.Mutex
+	beats []beat
+}
+
+func (r *beatRecorder) record(elapsed time.Duration, bytesOut int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.beats = append(r.beats, beat{elapsed, bytesOut})
+}
+
+func (*heartbeatSuite) TestHeartbeat(c *gc.C) {
+	defer leaktest.Check(c)()
+	var recorder beatRecorder
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo hello; echo oops >&2; sleep 0.3",
+		Heartbeat: &exec.Heartbeat{
+			Interval: 50 * time.Millisecond,
+			Func:     recorder.record,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(result.Stdout), gc.Equals, "hello\n")
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	beats := recorder.beats
+	c.Assert(len(beats) >= 2, jc.IsTrue, gc.Commentf("%d heartbeats", len(beats)))
+	for i, b := range beats {
+		if i > 0 {
+			c.Assert(b.elapsed > beats[i-1].elapsed, jc.IsTrue)
+			c.Assert(b.bytesOut >= beats[i-1].bytesOut, jc.IsTrue)
+		}
+		c.Assert(b.elapsed < result.Duration, jc.IsTrue)
+	}
+	c.Assert(beats[len(beats)-1].bytesOut, gc.Equals, int64(len("hello\noops\n")))
+}
+
+func (*heartbeatSuite) TestNoHeartbeatForQuickCommand(c *gc.C) {
+	defer leaktest.Check(c)()
+	var recorder beatRecorder
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "exit 0",
+		Heartbeat: &exec.Heartbeat{
+			Interval: time.Minute,
+			Func:     recorder.record,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(recorder.beats, gc.HasLen, 0)
+}
+
+func (*heartbeatSuite) TestNotValid(c *gc.C) {
+	defer leaktest.Check(c)()
+	for i, test := range []struct {
+		heartbeat exec.Heartbeat
+		err       string
+	}{{
+		heartbeat: exec.Heartbeat{Func: func(time.Duration, int64) {}},
+		err:       "heartbeat interval 0s not valid",
+	}, {
+		heartbeat: exec.Heartbeat{Interval: time.Second},
+		err:       "nil heartbeat function not valid",
+	}} {
+		c.Logf("test %d", i)
+		heartbeat := test.heartbeat
+		_, err := exec.RunCommands(exec.RunParams{
+			Commands:  "exit 0",
+			Heartbeat: &heartbeat,
+		})
+		c.Assert(err, jc.Satisfies, errors.IsNotValid)
+		c.Assert(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (*heartbeatSuite) TestDetachNotValid(c *gc.C) {
+	defer leaktest.Check(c)()
+	params := exec.RunParams{
+		Commands: "exit 0",
+		Detach:   true,
+		Heartbeat: &exec.Heartbeat{
+			Interval: time.Second,
+			Func:     func(time.Duration, int64) {},
+		},
+	}
+	err := params.Run()
+	c.Assert(err, gc.ErrorMatches, "setting Heartbeat with Detach not valid")
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"sync"
+)
+
+// Hooks holds functions that are called around the execution of a
+// command, allowing logging, metrics or changes to the parameters to
+// be applied to every command without changing each place that runs
+// one.
+type Hooks struct {
+	// BeforeStart, if set, is called by Run once it has checked
+	// that the parameters are valid, before it does anything else,
+	// and may modify the parameters, for instance to add to the
+	// environment. The modified parameters are checked again. If it
+	// returns an error, the command is not started and Run returns
+	// the error.
+	BeforeStart func(run *RunParams) error
+
+	// AfterWait, if set, is called once a command started by Run
+	// has been waited for, with the response and error that Wait is
+	// about to return. The response may be modified.
+	AfterWait func(run *RunParams, resp *ExecResponse, err error)
+}
+
+var (
+	hooksMutex  sync.Mutex
+	globalHooks []*Hooks
+)
+
+// AddHooks adds hooks that are called for every command run by the
+// package, and returns a function that removes them again. Hooks
+// added earlier have BeforeStart called first and AfterWait called
+// last. Hooks added or removed while a command is running do not
+// affect it.
+func AddHooks(h Hooks) (remove func()) {
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+	added := &h
+	globalHooks = append(globalHooks, added)
+	return func() {
+		hooksMutex.Lock()
+		defer hooksMutex.Unlock()
+		for i, h := range globalHooks {
+			if h == added {
+				globalHooks = append(globalHooks[:i:i], globalHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// collectHooks returns the hooks that apply to a command with the
+// given hooks of its own.
+func collectHooks(own *Hooks) []*Hooks {
+	hooksMutex.Lock()
+	defer hooksMutex.Unlock()
+	hooks := append([]*Hooks(nil), globalHooks...)
+	if own != nil {
+		hooks = append(hooks, own)
+	}
+	return hooks
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type hooksSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&hooksSuite{})
+
+func (*hooksSuite) TestHooks(c *gc.C) {
+	var calls []string
+	remove := exec.AddHooks(exec.Hooks{
+		BeforeStart: func(run *exec.RunParams) error {
+			calls = append(calls, "global before")
+			run.Environment = append(run.Environment, "INJECTED=yes")
+			return nil
+		},
+		AfterWait: func(run *exec.RunParams, resp *exec.ExecResponse, err error) {
+			calls = append(calls, "global after "+string(resp.Stdout))
+		},
+	})
+	defer remove()
+
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo $INJECTED",
+		Hooks: &exec.Hooks{
+			BeforeStart: func(run *exec.RunParams) error {
+				calls = append(calls, "own before")
+				return nil
+			},
+			AfterWait: func(run *exec.RunParams, resp *exec.ExecResponse, err error) {
+				calls = append(calls, "own after")
+				resp.Code = 42
+			},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "yes\n")
+	c.Assert(resp.Code, gc.Equals, 42)
+	c.Assert(calls, jc.DeepEquals, []string{
+		"global before", "own before", "own after", "global after yes\n",
+	})
+
+	remove()
+	calls = nil
+	_, err = exec.RunCommands(exec.RunParams{Commands: "true"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(calls, gc.HasLen, 0)
+}
+
+func (*hooksSuite) TestBeforeStartError(c *gc.C) {
+	afterCalled := false
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo not run",
+		Hooks: &exec.Hooks{
+			BeforeStart: func(run *exec.RunParams) error {
+				return errors.New("denied")
+			},
+			AfterWait: func(*exec.RunParams, *exec.ExecResponse, error) {
+				afterCalled = true
+			},
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, "denied")
+	c.Assert(afterCalled, jc.IsFalse)
+}
+
+func (*hooksSuite) TestNotValidBeforeHooks(c *gc.C) {
+	beforeCalled := false
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo not run",
+		Args:     []string{"echo", "not run"},
+		Hooks: &exec.Hooks{
+			BeforeStart: func(run *exec.RunParams) error {
+				beforeCalled = true
+				return nil
+			},
+		},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(beforeCalled, jc.IsFalse)
+}
+
+func (*hooksSuite) TestBeforeStartChangesChecked(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo not run",
+		Hooks: &exec.Hooks{
+			BeforeStart: func(run *exec.RunParams) error {
+				run.Args = []string{"echo", "not run"}
+				return nil
+			},
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, "setting Args with Commands or Interpreter not valid")
+}
@@ -0,0 +1,211 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/juju/errors"
+)
+
+// Interpreter describes a program that reads the script to execute
+// from its standard input.
+type Interpreter struct {
+	// Path holds the name or path of the interpreter executable.
+	// If it contains no path separators, it is looked up in $PATH.
+	Path string
+
+	// Args holds the arguments that make the interpreter read its
+	// script from standard input.
+	Args []string
+
+	// Prelude, if not empty, is sent to the interpreter before the
+	// commands. It allows interpreter specific conventions, such as
+	// making errors produce a non-zero exit code, to be established.
+	Prelude string
+
+	// Environment holds "NAME=value" entries added to the
+	// environment of the interpreter, after those specified in
+	// RunParams.Environment.
+	Environment []string
+
+	// ScriptArgs holds the arguments, in place of Args, that precede
+	// the path of the script when RunParams.ScriptFile is set, and
+	// ScriptExtension the file name extension, such as ".ps1", that
+	// the interpreter requires the script to have.
+	ScriptArgs      []string
+	ScriptExtension string
+}
+
+var (
+	// Python3 runs the commands as a Python 3 script. Output is
+	// unbuffered so that the relative order of stdout and stderr is
+	// preserved, and encoded as UTF-8 regardless of the locale. An
+	// uncaught exception prints a traceback on stderr and exits with
+	// code 1.
+	Python3 = Interpreter{
+		Path: "python3",
+		Args: []string{"-"},
+		Environment: []string{
+			"PYTHONUNBUFFERED=1",
+			"PYTHONIOENCODING=utf-8",
+		},
+		ScriptExtension: ".py",
+	}
+
+	// Perl runs the commands as a Perl script. Standard output is
+	// unbuffered, die prints its message on stderr and exits with a
+	// non-zero code (usually 255).
+	Perl = Interpreter{
+		Path:            "perl",
+		Args:            []string{"-"},
+		Prelude:         "$| = 1;\n",
+		ScriptExtension: ".pl",
+	}
+
+	// OSAScript runs the commands as an AppleScript (or other OSA
+	// language) script on OS X. Script errors are reported on stderr
+	// with exit code 1; the value of the last statement is written to
+	// stdout.
+	OSAScript = Interpreter{
+		Path: "osascript",
+		Args: []string{"-"},
+	}
+)
+
+// powershellCommand makes powershell read its script from standard
+// input, exiting with the exit code of the last native command run,
+// or 1 if the script throws an error.
+const powershellCommand = "try{$input|iex; exit $LastExitCode}catch{Write-Error -Message $Error[0]; exit 1}"
+
+// powershellScriptArgs make powershell run a script file, which
+// execution policy would otherwise forbid.
+var powershellScriptArgs = []string{"-noprofile", "-noninteractive", "-executionpolicy", "bypass", "-file"}
+
+var (
+	// Bash runs the commands with /bin/bash. It is the default on
+	// platforms other than Windows.
+	Bash = Interpreter{
+		Path: "/bin/bash",
+		Args: []string{"-s"},
+	}
+
+	// Sh runs the commands with /bin/sh, which is available in
+	// minimal container images that lack bash.
+	Sh = Interpreter{
+		Path: "/bin/sh",
+		Args: []string{"-s"},
+	}
+
+	// Zsh runs the commands with zsh, found in $PATH.
+	Zsh = Interpreter{
+		Path: "zsh",
+		Args: []string{"-s"},
+	}
+
+	// PowerShell runs the commands with Windows PowerShell. It is the
+	// default on Windows.
+	PowerShell = Interpreter{
+		Path:            "powershell.exe",
+		Args:            []string{"-noprofile", "-noninteractive", "-command", powershellCommand},
+		ScriptArgs:      powershellScriptArgs,
+		ScriptExtension: ".ps1",
+	}
+
+	// Pwsh runs the commands with PowerShell Core, found in $PATH,
+	// which is also available on Linux and OS X.
+	Pwsh = Interpreter{
+		Path:            "pwsh",
+		Args:            []string{"-noprofile", "-noninteractive", "-command", powershellCommand},
+		ScriptArgs:      powershellScriptArgs,
+		ScriptExtension: ".ps1",
+	}
+
+	// Cmd runs the commands with cmd.exe on Windows. Commands are
+	// not echoed, but cmd.exe still writes its banner and a prompt
+	// for each line it reads to standard output, as it treats its
+	// input as an interactive session; with RunParams.ScriptFile it
+	// runs them as a batch file, without either.
+	Cmd = Interpreter{
+		Path:            "cmd.exe",
+		Args:            []string{"/D", "/Q"},
+		Prelude:         "@echo off\r\n",
+		ScriptArgs:      []string{"/D", "/Q", "/C"},
+		ScriptExtension: ".cmd",
+	}
+)
+
+// defaultShell returns the interpreter used when RunParams.Interpreter
+// is not set. Where bash is not installed, as in many minimal
+// container images, Sh is used instead unless requireBash is set.
+// Bash is looked for within root, if not empty.
+func defaultShell(requireBash bool, root string) (*Interpreter, error) {
+	if runtime.GOOS == "windows" {
+		return &PowerShell, nil
+	}
+	if _, err := os.Stat(filepath.Join(root, Bash.Path)); err == nil {
+		return &Bash, nil
+	} else if requireBash {
+		return nil, errors.NotFoundf("bash at %q", Bash.Path)
+	}
+	logger.Debugf("%s not found, running commands with %s", Bash.Path, Sh.Path)
+	return &Sh, nil
+}
+
+// command returns a command that will run commands with the
+// interpreter, given the environment requested by the caller.
+func (i *Interpreter) command(commands string, env []string) (*exec.Cmd, string) {
+	cmd := exec.Command(i.Path, i.Args...)
+	cmd.Env = i.environment(env)
+	return cmd, i.Prelude + commands
+}
+
+// scriptCommand writes commands to a new temporary script file and
+// returns a command that will run it with the interpreter, along with
+// the path of the file.
+func (i *Interpreter) scriptCommand(commands string, env []string) (*exec.Cmd, string, error) {
+	f, err := ioutil.TempFile("", "juju-exec-*"+i.ScriptExtension)
+	if err != nil {
+		return nil, "", errors.Annotate(err, "cannot create script file")
+	}
+	_, err = f.WriteString(i.Prelude + commands)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, "", errors.Annotate(err, "cannot write script file")
+	}
+	args := append(append([]string(nil), i.ScriptArgs...), f.Name())
+	cmd := exec.Command(i.Path, args...)
+	cmd.Env = i.environment(env)
+	return cmd, f.Name(), nil
+}
+
+// removeScript removes the script file written for ScriptFile, if any.
+func (r *RunParams) removeScript() {
+	if r.script == "" {
+		return
+	}
+	if err := os.Remove(r.script); err != nil {
+		logger.Warningf("cannot remove script file: %v", err)
+	}
+	r.script = ""
+}
+
+// environment returns the environment for the interpreter, given the
+// environment requested by the caller.
+func (i *Interpreter) environment(env []string) []string {
+	if len(i.Environment) == 0 {
+		return env
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(append([]string(nil), env...), i.Environment...)
+}
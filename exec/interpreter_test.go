@@ -0,0 +1,105 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	utilsexec "github.com/juju/utils/exec"
+)
+
+type interpreterSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&interpreterSuite{})
+
+func requireInterpreter(c *gc.C, i utilsexec.Interpreter) {
+	if _, err := exec.LookPath(i.Path); err != nil {
+		c.Skip(i.Path + " not available")
+	}
+}
+
+func (*interpreterSuite) TestPython3(c *gc.C) {
+	requireInterpreter(c, utilsexec.Python3)
+	result, err := utilsexec.RunCommands(utilsexec.RunParams{
+		Commands:    "import os, sys\nprint(os.environ['GREETING'])\nsys.exit(4)\n",
+		Environment: append(os.Environ(), "GREETING=hello"),
+		Interpreter: &utilsexec.Python3,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result.Stdout), gc.Equals, "hello\n")
+	c.Assert(result.Code, gc.Equals, 4)
+}
+
+func (*interpreterSuite) TestPython3Exception(c *gc.C) {
+	requireInterpreter(c, utilsexec.Python3)
+	result, err := utilsexec.RunCommands(utilsexec.RunParams{
+		Commands:    "raise ValueError('bad value')\n",
+		Interpreter: &utilsexec.Python3,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 1)
+	c.Assert(string(result.Stderr), jc.Contains, "ValueError: bad value")
+}
+
+func (*interpreterSuite) TestPerl(c *gc.C) {
+	requireInterpreter(c, utilsexec.Perl)
+	result, err := utilsexec.RunCommands(utilsexec.RunParams{
+		Commands:    "print \"out\\n\";\ndie \"failed\\n\";\n",
+		Interpreter: &utilsexec.Perl,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result.Stdout), gc.Equals, "out\n")
+	c.Assert(string(result.Stderr), gc.Equals, "failed\n")
+	c.Assert(result.Code, gc.Not(gc.Equals), 0)
+}
+
+func (*interpreterSuite) TestCustomInterpreter(c *gc.C) {
+	requireInterpreter(c, utilsexec.Interpreter{Path: "sh"})
+	result, err := utilsexec.RunCommands(utilsexec.RunParams{
+		Commands: "echo $0 $EXTRA\n",
+		Interpreter: &utilsexec.Interpreter{
+			Path:        "sh",
+			Args:        []string{"-s"},
+			Prelude:     "set -e\n",
+			Environment: []string{"EXTRA=extra"},
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result.Stdout), gc.Equals, "sh extra\n")
+}
+
+func (*interpreterSuite) TestPosixShells(c *gc.C) {
+	for _, shell := range []utilsexec.Interpreter{utilsexec.Bash, utilsexec.Sh, utilsexec.Zsh} {
+		c.Logf("shell %s", shell.Path)
+		if _, err := exec.LookPath(shell.Path); err != nil {
+			c.Logf("%s not available", shell.Path)
+			continue
+		}
+		shell := shell
+		result, err := utilsexec.RunCommands(utilsexec.RunParams{
+			Commands:    "echo hello\nexit 3\n",
+			Interpreter: &shell,
+		})
+		c.Assert(err, gc.IsNil)
+		c.Check(string(result.Stdout), gc.Equals, "hello\n")
+		c.Check(result.Code, gc.Equals, 3)
+	}
+}
+
+func (*interpreterSuite) TestPwsh(c *gc.C) {
+	requireInterpreter(c, utilsexec.Pwsh)
+	result, err := utilsexec.RunCommands(utilsexec.RunParams{
+		Commands:    "Write-Output hello",
+		Interpreter: &utilsexec.Pwsh,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result.Stdout), gc.Matches, "hello\r?\n")
+}
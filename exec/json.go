@@ -0,0 +1,55 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// RunJSON runs the command described by run, as RunCommandsContext
+// does, and decodes its standard output, which must be JSON, into
+// target, as json.Unmarshal does. It suits tools that report their
+// results with an option such as --format=json.
+//
+// A command that exits with a non-zero code, or is killed by a
+// signal, fails with an *ExitError, whose message includes the last
+// line of its standard error. The output of the command must be
+// captured, so neither Stdout nor StdoutPath may be set.
+func RunJSON(ctx context.Context, run RunParams, target interface{}) error {
+	if run.Stdout != nil || run.StdoutPath != "" {
+		return errors.NotValidf("setting Stdout or StdoutPath with RunJSON")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	resp, err := strict(runWithRetry(ctx, run))
+	if err != nil {
+		return err
+	}
+	if resp.StdoutTruncated {
+		return errors.Errorf("cannot decode truncated output of %s", run.describe())
+	}
+	if err := json.Unmarshal(resp.Stdout, target); err != nil {
+		return errors.Annotatef(err, "cannot decode output of %s", run.describe())
+	}
+	return nil
+}
+
+// describe returns a short description of the command for errors,
+// with any redactions applied.
+func (r *RunParams) describe() string {
+	if len(r.Args) > 0 {
+		return r.redact(QuotePOSIX(r.Args...))
+	}
+	line := r.Commands
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i] + " ..."
+	}
+	return r.redact(strconv.Quote(line))
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type jsonSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&jsonSuite{})
+
+type machine struct {
+	ID     string `json:"id"`
+	Series string `json:"series"`
+}
+
+func (*jsonSuite) TestRunJSON(c *gc.C) {
+	var machines []machine
+	err := exec.RunJSON(context.Background(), exec.RunParams{
+		Commands: `echo '[{"id": "0", "series": "xenial"},'; echo '{"id": "1", "series": "bionic"}]'`,
+	}, &machines)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(machines, jc.DeepEquals, []machine{{"0", "xenial"}, {"1", "bionic"}})
+}
+
+func (*jsonSuite) TestExitError(c *gc.C) {
+	var target interface{}
+	err := exec.RunJSON(context.Background(), exec.RunParams{
+		Commands: "echo '{}'; echo 'error: no such model' >&2; exit 2",
+	}, &target)
+	c.Assert(err, gc.ErrorMatches, "exited with code 2: error: no such model")
+	exitErr, ok := errors.Cause(err).(*exec.ExitError)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(exitErr.Code, gc.Equals, 2)
+	c.Assert(target, gc.IsNil)
+}
+
+func (*jsonSuite) TestDecodeError(c *gc.C) {
+	var target map[string]string
+	err := exec.RunJSON(context.Background(), exec.RunParams{
+		Args: []string{"/bin/echo", "not json"},
+	}, &target)
+	c.Assert(err, gc.ErrorMatches, `cannot decode output of /bin/echo 'not json': invalid character .*`)
+
+	err = exec.RunJSON(context.Background(), exec.RunParams{
+		Commands:   "echo secret\necho more",
+		Redactions: []*regexp.Regexp{exec.RedactString("secret")},
+	}, &target)
+	c.Assert(err, gc.ErrorMatches, `cannot decode output of "echo \[REDACTED\] ...": invalid character .*`)
+}
+
+func (*jsonSuite) TestTruncated(c *gc.C) {
+	var target interface{}
+	err := exec.RunJSON(context.Background(), exec.RunParams{
+		Args:           []string{"/bin/echo", `{"long": "value"}`},
+		MaxOutputBytes: 4,
+	}, &target)
+	c.Assert(err, gc.ErrorMatches, `cannot decode truncated output of /bin/echo .*`)
+}
+
+func (*jsonSuite) TestStdoutNotValid(c *gc.C) {
+	var target interface{}
+	err := exec.RunJSON(context.Background(), exec.RunParams{
+		Commands: "echo {}",
+		Stdout:   ioutil.Discard,
+	}, &target)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// IOClass identifies an I/O scheduling class, as used by ionice(1).
+type IOClass int
+
+const (
+	// IOClassNone leaves the I/O scheduling of the command unchanged.
+	IOClassNone IOClass = iota
+	IOClassRealtime
+	IOClassBestEffort
+	IOClassIdle
+)
+
+// ResourceLimits restricts the resources available to a command and
+// the processes it starts. They are only supported on Unix.
+type ResourceLimits struct {
+	// CPUTime, if positive, limits the CPU time used by each process,
+	// rounded up to a whole number of seconds.
+	CPUTime time.Duration
+
+	// OpenFiles, if positive, limits the number of files that each
+	// process may have open.
+	OpenFiles uint64
+
+	// Memory, if positive, limits the size in bytes of the virtual
+	// address space of each process.
+	Memory uint64
+
+	// Nice, if not zero, is added to the nice value of the agent to
+	// give that of the command. Making it negative, to raise the
+	// command's priority, requires privilege.
+	Nice int
+
+	// IOClass, if not IOClassNone, sets the I/O scheduling class of
+	// the command, and IOPriority its priority within the realtime and
+	// best effort classes, from 0 (highest) to 7. They are only
+	// supported on Linux.
+	IOClass    IOClass
+	IOPriority int
+}
+
+// Validate returns an error if the limits are not valid.
+func (l *ResourceLimits) Validate() error {
+	if l.CPUTime < 0 {
+		return errors.NotValidf("negative CPU time limit")
+	}
+	if l.Nice < -20 || l.Nice > 19 {
+		return errors.NotValidf("nice value %d", l.Nice)
+	}
+	if l.IOClass < IOClassNone || l.IOClass > IOClassIdle {
+		return errors.NotValidf("I/O class %d", l.IOClass)
+	}
+	if l.IOPriority < 0 || l.IOPriority > 7 {
+		return errors.NotValidf("I/O priority %d", l.IOPriority)
+	}
+	if l.IOPriority != 0 && (l.IOClass == IOClassNone || l.IOClass == IOClassIdle) {
+		return errors.NotValidf("I/O priority without realtime or best effort class")
+	}
+	return nil
+}
+
+// isZero reports whether l restricts nothing.
+func (l *ResourceLimits) isZero() bool {
+	return *l == ResourceLimits{}
+}
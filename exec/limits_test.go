@@ -0,0 +1,131 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"fmt"
+	osexec "os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type limitsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&limitsSuite{})
+
+func (s *limitsSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	// The limits are applied through nice and ionice, which are
+	// looked up in $PATH.
+	s.PatchEnvironment("PATH", "/usr/bin:/bin")
+}
+
+func (*limitsSuite) TestRLimits(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "ulimit -t; ulimit -n; ulimit -v",
+		Limits: &exec.ResourceLimits{
+			CPUTime:   1500 * time.Millisecond,
+			OpenFiles: 64,
+			Memory:    512 * 1024 * 1024,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(string(resp.Stdout), gc.Equals, "2\n64\n524288\n")
+}
+
+func (*limitsSuite) TestOpenFilesEnforced(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:   []string{"sh", "-c", "exec 3</dev/null 4</dev/null 5</dev/null 6</dev/null"},
+		Limits: &exec.ResourceLimits{OpenFiles: 5},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Not(gc.Equals), 0)
+}
+
+func (*limitsSuite) TestNice(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:   []string{"nice"},
+		Limits: &exec.ResourceLimits{Nice: 5},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	base, err := osexec.Command("nice").Output()
+	c.Assert(err, jc.ErrorIsNil)
+	var before, after int
+	_, err = fmt.Sscan(string(base), &before)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = fmt.Sscan(string(resp.Stdout), &after)
+	c.Assert(err, jc.ErrorIsNil)
+	if before+5 <= 19 {
+		c.Assert(after, gc.Equals, before+5)
+	}
+}
+
+func (*limitsSuite) TestIOPriority(c *gc.C) {
+	if runtime.GOOS != "linux" {
+		c.Skip("I/O scheduling classes are only supported on Linux")
+	}
+	if _, err := osexec.LookPath("ionice"); err != nil {
+		c.Skip("ionice not available")
+	}
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "ionice -p $$",
+		Limits: &exec.ResourceLimits{
+			IOClass:    exec.IOClassBestEffort,
+			IOPriority: 6,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "best-effort: prio 6\n")
+}
+
+func (*limitsSuite) TestPreservesArgsAndStdin(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "read x; echo \"$x\"",
+		Stdin:    strings.NewReader("it's $HOME\n"),
+		Limits:   &exec.ResourceLimits{Nice: 1, OpenFiles: 32},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "it's $HOME\n")
+}
+
+func (*limitsSuite) TestInvalid(c *gc.C) {
+	for i, test := range []struct {
+		limits exec.ResourceLimits
+		err    string
+	}{{
+		limits: exec.ResourceLimits{Nice: 20},
+		err:    "nice value 20 not valid",
+	}, {
+		limits: exec.ResourceLimits{CPUTime: -time.Second},
+		err:    "negative CPU time limit not valid",
+	}, {
+		limits: exec.ResourceLimits{IOClass: 4},
+		err:    "I/O class 4 not valid",
+	}, {
+		limits: exec.ResourceLimits{IOClass: exec.IOClassBestEffort, IOPriority: 8},
+		err:    "I/O priority 8 not valid",
+	}, {
+		limits: exec.ResourceLimits{IOClass: exec.IOClassIdle, IOPriority: 3},
+		err:    "I/O priority without realtime or best effort class not valid",
+	}} {
+		c.Logf("test %d", i)
+		limits := test.limits
+		err := (&exec.RunParams{Commands: "true", Limits: &limits}).Run()
+		c.Check(err, gc.ErrorMatches, "invalid run parameters: Limits: "+test.err)
+		c.Check(errors.IsNotValid(err), jc.IsTrue)
+	}
+}
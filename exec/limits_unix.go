@@ -0,0 +1,72 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec
+
+import (
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// limitCommand rewrites cmd so that it runs with the given limits. A
+// shell sets the resource limits before executing the command through
+// nice and ionice, so that they apply from its first instruction.
+func limitCommand(cmd *exec.Cmd, l *ResourceLimits) error {
+	if err := l.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if cmd.Err != nil || l.isZero() {
+		return nil
+	}
+	script := ""
+	ulimit := func(flag string, value uint64) {
+		script += "ulimit " + flag + " " + strconv.FormatUint(value, 10) + " || exit 126; "
+	}
+	if l.CPUTime > 0 {
+		ulimit("-t", uint64((l.CPUTime+time.Second-1)/time.Second))
+	}
+	if l.OpenFiles > 0 {
+		ulimit("-n", l.OpenFiles)
+	}
+	if l.Memory > 0 {
+		// The limit is given to ulimit in kibibytes.
+		kib := l.Memory / 1024
+		if kib == 0 {
+			kib = 1
+		}
+		ulimit("-v", kib)
+	}
+	script += `exec "$@"`
+
+	argv := append([]string{cmd.Path}, cmd.Args[1:]...)
+	if l.IOClass != IOClassNone {
+		if runtime.GOOS != "linux" {
+			return errors.NotSupportedf("I/O scheduling class on %s", runtime.GOOS)
+		}
+		ionice, err := exec.LookPath("ionice")
+		if err != nil {
+			return errors.NotFoundf("ionice")
+		}
+		args := []string{ionice, "-c", strconv.Itoa(int(l.IOClass))}
+		if l.IOClass != IOClassIdle {
+			args = append(args, "-n", strconv.Itoa(l.IOPriority))
+		}
+		argv = append(append(args, "--"), argv...)
+	}
+	if l.Nice != 0 {
+		nice, err := exec.LookPath("nice")
+		if err != nil {
+			return errors.NotFoundf("nice")
+		}
+		argv = append([]string{nice, "-n", strconv.Itoa(l.Nice), "--"}, argv...)
+	}
+	cmd.Path = "/bin/sh"
+	cmd.Args = append([]string{"/bin/sh", "-c", script, "sh"}, argv...)
+	return nil
+}
@@ -0,0 +1,22 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"os/exec"
+
+	"github.com/juju/errors"
+)
+
+// limitCommand returns an error satisfying errors.IsNotSupported, as
+// resource limits are not available on Windows.
+func limitCommand(cmd *exec.Cmd, l *ResourceLimits) error {
+	if err := l.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	if l.isZero() {
+		return nil
+	}
+	return errors.NotSupportedf("resource limits on windows")
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"bytes"
+	"sync"
+)
+
+// lineWriter is an io.Writer that calls emit for each complete line
+// written to it, without the trailing newline. Any final partial line
+// is emitted by Flush. It never returns an error, so that a slow or
+// failing consumer cannot disturb the command being run.
+type lineWriter struct {
+	mu      sync.Mutex
+	emit    func(line []byte)
+	partial []byte
+}
+
+func newLineWriter(emit func(line []byte)) *lineWriter {
+	return &lineWriter{emit: emit}
+}
+
+// Write implements io.Writer.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.partial = append(w.partial, p...)
+			break
+		}
+		if len(w.partial) > 0 {
+			w.partial = append(w.partial, p[:i]...)
+			w.emit(w.partial)
+			w.partial = w.partial[:0]
+		} else {
+			w.emit(p[:i])
+		}
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Flush emits any partial line that has not been terminated by a
+// newline.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.emit(w.partial)
+		w.partial = nil
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+// DefaultLocale is the locale used by RunParams.NormalizeLocale when
+// no other is given. Programs write their messages in it untranslated
+// and format numbers and dates in it predictably.
+const DefaultLocale = "C"
+
+// localeVariables returns the environment variables that make
+// programs on POSIX systems use locale, if not empty, or
+// DefaultLocale. LC_ALL overrides the other LC_ variables and LANG,
+// which is set for programs that only read it; LANGUAGE, which GNU
+// gettext consults before them, is cleared.
+func localeVariables(locale string) []string {
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	return []string{
+		"LANG=" + locale,
+		"LC_ALL=" + locale,
+		"LANGUAGE=",
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type localeSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&localeSuite{})
+
+const printLocale = `echo "$LANG|$LC_ALL|${LANGUAGE-unset}|$LC_MESSAGES"`
+
+func (s *localeSuite) TestNormalizeLocale(c *gc.C) {
+	s.PatchEnvironment("LANG", "de_DE.UTF-8")
+	s.PatchEnvironment("LANGUAGE", "de:en")
+	s.PatchEnvironment("LC_MESSAGES", "de_DE.UTF-8")
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:        printLocale,
+		NormalizeLocale: true,
+		Environment:     []string{"LC_ALL=fr_FR.UTF-8"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "C|C||de_DE.UTF-8\n")
+}
+
+func (s *localeSuite) TestLocale(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:        printLocale,
+		NormalizeLocale: true,
+		Locale:          "C.UTF-8",
+		EnvironmentMode: exec.ReplaceEnvironment,
+		Environment:     []string{"PATH=/bin:/usr/bin"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "C.UTF-8|C.UTF-8||\n")
+}
+
+func (s *localeSuite) TestNotNormalized(c *gc.C) {
+	s.PatchEnvironment("LANG", "de_DE.UTF-8")
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: printLocale,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), jc.HasPrefix, "de_DE.UTF-8|")
+}
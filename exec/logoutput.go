@@ -0,0 +1,33 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"github.com/juju/loggo"
+)
+
+// logf logs the output lines of commands run with LogOutput. It is a
+// variable so that tests can see what is logged.
+var logf = logger.Logf
+
+// outputLogLevels returns the levels at which the standard output and
+// standard error of r are logged.
+func (r *RunParams) outputLogLevels() (stdout, stderr loggo.Level) {
+	stdout, stderr = r.StdoutLogLevel, r.StderrLogLevel
+	if stdout == loggo.UNSPECIFIED {
+		stdout = loggo.DEBUG
+	}
+	if stderr == loggo.UNSPECIFIED {
+		stderr = loggo.WARNING
+	}
+	return stdout, stderr
+}
+
+// logLines returns a function, to be passed to lineCallback, that logs
+// each line of the named stream at level, with r's redactions masked.
+func (r *RunParams) logLines(stream string, level loggo.Level) func(line string) {
+	return func(line string) {
+		logf(level, "process %d %s: %s", r.ps.Process.Pid, stream, r.redact(line))
+	}
+}
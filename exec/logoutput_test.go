@@ -0,0 +1,82 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/juju/loggo"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type logOutputSuite struct {
+	testing.IsolationSuite
+
+	mu     sync.Mutex
+	logged []string
+}
+
+var _ = gc.Suite(&logOutputSuite{})
+
+func (s *logOutputSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.logged = nil
+	s.PatchValue(exec.Logf, func(level loggo.Level, format string, args ...interface{}) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.logged = append(s.logged, level.String()+" "+fmt.Sprintf(format, args...))
+	})
+}
+
+func (s *logOutputSuite) TestLogOutput(c *gc.C) {
+	run := exec.RunParams{
+		Commands:   "echo out\necho err >&2\nprintf partial",
+		LogOutput:  true,
+		Redactions: []*regexp.Regexp{exec.RedactString("partial")},
+	}
+	err := run.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	pid := strconv.Itoa(run.Process().Pid)
+	resp, err := run.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "out\npartial")
+	c.Assert(s.logged, jc.SameContents, []string{
+		"DEBUG process " + pid + " stdout: out",
+		"WARNING process " + pid + " stderr: err",
+		"DEBUG process " + pid + " stdout: [REDACTED]",
+	})
+}
+
+func (s *logOutputSuite) TestLogLevels(c *gc.C) {
+	run := exec.RunParams{
+		Commands:       "echo out\necho err >&2",
+		LogOutput:      true,
+		StdoutLogLevel: loggo.INFO,
+		StderrLogLevel: loggo.ERROR,
+	}
+	err := run.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	pid := strconv.Itoa(run.Process().Pid)
+	_, err = run.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.logged, jc.SameContents, []string{
+		"INFO process " + pid + " stdout: out",
+		"ERROR process " + pid + " stderr: err",
+	})
+}
+
+func (s *logOutputSuite) TestLogOutputDisabled(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{Commands: "echo out"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.logged, gc.HasLen, 0)
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// LookPath searches for an executable named name in the directories
+// named by the PATH environment variable and then in extraDirs, such
+// as /usr/sbin or an agent's tools directory, which are often missing
+// from the PATH of services. On Windows the extensions listed in
+// PATHEXT are tried in turn, as the shell would. A name that contains
+// a path separator is not searched for, but only checked.
+//
+// Relative directories, including the empty entries that stand for
+// the current directory in PATH, are ignored, as what they find
+// depends on the working directory.
+//
+// The result is an absolute path, which can be given as
+// RunParams.Path so that it is not looked up again. If no executable
+// is found, the error satisfies errors.IsNotFound.
+func LookPath(name string, extraDirs ...string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || filepath.VolumeName(name) != "" {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return "", errors.NotFoundf("executable %q", name)
+		}
+		return filepath.Abs(path)
+	}
+	dirs := append(filepath.SplitList(os.Getenv("PATH")), extraDirs...)
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		// Passing a path, rather than a name, makes exec.LookPath
+		// check it, trying the PATHEXT extensions on Windows,
+		// without searching.
+		if path, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.NotFoundf("executable %q", name)
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type lookPathSuite struct {
+	testing.IsolationSuite
+	pathDir  string
+	extraDir string
+}
+
+var _ = gc.Suite(&lookPathSuite{})
+
+func (s *lookPathSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.pathDir = c.MkDir()
+	s.extraDir = c.MkDir()
+	s.PatchEnvironment("PATH", s.pathDir+string(os.PathListSeparator)+"."+string(os.PathListSeparator))
+}
+
+func writeExecutable(c *gc.C, path, output string) {
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho "+output+"\n"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *lookPathSuite) TestPath(c *gc.C) {
+	writeExecutable(c, filepath.Join(s.pathDir, "tool"), "path")
+	writeExecutable(c, filepath.Join(s.extraDir, "tool"), "extra")
+	path, err := exec.LookPath("tool", s.extraDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(path, gc.Equals, filepath.Join(s.pathDir, "tool"))
+}
+
+func (s *lookPathSuite) TestExtraDirs(c *gc.C) {
+	writeExecutable(c, filepath.Join(s.extraDir, "tool"), "extra")
+	path, err := exec.LookPath("tool", "relative", s.extraDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(path, gc.Equals, filepath.Join(s.extraDir, "tool"))
+}
+
+func (s *lookPathSuite) TestNotExecutable(c *gc.C) {
+	err := ioutil.WriteFile(filepath.Join(s.pathDir, "tool"), nil, 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	writeExecutable(c, filepath.Join(s.extraDir, "tool"), "extra")
+	path, err := exec.LookPath("tool", s.extraDir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(path, gc.Equals, filepath.Join(s.extraDir, "tool"))
+}
+
+func (s *lookPathSuite) TestRelativeDirsIgnored(c *gc.C) {
+	dir := c.MkDir()
+	writeExecutable(c, filepath.Join(dir, "tool"), "cwd")
+	cwd, err := os.Getwd()
+	c.Assert(err, jc.ErrorIsNil)
+	defer os.Chdir(cwd)
+	err = os.Chdir(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = exec.LookPath("tool")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `executable "tool" not found`)
+}
+
+func (s *lookPathSuite) TestWithSeparator(c *gc.C) {
+	tool := filepath.Join(s.extraDir, "tool")
+	writeExecutable(c, tool, "extra")
+	path, err := exec.LookPath(tool)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(path, gc.Equals, tool)
+
+	_, err = exec.LookPath(filepath.Join(s.pathDir, "missing"))
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *lookPathSuite) TestRunParamsPath(c *gc.C) {
+	tool := filepath.Join(s.extraDir, "tool")
+	err := ioutil.WriteFile(tool, []byte("#!/bin/sh\necho \"$0\"\n"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	path, err := exec.LookPath("tool", s.extraDir)
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args: []string{"tool"},
+		Path: path,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, tool+"\n")
+}
+
+func (s *lookPathSuite) TestPathWithoutArgs(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		Path:     "/bin/true",
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, "setting Path without Args not valid")
+}
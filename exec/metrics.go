@@ -0,0 +1,95 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements of the commands run by the package,
+// so that they can be exported to a monitoring system. See SetMetrics
+// and the prommetrics package. Its methods may be called
+// concurrently.
+type Metrics interface {
+	// CommandStarted is called with the name of each command once
+	// it has been started. The name is RunParams.MetricName, if set,
+	// or else the base name, without any extension, of the program in
+	// Args or of the shell or interpreter that runs Commands.
+	CommandStarted(name string)
+
+	// CommandFinished is called once a started command has been
+	// waited for, with how long it ran and its exit code, which is
+	// -1 if it did not exit normally, for instance because it was
+	// killed.
+	CommandFinished(name string, duration time.Duration, code int)
+}
+
+var (
+	metricsMutex sync.Mutex
+	metrics      Metrics
+)
+
+// SetMetrics sets the metrics that every command run by the package
+// is reported to, and returns the previous ones. Commands started with
+// Detach are not reported. A nil value disables reporting. Commands
+// that are already running continue to be reported to the metrics
+// that they started with, so that their starts and finishes match.
+func SetMetrics(m Metrics) Metrics {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	previous := metrics
+	metrics = m
+	return previous
+}
+
+func currentMetrics() Metrics {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	return metrics
+}
+
+// metricName returns the name by which r is reported to Metrics.
+func (r *RunParams) metricName() string {
+	if r.MetricName != "" {
+		return r.MetricName
+	}
+	program := r.shell
+	if len(r.Args) > 0 {
+		program = r.Args[0]
+	}
+	// filepath.Base does not know about backslashes on other
+	// platforms, so handle them here for Windows paths.
+	base := filepath.Base(program[strings.LastIndex(program, `\`)+1:])
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// metricsStarted reports that r has started to the current metrics,
+// which are retained to report its finish.
+func (r *RunParams) metricsStarted() {
+	r.metrics = currentMetrics()
+	if r.metrics != nil {
+		r.metrics.CommandStarted(r.metricName())
+	}
+}
+
+// metricsFinished reports that r has finished with the given result.
+func (r *RunParams) metricsFinished(result *ExecResponse) {
+	m := r.metrics
+	if m == nil {
+		return
+	}
+	r.metrics = nil
+	duration := r.getClock().Now().Sub(r.started)
+	if result != nil {
+		duration = result.Duration
+	}
+	code := -1
+	if state := r.ps.ProcessState; state != nil && state.Exited() {
+		code = state.ExitCode()
+	}
+	m.CommandFinished(r.metricName(), duration, code)
+}
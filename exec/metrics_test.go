@@ -0,0 +1,113 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type metricsSuite struct {
+	testing.IsolationSuite
+	metrics *fakeMetrics
+}
+
+var _ = gc.Suite(&metricsSuite{})
+
+func (s *metricsSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.metrics = &fakeMetrics{}
+	previous := exec.SetMetrics(s.metrics)
+	s.AddCleanup(func(*gc.C) { exec.SetMetrics(previous) })
+}
+
+type fakeMetrics struct {
+	mu        sync.Mutex
+	events    []string
+	durations []time.Duration
+}
+
+func (m *fakeMetrics) CommandStarted(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, "started "+name)
+}
+
+func (m *fakeMetrics) CommandFinished(name string, duration time.Duration, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, fmt.Sprintf("finished %s %d", name, code))
+	m.durations = append(m.durations, duration)
+}
+
+func (s *metricsSuite) TestCommands(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "sleep 0.1; exit 3",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 3)
+	c.Assert(s.metrics.events, jc.DeepEquals, []string{"started bash", "finished bash 3"})
+	c.Assert(s.metrics.durations[0], gc.Equals, resp.Duration)
+	c.Assert(s.metrics.durations[0] >= 100*time.Millisecond, jc.IsTrue)
+}
+
+func (s *metricsSuite) TestArgs(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Args: []string{"/bin/true"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.metrics.events, jc.DeepEquals, []string{"started true", "finished true 0"})
+}
+
+func (s *metricsSuite) TestMetricName(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:   "true",
+		MetricName: "upgrade",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.metrics.events, jc.DeepEquals, []string{"started upgrade", "finished upgrade 0"})
+}
+
+func (s *metricsSuite) TestKilled(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "exec sleep 60",
+		Timeout:  50 * time.Millisecond,
+	})
+	c.Assert(err, gc.Equals, exec.ErrTimedOut)
+	c.Assert(s.metrics.events, jc.DeepEquals, []string{"started bash", "finished bash -1"})
+}
+
+func (s *metricsSuite) TestNotStarted(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Args: []string{"/non/existent"},
+	})
+	c.Assert(err, gc.NotNil)
+	c.Assert(s.metrics.events, gc.HasLen, 0)
+}
+
+func (s *metricsSuite) TestDetached(c *gc.C) {
+	_, err := exec.StartDetached(exec.RunParams{
+		Commands: "true",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.metrics.events, gc.HasLen, 0)
+}
+
+func (s *metricsSuite) TestDisabled(c *gc.C) {
+	exec.SetMetrics(nil)
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.metrics.events, gc.HasLen, 0)
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot and procSelfCgroup are overridden in tests.
+var (
+	cgroupRoot     = "/sys/fs/cgroup"
+	procSelfCgroup = "/proc/self/cgroup"
+)
+
+// oomKillCount returns the number of processes killed by the OOM
+// killer in the memory cgroup containing the agent, or -1 if this
+// cannot be determined. Both the unified (v2) and legacy (v1)
+// hierarchies are supported.
+func oomKillCount() int {
+	data, err := ioutil.ReadFile(procSelfCgroup)
+	if err != nil {
+		return -1
+	}
+	var v1, v2 string
+	haveV1, haveV2 := false, false
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			v2, haveV2 = parts[2], true
+		case strings.Contains(","+parts[1]+",", ",memory,"):
+			v1, haveV1 = parts[2], true
+		}
+	}
+	if haveV1 {
+		if n := readOOMKill(filepath.Join(cgroupRoot, "memory", v1, "memory.oom_control")); n >= 0 {
+			return n
+		}
+	}
+	if haveV2 {
+		return readOOMKill(filepath.Join(cgroupRoot, v2, "memory.events"))
+	}
+	return -1
+}
+
+// readOOMKill reads the oom_kill entry from a cgroup memory.events or
+// memory.oom_control file.
+func readOOMKill(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return -1
+			}
+			return n
+		}
+	}
+	return -1
+}
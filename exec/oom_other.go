@@ -0,0 +1,12 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !linux
+
+package exec
+
+// oomKillCount always returns -1 as OOM kills cannot be detected on
+// this platform.
+func oomKillCount() int {
+	return -1
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package otelexec traces the commands run by the exec package with
+// OpenTelemetry.
+//
+// To use it, set a tracer as the exec package's tracer:
+//
+//	exec.SetTracer(otelexec.New(otel.GetTracerProvider()))
+//
+// Each command then has a span, a child of any span in the context
+// passed to exec.RunCommandsContext or set in RunParams.TraceContext,
+// and is given the W3C trace context in the TRACEPARENT and
+// TRACESTATE environment variables, so that tools that support them
+// can continue the trace.
+package otelexec
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/juju/utils/exec"
+)
+
+// InstrumentationName is the name of the tracer obtained from the
+// provider passed to New.
+const InstrumentationName = "github.com/juju/utils/exec"
+
+// SpanName is the name of the spans created for commands.
+const SpanName = "exec"
+
+// Attributes recorded on the spans.
+const (
+	// CommandLineKey holds the command line, with any redactions
+	// applied.
+	CommandLineKey = attribute.Key("process.command_line")
+
+	// PIDKey holds the process ID of the command.
+	PIDKey = attribute.Key("process.pid")
+
+	// ExitCodeKey holds the exit code of the command, if it exited
+	// normally.
+	ExitCodeKey = attribute.Key("process.exit.code")
+
+	// DurationKey holds the time, in seconds, that the command ran
+	// for.
+	DurationKey = attribute.Key("process.duration")
+)
+
+// Tracer is an exec.Tracer that creates OpenTelemetry spans.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+var _ exec.Tracer = (*Tracer)(nil)
+
+// New returns a tracer that creates spans with a tracer from the
+// given provider.
+func New(provider trace.TracerProvider) *Tracer {
+	return &Tracer{
+		tracer:     provider.Tracer(InstrumentationName),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// StartCommand implements exec.Tracer.
+func (t *Tracer) StartCommand(ctx context.Context, command string) (exec.CommandSpan, []string) {
+	ctx, span := t.tracer.Start(ctx, SpanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(CommandLineKey.String(command)),
+	)
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	keys := carrier.Keys()
+	sort.Strings(keys)
+	var env []string
+	for _, key := range keys {
+		env = append(env, strings.ToUpper(key)+"="+carrier.Get(key))
+	}
+	return commandSpan{span}, env
+}
+
+// commandSpan implements exec.CommandSpan.
+type commandSpan struct {
+	span trace.Span
+}
+
+// End implements exec.CommandSpan.
+func (s commandSpan) End(resp *exec.ExecResponse, err error) {
+	if resp != nil {
+		s.span.SetAttributes(
+			PIDKey.Int(resp.PID),
+			DurationKey.Float64(resp.Duration.Seconds()),
+		)
+		if resp.Signal == 0 {
+			s.span.SetAttributes(ExitCodeKey.Int(resp.Code))
+		}
+	}
+	switch {
+	case err != nil:
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	case resp != nil && resp.Code != 0:
+		s.span.SetStatus(codes.Error, fmt.Sprintf("exited with code %d", resp.Code))
+	}
+	s.span.End()
+}
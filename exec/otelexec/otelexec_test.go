@@ -0,0 +1,56 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package otelexec_test
+
+import (
+	"context"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/exec/otelexec"
+)
+
+type otelexecSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&otelexecSuite{})
+
+func (s *otelexecSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	previous := exec.SetTracer(otelexec.New(noop.NewTracerProvider()))
+	s.AddCleanup(func(*gc.C) { exec.SetTracer(previous) })
+}
+
+func parentContext() context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+}
+
+func (*otelexecSuite) TestPropagation(c *gc.C) {
+	resp, err := exec.RunCommandsContext(parentContext(), exec.RunParams{
+		Commands: "echo $TRACEPARENT",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\n")
+}
+
+func (*otelexecSuite) TestNoParent(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo \"[$TRACEPARENT]\"",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "[]\n")
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+)
+
+// OutputWriteMode determines how the files named by
+// RunParams.StdoutPath and StderrPath are written.
+type OutputWriteMode int
+
+const (
+	// ReplaceOutput writes the output to a temporary file which
+	// replaces the file once the command has finished, so that the
+	// file is always complete. When the command is detached, the
+	// output is appended to the file instead.
+	ReplaceOutput OutputWriteMode = iota
+
+	// TruncateOutput truncates the file and writes the output to it
+	// in place, so that it can be followed as the command runs.
+	TruncateOutput
+
+	// AppendOutput appends the output to the file in place.
+	AppendOutput
+)
+
+// openFlags returns the flags for opening a file written in place with
+// mode m.
+func (m OutputWriteMode) openFlags() int {
+	if m == TruncateOutput {
+		return os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	return os.O_WRONLY | os.O_CREATE | os.O_APPEND
+}
+
+// outputFile is a file receiving command output. Unless it is written
+// in place, the output is written to a temporary file which is only
+// renamed into place once the command has finished, so the file at
+// path is always complete.
+type outputFile struct {
+	path    string
+	file    *os.File
+	inPlace bool
+}
+
+// createOutputFile opens the file at path to be written as write
+// specifies, or creates a temporary file alongside it that will
+// become path when committed.
+func createOutputFile(path string, mode os.FileMode, write OutputWriteMode) (*outputFile, error) {
+	if mode == 0 {
+		mode = 0644
+	}
+	if write != ReplaceOutput {
+		f, err := openInPlace(path, mode, write.openFlags())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return &outputFile{path: path, file: f, inPlace: true}, nil
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create output file")
+	}
+	// Chmod explicitly so that the umask does not apply.
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, errors.Annotate(err, "cannot set output file mode")
+	}
+	return &outputFile{path: path, file: f}, nil
+}
+
+// openInPlace opens the file at path with the given flags, setting
+// the permissions of a new file to mode regardless of the umask.
+func openInPlace(path string, mode os.FileMode, flag int) (*os.File, error) {
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, flag, mode)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot open output file")
+	}
+	if os.IsNotExist(statErr) {
+		if err := f.Chmod(mode); err != nil {
+			f.Close()
+			return nil, errors.Annotate(err, "cannot set output file mode")
+		}
+	}
+	return f, nil
+}
+
+// commit closes the file and moves it into place.
+func (f *outputFile) commit() error {
+	if f.inPlace {
+		return errors.Annotate(f.file.Close(), "cannot write output file")
+	}
+	if err := f.file.Close(); err != nil {
+		os.Remove(f.file.Name())
+		return errors.Annotate(err, "cannot write output file")
+	}
+	if err := os.Rename(f.file.Name(), f.path); err != nil {
+		os.Remove(f.file.Name())
+		return errors.Annotate(err, "cannot write output file")
+	}
+	return nil
+}
+
+// abort closes the file and removes it, unless it is written in
+// place.
+func (f *outputFile) abort() {
+	f.file.Close()
+	if !f.inPlace {
+		os.Remove(f.file.Name())
+	}
+}
+
+// openOutputFiles creates the files named by r.StdoutPath and
+// r.StderrPath, if any. When both name the same file, it is shared.
+func (r *RunParams) openOutputFiles() error {
+	if r.StdoutPath != "" {
+		f, err := createOutputFile(r.StdoutPath, r.OutputFileMode, r.OutputWrite)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		r.stdoutFile = f
+	}
+	if r.StderrPath != "" {
+		if r.StderrPath == r.StdoutPath {
+			r.stderrFile = r.stdoutFile
+			return nil
+		}
+		f, err := createOutputFile(r.StderrPath, r.OutputFileMode, r.OutputWrite)
+		if err != nil {
+			r.abortOutputFiles()
+			return errors.Trace(err)
+		}
+		r.stderrFile = f
+	}
+	return nil
+}
+
+// commitOutputFiles moves any output files into place.
+func (r *RunParams) commitOutputFiles(result *ExecResponse) error {
+	var err error
+	if r.stdoutFile != nil {
+		err = r.stdoutFile.commit()
+		result.StdoutPath = r.StdoutPath
+	}
+	if r.stderrFile != nil && r.stderrFile != r.stdoutFile {
+		if err1 := r.stderrFile.commit(); err == nil {
+			err = err1
+		}
+	}
+	if r.stderrFile != nil {
+		result.StderrPath = r.StderrPath
+	}
+	r.stdoutFile, r.stderrFile = nil, nil
+	return err
+}
+
+// abortOutputFiles removes any output files.
+func (r *RunParams) abortOutputFiles() {
+	if r.stdoutFile != nil {
+		r.stdoutFile.abort()
+	}
+	if r.stderrFile != nil && r.stderrFile != r.stdoutFile {
+		r.stderrFile.abort()
+	}
+	r.stdoutFile, r.stderrFile = nil, nil
+}
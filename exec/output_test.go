@@ -0,0 +1,172 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type outputSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&outputSuite{})
+
+func (*outputSuite) TestOutputToFiles(c *gc.C) {
+	dir := c.MkDir()
+	stdoutPath := filepath.Join(dir, "stdout")
+	stderrPath := filepath.Join(dir, "stderr")
+	params := exec.RunParams{
+		Commands:       "echo out\necho err >&2\nexit 2",
+		StdoutPath:     stdoutPath,
+		StderrPath:     stderrPath,
+		OutputFileMode: 0600,
+	}
+	if runtime.GOOS == "windows" {
+		params.Commands = "echo out\n[Console]::Error.WriteLine('err')\nexit 2"
+	}
+	err := params.Run()
+	c.Assert(err, gc.IsNil)
+
+	// Output is not visible under the final names until the command
+	// has finished.
+	_, err = os.Stat(stdoutPath)
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+
+	result, err := params.Wait()
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 2)
+	c.Assert(result.Stdout, gc.HasLen, 0)
+	c.Assert(result.Stderr, gc.HasLen, 0)
+	c.Assert(result.StdoutPath, gc.Equals, stdoutPath)
+	c.Assert(result.StderrPath, gc.Equals, stderrPath)
+
+	data, err := ioutil.ReadFile(stdoutPath)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, "out\r?\n")
+	data, err = ioutil.ReadFile(stderrPath)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Matches, "err\r?\n")
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(stdoutPath)
+		c.Assert(err, gc.IsNil)
+		c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0600))
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 2)
+}
+
+func (*outputSuite) TestSharedOutputFile(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "output")
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:   "echo one\necho two >&2",
+		StdoutPath: path,
+		StderrPath: path,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.StdoutPath, gc.Equals, path)
+	c.Assert(result.StderrPath, gc.Equals, path)
+	if runtime.GOOS != "windows" {
+		data, err := ioutil.ReadFile(path)
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(data), gc.Equals, "one\ntwo\n")
+	}
+}
+
+func (*outputSuite) TestOutputFileDirectoryMissing(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:   "echo hello",
+		StdoutPath: filepath.Join(c.MkDir(), "missing", "stdout"),
+	})
+	c.Assert(err, gc.ErrorMatches, "cannot create output file: .*")
+}
+
+func (*outputSuite) TestAppendOutput(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("POSIX shell not available")
+	}
+	path := filepath.Join(c.MkDir(), "output")
+	err := ioutil.WriteFile(path, []byte("before\n"), 0640)
+	c.Assert(err, gc.IsNil)
+	for _, line := range []string{"one", "two"} {
+		_, err := exec.RunCommands(exec.RunParams{
+			Commands:       "echo " + line,
+			StdoutPath:     path,
+			OutputWrite:    exec.AppendOutput,
+			OutputFileMode: 0600,
+		})
+		c.Assert(err, gc.IsNil)
+	}
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "before\none\ntwo\n")
+	info, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0640))
+}
+
+func (*outputSuite) TestTruncateOutput(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("POSIX shell not available")
+	}
+	dir := c.MkDir()
+	path := filepath.Join(dir, "output")
+	err := ioutil.WriteFile(path, []byte("a long line from before\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	stdin, input := io.Pipe()
+	params := exec.RunParams{
+		Commands:    "echo started; read x",
+		Stdin:       stdin,
+		StdoutPath:  path,
+		OutputWrite: exec.TruncateOutput,
+	}
+	err = params.Run()
+	c.Assert(err, gc.IsNil)
+
+	// The output can be read while the command is running.
+	var data []byte
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		if data, _ = ioutil.ReadFile(path); string(data) == "started\n" {
+			break
+		}
+	}
+	c.Assert(string(data), gc.Equals, "started\n")
+	input.Close()
+	_, err = params.Wait()
+	c.Assert(err, gc.IsNil)
+
+	// No temporary file was created alongside.
+	entries, err := ioutil.ReadDir(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+}
+
+func (*outputSuite) TestNewFileInPlace(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("file permissions not available")
+	}
+	path := filepath.Join(c.MkDir(), "output")
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:       "echo hello",
+		StdoutPath:     path,
+		OutputWrite:    exec.TruncateOutput,
+		OutputFileMode: 0666,
+	})
+	c.Assert(err, gc.IsNil)
+	info, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0666))
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"sync"
+	"time"
+
+	"github.com/juju/utils/clock"
+)
+
+// OutputLine holds a line of a command's output recorded because
+// RunParams.TimestampOutput was set.
+type OutputLine struct {
+	// Time holds when the line was read from the command. It carries
+	// a monotonic clock reading, so the time between lines is not
+	// disturbed by changes to the wall clock.
+	Time time.Time
+
+	// Stream holds StdoutTag or StderrTag, according to the stream
+	// the line was written to.
+	Stream string
+
+	// Text holds the line without its line ending.
+	Text string
+}
+
+// lineRecorder records timestamped output lines, keeping at most max
+// bytes of text if max is positive. Once the limit is reached it
+// keeps either the first or the most recent lines.
+type lineRecorder struct {
+	mu        sync.Mutex
+	clock     clock.Clock
+	max       int
+	keepTail  bool
+	size      int
+	lines     []OutputLine
+	truncated bool
+}
+
+func newLineRecorder(clock clock.Clock, max int, keepTail bool) *lineRecorder {
+	return &lineRecorder{
+		clock:    clock,
+		max:      max,
+		keepTail: keepTail,
+	}
+}
+
+// record returns a function, to be passed to lineCallback, that
+// records each line with the given stream tag.
+func (l *lineRecorder) record(stream string) func(line string) {
+	return func(line string) {
+		l.add(OutputLine{
+			Time:   l.clock.Now(),
+			Stream: stream,
+			Text:   line,
+		})
+	}
+}
+
+func (l *lineRecorder) add(line OutputLine) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && !l.keepTail && l.size+len(line.Text) > l.max {
+		l.truncated = true
+		return
+	}
+	l.lines = append(l.lines, line)
+	l.size += len(line.Text)
+	for l.max > 0 && l.size > l.max && len(l.lines) > 0 {
+		l.size -= len(l.lines[0].Text)
+		l.lines = l.lines[1:]
+		l.truncated = true
+	}
+}
+
+// finish returns the recorded lines and whether any were discarded.
+func (l *lineRecorder) finish() ([]OutputLine, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lines, l.truncated
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type outputLinesSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&outputLinesSuite{})
+
+// lineTexts returns the stream and text of each line.
+func lineTexts(lines []exec.OutputLine) []string {
+	var texts []string
+	for _, line := range lines {
+		texts = append(texts, line.Stream+" "+line.Text)
+	}
+	return texts
+}
+
+func (*outputLinesSuite) TestTimestampOutput(c *gc.C) {
+	start := time.Now()
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:        "echo one\nsleep 0.2\necho two >&2\nprintf three",
+		TimestampOutput: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "one\nthree")
+	c.Assert(lineTexts(resp.OutputLines), jc.DeepEquals, []string{
+		"OUT one",
+		"ERR two",
+		"OUT three",
+	})
+	c.Assert(resp.OutputLinesTruncated, jc.IsFalse)
+	lines := resp.OutputLines
+	c.Assert(lines[0].Time.Before(start), jc.IsFalse)
+	c.Assert(lines[1].Time.Sub(lines[0].Time) >= 150*time.Millisecond, jc.IsTrue)
+	c.Assert(lines[2].Time.Before(lines[1].Time), jc.IsFalse)
+}
+
+func (*outputLinesSuite) TestTimestampOutputLimit(c *gc.C) {
+	commands := "echo one\necho two\necho three\n"
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:        commands,
+		TimestampOutput: true,
+		MaxOutputBytes:  7,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(lineTexts(resp.OutputLines), jc.DeepEquals, []string{"OUT one", "OUT two"})
+	c.Assert(resp.OutputLinesTruncated, jc.IsTrue)
+
+	resp, err = exec.RunCommands(exec.RunParams{
+		Commands:        commands,
+		TimestampOutput: true,
+		MaxOutputBytes:  8,
+		KeepOutputTail:  true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(lineTexts(resp.OutputLines), jc.DeepEquals, []string{"OUT two", "OUT three"})
+	c.Assert(resp.OutputLinesTruncated, jc.IsTrue)
+}
+
+func (*outputLinesSuite) TestTimestampOutputRedacted(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:        "echo the secret",
+		TimestampOutput: true,
+		Redactions:      []*regexp.Regexp{exec.RedactString("secret")},
+		RedactOutput:    true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(lineTexts(resp.OutputLines), jc.DeepEquals, []string{"OUT the " + exec.Redacted})
+}
@@ -0,0 +1,151 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/juju/errors"
+)
+
+// Pipeline runs a sequence of programs with the standard output of
+// each connected to the standard input of the next, as the shell does
+// for "cmd1 | cmd2 | cmd3", but without a shell, so that the arguments
+// need no quoting.
+type Pipeline struct {
+	// Stages holds the program and arguments of each stage, as for
+	// RunParams.Args.
+	Stages [][]string
+
+	// WorkingDir and Environment apply to every stage, as they do in
+	// RunParams.
+	WorkingDir  string
+	Environment []string
+
+	// Stdin, if set, is the standard input of the first stage.
+	Stdin io.Reader
+
+	// Stdout, if set, receives the standard output of the last stage,
+	// which is otherwise captured in its response.
+	Stdout io.Writer
+}
+
+// NewPipeline returns a pipeline whose first stage runs the given
+// program and arguments.
+func NewPipeline(args ...string) *Pipeline {
+	return (&Pipeline{}).Pipe(args...)
+}
+
+// Pipe adds a stage that runs the given program and arguments,
+// reading the output of the previous stage, and returns p.
+func (p *Pipeline) Pipe(args ...string) *Pipeline {
+	p.Stages = append(p.Stages, args)
+	return p
+}
+
+// Run runs the pipeline and waits for every stage to exit. It returns
+// a response for each stage, holding its exit code and standard error;
+// the standard output of the last stage is in its response unless
+// p.Stdout is set. As in RunCommands, a non-zero exit code is not an
+// error, and nor is a stage other than the last being killed by
+// SIGPIPE; the first other error from waiting for a stage is returned
+// along with the responses.
+func (p *Pipeline) Run() ([]*ExecResponse, error) {
+	return p.RunContext(context.Background())
+}
+
+// RunContext is like Run, but kills every stage if ctx is done before
+// the pipeline finishes, returning the responses along with ctx.Err().
+func (p *Pipeline) RunContext(ctx context.Context) ([]*ExecResponse, error) {
+	if len(p.Stages) == 0 {
+		return nil, errors.NotValidf("empty pipeline")
+	}
+	for i, args := range p.Stages {
+		if len(args) == 0 {
+			return nil, errors.NotValidf("empty pipeline stage %d", i)
+		}
+	}
+	// The pipeline counts as one command under the concurrency limit,
+	// as its stages must all run at once.
+	sem, err := acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sem.release()
+	runs := make([]*RunParams, len(p.Stages))
+	abort := func() {
+		for _, run := range runs {
+			if run != nil {
+				run.KillAll()
+				run.Wait()
+			}
+		}
+	}
+	// prev holds the read end of the pipe from the previous stage.
+	var prev *os.File
+	for i, args := range p.Stages {
+		run := &RunParams{
+			Args:        args,
+			WorkingDir:  p.WorkingDir,
+			Environment: p.Environment,
+			Stdout:      p.Stdout,
+			slotHeld:    true,
+			ctx:         ctx,
+		}
+		if prev != nil {
+			run.Stdin = prev
+		} else {
+			run.Stdin = p.Stdin
+		}
+		var next, w *os.File
+		if i < len(p.Stages)-1 {
+			var err error
+			if next, w, err = os.Pipe(); err != nil {
+				closeFile(prev)
+				abort()
+				return nil, errors.Trace(err)
+			}
+			run.Stdout = w
+		}
+		err := run.Run()
+		// The stage holds its own copies of the pipe ends, which are
+		// closed here so that each stage sees end of file once the
+		// one before it exits.
+		closeFile(prev)
+		closeFile(w)
+		prev = next
+		if err != nil {
+			closeFile(prev)
+			abort()
+			return nil, errors.Annotatef(err, "cannot start pipeline stage %d", i)
+		}
+		runs[i] = run
+	}
+
+	responses := make([]*ExecResponse, len(runs))
+	var firstErr error
+	for i, run := range runs {
+		resp, err := run.WaitWithContext(ctx)
+		responses[i] = resp
+		if resp != nil && resp.Signal == syscall.SIGPIPE && i < len(runs)-1 && ctx.Err() == nil {
+			// A stage writing to one that has exited is killed
+			// by SIGPIPE, which is how pipelines normally end
+			// early, as with "yes | head".
+			err = nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return responses, firstErr
+}
+
+func closeFile(f *os.File) {
+	if f != nil {
+		f.Close()
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type pipelineSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&pipelineSuite{})
+
+func (*pipelineSuite) TestPipeline(c *gc.C) {
+	dir := c.MkDir()
+	p := exec.NewPipeline("/bin/sh", "-c", "printf 'b\\na; rm -rf /\\n$HOME\\n'; echo first >&2").
+		Pipe("/usr/bin/sort").
+		Pipe("/bin/sh", "-c", "cat; pwd; echo $GREETING; exit 3")
+	p.WorkingDir = dir
+	p.Environment = []string{"GREETING=hello"}
+	responses, err := p.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(responses, gc.HasLen, 3)
+	c.Check(string(responses[0].Stderr), gc.Equals, "first\n")
+	c.Check(responses[0].Stdout, gc.HasLen, 0)
+	c.Check(responses[1].Code, gc.Equals, 0)
+	c.Check(responses[2].Code, gc.Equals, 3)
+	c.Check(string(responses[2].Stdout), gc.Equals, "$HOME\na; rm -rf /\nb\n"+dir+"\nhello\n")
+}
+
+func (*pipelineSuite) TestStdinStdout(c *gc.C) {
+	var out bytes.Buffer
+	p := exec.NewPipeline("/usr/bin/tr", "a-z", "A-Z").Pipe("/usr/bin/rev")
+	p.Stdin = strings.NewReader("hello\n")
+	p.Stdout = &out
+	responses, err := p.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(responses[1].Stdout, gc.HasLen, 0)
+	c.Assert(out.String(), gc.Equals, "OLLEH\n")
+}
+
+func (*pipelineSuite) TestEarlyExit(c *gc.C) {
+	responses, err := exec.NewPipeline("/usr/bin/yes").Pipe("/usr/bin/head", "-n", "2").Run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(responses[1].Stdout), gc.Equals, "y\ny\n")
+	c.Assert(responses[0].Signal.String(), gc.Equals, "broken pipe")
+}
+
+func (*pipelineSuite) TestContext(c *gc.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	responses, err := exec.NewPipeline("/bin/sleep", "10").Pipe("/bin/cat").RunContext(ctx)
+	c.Assert(err, gc.Equals, context.DeadlineExceeded)
+	c.Assert(responses, gc.HasLen, 2)
+}
+
+func (*pipelineSuite) TestStartFailure(c *gc.C) {
+	_, err := exec.NewPipeline("/bin/cat").Pipe("/no/such/program").Run()
+	c.Assert(err, gc.ErrorMatches, "cannot start pipeline stage 1: .*")
+
+	_, err = (&exec.Pipeline{}).Run()
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
@@ -0,0 +1,12 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package prommetrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Duration(m *Metrics) *prometheus.HistogramVec { return m.duration }
+func Exits(m *Metrics) *prometheus.CounterVec      { return m.exits }
+func Running(m *Metrics) *prometheus.GaugeVec      { return m.running }
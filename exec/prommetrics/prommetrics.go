@@ -0,0 +1,105 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package prommetrics reports the commands run by the exec package to
+// Prometheus.
+//
+// To use it, register the collector and set it as the exec package's
+// metrics:
+//
+//	m := prommetrics.New("juju")
+//	prometheus.MustRegister(m)
+//	exec.SetMetrics(m)
+package prommetrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/juju/utils/exec"
+)
+
+// Metrics is an exec.Metrics that records, for each command name:
+//
+//	<namespace>_exec_command_duration_seconds  histogram of the time commands ran for
+//	<namespace>_exec_command_exits_total       count of finished commands by exit code
+//	<namespace>_exec_commands_running          number of commands currently running
+//
+// Commands that did not exit normally are counted with the code
+// "none". It is also a prometheus.Collector for those metrics.
+type Metrics struct {
+	duration *prometheus.HistogramVec
+	exits    *prometheus.CounterVec
+	running  *prometheus.GaugeVec
+}
+
+var (
+	_ exec.Metrics         = (*Metrics)(nil)
+	_ prometheus.Collector = (*Metrics)(nil)
+)
+
+// DurationBuckets holds the upper bounds, in seconds, of the buckets
+// of the duration histogram, which range from commands that do little
+// more than start to long-running operations such as package
+// upgrades.
+var DurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+
+// New returns metrics whose names have the given namespace.
+func New(namespace string) *Metrics {
+	return &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "exec",
+			Name:      "command_duration_seconds",
+			Help:      "The time taken by commands run by the agent.",
+			Buckets:   DurationBuckets,
+		}, []string{"command"}),
+		exits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exec",
+			Name:      "command_exits_total",
+			Help:      "The number of commands run by the agent that have finished, by exit code.",
+		}, []string{"command", "code"}),
+		running: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exec",
+			Name:      "commands_running",
+			Help:      "The number of commands run by the agent that are still running.",
+		}, []string{"command"}),
+	}
+}
+
+// CommandStarted implements exec.Metrics.
+func (m *Metrics) CommandStarted(name string) {
+	m.running.WithLabelValues(name).Inc()
+}
+
+// CommandFinished implements exec.Metrics.
+func (m *Metrics) CommandFinished(name string, duration time.Duration, code int) {
+	m.running.WithLabelValues(name).Dec()
+	m.duration.WithLabelValues(name).Observe(duration.Seconds())
+	m.exits.WithLabelValues(name, codeLabel(code)).Inc()
+}
+
+func codeLabel(code int) string {
+	if code < 0 {
+		return "none"
+	}
+	return strconv.Itoa(code)
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.duration.Describe(ch)
+	m.exits.Describe(ch)
+	m.running.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.duration.Collect(ch)
+	m.exits.Collect(ch)
+	m.running.Collect(ch)
+}
@@ -0,0 +1,55 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package prommetrics_test
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec/prommetrics"
+)
+
+type metricsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&metricsSuite{})
+
+func (*metricsSuite) TestRunning(c *gc.C) {
+	m := prommetrics.New("test")
+	m.CommandStarted("apt-get")
+	m.CommandStarted("apt-get")
+	running := prommetrics.Running(m).WithLabelValues("apt-get")
+	c.Assert(testutil.ToFloat64(running), gc.Equals, 2.0)
+
+	m.CommandFinished("apt-get", time.Second, 0)
+	c.Assert(testutil.ToFloat64(running), gc.Equals, 1.0)
+}
+
+func (*metricsSuite) TestExits(c *gc.C) {
+	m := prommetrics.New("test")
+	for _, code := range []int{0, 0, 100, -1} {
+		m.CommandStarted("apt-get")
+		m.CommandFinished("apt-get", time.Second, code)
+	}
+	exits := prommetrics.Exits(m)
+	c.Assert(testutil.ToFloat64(exits.WithLabelValues("apt-get", "0")), gc.Equals, 2.0)
+	c.Assert(testutil.ToFloat64(exits.WithLabelValues("apt-get", "100")), gc.Equals, 1.0)
+	c.Assert(testutil.ToFloat64(exits.WithLabelValues("apt-get", "none")), gc.Equals, 1.0)
+}
+
+func (*metricsSuite) TestCollect(c *gc.C) {
+	m := prommetrics.New("test")
+	c.Assert(testutil.CollectAndCount(m), gc.Equals, 0)
+	m.CommandStarted("apt-get")
+	m.CommandFinished("apt-get", time.Second, 0)
+	m.CommandStarted("bash")
+	// A gauge for each command, a histogram for the one that
+	// finished and a counter for its exit code.
+	c.Assert(testutil.CollectAndCount(m), gc.Equals, 4)
+	c.Assert(testutil.CollectAndCount(prommetrics.Duration(m)), gc.Equals, 1)
+}
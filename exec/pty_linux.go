@@ -0,0 +1,125 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/bufpool"
+)
+
+// Default terminal dimensions used for AllocatePTY.
+const (
+	ptyRows = 24
+	ptyCols = 80
+)
+
+// allocatePTY connects the standard output and standard error of the
+// command to a new pseudo-terminal, which becomes its controlling
+// terminal, and arranges for the terminal output to be copied to the
+// writer previously set for standard output.
+func allocatePTY(r *RunParams) error {
+	if r.Foreground {
+		return errors.NotValidf("setting AllocatePTY with Foreground")
+	}
+	master, slave, err := openPTY()
+	if err != nil {
+		return errors.Annotate(err, "cannot allocate pseudo-terminal")
+	}
+	attr := r.ps.SysProcAttr
+	attr.Setsid = true
+	attr.Setpgid = false
+	attr.Setctty = true
+	// Ctty refers to the descriptor in the child, which is its
+	// standard output.
+	attr.Ctty = 1
+
+	out := r.ps.Stdout
+	r.ps.Stdout = slave
+	r.ps.Stderr = slave
+	r.pty = &pty{
+		master: master,
+		slave:  slave,
+		out:    out,
+		done:   make(chan struct{}),
+	}
+	return nil
+}
+
+// pty holds the pseudo-terminal allocated for a command.
+type pty struct {
+	master *os.File
+	slave  *os.File
+	out    io.Writer
+	done   chan struct{}
+}
+
+// started closes the agent's copy of the terminal's slave side, which
+// the command now holds, and starts copying the terminal output.
+func (p *pty) started() {
+	p.slave.Close()
+	go func() {
+		defer close(p.done)
+		defer p.master.Close()
+		// Once every process holding the slave side has closed it,
+		// reads from the master fail with EIO, which marks the end
+		// of the output rather than an error.
+		bufpool.Copy(p.out, p.master)
+	}()
+}
+
+// wait waits for the copying of the terminal output to finish.
+func (p *pty) wait() {
+	<-p.done
+}
+
+// abort releases the terminal when the command could not be started.
+func (p *pty) abort() {
+	p.slave.Close()
+	p.master.Close()
+}
+
+// openPTY opens a new pseudo-terminal pair, returning its master and
+// slave sides.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	defer func() {
+		if err != nil {
+			master.Close()
+		}
+	}()
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot unlock terminal")
+	}
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot get terminal number")
+	}
+	ws := struct{ row, col, xpixel, ypixel uint16 }{row: ptyRows, col: ptyCols}
+	if err := ioctl(master.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return nil, nil, errors.Annotate(err, "cannot set terminal size")
+	}
+	slave, err = os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return master, slave, nil
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"bytes"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type ptySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ptySuite{})
+
+func (*ptySuite) TestAllocatePTY(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:    "test -t 1 && echo out-tty\ntest -t 0 || echo in-pipe\necho err >&2\nstty size < /dev/tty\nexit 3\n",
+		AllocatePTY: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 3)
+	c.Assert(string(resp.Stdout), gc.Equals, "out-tty\r\nin-pipe\r\nerr\r\n24 80\r\n")
+	c.Assert(resp.Stderr, gc.HasLen, 0)
+}
+
+func (*ptySuite) TestAllocatePTYControllingTerminal(c *gc.C) {
+	var out bytes.Buffer
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:        []string{"/bin/sh", "-c", "echo hello > /dev/tty"},
+		AllocatePTY: true,
+		Stdout:      &out,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(out.String(), gc.Equals, "hello\r\n")
+}
+
+func (*ptySuite) TestAllocatePTYWithForeground(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:    "true",
+		AllocatePTY: true,
+		Foreground:  true,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
@@ -0,0 +1,23 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !linux
+
+package exec
+
+import (
+	"github.com/juju/errors"
+)
+
+// allocatePTY always fails as pseudo-terminals are not supported on
+// this platform.
+func allocatePTY(r *RunParams) error {
+	return errors.NotSupportedf("allocating a pseudo-terminal on this platform")
+}
+
+// pty is never allocated on this platform.
+type pty struct{}
+
+func (*pty) started() {}
+func (*pty) wait()    {}
+func (*pty) abort()   {}
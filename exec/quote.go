@@ -0,0 +1,93 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/juju/utils"
+)
+
+// QuotePOSIX returns a command line that runs args with a POSIX shell,
+// such as bash or sh, with each argument passed as it is, suitable for
+// use in RunParams.Commands. Arguments containing anything other than
+// letters, digits and a few punctuation characters that are never
+// special to the shell are single-quoted.
+func QuotePOSIX(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.IndexFunc(arg, isPOSIXUnsafe) >= 0 {
+			arg = utils.ShQuote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+func isPOSIXUnsafe(r rune) bool {
+	return !isQuoteSafe(r) && !strings.ContainsRune("@%+=:,./-", r)
+}
+
+// QuotePowerShell returns a command line that runs args with
+// PowerShell, suitable for use in RunParams.Commands. Arguments that
+// need it are enclosed in single quotes, within which PowerShell
+// expands nothing, and the call operator is used when the program
+// name is quoted so that it is run rather than evaluated as a string.
+//
+// Windows PowerShell before version 7.3 does not escape double quotes
+// within the arguments it passes to native programs, so such
+// arguments may still not reach them intact.
+func QuotePowerShell(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.IndexFunc(arg, isPowerShellUnsafe) >= 0 || strings.HasPrefix(arg, "-") && i == 0 {
+			arg = quotePowerShellString(arg)
+		}
+		quoted[i] = arg
+	}
+	line := strings.Join(quoted, " ")
+	if len(quoted) > 0 && strings.HasPrefix(quoted[0], "'") {
+		line = "& " + line
+	}
+	return line
+}
+
+func isPowerShellUnsafe(r rune) bool {
+	return !isQuoteSafe(r) && !strings.ContainsRune(`%+=:./\-`, r)
+}
+
+// powershellQuotes holds the characters that PowerShell treats as
+// single quotes.
+const powershellQuotes = "'\u2018\u2019\u201a\u201b"
+
+// quotePowerShellString returns s as a PowerShell single-quoted
+// string, in which each quote character is escaped by doubling it.
+func quotePowerShellString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('\'')
+	for _, r := range s {
+		if strings.ContainsRune(powershellQuotes, r) {
+			buf.WriteRune(r)
+		}
+		buf.WriteRune(r)
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
+
+// isQuoteSafe reports whether r never needs quoting in any shell.
+func isQuoteSafe(r rune) bool {
+	return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9'
+}
+
+// Quote returns a command line that runs args with the default shell
+// for the platform: QuotePowerShell on Windows and QuotePOSIX on
+// everything else.
+func Quote(args ...string) string {
+	if runtime.GOOS == "windows" {
+		return QuotePowerShell(args...)
+	}
+	return QuotePOSIX(args...)
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"runtime"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type quoteSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&quoteSuite{})
+
+var quoteTests = []struct {
+	args       []string
+	posix      string
+	powershell string
+}{{
+	args:       []string{"ls", "-la", "/tmp"},
+	posix:      "ls -la /tmp",
+	powershell: "ls -la /tmp",
+}, {
+	args:       []string{"echo", ""},
+	posix:      "echo ''",
+	powershell: "echo ''",
+}, {
+	args:       []string{"echo", "it's $HOME; rm -rf /"},
+	posix:      `echo 'it'"'"'s $HOME; rm -rf /'`,
+	powershell: `echo 'it''s $HOME; rm -rf /'`,
+}, {
+	args:       []string{`C:\Program Files\app.exe`, "a`b", "x\u2019y"},
+	posix:      `'C:\Program Files\app.exe' 'a` + "`" + `b' 'x` + "\u2019" + `y'`,
+	powershell: `& 'C:\Program Files\app.exe' 'a` + "`" + `b' 'x` + "\u2019\u2019" + `y'`,
+}, {
+	args:       []string{"user@host:dir", "a=b,c", "$(id)", "*"},
+	posix:      `user@host:dir a=b,c '$(id)' '*'`,
+	powershell: `& 'user@host:dir' 'a=b,c' '$(id)' '*'`,
+}, {
+	args:       []string{"-file"},
+	posix:      "-file",
+	powershell: "& '-file'",
+}}
+
+func (*quoteSuite) TestQuotePOSIX(c *gc.C) {
+	for i, test := range quoteTests {
+		c.Logf("test %d: %q", i, test.args)
+		c.Check(exec.QuotePOSIX(test.args...), gc.Equals, test.posix)
+	}
+}
+
+func (*quoteSuite) TestQuotePowerShell(c *gc.C) {
+	for i, test := range quoteTests {
+		c.Logf("test %d: %q", i, test.args)
+		c.Check(exec.QuotePowerShell(test.args...), gc.Equals, test.powershell)
+	}
+}
+
+func (*quoteSuite) TestQuote(c *gc.C) {
+	args := []string{"echo", "it's"}
+	expect := exec.QuotePOSIX(args...)
+	if runtime.GOOS == "windows" {
+		expect = exec.QuotePowerShell(args...)
+	}
+	c.Assert(exec.Quote(args...), gc.Equals, expect)
+}
+
+func (*quoteSuite) TestQuoteRoundTrip(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("POSIX shell not available")
+	}
+	args := []string{"it's", "", "$HOME", "`id`", "a\nb", `\"`, "*", "-n"}
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: exec.QuotePOSIX(append([]string{"printf", "[%s]"}, args...)...),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(string(resp.Stdout), gc.Equals, "[it's][][$HOME][`id`][a\nb][\\\"][*][-n]")
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Redacted replaces text masked by RunParams.Redactions.
+const Redacted = "[REDACTED]"
+
+// RedactString returns a pattern for RunParams.Redactions that matches
+// s literally.
+func RedactString(s string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(s))
+}
+
+// redactions returns the patterns to mask for r, including the values
+// of the variables named by RedactEnv.
+func (r *RunParams) redactions() []*regexp.Regexp {
+	if len(r.RedactEnv) == 0 {
+		return r.Redactions
+	}
+	patterns := append([]*regexp.Regexp(nil), r.Redactions...)
+	for _, name := range r.RedactEnv {
+		for _, kv := range r.Environment {
+			if strings.HasPrefix(kv, name+"=") && len(kv) > len(name)+1 {
+				patterns = append(patterns, RedactString(kv[len(name)+1:]))
+			}
+		}
+	}
+	return patterns
+}
+
+// redact masks the text matched by r's redactions in s.
+func (r *RunParams) redact(s string) string {
+	for _, re := range r.redactions() {
+		s = re.ReplaceAllLiteralString(s, Redacted)
+	}
+	return s
+}
+
+// redactArgs returns a copy of args with r's redactions masked in each
+// element.
+func (r *RunParams) redactArgs(args []string) []string {
+	var redacted []string
+	for _, arg := range args {
+		redacted = append(redacted, r.redact(arg))
+	}
+	return redacted
+}
+
+// redactBytes is like redact, for captured output.
+func (r *RunParams) redactBytes(b []byte) []byte {
+	for _, re := range r.redactions() {
+		b = re.ReplaceAllLiteral(b, []byte(Redacted))
+	}
+	return b
+}
+
+// redactError returns err with r's redactions masked in its message.
+// The result has the same cause, so that it satisfies the same
+// checks, such as errors.IsNotValid, as err. Some errors are
+// returned unchanged so that they can be compared directly.
+func (r *RunParams) redactError(err error) error {
+	if err == nil || len(r.redactions()) == 0 {
+		return err
+	}
+	msg := r.redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// redactedError is an error whose message has been redacted.
+type redactedError struct {
+	msg string
+	err error
+}
+
+// Error implements error.
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Cause returns the cause of the original error, for errors.Cause.
+func (e *redactedError) Cause() error {
+	return errors.Cause(e.err)
+}
+
+// Unwrap returns the original error, whose message is not redacted.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"path/filepath"
+	"regexp"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type redactSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&redactSuite{})
+
+func (*redactSuite) TestRedactOutput(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:     "echo password=hunter2; echo token $TOKEN >&2",
+		Environment:  []string{"TOKEN=s3cr3t"},
+		Redactions:   []*regexp.Regexp{regexp.MustCompile(`password=\S+`)},
+		RedactEnv:    []string{"TOKEN"},
+		RedactOutput: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "[REDACTED]\n")
+	c.Assert(string(resp.Stderr), gc.Equals, "token [REDACTED]\n")
+}
+
+func (*redactSuite) TestOutputNotRedactedByDefault(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:   "echo hunter2",
+		Redactions: []*regexp.Regexp{exec.RedactString("hunter2")},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "hunter2\n")
+}
+
+func (*redactSuite) TestRedactError(c *gc.C) {
+	secret := filepath.Join(c.MkDir(), "s3cr3t")
+	_, err := exec.RunCommands(exec.RunParams{
+		Args:       []string{secret},
+		Redactions: []*regexp.Regexp{exec.RedactString("s3cr3t")},
+	})
+	c.Assert(err, gc.NotNil)
+	c.Assert(err.Error(), gc.Not(jc.Contains), "s3cr3t")
+	c.Assert(err.Error(), jc.Contains, "[REDACTED]")
+
+	_, err = exec.RunCommands(exec.RunParams{
+		Commands:        "echo ${s3cr3t}",
+		ExpandVariables: true,
+		StrictVariables: true,
+		Redactions:      []*regexp.Regexp{exec.RedactString("s3cr3t")},
+	})
+	c.Assert(err, gc.NotNil)
+	c.Assert(err.Error(), gc.Not(jc.Contains), "s3cr3t")
+}
+
+func (*redactSuite) TestRedactErrorKeepsCause(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:   "true",
+		Args:       []string{"s3cr3t"},
+		Redactions: []*regexp.Regexp{exec.RedactString("Args")},
+	})
+	c.Assert(err, gc.ErrorMatches, "setting \\[REDACTED\\] with Commands or Interpreter not valid")
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (*redactSuite) TestRedactRunning(c *gc.C) {
+	run := exec.RunParams{
+		Commands:   "exec sleep 10 # s3cr3t",
+		Redactions: []*regexp.Regexp{exec.RedactString("s3cr3t")},
+	}
+	err := run.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	defer run.Wait()
+	defer run.Kill()
+	var found bool
+	for _, cmd := range exec.Running() {
+		if cmd.PID == run.Process().Pid {
+			found = true
+			c.Assert(cmd.Commands, gc.Equals, "exec sleep 10 # [REDACTED]")
+		}
+	}
+	c.Assert(found, jc.IsTrue)
+}
+
+func (*redactSuite) TestRedactRunningArgs(c *gc.C) {
+	run := exec.RunParams{
+		Args:       []string{"/bin/sh", "-c", "exec sleep 10", "--token=s3cr3t"},
+		Redactions: []*regexp.Regexp{exec.RedactString("s3cr3t")},
+	}
+	err := run.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	defer run.Wait()
+	defer run.Kill()
+	var found bool
+	for _, cmd := range exec.Running() {
+		if cmd.PID == run.Process().Pid {
+			found = true
+			c.Assert(cmd.Args, jc.DeepEquals, []string{"/bin/sh", "-c", "exec sleep 10", "--token=[REDACTED]"})
+		}
+	}
+	c.Assert(found, jc.IsTrue)
+}
@@ -0,0 +1,132 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/retry"
+)
+
+// RetryPolicy describes how RunCommands and RunCommandsContext re-run
+// a command that fails in a way that may be transient, such as when
+// a lock is held by another process.
+type RetryPolicy struct {
+	// MaxAttempts holds the maximum number of times the command is
+	// run, including the first. Values less than 2 mean that it is
+	// not retried.
+	MaxAttempts int
+
+	// Delay holds the time to wait before the first retry.
+	Delay time.Duration
+
+	// Backoff, if greater than 1, is the factor by which the delay
+	// grows after each retry.
+	Backoff float64
+
+	// MaxDelay, if positive, bounds the delay between attempts.
+	MaxDelay time.Duration
+
+	// Jitter causes each delay to be chosen at random from between
+	// half the computed delay and the full delay, so that many agents
+	// retrying at once do not stay in step.
+	Jitter bool
+
+	// RetryExitCodes holds the exit codes that cause the command to
+	// be retried. If it is empty, and ShouldRetry is not set, any
+	// non-zero exit code does.
+	RetryExitCodes []int
+
+	// ShouldRetry, if set, decides whether to retry instead of
+	// RetryExitCodes. It is called with the response and error from
+	// the failed attempt, and with the number of attempts made so far.
+	// Without it, errors other than a non-zero exit code, such as
+	// timeouts, are never retried.
+	ShouldRetry func(resp *ExecResponse, err error, attempts int) bool
+}
+
+// shouldRetry reports whether a command that returned resp and err
+// should be run again according to p.
+func (p *RetryPolicy) shouldRetry(resp *ExecResponse, err error, attempts int) bool {
+	if attempts >= p.MaxAttempts {
+		return false
+	}
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(resp, err, attempts)
+	}
+	if err != nil || resp.Code == 0 {
+		return false
+	}
+	if len(p.RetryExitCodes) == 0 {
+		return true
+	}
+	for _, code := range p.RetryExitCodes {
+		if resp.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the time to wait before the retry that follows the
+// given number of attempts.
+func (p *RetryPolicy) delay(attempts int) time.Duration {
+	return retry.Strategy{
+		Delay:    p.Delay,
+		Backoff:  retry.Exponential(p.Backoff),
+		MaxDelay: p.MaxDelay,
+		Jitter:   p.Jitter,
+	}.DelayAfter(attempts)
+}
+
+// runWithRetry runs the command described by run, and waits for it,
+// until it succeeds or run.Retry says that it should not be retried.
+func runWithRetry(ctx context.Context, run RunParams) (*ExecResponse, error) {
+	policy := run.Retry
+	if policy != nil && policy.MaxAttempts > 1 && run.Stdin != nil {
+		return nil, errors.NotValidf("setting Retry with Stdin")
+	}
+	for attempts := 1; ; attempts++ {
+		attempt := run
+		if attempt.TraceContext == nil {
+			attempt.TraceContext = ctx
+		}
+		attempt.ctx = ctx
+		resp, err := runOnce(ctx, &attempt)
+		if resp != nil {
+			resp.Attempts = attempts
+		}
+		if policy == nil || !policy.shouldRetry(resp, err, attempts) {
+			return resp, err
+		}
+		delay := policy.delay(attempts)
+		logger.Debugf("command failed on attempt %d (code %d, error %v), retrying in %v", attempts, responseCode(resp), err, delay)
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-run.getClock().After(delay):
+		}
+	}
+}
+
+// runOnce runs the command described by run and waits for it.
+func runOnce(ctx context.Context, run *RunParams) (*ExecResponse, error) {
+	if len(run.Sequence) > 0 {
+		return runSequence(ctx, run)
+	}
+	if err := run.Run(); err != nil {
+		return nil, err
+	}
+	return run.WaitWithContext(ctx)
+}
+
+func responseCode(resp *ExecResponse) int {
+	if resp == nil {
+		return -1
+	}
+	return resp.Code
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type retrySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&retrySuite{})
+
+// flakyCommands returns commands that exit with code 75 until they
+// have been run more than the given number of times.
+func flakyCommands(c *gc.C, failures int) string {
+	return strings.NewReplacer(
+		"COUNTER", filepath.Join(c.MkDir(), "counter"),
+		"FAILURES", strconv.Itoa(failures),
+	).Replace(`n=$(cat COUNTER 2>/dev/null || echo 0)
+n=$((n+1))
+echo $n > COUNTER
+echo attempt $n
+[ $n -gt FAILURES ] || exit 75
+`)
+}
+
+func (*retrySuite) TestRetryUntilSuccess(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: flakyCommands(c, 2),
+		Retry: &exec.RetryPolicy{
+			MaxAttempts:    5,
+			Delay:          time.Millisecond,
+			RetryExitCodes: []int{75},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(resp.Attempts, gc.Equals, 3)
+	c.Assert(string(resp.Stdout), gc.Equals, "attempt 3\n")
+}
+
+func (*retrySuite) TestRetryGivesUp(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: flakyCommands(c, 5),
+		Retry: &exec.RetryPolicy{
+			MaxAttempts: 2,
+			Delay:       time.Millisecond,
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 75)
+	c.Assert(resp.Attempts, gc.Equals, 2)
+}
+
+func (*retrySuite) TestNotRetryableCode(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: flakyCommands(c, 5),
+		Retry: &exec.RetryPolicy{
+			MaxAttempts:    3,
+			RetryExitCodes: []int{1},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 75)
+	c.Assert(resp.Attempts, gc.Equals, 1)
+}
+
+func (*retrySuite) TestShouldRetry(c *gc.C) {
+	var calls []int
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo busy >&2; exit 1",
+		Retry: &exec.RetryPolicy{
+			MaxAttempts: 5,
+			ShouldRetry: func(resp *exec.ExecResponse, err error, attempts int) bool {
+				calls = append(calls, attempts)
+				return attempts < 2 && strings.Contains(string(resp.Stderr), "busy")
+			},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Attempts, gc.Equals, 2)
+	c.Assert(calls, jc.DeepEquals, []int{1, 2})
+}
+
+func (*retrySuite) TestContextDoneWhileWaiting(c *gc.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resp, err := exec.RunCommandsContext(ctx, exec.RunParams{
+		Commands: "exit 1",
+		Retry: &exec.RetryPolicy{
+			MaxAttempts: 5,
+			Delay:       time.Minute,
+		},
+	})
+	c.Assert(err, gc.Equals, context.DeadlineExceeded)
+	c.Assert(resp.Code, gc.Equals, 1)
+	c.Assert(resp.Attempts, gc.Equals, 1)
+}
+
+func (*retrySuite) TestRetryWithStdin(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		Stdin:    strings.NewReader(""),
+		Retry:    &exec.RetryPolicy{MaxAttempts: 2},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (*retrySuite) TestDelay(c *gc.C) {
+	p := &exec.RetryPolicy{
+		Delay:    time.Second,
+		Backoff:  2,
+		MaxDelay: 5 * time.Second,
+	}
+	var delays []time.Duration
+	for attempts := 1; attempts <= 5; attempts++ {
+		delays = append(delays, exec.RetryDelay(p, attempts))
+	}
+	c.Assert(delays, jc.DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+	})
+
+	p.Jitter = true
+	for i := 0; i < 20; i++ {
+		d := exec.RetryDelay(p, 2)
+		c.Assert(d >= time.Second && d < 2*time.Second, jc.IsTrue, gc.Commentf("delay %v", d))
+	}
+}
+
+func (*retrySuite) TestDelayUnbounded(c *gc.C) {
+	p := &exec.RetryPolicy{
+		Delay:   time.Second,
+		Backoff: 2,
+	}
+	c.Assert(exec.RetryDelay(p, 100), gc.Equals, time.Duration(math.MaxInt64))
+}
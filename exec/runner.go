@@ -0,0 +1,23 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+// Runner runs commands. Code that accepts a Runner, rather than
+// calling RunCommands directly, can be tested with a fake such as the
+// one in the testing/exectest package.
+type Runner interface {
+	RunCommands(run RunParams) (*ExecResponse, error)
+}
+
+// RunnerFunc adapts a function with the signature of RunCommands to
+// the Runner interface.
+type RunnerFunc func(run RunParams) (*ExecResponse, error)
+
+// RunCommands implements Runner by calling f.
+func (f RunnerFunc) RunCommands(run RunParams) (*ExecResponse, error) {
+	return f(run)
+}
+
+// DefaultRunner is a Runner that runs commands with RunCommands.
+var DefaultRunner Runner = RunnerFunc(RunCommands)
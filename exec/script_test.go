@@ -0,0 +1,124 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type scriptSuite struct {
+	testing.IsolationSuite
+	tmpDir string
+}
+
+var _ = gc.Suite(&scriptSuite{})
+
+func (s *scriptSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.tmpDir = c.MkDir()
+	s.PatchEnvironment("TMPDIR", s.tmpDir)
+}
+
+func (s *scriptSuite) assertNoScripts(c *gc.C) {
+	matches, err := filepath.Glob(filepath.Join(s.tmpDir, "juju-exec-*"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(matches, gc.HasLen, 0)
+}
+
+func (s *scriptSuite) TestScriptFile(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:   "echo $0 >&2; read line; echo got $line; exit 2",
+		Stdin:      strings.NewReader("input\n"),
+		ScriptFile: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 2)
+	c.Assert(string(resp.Stdout), gc.Equals, "got input\n")
+	c.Assert(string(resp.Stderr), gc.Matches, regexp.QuoteMeta(s.tmpDir)+"/juju-exec-.*\n")
+	s.assertNoScripts(c)
+}
+
+func (s *scriptSuite) TestScriptFileMode(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:   `stat -c %a "$0"`,
+		ScriptFile: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "600\n")
+}
+
+func (s *scriptSuite) TestScriptFileInterpreter(c *gc.C) {
+	requireInterpreter(c, exec.Perl)
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:    `print "$0\n";`,
+		Interpreter: &exec.Perl,
+		ScriptFile:  true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Matches, ".*/juju-exec-.*\\.pl\n")
+	s.assertNoScripts(c)
+}
+
+func (s *scriptSuite) TestScriptFileRemovedOnStartFailure(c *gc.C) {
+	err := (&exec.RunParams{
+		Commands:    "true",
+		Interpreter: &exec.Interpreter{Path: "/no/such/interpreter"},
+		ScriptFile:  true,
+	}).Run()
+	c.Assert(err, gc.NotNil)
+	s.assertNoScripts(c)
+}
+
+func (s *scriptSuite) TestScriptFileDryRun(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:    "echo hello",
+		Interpreter: &exec.Sh,
+		ScriptFile:  true,
+		DryRun:      true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Plan.Script, gc.Equals, "echo hello")
+	c.Assert(resp.Plan.Input, gc.Equals, "")
+	c.Assert(resp.Plan.Args, gc.HasLen, 2)
+	c.Assert(resp.Plan.Args[1], gc.Matches, ".*/juju-exec-.*")
+	s.assertNoScripts(c)
+}
+
+func (s *scriptSuite) TestScriptFileWithArgs(c *gc.C) {
+	err := (&exec.RunParams{
+		Args:       []string{"true"},
+		ScriptFile: true,
+	}).Run()
+	c.Assert(err, gc.ErrorMatches, "setting Args with ScriptFile not valid")
+}
+
+func (s *scriptSuite) TestScriptFileDetached(c *gc.C) {
+	out := filepath.Join(c.MkDir(), "out")
+	_, err := exec.StartDetached(exec.RunParams{
+		Commands:   "echo detached",
+		StdoutPath: out,
+		ScriptFile: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	waitForFile(c, out, "detached\n")
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		matches, err := filepath.Glob(filepath.Join(s.tmpDir, "juju-exec-*"))
+		c.Assert(err, jc.ErrorIsNil)
+		if len(matches) == 0 {
+			return
+		}
+	}
+	c.Fatalf("script file not removed")
+}
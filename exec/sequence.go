@@ -0,0 +1,130 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+
+	"github.com/juju/errors"
+)
+
+// StepResult holds the result of one of the commands in
+// RunParams.Sequence.
+type StepResult struct {
+	// Command holds the command as given in the sequence.
+	Command string
+
+	// Code holds the exit status of the command.
+	Code int
+
+	// Stdout and Stderr hold the output of the command.
+	Stdout []byte
+	Stderr []byte
+}
+
+// FirstFailure returns the index in Steps of the command in a
+// sequence that failed, or -1 if none did.
+func (r *ExecResponse) FirstFailure() int {
+	for i, step := range r.Steps {
+		if step.Code != 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// remainingOutput matches all the output that has not been read.
+var remainingOutput = regexp.MustCompile(`\z`)
+
+// runSequence runs the commands in run.Sequence one after another in
+// a single session, stopping at the first that fails.
+func runSequence(ctx context.Context, run *RunParams) (*ExecResponse, error) {
+	for _, opt := range []struct {
+		name string
+		set  bool
+	}{
+		{"Commands", run.Commands != ""},
+		{"Args", len(run.Args) > 0},
+		{"Stdin", run.Stdin != nil},
+		{"Stdout", run.Stdout != nil},
+		{"Stderr", run.Stderr != nil},
+		{"StdoutPath", run.StdoutPath != ""},
+		{"StderrPath", run.StderrPath != ""},
+		{"Detach", run.Detach},
+		{"ScriptFile", run.ScriptFile},
+		{"DryRun", run.DryRun},
+	} {
+		if opt.set {
+			return nil, errors.NotValidf("setting %s with Sequence", opt.name)
+		}
+	}
+	sequence := run.Sequence
+	params := *run
+	params.Sequence = nil
+	session, err := StartSession(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	var steps []StepResult
+	var stdout, stderr bytes.Buffer
+	for _, command := range sequence {
+		step, err := session.Exec(ctx, command)
+		if errors.Cause(err) == io.EOF {
+			// The command made the shell exit, so its status is
+			// that of the shell, and its output is all that is
+			// left.
+			resp, closeErr := session.Close()
+			stepOut, _ := session.Stdout().Expect(ctx, remainingOutput)
+			stepErr, _ := session.Stderr().Expect(ctx, remainingOutput)
+			step = &ExecResponse{Stdout: []byte(stepOut), Stderr: []byte(stepErr)}
+			if resp != nil {
+				step.Code = resp.Code
+			}
+			steps = append(steps, newStepResult(command, step))
+			stdout.Write(step.Stdout)
+			stderr.Write(step.Stderr)
+			return sequenceResponse(resp, steps, &stdout, &stderr), closeErr
+		}
+		if err != nil {
+			session.Kill()
+			resp, _ := session.Close()
+			return sequenceResponse(resp, steps, &stdout, &stderr), err
+		}
+		steps = append(steps, newStepResult(command, step))
+		stdout.Write(step.Stdout)
+		stderr.Write(step.Stderr)
+		if step.Code != 0 {
+			break
+		}
+	}
+	resp, err := session.Close()
+	return sequenceResponse(resp, steps, &stdout, &stderr), err
+}
+
+func newStepResult(command string, resp *ExecResponse) StepResult {
+	return StepResult{
+		Command: command,
+		Code:    resp.Code,
+		Stdout:  resp.Stdout,
+		Stderr:  resp.Stderr,
+	}
+}
+
+// sequenceResponse returns the response for a sequence, given the
+// response for the session that ran it.
+func sequenceResponse(resp *ExecResponse, steps []StepResult, stdout, stderr *bytes.Buffer) *ExecResponse {
+	if resp == nil {
+		return nil
+	}
+	resp.Steps = steps
+	resp.Stdout = stdout.Bytes()
+	resp.Stderr = stderr.Bytes()
+	if i := resp.FirstFailure(); i >= 0 {
+		resp.Code = steps[i].Code
+	}
+	return resp
+}
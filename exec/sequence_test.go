@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type sequenceSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&sequenceSuite{})
+
+func (*sequenceSuite) TestSequence(c *gc.C) {
+	dir := c.MkDir()
+	resp, err := exec.RunCommands(exec.RunParams{
+		Sequence: []string{
+			"cd " + dir,
+			"GREETING=hello; pwd",
+			"echo $GREETING; echo warning >&2",
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(resp.FirstFailure(), gc.Equals, -1)
+	c.Assert(string(resp.Stdout), gc.Equals, dir+"\nhello\n")
+	c.Assert(string(resp.Stderr), gc.Equals, "warning\n")
+	c.Assert(resp.Steps, gc.HasLen, 3)
+	c.Assert(resp.Steps[1], jc.DeepEquals, exec.StepResult{
+		Command: "GREETING=hello; pwd",
+		Stdout:  []byte(dir + "\n"),
+		Stderr:  []byte{},
+	})
+	c.Assert(string(resp.Steps[2].Stdout), gc.Equals, "hello\n")
+	c.Assert(string(resp.Steps[2].Stderr), gc.Equals, "warning\n")
+}
+
+func (*sequenceSuite) TestFailure(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Sequence: []string{
+			"echo one",
+			"echo oops >&2; (exit 3)",
+			"echo not run",
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 3)
+	c.Assert(resp.FirstFailure(), gc.Equals, 1)
+	c.Assert(resp.Steps, gc.HasLen, 2)
+	c.Assert(resp.Steps[1].Code, gc.Equals, 3)
+	c.Assert(string(resp.Steps[1].Stderr), gc.Equals, "oops\n")
+	c.Assert(string(resp.Stdout), gc.Equals, "one\n")
+}
+
+func (*sequenceSuite) TestExit(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Sequence: []string{
+			"echo one",
+			"echo leaving; exit 4",
+			"echo not run",
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 4)
+	c.Assert(resp.FirstFailure(), gc.Equals, 1)
+	c.Assert(resp.Steps, gc.HasLen, 2)
+	c.Assert(string(resp.Steps[1].Stdout), gc.Equals, "leaving\n")
+	c.Assert(string(resp.Stdout), gc.Equals, "one\nleaving\n")
+}
+
+func (*sequenceSuite) TestNotValid(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		Sequence: []string{"true"},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, "setting Commands with Sequence not valid")
+
+	run := exec.RunParams{Sequence: []string{"true"}}
+	err = run.Run()
+	c.Assert(err, gc.ErrorMatches, "calling Run with Sequence not valid")
+}
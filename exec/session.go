@@ -0,0 +1,237 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Session is a shell, or another interpreter, that is kept running so
+// that it can be given commands one after another, sharing state such
+// as the working directory and shell variables between them. It is
+// created with StartSession and must be closed with Close.
+type Session struct {
+	run    *RunParams
+	stdin  io.WriteCloser
+	stdout *SessionOutput
+	stderr *SessionOutput
+	nonce  string
+
+	mu  sync.Mutex
+	seq int
+
+	closeOnce sync.Once
+	done      chan struct{}
+	result    *ExecResponse
+	err       error
+}
+
+// StartSession starts the shell described by run, running run.Commands
+// first if set, and returns a session through which further input can
+// be sent to it. The session's output is available through its Stdout
+// and Stderr methods; it is not captured in the response returned by
+// Close unless run.Stdout or run.Stderr direct it elsewhere. If ctx is
+// done before the session is closed, the shell is killed.
+//
+// Run.Stdin must not be set, as the session supplies the shell's
+// input.
+func StartSession(ctx context.Context, run RunParams) (*Session, error) {
+	if run.Stdin != nil {
+		return nil, errors.NotValidf("setting Stdin for a session")
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &Session{
+		run:    &run,
+		stdout: newSessionOutput(),
+		stderr: newSessionOutput(),
+		nonce:  hex.EncodeToString(nonce),
+		done:   make(chan struct{}),
+	}
+	if run.Stdout == nil && run.StdoutPath == "" {
+		run.Stdout = ioutil.Discard
+	}
+	if run.Stderr == nil && run.StderrPath == "" {
+		run.Stderr = ioutil.Discard
+	}
+	run.stdoutTap = s.stdout
+	run.stderrTap = s.stderr
+	run.openStdin = true
+	run.ctx = ctx
+	if err := run.Run(); err != nil {
+		return nil, err
+	}
+	s.stdin = run.stdinPipe
+	input := run.pendingInput
+	if input != "" && !strings.HasSuffix(input, "\n") {
+		input += "\n"
+	}
+	if err := s.Send(input); err != nil {
+		logger.Debugf("cannot send commands to session: %v", err)
+	}
+	go func() {
+		defer close(s.done)
+		s.result, s.err = run.WaitWithContext(ctx)
+		s.stdout.close()
+		s.stderr.close()
+	}()
+	return s, nil
+}
+
+// Stdout returns the standard output of the session.
+func (s *Session) Stdout() *SessionOutput {
+	return s.stdout
+}
+
+// Stderr returns the standard error of the session.
+func (s *Session) Stderr() *SessionOutput {
+	return s.stderr
+}
+
+// Process returns the process running the shell.
+func (s *Session) Process() *os.Process {
+	return s.run.Process()
+}
+
+// Send writes input to the shell.
+func (s *Session) Send(input string) error {
+	_, err := io.WriteString(s.stdin, input)
+	return errors.Trace(err)
+}
+
+// Exec runs command in the shell, which must be a POSIX shell such as
+// the default Bash, and waits for it to finish. The response holds the
+// output the command produced and its exit code; the fields relating
+// to the process are not set, as the shell continues running. Output
+// already sent by the shell but not read with Expect is discarded.
+//
+// If ctx is done before the command finishes, Exec returns ctx.Err()
+// and the command continues to run; the session should then normally
+// be closed, as the output of the command may be read by later calls.
+func (s *Session) Exec(ctx context.Context, command string) (*ExecResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	marker := fmt.Sprintf("%s-%d", s.nonce, s.seq)
+	script := command + "\n" +
+		"printf '\\n%s %d\\n' " + marker + " $?\n" +
+		"printf '\\n%s\\n' " + marker + " >&2\n"
+	if err := s.Send(script); err != nil {
+		return nil, errors.Annotate(err, "cannot send command")
+	}
+	stdoutEnd := "\n" + marker
+	stdoutMatch := regexp.MustCompile(regexp.QuoteMeta(stdoutEnd) + ` ([0-9]+)\n`)
+	stdout, err := s.stdout.Expect(ctx, stdoutMatch)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	stderrEnd := "\n" + marker + "\n"
+	stderr, err := s.stderr.Expect(ctx, regexp.MustCompile(regexp.QuoteMeta(stderrEnd)))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	code, err := strconv.Atoi(stdoutMatch.FindStringSubmatch(stdout)[1])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &ExecResponse{
+		Code:   code,
+		Stdout: []byte(stdout[:strings.LastIndex(stdout, stdoutEnd)]),
+		Stderr: []byte(strings.TrimSuffix(stderr, stderrEnd)),
+	}, nil
+}
+
+// Kill kills the shell and any processes it started.
+func (s *Session) Kill() error {
+	return s.run.KillAll()
+}
+
+// Close closes the shell's standard input and waits for it to exit,
+// returning the response for the whole session, as Wait would.
+// Calling Close more than once returns the same result.
+func (s *Session) Close() (*ExecResponse, error) {
+	s.closeOnce.Do(func() {
+		s.stdin.Close()
+	})
+	<-s.done
+	return s.result, s.err
+}
+
+// SessionOutput holds output written by a session's shell that has
+// not yet been read.
+type SessionOutput struct {
+	mu      sync.Mutex
+	buf     []byte
+	closed  bool
+	changed chan struct{}
+}
+
+func newSessionOutput() *SessionOutput {
+	return &SessionOutput{changed: make(chan struct{})}
+}
+
+// Write implements io.Writer.
+func (o *SessionOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = append(o.buf, p...)
+	o.notify()
+	return len(p), nil
+}
+
+// close records that no more output will be written.
+func (o *SessionOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	o.notify()
+}
+
+// notify wakes up any callers of Expect. It must be called with o.mu
+// held.
+func (o *SessionOutput) notify() {
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// Expect waits until the unread output matches re and returns the
+// output up to and including the match, which is then considered
+// read. If the shell exits without the output matching, Expect
+// returns io.EOF; if ctx is done first, it returns ctx.Err(). In both
+// cases the output remains unread.
+func (o *SessionOutput) Expect(ctx context.Context, re *regexp.Regexp) (string, error) {
+	for {
+		o.mu.Lock()
+		if loc := re.FindIndex(o.buf); loc != nil {
+			out := string(o.buf[:loc[1]])
+			o.buf = append([]byte(nil), o.buf[loc[1]:]...)
+			o.mu.Unlock()
+			return out, nil
+		}
+		closed, changed := o.closed, o.changed
+		o.mu.Unlock()
+		if closed {
+			return "", io.EOF
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-changed:
+		}
+	}
+}
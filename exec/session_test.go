@@ -0,0 +1,117 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/testing/leaktest"
+)
+
+type sessionSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&sessionSuite{})
+
+func (*sessionSuite) TestExec(c *gc.C) {
+	defer leaktest.Check(c)()
+	dir := c.MkDir()
+	s, err := exec.StartSession(context.Background(), exec.RunParams{
+		Commands: "GREETING=hello",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer s.Close()
+
+	ctx := context.Background()
+	resp, err := s.Exec(ctx, "cd "+dir+"\necho $GREETING")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(resp.Code, gc.Equals, 0)
+	c.Check(string(resp.Stdout), gc.Equals, "hello\n")
+
+	resp, err = s.Exec(ctx, "pwd; printf partial; echo oops >&2; false")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(resp.Code, gc.Equals, 1)
+	c.Check(string(resp.Stdout), gc.Equals, dir+"\npartial")
+	c.Check(string(resp.Stderr), gc.Equals, "oops\n")
+
+	resp, err = s.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+}
+
+func (*sessionSuite) TestSendExpect(c *gc.C) {
+	defer leaktest.Check(c)()
+	s, err := exec.StartSession(context.Background(), exec.RunParams{
+		Commands: "while read line; do echo \"got $line\"; echo '> ' >&2; done",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	defer s.Close()
+
+	ctx := context.Background()
+	prompt := regexp.MustCompile("> ")
+	got := regexp.MustCompile(`got (.*)\n`)
+	for _, input := range []string{"one", "two"} {
+		err = s.Send(input + "\n")
+		c.Assert(err, jc.ErrorIsNil)
+		out, err := s.Stdout().Expect(ctx, got)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(out, gc.Equals, "got "+input+"\n")
+		_, err = s.Stderr().Expect(ctx, prompt)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = s.Stdout().Expect(ctx, got)
+	c.Assert(err, gc.Equals, context.DeadlineExceeded)
+}
+
+func (*sessionSuite) TestExpectAfterExit(c *gc.C) {
+	defer leaktest.Check(c)()
+	s, err := exec.StartSession(context.Background(), exec.RunParams{})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.Send("echo bye; exit 5\n")
+	c.Assert(err, jc.ErrorIsNil)
+
+	ctx := context.Background()
+	out, err := s.Stdout().Expect(ctx, regexp.MustCompile("bye\n"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(out, gc.Equals, "bye\n")
+	_, err = s.Stdout().Expect(ctx, regexp.MustCompile("never"))
+	c.Assert(err, gc.Equals, io.EOF)
+
+	resp, err := s.Close()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 5)
+}
+
+func (*sessionSuite) TestContextKillsSession(c *gc.C) {
+	defer leaktest.Check(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := exec.StartSession(ctx, exec.RunParams{})
+	c.Assert(err, jc.ErrorIsNil)
+	cancel()
+	_, err = s.Close()
+	c.Assert(err, gc.Equals, context.Canceled)
+}
+
+func (*sessionSuite) TestStdinNotValid(c *gc.C) {
+	defer leaktest.Check(c)()
+	_, err := exec.StartSession(context.Background(), exec.RunParams{
+		Stdin: new(io.PipeReader),
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type signalSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&signalSuite{})
+
+// startReady starts commands, which must print "ready" once they are
+// prepared to receive a signal, and waits for them to do so.
+func startReady(c *gc.C, commands string) *exec.RunParams {
+	ready := make(chan struct{}, 1)
+	run := &exec.RunParams{
+		Commands: commands,
+		OnStdoutLine: func(line string) {
+			if line == "ready" {
+				ready <- struct{}{}
+			}
+		},
+	}
+	err := run.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	<-ready
+	return run
+}
+
+func (*signalSuite) TestSignal(c *gc.C) {
+	run := startReady(c, "trap 'echo term; exit 7' TERM\necho ready\nwhile :; do sleep 0.05; done\n")
+	err := run.Signal(syscall.SIGTERM)
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := run.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 7)
+	c.Assert(string(resp.Stdout), gc.Equals, "ready\nterm\n")
+
+	err = run.Signal(syscall.SIGTERM)
+	c.Assert(err, gc.Equals, os.ErrProcessDone)
+}
+
+func (*signalSuite) TestKill(c *gc.C) {
+	run := startReady(c, "echo ready\nexec sleep 60\n")
+	err := run.Kill()
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := run.Wait()
+	c.Assert(err, gc.ErrorMatches, "signal: killed")
+	c.Assert(resp.Signal, gc.Equals, syscall.SIGKILL)
+
+	err = run.Kill()
+	c.Assert(err, gc.Equals, os.ErrProcessDone)
+}
+
+func (*signalSuite) TestNotStarted(c *gc.C) {
+	var run exec.RunParams
+	c.Assert(run.Signal(os.Interrupt), gc.Equals, exec.ErrNotStarted)
+	c.Assert(run.Kill(), gc.Equals, exec.ErrNotStarted)
+	c.Assert(run.KillAll(), gc.Equals, exec.ErrNotStarted)
+}
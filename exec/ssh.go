@@ -0,0 +1,301 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// HostKeyPolicy determines how an SSHRunner checks the key of the
+// remote host.
+type HostKeyPolicy int
+
+const (
+	// StrictHostKeys requires the key of the host to be known
+	// already.
+	StrictHostKeys HostKeyPolicy = iota
+
+	// AcceptNewHostKeys accepts, and records, the key of a host that
+	// is not yet known, but still refuses a host whose key has
+	// changed.
+	AcceptNewHostKeys
+
+	// IgnoreHostKeys accepts any key without recording it. It leaves
+	// the connection open to being intercepted, so it should only be
+	// used where the host cannot otherwise be verified, such as a
+	// machine that has just been provisioned.
+	IgnoreHostKeys
+)
+
+// sshExitCode is the exit code with which ssh reports its own
+// failures, such as being unable to connect.
+const sshExitCode = 255
+
+// SSHRunner is a Runner that runs commands on a remote host with the
+// OpenSSH client, which must be installed locally. The remote host
+// must have a POSIX shell.
+//
+// Commands are run there as RunCommands would run them locally: by
+// /bin/bash, or /bin/sh if bash is not installed and RequireBash is
+// not set, or by the Interpreter, reading them from standard input,
+// and Args are run as they are, from Path if it is set. Environment,
+// WorkingDir, Umask and NormalizeLocale apply on the remote host, and
+// the environment there is that of the remote user's login, with
+// Environment added or, with ReplaceEnvironment, Environment alone;
+// ExpandVariables expands only variables from Environment. Output,
+// timeouts, retries and the other options that concern the command's
+// output or lifetime apply to the ssh process, and so behave as they
+// do locally, but killing it does not necessarily stop the remote
+// command. User, Group, Elevate, ScriptFile, Chroot,
+// NewMountNamespace, Limits, Cgroup and CreateWorkingDir are not
+// supported.
+//
+// An exit code of 255, which ssh uses to report that it could not
+// run the command, is returned as an error along with the response.
+type SSHRunner struct {
+	// Host holds the name or address of the remote host.
+	Host string
+
+	// Port holds the port sshd listens on. If zero, the port
+	// configured for the host, usually 22, is used.
+	Port int
+
+	// User holds the user to log in as. If empty, the user configured
+	// for the host, or the local user name, is used.
+	User string
+
+	// IdentityFile, if set, holds the path of the private key used to
+	// authenticate. Otherwise the keys configured for ssh, or offered
+	// by ssh-agent, are used. Password authentication is never
+	// attempted, as there is nobody to type the password.
+	IdentityFile string
+
+	// KnownHostsFile, if set, holds the path of the file listing the
+	// known host keys, in place of ~/.ssh/known_hosts.
+	KnownHostsFile string
+
+	// HostKeys determines how the key of the host is checked.
+	HostKeys HostKeyPolicy
+
+	// Options holds further ssh options, in the "Name=value" form
+	// taken by ssh -o, such as "ConnectTimeout=10".
+	Options []string
+
+	// SSHPath holds the name or path of the ssh executable. If empty,
+	// "ssh" is looked up in $PATH.
+	SSHPath string
+}
+
+var _ Runner = (*SSHRunner)(nil)
+
+// RunCommands implements Runner.
+func (s *SSHRunner) RunCommands(run RunParams) (*ExecResponse, error) {
+	return s.RunCommandsContext(context.Background(), run)
+}
+
+// RunCommandsContext is like RunCommands, but kills ssh if ctx is done
+// before it exits, as RunCommandsContext does.
+func (s *SSHRunner) RunCommandsContext(ctx context.Context, run RunParams) (*ExecResponse, error) {
+	local, err := s.localParams(run)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	resp, err := RunCommandsContext(ctx, local)
+	if err == nil && resp != nil && resp.Code == sshExitCode && !run.DryRun {
+		err = errors.Errorf("cannot run command on %s: %s", s.Host, lastLine(resp.Stderr))
+		if len(resp.Stderr) == 0 {
+			err = errors.Errorf("cannot run command on %s", s.Host)
+		}
+	}
+	return resp, err
+}
+
+// localParams returns the parameters that run ssh locally to run the
+// command described by run on the remote host.
+func (s *SSHRunner) localParams(run RunParams) (RunParams, error) {
+	if s.Host == "" {
+		return RunParams{}, errors.NotValidf("empty host")
+	}
+	for _, opt := range []struct {
+		name string
+		set  bool
+	}{
+		{"User", run.User != ""},
+		{"Group", run.Group != ""},
+		{"Elevate", run.Elevate},
+		{"ScriptFile", run.ScriptFile},
+		{"Chroot", run.Chroot != ""},
+		{"NewMountNamespace", run.NewMountNamespace},
+		{"Limits", run.Limits != nil},
+		{"Cgroup", run.Cgroup != nil},
+		{"CreateWorkingDir", run.CreateWorkingDir != nil},
+	} {
+		if opt.set {
+			return RunParams{}, errors.NotSupportedf("%s with SSHRunner", opt.name)
+		}
+	}
+	if len(run.Args) > 0 && (run.Commands != "" || run.Interpreter != nil) {
+		return RunParams{}, errors.NotValidf("setting Args with Commands or Interpreter")
+	}
+	if run.Path != "" && len(run.Args) == 0 {
+		return RunParams{}, errors.NotValidf("setting Path without Args")
+	}
+	commands, args := run.Commands, run.Args
+	if run.ExpandVariables {
+		var err error
+		commands, err = ExpandVariables(commands, run.Environment, run.StrictVariables)
+		if err != nil {
+			return RunParams{}, errors.Annotate(err, "cannot expand commands")
+		}
+		args = make([]string, len(run.Args))
+		for i, arg := range run.Args {
+			args[i], err = ExpandVariables(arg, run.Environment, run.StrictVariables)
+			if err != nil {
+				return RunParams{}, errors.Annotate(err, "cannot expand arguments")
+			}
+		}
+	}
+
+	remoteEnv := run.Environment
+	if run.NormalizeLocale {
+		remoteEnv = append(append([]string(nil), remoteEnv...), localeVariables(run.Locale)...)
+	}
+	var remote string
+	if len(args) > 0 {
+		if run.Path != "" {
+			// The remote shell cannot set the program's name.
+			args = append([]string{run.Path}, args[1:]...)
+		}
+		remote = s.remoteCommand(run.EnvironmentMode, remoteEnv, args)
+	} else {
+		env := remoteEnv
+		var shell []string
+		if i := run.Interpreter; i != nil {
+			env = append(append([]string(nil), env...), i.Environment...)
+			shell = append([]string{i.Path}, i.Args...)
+			commands = i.Prelude + commands
+		}
+		if shell != nil {
+			remote = s.remoteCommand(run.EnvironmentMode, env, shell)
+		} else if run.RequireBash {
+			remote = s.remoteCommand(run.EnvironmentMode, env, append([]string{Bash.Path}, Bash.Args...))
+		} else {
+			remote = "if [ -x " + QuotePOSIX(Bash.Path) + " ]; then " +
+				s.remoteCommand(run.EnvironmentMode, env, append([]string{Bash.Path}, Bash.Args...)) +
+				"; else " +
+				s.remoteCommand(run.EnvironmentMode, env, append([]string{Sh.Path}, Sh.Args...)) +
+				"; fi"
+		}
+	}
+	if run.WorkingDir != "" {
+		remote = "cd " + QuotePOSIX(run.WorkingDir) + " && " + remote
+	}
+	if run.Umask != nil {
+		if err := validateUmask(*run.Umask); err != nil {
+			return RunParams{}, errors.Trace(err)
+		}
+		remote = "umask " + umaskString(*run.Umask) + " && " + remote
+	}
+
+	local := run
+	local.Commands = ""
+	local.Interpreter = nil
+	local.Path = ""
+	local.Args = append(s.sshArgs(), "--", s.destination(), remote)
+	local.Environment = nil
+	local.EnvironmentMode = InheritEnvironment
+	local.WorkingDir = ""
+	local.Umask = nil
+	local.NormalizeLocale = false
+	local.ExpandVariables = false
+	local.Stdin = s.stdin(commands, run.Stdin)
+	return local, nil
+}
+
+// remoteCommand returns the shell command that runs args on the
+// remote host with the given environment variables added to, or
+// replacing, its environment.
+func (s *SSHRunner) remoteCommand(mode EnvironmentMode, env, args []string) string {
+	switch {
+	case mode == ReplaceEnvironment:
+		return "exec env -i " + QuotePOSIX(append(append([]string(nil), env...), args...)...)
+	case len(env) > 0:
+		return "exec env " + QuotePOSIX(append(append([]string(nil), env...), args...)...)
+	}
+	return "exec " + QuotePOSIX(args...)
+}
+
+// stdin returns the standard input for ssh, which carries commands
+// followed by the caller's input.
+func (s *SSHRunner) stdin(commands string, stdin io.Reader) io.Reader {
+	switch {
+	case stdin == nil && commands == "":
+		return nil
+	case stdin == nil:
+		return strings.NewReader(commands)
+	case commands == "":
+		return stdin
+	}
+	if !strings.HasSuffix(commands, "\n") {
+		// Ensure the last command is complete before the shell
+		// starts reading from Stdin.
+		commands += "\n"
+	}
+	return io.MultiReader(strings.NewReader(commands), stdin)
+}
+
+// destination returns the ssh destination argument.
+func (s *SSHRunner) destination() string {
+	if s.User != "" {
+		return s.User + "@" + s.Host
+	}
+	return s.Host
+}
+
+// sshArgs returns the ssh executable and the options that precede the
+// destination.
+func (s *SSHRunner) sshArgs() []string {
+	path := s.SSHPath
+	if path == "" {
+		path = "ssh"
+	}
+	args := []string{
+		path,
+		// Never allocate a terminal, so that the output is passed
+		// through unchanged and the commands are read from standard
+		// input as they are locally.
+		"-T",
+		"-o", "BatchMode=yes",
+	}
+	switch s.HostKeys {
+	case AcceptNewHostKeys:
+		args = append(args, "-o", "StrictHostKeyChecking=accept-new")
+	case IgnoreHostKeys:
+		args = append(args, "-o", "StrictHostKeyChecking=no")
+	default:
+		args = append(args, "-o", "StrictHostKeyChecking=yes")
+	}
+	switch {
+	case s.KnownHostsFile != "":
+		args = append(args, "-o", "UserKnownHostsFile="+s.KnownHostsFile)
+	case s.HostKeys == IgnoreHostKeys:
+		args = append(args, "-o", "UserKnownHostsFile="+os.DevNull)
+	}
+	if s.IdentityFile != "" {
+		args = append(args, "-i", s.IdentityFile, "-o", "IdentitiesOnly=yes")
+	}
+	if s.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(s.Port))
+	}
+	for _, opt := range s.Options {
+		args = append(args, "-o", opt)
+	}
+	return args
+}
@@ -0,0 +1,201 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type sshSuite struct {
+	testing.IsolationSuite
+	dir    string
+	runner *exec.SSHRunner
+}
+
+var _ = gc.Suite(&sshSuite{})
+
+// fakeSSH records its arguments, one per line, and runs the remote
+// command locally with sh, as sshd would with the user's shell.
+const fakeSSH = `#!/bin/sh
+printf '%s\n' "$@" > "$(dirname "$0")/args"
+while [ "$1" != "--" ]; do shift; done
+case "$2" in
+unreachable) echo "ssh: connect to host unreachable port 22: No route to host" >&2; exit 255;;
+esac
+exec sh -c "$3"
+`
+
+func (s *sshSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+	ssh := filepath.Join(s.dir, "ssh")
+	err := ioutil.WriteFile(ssh, []byte(fakeSSH), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	s.runner = &exec.SSHRunner{
+		Host:    "remote",
+		SSHPath: ssh,
+	}
+}
+
+func (s *sshSuite) args(c *gc.C) []string {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "args"))
+	c.Assert(err, jc.ErrorIsNil)
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func (s *sshSuite) TestCommands(c *gc.C) {
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Commands:    "echo $FOO; echo oops >&2; pwd; exit 3",
+		Environment: []string{"FOO=foo bar"},
+		WorkingDir:  s.dir,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 3)
+	c.Assert(string(resp.Stdout), gc.Equals, "foo bar\n"+s.dir+"\n")
+	c.Assert(string(resp.Stderr), gc.Equals, "oops\n")
+	args := s.args(c)
+	c.Assert(args[len(args)-2:], jc.DeepEquals, []string{
+		"remote",
+		"cd " + s.dir + " && if [ -x /bin/bash ]; then exec env 'FOO=foo bar' /bin/bash -s; else exec env 'FOO=foo bar' /bin/sh -s; fi",
+	})
+}
+
+func (s *sshSuite) TestArgs(c *gc.C) {
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Args: []string{"printf", "%s|", "a b", "it's"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "a b|it's|")
+}
+
+func (s *sshSuite) TestInterpreterAndStdin(c *gc.C) {
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Commands:    "read line; echo \"got $line\"",
+		Interpreter: &exec.Bash,
+		Stdin:       strings.NewReader("input\n"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "got input\n")
+	args := s.args(c)
+	c.Assert(args[len(args)-1], gc.Equals, "exec /bin/bash -s")
+}
+
+func (s *sshSuite) TestReplaceEnvironment(c *gc.C) {
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Args:            []string{"/usr/bin/env"},
+		Environment:     []string{"ONLY=this"},
+		EnvironmentMode: exec.ReplaceEnvironment,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "ONLY=this\n")
+}
+
+func (s *sshSuite) TestOptions(c *gc.C) {
+	s.runner.User = "ubuntu"
+	s.runner.Port = 2222
+	s.runner.IdentityFile = "/keys/id"
+	s.runner.HostKeys = exec.IgnoreHostKeys
+	s.runner.Options = []string{"ConnectTimeout=10"}
+	_, err := s.runner.RunCommands(exec.RunParams{
+		Args: []string{"true"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.args(c), jc.DeepEquals, []string{
+		"-T",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-i", "/keys/id", "-o", "IdentitiesOnly=yes",
+		"-p", "2222",
+		"-o", "ConnectTimeout=10",
+		"--",
+		"ubuntu@remote",
+		"exec true",
+	})
+}
+
+func (s *sshSuite) TestKnownHosts(c *gc.C) {
+	s.runner.HostKeys = exec.AcceptNewHostKeys
+	s.runner.KnownHostsFile = "/etc/known"
+	_, err := s.runner.RunCommands(exec.RunParams{
+		Args: []string{"true"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.args(c)[:7], jc.DeepEquals, []string{
+		"-T",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "UserKnownHostsFile=/etc/known",
+	})
+}
+
+func (s *sshSuite) TestSSHFailure(c *gc.C) {
+	s.runner.Host = "unreachable"
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Args: []string{"true"},
+	})
+	c.Assert(err, gc.ErrorMatches, "cannot run command on unreachable: ssh: connect to host unreachable port 22: No route to host")
+	c.Assert(resp.Code, gc.Equals, 255)
+}
+
+func (s *sshSuite) TestNotSupported(c *gc.C) {
+	_, err := s.runner.RunCommands(exec.RunParams{
+		Commands: "true",
+		Elevate:  true,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+	c.Assert(err, gc.ErrorMatches, "Elevate with SSHRunner not supported")
+}
+
+func (s *sshSuite) TestContext(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.runner.RunCommandsContext(ctx, exec.RunParams{
+		Args: []string{"true"},
+	})
+	c.Assert(err, gc.Equals, context.Canceled)
+}
+
+func (s *sshSuite) TestRunner(c *gc.C) {
+	var runner exec.Runner = s.runner
+	resp, err := runner.RunCommands(exec.RunParams{
+		Commands: "echo remote",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "remote\n")
+}
+
+func (s *sshSuite) TestUmask(c *gc.C) {
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Args:  []string{"sh", "-c", "umask"},
+		Umask: umask(0077),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "0077\n")
+	args := s.args(c)
+	c.Assert(args[len(args)-1], gc.Equals, "umask 0077 && exec sh -c umask")
+}
+
+func (s *sshSuite) TestNormalizeLocale(c *gc.C) {
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Args:            []string{"sh", "-c", "echo $LC_ALL"},
+		NormalizeLocale: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "C\n")
+	args := s.args(c)
+	c.Assert(args[len(args)-1], gc.Equals, "exec env LANG=C LC_ALL=C LANGUAGE= sh -c 'echo $LC_ALL'")
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"syscall"
+)
+
+// sigkillExitCode is the exit code reported by shells for a child
+// process killed by SIGKILL, which is how the kernel's OOM killer
+// terminates processes.
+const sigkillExitCode = 128 + 9
+
+// setTerminationDetails fills in the signal related fields of result
+// from the wait status of the process. oomBefore holds the number of
+// OOM kills recorded for the agent's cgroup when the process was
+// started, or -1 if unknown.
+func setTerminationDetails(result *ExecResponse, status syscall.WaitStatus, oomBefore int) {
+	killed := false
+	if status.Signaled() {
+		result.Signal = status.Signal()
+		result.CoreDumped = status.CoreDump()
+		killed = result.Signal == syscall.Signal(9)
+	} else if status.Exited() && status.ExitStatus() == sigkillExitCode {
+		// The shell itself survived, but a command it ran was
+		// killed.
+		killed = true
+	}
+	if !killed || oomBefore < 0 {
+		return
+	}
+	if after := oomKillCount(); after > oomBefore {
+		result.OOMKilled = true
+	}
+}
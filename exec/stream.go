@@ -0,0 +1,153 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Event is implemented by the events sent by RunStream: Started,
+// StdoutChunk, StderrChunk and Exited.
+type Event interface {
+	isEvent()
+}
+
+// Started is the first event sent by RunStream.
+type Started struct {
+	PID  int
+	Time time.Time
+}
+
+// StdoutChunk holds output written by the command to its standard
+// output.
+type StdoutChunk struct {
+	Data []byte
+}
+
+// StderrChunk holds output written by the command to its standard
+// error.
+type StderrChunk struct {
+	Data []byte
+}
+
+// Exited is the last event sent by RunStream. It holds what Wait
+// returned, or the context's error if the command was killed because
+// the context was done.
+type Exited struct {
+	Response *ExecResponse
+	Err      error
+}
+
+func (Started) isEvent()     {}
+func (StdoutChunk) isEvent() {}
+func (StderrChunk) isEvent() {}
+func (Exited) isEvent()      {}
+
+// RunStream starts the commands described by run and returns a channel
+// on which the progress of execution is reported as it happens: a
+// Started event, a StdoutChunk or StderrChunk event for each write the
+// command makes, and finally an Exited event holding the complete
+// response, after which the channel is closed. Output is also
+// captured in the response as it would be by RunCommands.
+//
+// If ctx is done before the command exits, the command is killed.
+// The caller must receive from the channel until it is closed; output
+// is queued rather than blocking the command while the caller is busy.
+func RunStream(ctx context.Context, run RunParams) (<-chan Event, error) {
+	q := newEventQueue()
+	run.stdoutTap = chunkWriter(func(data []byte) {
+		q.push(StdoutChunk{Data: data})
+	})
+	run.stderrTap = chunkWriter(func(data []byte) {
+		q.push(StderrChunk{Data: data})
+	})
+	run.ctx = ctx
+	if err := run.Run(); err != nil {
+		return nil, err
+	}
+	proc := run.Process()
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		events <- Started{
+			PID:  proc.Pid,
+			Time: run.started,
+		}
+		for {
+			e, ok := q.pop()
+			if !ok {
+				return
+			}
+			events <- e
+		}
+	}()
+	go func() {
+		resp, err := run.WaitWithContext(ctx)
+		q.close(Exited{
+			Response: resp,
+			Err:      err,
+		})
+	}()
+	return events, nil
+}
+
+// chunkWriter is an io.Writer that passes a copy of each write to
+// the function. It never returns an error.
+type chunkWriter func(data []byte)
+
+// Write implements io.Writer.
+func (w chunkWriter) Write(p []byte) (int, error) {
+	w(append([]byte(nil), p...))
+	return len(p), nil
+}
+
+// eventQueue is an unbounded queue of events, closed by a final
+// event.
+type eventQueue struct {
+	mu     sync.Mutex
+	cond   sync.Cond
+	events []Event
+	closed bool
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{}
+	q.cond.L = &q.mu
+	return q
+}
+
+func (q *eventQueue) push(e Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, e)
+	q.cond.Signal()
+}
+
+// close adds the final event to the queue.
+func (q *eventQueue) close(final Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, final)
+	q.closed = true
+	q.cond.Signal()
+}
+
+// pop removes and returns the next event, waiting for one if
+// necessary. It returns false once the final event has been popped.
+func (q *eventQueue) pop() (Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) == 0 {
+		if q.closed {
+			return nil, false
+		}
+		q.cond.Wait()
+	}
+	e := q.events[0]
+	q.events[0] = nil
+	q.events = q.events[1:]
+	return e, true
+}
@@ -0,0 +1,109 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/testing/leaktest"
+)
+
+type streamSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&streamSuite{})
+
+// collect receives all the events from events.
+func collect(c *gc.C, events <-chan exec.Event) []exec.Event {
+	var all []exec.Event
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return all
+			}
+			all = append(all, e)
+		case <-timeout:
+			c.Fatalf("timed out waiting for events")
+		}
+	}
+}
+
+func (*streamSuite) TestRunStream(c *gc.C) {
+	defer leaktest.Check(c)()
+	events, err := exec.RunStream(context.Background(), exec.RunParams{
+		Commands: "echo out1; echo err1 >&2; sleep 0.1; echo out2; exit 3",
+	})
+	c.Assert(err, gc.IsNil)
+	all := collect(c, events)
+	c.Assert(len(all) >= 2, jc.IsTrue)
+
+	started, ok := all[0].(exec.Started)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(started.PID, gc.Not(gc.Equals), 0)
+
+	exited, ok := all[len(all)-1].(exec.Exited)
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(exited.Err, gc.IsNil)
+	c.Assert(exited.Response.Code, gc.Equals, 3)
+	c.Assert(string(exited.Response.Stdout), gc.Equals, "out1\nout2\n")
+	c.Assert(string(exited.Response.Stderr), gc.Equals, "err1\n")
+
+	var stdout, stderr string
+	for _, e := range all[1 : len(all)-1] {
+		switch e := e.(type) {
+		case exec.StdoutChunk:
+			stdout += string(e.Data)
+		case exec.StderrChunk:
+			stderr += string(e.Data)
+		default:
+			c.Fatalf("unexpected event %#v", e)
+		}
+	}
+	c.Assert(stdout, gc.Equals, "out1\nout2\n")
+	c.Assert(stderr, gc.Equals, "err1\n")
+}
+
+func (*streamSuite) TestRunStreamCancel(c *gc.C) {
+	defer leaktest.Check(c)()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := exec.RunStream(ctx, exec.RunParams{
+		Commands: "echo ready; exec sleep 60",
+	})
+	c.Assert(err, gc.IsNil)
+	var exited exec.Exited
+	for e := range events {
+		switch e := e.(type) {
+		case exec.StdoutChunk:
+			cancel()
+		case exec.Exited:
+			exited = e
+		}
+	}
+	c.Assert(exited.Err, gc.Equals, context.Canceled)
+	c.Assert(exited.Response.Signal, gc.Equals, syscall.SIGKILL)
+}
+
+func (*streamSuite) TestRunStreamStartError(c *gc.C) {
+	defer leaktest.Check(c)()
+	_, err := exec.RunStream(context.Background(), exec.RunParams{
+		Commands:         "true",
+		WorkingDir:       "/no/such/dir",
+		EnsureWorkingDir: true,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
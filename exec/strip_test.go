@@ -0,0 +1,72 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type stripSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&stripSuite{})
+
+const coloredCommands = `printf '\033[1;31mred\033[0m text\n'; printf '\033]0;title\007err\n' >&2`
+
+func (*stripSuite) TestStripANSI(c *gc.C) {
+	var stdout bytes.Buffer
+	var lines []string
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:     coloredCommands,
+		StripANSI:    true,
+		Stdout:       &stdout,
+		OnStderrLine: func(line string) { lines = append(lines, line) },
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(stdout.String(), gc.Equals, "red text\n")
+	c.Assert(string(resp.Stderr), gc.Equals, "err\n")
+	c.Assert(lines, jc.DeepEquals, []string{"err"})
+}
+
+func (*stripSuite) TestStripANSICaptured(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "out")
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:       coloredCommands,
+		StripANSI:      true,
+		TranscriptSize: 1024,
+		StderrPath:     path,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "red text\n")
+	c.Assert(string(resp.Transcript), jc.Contains, "red text")
+	c.Assert(string(resp.Transcript), gc.Not(jc.Contains), "\033")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, "err\n")
+}
+
+func (*stripSuite) TestNotStripped(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{Commands: coloredCommands})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "\033[1;31mred\033[0m text\n")
+}
+
+func (*stripSuite) TestStripANSIDetach(c *gc.C) {
+	_, err := exec.StartDetached(exec.RunParams{
+		Commands:  "true",
+		StripANSI: true,
+	})
+	c.Assert(err, gc.ErrorMatches, "setting StripANSI with Detach not valid")
+}
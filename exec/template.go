@@ -0,0 +1,155 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/juju/errors"
+)
+
+// CommandTemplate renders command lines for RunParams.Commands from a
+// text/template, quoting the value of every action so that each is
+// passed to the shell as a single argument, or a []string as one
+// argument per element. For example
+//
+//	exec.Command("apt-get install -y {{.Package}}").With(values)
+//
+// cannot be made to run anything other than apt-get, whatever the
+// package name. Actions must therefore not be written within quotes
+// in the template. A trusted fragment of shell syntax can be
+// interpolated unquoted with the raw function, as in {{raw .Options}}.
+type CommandTemplate struct {
+	text  string
+	quote func(args ...string) string
+	tmpl  *template.Template
+}
+
+// quoteFunc and rawFunc name the template functions that quote an
+// action's value and that leave it unquoted.
+const (
+	quoteFunc = "_quote"
+	rawFunc   = "raw"
+)
+
+// ParseCommand parses text as a command line template that quotes
+// values with Quote.
+func ParseCommand(text string) (*CommandTemplate, error) {
+	return parseCommand(text, Quote)
+}
+
+// Command is like ParseCommand but panics if text cannot be parsed.
+// It is intended for templates that are constants in the program.
+func Command(text string) *CommandTemplate {
+	t, err := ParseCommand(text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func parseCommand(text string, quote func(args ...string) string) (*CommandTemplate, error) {
+	t := &CommandTemplate{
+		text:  text,
+		quote: quote,
+	}
+	tmpl, err := template.New("command").Funcs(template.FuncMap{
+		quoteFunc: t.quoteValue,
+		rawFunc:   fmt.Sprint,
+	}).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot parse command template")
+	}
+	for _, tt := range tmpl.Templates() {
+		if tt.Tree != nil {
+			quoteList(tt.Tree.Root)
+		}
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// Quoting returns a copy of t that quotes values with the given
+// function, such as QuotePOSIX when the commands are to be run by an
+// Interpreter other than the platform default.
+func (t *CommandTemplate) Quoting(quote func(args ...string) string) *CommandTemplate {
+	// The template is parsed again as its functions refer to t.
+	q, err := parseCommand(t.text, quote)
+	if err != nil {
+		// The text has been parsed successfully already.
+		panic(err)
+	}
+	return q
+}
+
+// With renders the command line with the given values, which are
+// referred to as dot in the template.
+func (t *CommandTemplate) With(values interface{}) (string, error) {
+	var buf strings.Builder
+	if err := t.tmpl.Execute(&buf, values); err != nil {
+		return "", errors.Annotate(err, "cannot render command template")
+	}
+	return buf.String(), nil
+}
+
+// quoteValue returns v quoted as one or more arguments.
+func (t *CommandTemplate) quoteValue(v interface{}) string {
+	var args []string
+	switch v := v.(type) {
+	case []string:
+		args = v
+	case string:
+		args = []string{v}
+	default:
+		args = []string{fmt.Sprint(v)}
+	}
+	// The values are quoted as arguments following a program name,
+	// which is then removed, so that they are never quoted in the
+	// way that a program name may need to be, as by QuotePowerShell.
+	line := t.quote(append([]string{"_"}, args...)...)
+	return strings.TrimPrefix(strings.TrimPrefix(line, "_"), " ")
+}
+
+// quoteList arranges for the output of every action in l, including
+// those within control structures, to be quoted.
+func quoteList(l *parse.ListNode) {
+	if l == nil {
+		return
+	}
+	for _, n := range l.Nodes {
+		switch n := n.(type) {
+		case *parse.ActionNode:
+			quotePipe(n.Pipe)
+		case *parse.IfNode:
+			quoteList(n.List)
+			quoteList(n.ElseList)
+		case *parse.RangeNode:
+			quoteList(n.List)
+			quoteList(n.ElseList)
+		case *parse.WithNode:
+			quoteList(n.List)
+			quoteList(n.ElseList)
+		}
+	}
+}
+
+// quotePipe appends the quoting function to p, unless it produces no
+// output or its value is already passed to raw.
+func quotePipe(p *parse.PipeNode) {
+	if len(p.Decl) > 0 || len(p.Cmds) == 0 {
+		return
+	}
+	last := p.Cmds[len(p.Cmds)-1]
+	if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && ident.Ident == rawFunc {
+		return
+	}
+	p.Cmds = append(p.Cmds, &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      p.Pos,
+		Args:     []parse.Node{parse.NewIdentifier(quoteFunc).SetPos(p.Pos)},
+	})
+}
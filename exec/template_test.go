@@ -0,0 +1,97 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"runtime"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type templateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&templateSuite{})
+
+func (*templateSuite) TestWith(c *gc.C) {
+	tmpl := exec.Command("apt-get install -y {{.Package}}").Quoting(exec.QuotePOSIX)
+	line, err := tmpl.With(map[string]string{"Package": "foo; rm -rf /"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(line, gc.Equals, `apt-get install -y 'foo; rm -rf /'`)
+}
+
+func (*templateSuite) TestControlStructures(c *gc.C) {
+	tmpl := exec.Command(`{{if .Force}}rm -f {{else}}rm {{end}}{{range .Files}}{{.}} {{end}}{{with .Dir}}-- {{.}}{{end}}`).Quoting(exec.QuotePOSIX)
+	line, err := tmpl.With(map[string]interface{}{
+		"Force": true,
+		"Files": []string{"a b", "$c"},
+		"Dir":   "it's",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(line, gc.Equals, `rm -f 'a b' '$c' -- 'it'"'"'s'`)
+}
+
+func (*templateSuite) TestSliceAndNonString(c *gc.C) {
+	tmpl := exec.Command("tar {{.Args}} -n {{.Count}} {{printf \"%s*\" .Prefix}}").Quoting(exec.QuotePOSIX)
+	line, err := tmpl.With(struct {
+		Args   []string
+		Count  int
+		Prefix string
+	}{[]string{"-x", "my file"}, 3, "a"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(line, gc.Equals, `tar -x 'my file' -n 3 'a*'`)
+}
+
+func (*templateSuite) TestRaw(c *gc.C) {
+	tmpl := exec.Command("ls {{raw .Options}} {{.Dir | raw}} {{.Dir}}").Quoting(exec.QuotePOSIX)
+	line, err := tmpl.With(map[string]string{"Options": "-l -a", "Dir": "$HOME"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(line, gc.Equals, `ls -l -a $HOME '$HOME'`)
+}
+
+func (*templateSuite) TestVariables(c *gc.C) {
+	tmpl := exec.Command("{{$x := .X}}echo {{$x}}").Quoting(exec.QuotePowerShell)
+	line, err := tmpl.With(map[string]string{"X": "it's"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(line, gc.Equals, `echo 'it''s'`)
+}
+
+func (*templateSuite) TestEmptySlice(c *gc.C) {
+	line, err := exec.Command("ls {{.}}").Quoting(exec.QuotePOSIX).With([]string{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(line, gc.Equals, "ls ")
+}
+
+func (*templateSuite) TestDefaultQuoting(c *gc.C) {
+	line, err := exec.Command("echo {{.}}").With("a b")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(line, gc.Equals, `echo 'a b'`)
+}
+
+func (*templateSuite) TestMissingKey(c *gc.C) {
+	_, err := exec.Command("echo {{.Missing}}").With(map[string]string{})
+	c.Assert(err, gc.ErrorMatches, `cannot render command template: .*map has no entry for key "Missing"`)
+}
+
+func (*templateSuite) TestParseError(c *gc.C) {
+	_, err := exec.ParseCommand("echo {{.X")
+	c.Assert(err, gc.ErrorMatches, "cannot parse command template: .*")
+	c.Assert(func() { exec.Command("echo {{.X") }, gc.PanicMatches, "cannot parse command template: .*")
+}
+
+func (*templateSuite) TestRun(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("POSIX shell not available")
+	}
+	line, err := exec.Command("printf '[%s]' {{.}}").With([]string{"a b", "$HOME", "`id`"})
+	c.Assert(err, jc.ErrorIsNil)
+	resp, err := exec.RunCommands(exec.RunParams{Commands: line})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "[a b][$HOME][`id`]")
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/juju/utils"
+)
+
+// Tracer creates tracing spans for the commands run by the package.
+// See SetTracer and the otelexec package.
+type Tracer interface {
+	// StartCommand starts a span for a command that is about to be
+	// started, as a child of any span found in ctx. The command line
+	// has had RunParams.Redactions applied. It returns the span and
+	// any environment variables, in "name=value" form, that pass the
+	// trace context on to the command, such as TRACEPARENT.
+	StartCommand(ctx context.Context, command string) (span CommandSpan, env []string)
+}
+
+// CommandSpan is a span started by a Tracer.
+type CommandSpan interface {
+	// End ends the span once the command has been waited for, with
+	// the response and error returned by Wait, which have had any
+	// redactions applied. The response is nil if the command could
+	// not be started, or was started with Detach, in which case the
+	// span ends once it has started.
+	End(resp *ExecResponse, err error)
+}
+
+var (
+	tracerMutex sync.Mutex
+	tracer      Tracer
+)
+
+// SetTracer sets the tracer used for every command run by the
+// package, and returns the previous one. A nil tracer disables
+// tracing. Commands run with DryRun are not traced.
+func SetTracer(t Tracer) Tracer {
+	tracerMutex.Lock()
+	defer tracerMutex.Unlock()
+	previous := tracer
+	tracer = t
+	return previous
+}
+
+// startSpan starts a span for r, if tracing is enabled, and returns
+// env with the variables that propagate its trace context added.
+func (r *RunParams) startSpan(env []string) []string {
+	r.span = nil
+	tracerMutex.Lock()
+	t := tracer
+	tracerMutex.Unlock()
+	if t == nil || r.DryRun {
+		return env
+	}
+	ctx := r.TraceContext
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	command := r.Commands
+	if len(r.Args) > 0 {
+		command = utils.CommandString(r.Args...)
+	}
+	span, traceEnv := t.StartCommand(ctx, r.redact(command))
+	r.span = span
+	if len(traceEnv) == 0 {
+		return env
+	}
+	if env == nil {
+		env = os.Environ()
+	}
+	return mergeEnvironment(env, traceEnv)
+}
+
+// endSpan ends r's span, if it has one.
+func (r *RunParams) endSpan(result *ExecResponse, err error) {
+	if r.span != nil {
+		r.span.End(result, err)
+		r.span = nil
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type traceSuite struct {
+	testing.IsolationSuite
+	tracer *fakeTracer
+}
+
+var _ = gc.Suite(&traceSuite{})
+
+func (s *traceSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.tracer = &fakeTracer{}
+	previous := exec.SetTracer(s.tracer)
+	s.AddCleanup(func(*gc.C) { exec.SetTracer(previous) })
+}
+
+type traceKey struct{}
+
+type fakeTracer struct {
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) StartCommand(ctx context.Context, command string) (exec.CommandSpan, []string) {
+	parent, _ := ctx.Value(traceKey{}).(string)
+	span := &fakeSpan{parent: parent, command: command}
+	t.spans = append(t.spans, span)
+	return span, []string{"TRACEPARENT=00-trace-" + parent}
+}
+
+type fakeSpan struct {
+	parent  string
+	command string
+	ended   bool
+	resp    *exec.ExecResponse
+	err     error
+}
+
+func (s *fakeSpan) End(resp *exec.ExecResponse, err error) {
+	s.ended = true
+	s.resp = resp
+	s.err = err
+}
+
+func (s *traceSuite) TestSpan(c *gc.C) {
+	ctx := context.WithValue(context.Background(), traceKey{}, "parent")
+	resp, err := exec.RunCommandsContext(ctx, exec.RunParams{
+		Commands:   "echo $TRACEPARENT; exit 2 # secret",
+		Redactions: []*regexp.Regexp{exec.RedactString("secret")},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "00-trace-parent\n")
+	c.Assert(s.tracer.spans, gc.HasLen, 1)
+	span := s.tracer.spans[0]
+	c.Assert(span.parent, gc.Equals, "parent")
+	c.Assert(span.command, gc.Equals, "echo $TRACEPARENT; exit 2 # "+exec.Redacted)
+	c.Assert(span.ended, jc.IsTrue)
+	c.Assert(span.resp, gc.Equals, resp)
+	c.Assert(span.err, jc.ErrorIsNil)
+}
+
+func (s *traceSuite) TestTraceContext(c *gc.C) {
+	run := exec.RunParams{
+		Args:         []string{"/bin/sh", "-c", "echo $TRACEPARENT"},
+		Environment:  []string{"FOO=bar"},
+		TraceContext: context.WithValue(context.Background(), traceKey{}, "explicit"),
+	}
+	err := run.Run()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.tracer.spans, gc.HasLen, 1)
+	span := s.tracer.spans[0]
+	c.Assert(span.command, gc.Equals, `/bin/sh -c "echo \$TRACEPARENT"`)
+	c.Assert(span.ended, jc.IsFalse)
+	resp, err := run.Wait()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "00-trace-explicit\n")
+	c.Assert(span.ended, jc.IsTrue)
+}
+
+func (s *traceSuite) TestStartFailure(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Args: []string{"/non/existent"},
+	})
+	c.Assert(err, gc.NotNil)
+	c.Assert(s.tracer.spans, gc.HasLen, 1)
+	span := s.tracer.spans[0]
+	c.Assert(span.ended, jc.IsTrue)
+	c.Assert(span.resp, gc.IsNil)
+	c.Assert(span.err, gc.ErrorMatches, ".*no such file or directory")
+}
+
+func (s *traceSuite) TestDryRun(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		DryRun:   true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.tracer.spans, gc.HasLen, 0)
+}
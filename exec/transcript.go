@@ -0,0 +1,110 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Stream tags used in transcripts.
+const (
+	StdoutTag = "OUT"
+	StderrTag = "ERR"
+)
+
+// transcript records the output of a command as a single sequence of
+// lines, each prefixed by the time elapsed since the command started
+// and the stream it was written to:
+//
+//	[  0.000512] OUT starting
+//	[  1.203771] ERR warning: something happened
+type transcript struct {
+	mu        sync.Mutex
+	start     time.Time
+	w         io.Writer
+	writeErr  error
+	size      int
+	buf       []byte
+	truncated bool
+	streams   []*lineWriter
+}
+
+// newTranscript returns a transcript writing to w, if not nil, and
+// retaining up to size bytes of the most recent lines.
+func newTranscript(w io.Writer, size int) *transcript {
+	return &transcript{
+		start: time.Now(),
+		w:     w,
+		size:  size,
+	}
+}
+
+// stream returns a writer that records lines written to it with the
+// given tag.
+func (t *transcript) stream(tag string) *lineWriter {
+	lw := newLineWriter(func(line []byte) {
+		t.add(tag, line)
+	})
+	t.mu.Lock()
+	t.streams = append(t.streams, lw)
+	t.mu.Unlock()
+	return lw
+}
+
+func (t *transcript) add(tag string, line []byte) {
+	// time.Since uses the monotonic clock, so timestamps are not
+	// disturbed by changes to the wall clock.
+	elapsed := time.Since(t.start).Seconds()
+	entry := []byte(fmt.Sprintf("[%10.6f] %s %s\n", elapsed, tag, line))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w != nil && t.writeErr == nil {
+		if _, err := t.w.Write(entry); err != nil {
+			logger.Warningf("cannot write transcript: %v", err)
+			t.writeErr = err
+		}
+	}
+	if t.size <= 0 {
+		return
+	}
+	t.buf = append(t.buf, entry...)
+	// Only trim once the buffer is well over size so that the cost of
+	// copying is amortised.
+	if len(t.buf) > 2*t.size {
+		t.trim()
+	}
+}
+
+// trim discards whole lines from the start of the buffer until it fits
+// within size.
+func (t *transcript) trim() {
+	if len(t.buf) <= t.size {
+		return
+	}
+	t.truncated = true
+	excess := t.buf[len(t.buf)-t.size:]
+	if i := bytes.IndexByte(excess, '\n'); i >= 0 && i+1 < len(excess) {
+		excess = excess[i+1:]
+	}
+	t.buf = append([]byte(nil), excess...)
+}
+
+// finish flushes any partial lines and returns the retained part of
+// the transcript and whether earlier lines were discarded.
+func (t *transcript) finish() ([]byte, bool) {
+	t.mu.Lock()
+	streams := t.streams
+	t.mu.Unlock()
+	for _, s := range streams {
+		s.Flush()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trim()
+	return t.buf, t.truncated
+}
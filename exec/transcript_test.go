@@ -0,0 +1,69 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type transcriptSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&transcriptSuite{})
+
+func (s *transcriptSuite) SetUpSuite(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("transcript tests use bash syntax")
+	}
+	s.IsolationSuite.SetUpSuite(c)
+}
+
+func (*transcriptSuite) TestTranscript(c *gc.C) {
+	var buf bytes.Buffer
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:       "echo one\nsleep 0.1\necho two >&2\nprintf partial",
+		Transcript:     &buf,
+		TranscriptSize: 1024,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result.Stdout), gc.Equals, "one\npartial")
+	c.Assert(string(result.Stderr), gc.Equals, "two\n")
+	c.Assert(string(result.Transcript), gc.Equals, buf.String())
+	c.Assert(result.TranscriptTruncated, jc.IsFalse)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	c.Assert(lines, gc.HasLen, 3)
+	c.Assert(lines[0], gc.Matches, `\[ +0\.\d{6}\] OUT one`)
+	c.Assert(lines[1], gc.Matches, `\[ +0\.[1-9]\d{5}\] ERR two`)
+	c.Assert(lines[2], gc.Matches, `\[ +\d+\.\d{6}\] OUT partial`)
+}
+
+func (*transcriptSuite) TestTranscriptSizeCap(c *gc.C) {
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:       "for i in $(seq 1 100); do echo line $i; done",
+		TranscriptSize: 100,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.TranscriptTruncated, jc.IsTrue)
+	c.Assert(len(result.Transcript) <= 100, jc.IsTrue)
+	c.Assert(string(result.Transcript), jc.HasSuffix, "] OUT line 100\n")
+	c.Assert(string(result.Transcript), gc.Matches, `(?s)\[.*`)
+}
+
+func (*transcriptSuite) TestNoTranscriptByDefault(c *gc.C) {
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo hello",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Transcript, gc.IsNil)
+}
@@ -0,0 +1,26 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// validateUmask returns an error if mask is not a valid file mode
+// creation mask.
+func validateUmask(mask os.FileMode) error {
+	if mask&^os.ModePerm != 0 {
+		return errors.NotValidf("umask %#o", uint32(mask))
+	}
+	return nil
+}
+
+// umaskString returns mask in the octal form taken by the umask shell
+// builtin.
+func umaskString(mask os.FileMode) string {
+	return fmt.Sprintf("%04o", uint32(mask))
+}
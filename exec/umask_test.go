@@ -0,0 +1,63 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type umaskSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&umaskSuite{})
+
+func umask(mask os.FileMode) *os.FileMode {
+	return &mask
+}
+
+func (*umaskSuite) TestUmask(c *gc.C) {
+	dir := c.MkDir()
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:   "umask; touch file; mkdir dir",
+		Umask:      umask(0027),
+		WorkingDir: dir,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "0027\n")
+	info, err := os.Stat(filepath.Join(dir, "file"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0640))
+	info, err = os.Stat(filepath.Join(dir, "dir"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0750))
+}
+
+func (*umaskSuite) TestZeroUmask(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Args:  []string{"/bin/sh", "-c", "umask"},
+		Umask: umask(0),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "0000\n")
+}
+
+func (*umaskSuite) TestUmaskNotValid(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		Umask:    umask(01022),
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, "umask 01022 not valid")
+}
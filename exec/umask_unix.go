@@ -0,0 +1,31 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/juju/errors"
+)
+
+// umaskCommand rewrites cmd so that it runs with the given file mode
+// creation mask. A shell sets the mask before executing the command,
+// so that the agent's own mask, which is shared by all its threads,
+// is never changed.
+func umaskCommand(cmd *exec.Cmd, mask os.FileMode) error {
+	if err := validateUmask(mask); err != nil {
+		return errors.Trace(err)
+	}
+	if cmd.Err != nil {
+		return nil
+	}
+	script := "umask " + umaskString(mask) + ` || exit 126; exec "$@"`
+	argv := append([]string{cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	cmd.Args = append([]string{"/bin/sh", "-c", script, "sh"}, argv...)
+	return nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/juju/errors"
+)
+
+// umaskCommand returns an error satisfying errors.IsNotSupported, as
+// Windows has no file mode creation mask.
+func umaskCommand(cmd *exec.Cmd, mask os.FileMode) error {
+	if err := validateUmask(mask); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.NotSupportedf("umask on windows")
+}
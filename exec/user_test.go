@@ -0,0 +1,69 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"os"
+	"os/user"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type userSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&userSuite{})
+
+func requireRoot(c *gc.C) {
+	if os.Getuid() != 0 {
+		c.Skip("test must be run as root")
+	}
+}
+
+func (*userSuite) TestRunAsUser(c *gc.C) {
+	requireRoot(c)
+	u, err := user.Lookup("nobody")
+	if err != nil {
+		c.Skip("no nobody user")
+	}
+	for _, name := range []string{"nobody", u.Uid} {
+		resp, err := exec.RunCommands(exec.RunParams{
+			Commands: "id -u; id -g",
+			User:     name,
+		})
+		c.Assert(err, gc.IsNil)
+		c.Check(string(resp.Stderr), gc.Equals, "")
+		c.Check(string(resp.Stdout), gc.Equals, u.Uid+"\n"+u.Gid+"\n")
+	}
+}
+
+func (*userSuite) TestRunAsGroup(c *gc.C) {
+	requireRoot(c)
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "id -u; id -g",
+		Group:    "1",
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "0\n1\n")
+}
+
+func (*userSuite) TestUnknownUser(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		User:     "no-such-user-here",
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot find user "no-such-user-here": .*`)
+
+	_, err = exec.RunCommands(exec.RunParams{
+		Commands: "true",
+		Group:    "no-such-group-here",
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot find group "no-such-group-here": .*`)
+}
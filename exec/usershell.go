@@ -0,0 +1,114 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// passwdFile is the user database consulted when $SHELL is not set.
+var passwdFile = "/etc/passwd"
+
+// UserShellOptions holds options for UserShell.
+type UserShellOptions struct {
+	// Login runs the shell as a login shell, so that it reads the
+	// user's profile and sets up $PATH as an interactive login
+	// would.
+	Login bool
+
+	// RCFile, if set, names a file that the shell sources before the
+	// commands are run.
+	RCFile string
+}
+
+// UserShell returns an interpreter that runs commands with the shell
+// configured for the invoking user: the shell named by $SHELL or, if
+// that is not set, the login shell recorded in the user database. If
+// neither is available, /bin/sh is used.
+//
+// Bash, zsh, fish and POSIX shells are supported; the commands must be
+// written in the language of whichever shell is found. UserShell is not
+// supported on Windows.
+func UserShell(opts UserShellOptions) (*Interpreter, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.NotSupportedf("user shell on windows")
+	}
+	shell, err := userShellPath()
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot determine user shell")
+	}
+	i := &Interpreter{Path: shell}
+	name := filepath.Base(shell)
+	if opts.Login {
+		i.Args = append(i.Args, "-l")
+	}
+	// Fish reads its script from stdin when it is given none;
+	// other shells need -s to do so reliably.
+	if name != "fish" {
+		i.Args = append(i.Args, "-s")
+	}
+	if opts.RCFile != "" {
+		if _, err := os.Stat(opts.RCFile); err != nil {
+			return nil, errors.Annotate(err, "cannot use rc file")
+		}
+		if strings.ContainsAny(opts.RCFile, "'\n") {
+			return nil, errors.NotValidf("rc file name %q", opts.RCFile)
+		}
+		source := "source"
+		switch name {
+		case "bash", "zsh", "fish", "ksh", "mksh":
+		default:
+			// POSIX shells such as dash only know ".".
+			source = "."
+		}
+		i.Prelude = source + " '" + opts.RCFile + "'\n"
+	}
+	return i, nil
+}
+
+func userShellPath() (string, error) {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	shell, err := passwdShell(u.Username)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return shell, nil
+}
+
+// passwdShell returns the login shell recorded for the named user in
+// passwdFile, or "" if there is none.
+func passwdShell(username string) (string, error) {
+	f, err := os.Open(passwdFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) == 7 && fields[0] == username {
+			return fields[6], nil
+		}
+	}
+	return "", errors.Trace(scanner.Err())
+}
@@ -0,0 +1,94 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	utilsexec "github.com/juju/utils/exec"
+)
+
+type userShellSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&userShellSuite{})
+
+func (s *userShellSuite) TestShellFromEnvironment(c *gc.C) {
+	s.PatchEnvironment("SHELL", "/usr/bin/zsh")
+	i, err := utilsexec.UserShell(utilsexec.UserShellOptions{Login: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(i, jc.DeepEquals, &utilsexec.Interpreter{
+		Path: "/usr/bin/zsh",
+		Args: []string{"-l", "-s"},
+	})
+
+	s.PatchEnvironment("SHELL", "/usr/local/bin/fish")
+	i, err = utilsexec.UserShell(utilsexec.UserShellOptions{Login: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(i.Args, jc.DeepEquals, []string{"-l"})
+}
+
+func (s *userShellSuite) TestShellFromPasswd(c *gc.C) {
+	u, err := user.Current()
+	c.Assert(err, gc.IsNil)
+	passwd := filepath.Join(c.MkDir(), "passwd")
+	entries := fmt.Sprintf("other:x:1:1::/home/other:/bin/false\n%s:x:1000:1000::/home/x:/bin/dash\n", u.Username)
+	c.Assert(ioutil.WriteFile(passwd, []byte(entries), 0644), gc.IsNil)
+	s.PatchValue(utilsexec.PasswdFile, passwd)
+	s.PatchEnvironment("SHELL", "")
+
+	i, err := utilsexec.UserShell(utilsexec.UserShellOptions{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(i.Path, gc.Equals, "/bin/dash")
+	c.Assert(i.Args, jc.DeepEquals, []string{"-s"})
+
+	s.PatchValue(utilsexec.PasswdFile, filepath.Join(c.MkDir(), "missing"))
+	i, err = utilsexec.UserShell(utilsexec.UserShellOptions{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(i.Path, gc.Equals, "/bin/sh")
+}
+
+func (s *userShellSuite) TestRCFile(c *gc.C) {
+	rc := filepath.Join(c.MkDir(), "rc")
+	c.Assert(ioutil.WriteFile(rc, []byte("GREETING=hello\n"), 0644), gc.IsNil)
+	for _, shell := range []string{"bash", "dash"} {
+		path, err := exec.LookPath(shell)
+		if err != nil {
+			c.Logf("skipping %s: not installed", shell)
+			continue
+		}
+		c.Logf("shell %s", shell)
+		s.PatchEnvironment("SHELL", path)
+		i, err := utilsexec.UserShell(utilsexec.UserShellOptions{Login: true, RCFile: rc})
+		c.Assert(err, gc.IsNil)
+		result, err := utilsexec.RunCommands(utilsexec.RunParams{
+			Commands:    "echo $GREETING\n",
+			Interpreter: i,
+		})
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(result.Stdout), gc.Equals, "hello\n")
+	}
+}
+
+func (s *userShellSuite) TestRCFileErrors(c *gc.C) {
+	s.PatchEnvironment("SHELL", "/bin/bash")
+	_, err := utilsexec.UserShell(utilsexec.UserShellOptions{RCFile: "/no/such/rc"})
+	c.Assert(err, gc.ErrorMatches, "cannot use rc file: .*")
+
+	rc := filepath.Join(c.MkDir(), "it's")
+	c.Assert(ioutil.WriteFile(rc, nil, 0644), gc.IsNil)
+	_, err = utilsexec.UserShell(utilsexec.UserShellOptions{RCFile: rc})
+	c.Assert(err, gc.ErrorMatches, `rc file name ".*" not valid`)
+}
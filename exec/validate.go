@@ -0,0 +1,142 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/validate"
+)
+
+func init() {
+	mustRegister(RunParams{}, validate.Rules{
+		"EnvironmentMode": {validate.OneOf(InheritEnvironment, ReplaceEnvironment)},
+		"OutputWrite":     {validate.OneOf(ReplaceOutput, TruncateOutput, AppendOutput)},
+		"Capture":         {validate.OneOf(CaptureSeparate, CaptureCombined, CaptureBoth)},
+		"OutputFileMode":  {validate.Func(permissionsOnly)},
+	})
+	mustRegister(RetryPolicy{}, validate.Rules{
+		"MaxAttempts": {validate.Func(nonNegative)},
+		"Delay":       {validate.Func(nonNegative)},
+		"Backoff":     {validate.Func(nonNegative)},
+		"MaxDelay":    {validate.Func(nonNegative)},
+	})
+}
+
+func mustRegister(prototype interface{}, rules validate.Rules) {
+	if err := validate.Register(prototype, rules); err != nil {
+		panic(err)
+	}
+}
+
+// permissionsOnly checks that a file mode holds only permission bits.
+func permissionsOnly(value interface{}) error {
+	if mode := value.(os.FileMode); mode&^os.ModePerm != 0 {
+		return fmt.Errorf("mode %v has bits other than permissions", mode)
+	}
+	return nil
+}
+
+// nonNegative checks that a number is not negative.
+func nonNegative(value interface{}) error {
+	var negative bool
+	switch v := value.(type) {
+	case int:
+		negative = v < 0
+	case float64:
+		negative = v < 0
+	case time.Duration:
+		negative = v < 0
+	}
+	if negative {
+		return fmt.Errorf("value %v is negative", value)
+	}
+	return nil
+}
+
+// checkFields returns the violations of the rules registered for the
+// fields of RunParams and of the option types it holds. Only these are
+// checked, rather than every value reachable from r, so that values
+// owned by the caller, such as Stdin and Clock, are never inspected.
+func (r *RunParams) checkFields() validate.Errors {
+	var violations validate.Errors
+	add := func(field string, err error) {
+		if errs, ok := err.(validate.Errors); ok {
+			for _, v := range errs {
+				if field != "" {
+					v.Field = field + "." + v.Field
+				}
+				violations = append(violations, v)
+			}
+		} else if err != nil {
+			violations = append(violations, validate.Violation{Field: field, Message: err.Error()})
+		}
+	}
+	add("", validate.Fields(r))
+	if r.Retry != nil {
+		add("Retry", validate.Fields(r.Retry))
+	}
+	if r.Limits != nil {
+		add("Limits", r.Limits.Validate())
+	}
+	if r.Cgroup != nil {
+		add("Cgroup", r.Cgroup.Validate())
+	}
+	return violations
+}
+
+// validate checks the parameters against the rules registered for
+// RunParams and its option types, reporting every violation found, and
+// then checks that the options set can be used together.
+func (r *RunParams) validate() error {
+	if errs := r.checkFields(); len(errs) > 0 {
+		return errors.NewNotValid(errs, "invalid run parameters")
+	}
+	if len(r.Sequence) > 0 {
+		return errors.NotValidf("calling Run with Sequence")
+	}
+	if len(r.Args) > 0 && (r.Commands != "" || r.Interpreter != nil) {
+		return errors.NotValidf("setting Args with Commands or Interpreter")
+	}
+	if len(r.Args) > 0 && r.ScriptFile {
+		return errors.NotValidf("setting Args with ScriptFile")
+	}
+	if r.Path != "" && len(r.Args) == 0 {
+		return errors.NotValidf("setting Path without Args")
+	}
+	if r.Heartbeat != nil {
+		if err := r.Heartbeat.validate(); err != nil {
+			return err
+		}
+	}
+	if r.Elevate && (r.User != "" || r.Group != "") {
+		return errors.NotValidf("setting Elevate with User or Group")
+	}
+	if r.Chroot != "" {
+		switch {
+		case r.Elevate:
+			return errors.NotValidf("setting Chroot with Elevate")
+		case r.ScriptFile:
+			return errors.NotValidf("setting Chroot with ScriptFile")
+		case r.Limits != nil:
+			return errors.NotValidf("setting Chroot with Limits")
+		case r.Umask != nil:
+			return errors.NotValidf("setting Chroot with Umask")
+		}
+	}
+	if r.Stdout != nil && r.StdoutPath != "" {
+		return errors.NotValidf("setting both Stdout and StdoutPath")
+	}
+	if r.Stderr != nil && r.StderrPath != "" {
+		return errors.NotValidf("setting both Stderr and StderrPath")
+	}
+	if r.Detach {
+		return r.validateDetach()
+	}
+	return nil
+}
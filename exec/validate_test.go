@@ -0,0 +1,49 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type validateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&validateSuite{})
+
+func (*validateSuite) TestAllViolations(c *gc.C) {
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:       "echo not run",
+		OutputWrite:    exec.OutputWriteMode(7),
+		OutputFileMode: os.ModeSetuid | 0755,
+		Retry: &exec.RetryPolicy{
+			MaxAttempts: 3,
+			Delay:       -time.Second,
+		},
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, "invalid run parameters: "+
+		"OutputWrite: value 7 not one of 0, 1, 2; "+
+		"OutputFileMode: mode urwxr-xr-x has bits other than permissions; "+
+		"Retry.Delay: value -1s is negative")
+}
+
+func (*validateSuite) TestValid(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:    "echo ok",
+		OutputWrite: exec.AppendOutput,
+		Retry:       &exec.RetryPolicy{MaxAttempts: 2},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "ok\n")
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrmexec
+
+import (
+	"sync"
+
+	"github.com/juju/utils/ioutils"
+)
+
+// capture holds the output of a command in memory, keeping at most max
+// bytes, if max is positive, as exec.RunParams.MaxOutputBytes
+// describes. Unlike ioutils.LimitedBuffer, it may be read while it is
+// being written.
+type capture struct {
+	mu  sync.Mutex
+	buf *ioutils.LimitedBuffer
+}
+
+func newCapture(max int, keepTail bool) *capture {
+	return &capture{buf: ioutils.NewLimitedBuffer(max, keepTail)}
+}
+
+// Write implements io.Writer.
+func (c *capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+func (c *capture) bytes() ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Bytes()
+}
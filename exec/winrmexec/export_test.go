@@ -0,0 +1,8 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrmexec
+
+type Client = client
+
+var NewClient = &newClient
@@ -0,0 +1,70 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrmexec
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/exec"
+)
+
+// redactions returns the patterns masked for run, as they are by the
+// exec package.
+func redactions(run *exec.RunParams) []*regexp.Regexp {
+	patterns := append([]*regexp.Regexp(nil), run.Redactions...)
+	for _, name := range run.RedactEnv {
+		for _, kv := range run.Environment {
+			if strings.HasPrefix(kv, name+"=") && len(kv) > len(name)+1 {
+				patterns = append(patterns, exec.RedactString(kv[len(name)+1:]))
+			}
+		}
+	}
+	return patterns
+}
+
+// redact masks the text matched by run's redactions in s.
+func redact(run *exec.RunParams, s string) string {
+	for _, re := range redactions(run) {
+		s = re.ReplaceAllLiteralString(s, exec.Redacted)
+	}
+	return s
+}
+
+// redactError returns err with run's redactions masked in its message,
+// keeping its cause.
+func redactError(run *exec.RunParams, err error) error {
+	if err == exec.ErrTimedOut || err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	msg := redact(run, err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// redactedError is an error whose message has been redacted.
+type redactedError struct {
+	msg string
+	err error
+}
+
+// Error implements error.
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Cause returns the cause of the original error, for errors.Cause.
+func (e *redactedError) Cause() error {
+	return errors.Cause(e.err)
+}
+
+// Unwrap returns the original error, whose message is not redacted.
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,256 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package winrmexec runs commands described by exec.RunParams on
+// remote Windows machines with WinRM.
+package winrmexec
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/juju/errors"
+	"github.com/masterzen/winrm"
+
+	"github.com/juju/utils/exec"
+)
+
+// Runner is an exec.Runner that runs commands on a remote Windows
+// machine over WinRM, authenticating with a user name and password.
+//
+// Commands are run by Windows PowerShell, reading them from standard
+// input with the same wrapping as exec.PowerShell uses locally, so
+// that the exit code is that of the last native command run, or 1 if
+// the script throws an error. Args are run with the PowerShell call
+// operator. Stdin, Environment, WorkingDir, Stdout, Stderr, Timeout,
+// MaxOutputBytes, KeepOutputTail, Redactions, RedactEnv and
+// RedactOutput are supported, with the same meaning as they have
+// locally; setting any other field of exec.RunParams is an error
+// satisfying errors.IsNotSupported. The hooks, metrics, tracer and
+// auditor of the exec package are not applied.
+type Runner struct {
+	// Host holds the name or address of the remote machine.
+	Host string
+
+	// Port holds the port of the WinRM service. If zero, 5985 is
+	// used, or 5986 with HTTPS.
+	Port int
+
+	// HTTPS causes the connection to use TLS, verifying the server's
+	// certificate against CACert, if set, or the system roots, unless
+	// Insecure is set.
+	HTTPS    bool
+	Insecure bool
+	CACert   []byte
+
+	// User and Password hold the credentials used to log in.
+	User     string
+	Password string
+
+	// ConnectTimeout, if positive, bounds the time taken by each
+	// request to the WinRM service.
+	ConnectTimeout time.Duration
+}
+
+var _ exec.Runner = (*Runner)(nil)
+
+// client is the part of *winrm.Client used by Runner.
+type client interface {
+	RunWithContextWithInput(ctx context.Context, command string, stdout, stderr io.Writer, stdin io.Reader) (int, error)
+}
+
+// newClient returns a client for the WinRM service described by r.
+// It is a variable so that tests can avoid connecting.
+var newClient = func(r *Runner) (client, error) {
+	port := r.Port
+	if port == 0 {
+		port = 5985
+		if r.HTTPS {
+			port = 5986
+		}
+	}
+	endpoint := winrm.NewEndpoint(r.Host, port, r.HTTPS, r.Insecure, r.CACert, nil, nil, r.ConnectTimeout)
+	return winrm.NewClient(endpoint, r.User, r.Password)
+}
+
+// supported holds the names of the fields of exec.RunParams that
+// Runner supports.
+var supported = map[string]bool{
+	"Commands":       true,
+	"Args":           true,
+	"Stdin":          true,
+	"Environment":    true,
+	"WorkingDir":     true,
+	"Stdout":         true,
+	"Stderr":         true,
+	"Timeout":        true,
+	"MaxOutputBytes": true,
+	"KeepOutputTail": true,
+	"Redactions":     true,
+	"RedactEnv":      true,
+	"RedactOutput":   true,
+}
+
+// checkSupported returns an error naming the first field of run that
+// is set but not supported.
+func checkSupported(run *exec.RunParams) error {
+	v := reflect.ValueOf(run).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || supported[field.Name] {
+			continue
+		}
+		if !v.Field(i).IsZero() {
+			return errors.NotSupportedf("%s with WinRM", field.Name)
+		}
+	}
+	return nil
+}
+
+// RunCommands implements exec.Runner.
+func (r *Runner) RunCommands(run exec.RunParams) (*exec.ExecResponse, error) {
+	return r.RunCommandsContext(context.Background(), run)
+}
+
+// RunCommandsContext is like RunCommands, but stops the command if ctx
+// is done before it exits, returning the output received so far along
+// with ctx.Err().
+func (r *Runner) RunCommandsContext(ctx context.Context, run exec.RunParams) (*exec.ExecResponse, error) {
+	resp, err := r.run(ctx, &run)
+	if err != nil {
+		err = redactError(&run, err)
+	}
+	if resp != nil && run.RedactOutput {
+		resp.Stdout = []byte(redact(&run, string(resp.Stdout)))
+		resp.Stderr = []byte(redact(&run, string(resp.Stderr)))
+	}
+	return resp, err
+}
+
+func (r *Runner) run(ctx context.Context, run *exec.RunParams) (*exec.ExecResponse, error) {
+	if r.Host == "" {
+		return nil, errors.NotValidf("empty host")
+	}
+	if err := checkSupported(run); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(run.Args) > 0 && run.Commands != "" {
+		return nil, errors.NotValidf("setting Args with Commands")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c, err := newClient(r)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot connect to %s", r.Host)
+	}
+	command, stdin := remoteCommand(run)
+
+	resp := &exec.ExecResponse{
+		Shell:    exec.PowerShell.Path,
+		Attempts: 1,
+	}
+	if len(run.Args) > 0 {
+		resp.Shell = ""
+	}
+	runCtx := ctx
+	if run.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, run.Timeout)
+		defer cancel()
+	}
+	stdout := newCapture(run.MaxOutputBytes, run.KeepOutputTail)
+	stderr := newCapture(run.MaxOutputBytes, run.KeepOutputTail)
+	var stdoutW, stderrW io.Writer = stdout, stderr
+	if run.Stdout != nil {
+		stdoutW = run.Stdout
+	}
+	if run.Stderr != nil {
+		stderrW = run.Stderr
+	}
+	resp.StartTime = time.Now()
+	code, err := c.RunWithContextWithInput(runCtx, command, stdoutW, stderrW, stdin)
+	resp.Duration = time.Since(resp.StartTime)
+	resp.Stdout, resp.StdoutTruncated = stdout.bytes()
+	resp.Stderr, resp.StderrTruncated = stderr.bytes()
+	switch {
+	case ctx.Err() != nil:
+		return resp, ctx.Err()
+	case runCtx.Err() != nil:
+		return resp, exec.ErrTimedOut
+	case err != nil:
+		return resp, errors.Annotatef(err, "cannot run command on %s", r.Host)
+	}
+	resp.Code = code
+	return resp, nil
+}
+
+// remoteCommand returns the command line run on the remote machine
+// for run, and its standard input.
+func remoteCommand(run *exec.RunParams) (string, io.Reader) {
+	var script strings.Builder
+	for _, kv := range run.Environment {
+		name, value := kv, ""
+		if i := strings.Index(kv, "="); i >= 0 {
+			name, value = kv[:i], kv[i+1:]
+		}
+		script.WriteString("${env:" + name + "} = " + quoteString(value) + "\n")
+	}
+	if run.WorkingDir != "" {
+		script.WriteString("Set-Location -LiteralPath " + quoteString(run.WorkingDir) + "\n")
+	}
+	stdin := run.Stdin
+	if len(run.Args) > 0 {
+		script.WriteString(exec.QuotePowerShell(run.Args...) + "\nexit $LastExitCode\n")
+	} else {
+		// The commands are read from standard input, as they are by
+		// exec.PowerShell, whose script is its last argument.
+		args := exec.PowerShell.Args
+		script.WriteString(args[len(args)-1] + "\n")
+		commands := run.Commands
+		switch {
+		case stdin == nil:
+			stdin = strings.NewReader(commands)
+		case commands != "":
+			if !strings.HasSuffix(commands, "\n") {
+				commands += "\n"
+			}
+			stdin = io.MultiReader(strings.NewReader(commands), stdin)
+		}
+	}
+	return "powershell.exe -noprofile -noninteractive -encodedcommand " + encodeCommand(script.String()), stdin
+}
+
+// encodeCommand encodes script as PowerShell's -encodedcommand
+// option requires: base64 encoded UTF-16LE.
+func encodeCommand(script string) string {
+	var buf bytes.Buffer
+	for _, u := range utf16.Encode([]rune(script)) {
+		binary.Write(&buf, binary.LittleEndian, u)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// quoteString returns s as a single-quoted PowerShell string, within
+// which nothing is expanded. PowerShell treats the typographic single
+// quotes as it does the ASCII one, so they are doubled too.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		if strings.ContainsRune("'\u2018\u2019\u201a\u201b", r) {
+			b.WriteRune(r)
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
@@ -0,0 +1,197 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winrmexec_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/exec/winrmexec"
+)
+
+type winrmSuite struct {
+	testing.IsolationSuite
+	client *fakeClient
+	runner *winrmexec.Runner
+}
+
+var _ = gc.Suite(&winrmSuite{})
+
+func (s *winrmSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.client = &fakeClient{}
+	s.runner = &winrmexec.Runner{
+		Host:     "windows",
+		User:     "Administrator",
+		Password: "secret",
+	}
+	s.PatchValue(winrmexec.NewClient, func(r *winrmexec.Runner) (winrmexec.Client, error) {
+		c.Check(r, gc.Equals, s.runner)
+		return s.client, nil
+	})
+}
+
+// fakeClient records the command it is asked to run and its input,
+// and replies with the output and exit code it holds.
+type fakeClient struct {
+	command string
+	stdin   string
+	stdout  string
+	stderr  string
+	code    int
+	block   bool
+}
+
+func (f *fakeClient) RunWithContextWithInput(ctx context.Context, command string, stdout, stderr io.Writer, stdin io.Reader) (int, error) {
+	f.command = command
+	if stdin != nil {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return 0, err
+		}
+		f.stdin = string(data)
+	}
+	io.WriteString(stdout, f.stdout)
+	io.WriteString(stderr, f.stderr)
+	if f.block {
+		<-ctx.Done()
+		return 0, errors.Annotate(ctx.Err(), "http request failed")
+	}
+	return f.code, nil
+}
+
+// script returns the PowerShell script run by the fake.
+func (f *fakeClient) script(c *gc.C) string {
+	const prefix = "powershell.exe -noprofile -noninteractive -encodedcommand "
+	c.Assert(f.command, jc.HasPrefix, prefix)
+	data, err := base64.StdEncoding.DecodeString(f.command[len(prefix):])
+	c.Assert(err, jc.ErrorIsNil)
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func (s *winrmSuite) TestCommands(c *gc.C) {
+	s.client.stdout = "out\r\n"
+	s.client.stderr = "err\r\n"
+	s.client.code = 3
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Commands:    "Write-Output out",
+		Environment: []string{"FOO=it's"},
+		WorkingDir:  `C:\Program Files`,
+		Stdin:       strings.NewReader("input"),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 3)
+	c.Assert(string(resp.Stdout), gc.Equals, "out\r\n")
+	c.Assert(string(resp.Stderr), gc.Equals, "err\r\n")
+	c.Assert(resp.Shell, gc.Equals, "powershell.exe")
+	c.Assert(s.client.stdin, gc.Equals, "Write-Output out\ninput")
+	c.Assert(s.client.script(c), gc.Equals, "${env:FOO} = 'it''s'\n"+
+		"Set-Location -LiteralPath 'C:\\Program Files'\n"+
+		exec.PowerShell.Args[len(exec.PowerShell.Args)-1]+"\n")
+}
+
+func (s *winrmSuite) TestArgs(c *gc.C) {
+	_, err := s.runner.RunCommands(exec.RunParams{
+		Args: []string{`C:\Program Files\tool.exe`, "/all"},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.client.script(c), gc.Equals, "& 'C:\\Program Files\\tool.exe' /all\nexit $LastExitCode\n")
+	c.Assert(s.client.stdin, gc.Equals, "")
+}
+
+func (s *winrmSuite) TestStdoutWriter(c *gc.C) {
+	s.client.stdout = "out"
+	var stdout strings.Builder
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Commands: "Write-Output out",
+		Stdout:   &stdout,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(stdout.String(), gc.Equals, "out")
+	c.Assert(resp.Stdout, gc.HasLen, 0)
+}
+
+func (s *winrmSuite) TestMaxOutputBytes(c *gc.C) {
+	s.client.stdout = "0123456789"
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Commands:       "x",
+		MaxOutputBytes: 4,
+		KeepOutputTail: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "6789")
+	c.Assert(resp.StdoutTruncated, jc.IsTrue)
+}
+
+func (s *winrmSuite) TestTimeout(c *gc.C) {
+	s.client.stdout = "partial"
+	s.client.block = true
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Commands: "Start-Sleep 60",
+		Timeout:  10 * time.Millisecond,
+	})
+	c.Assert(err, gc.Equals, exec.ErrTimedOut)
+	c.Assert(string(resp.Stdout), gc.Equals, "partial")
+}
+
+func (s *winrmSuite) TestContext(c *gc.C) {
+	s.client.block = true
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	_, err := s.runner.RunCommandsContext(ctx, exec.RunParams{
+		Commands: "Start-Sleep 60",
+		Timeout:  time.Minute,
+	})
+	c.Assert(err, gc.Equals, context.Canceled)
+}
+
+func (s *winrmSuite) TestRedactOutput(c *gc.C) {
+	s.client.stdout = "token=hunter2"
+	resp, err := s.runner.RunCommands(exec.RunParams{
+		Commands:     "x",
+		Environment:  []string{"TOKEN=hunter2"},
+		RedactEnv:    []string{"TOKEN"},
+		RedactOutput: true,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "token="+exec.Redacted)
+}
+
+func (s *winrmSuite) TestNotSupported(c *gc.C) {
+	_, err := s.runner.RunCommands(exec.RunParams{
+		Commands:    "x",
+		Interpreter: &exec.Cmd,
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+	c.Assert(err, gc.ErrorMatches, "Interpreter with WinRM not supported")
+	c.Assert(s.client.command, gc.Equals, "")
+}
+
+func (s *winrmSuite) TestRedactError(c *gc.C) {
+	s.PatchValue(winrmexec.NewClient, func(r *winrmexec.Runner) (winrmexec.Client, error) {
+		return nil, errors.New("cannot log in with password secret")
+	})
+	_, err := s.runner.RunCommands(exec.RunParams{
+		Commands:   "x",
+		Redactions: []*regexp.Regexp{exec.RedactString("secret")},
+	})
+	c.Assert(err, gc.ErrorMatches, "cannot connect to windows: cannot log in with password "+regexp.QuoteMeta(exec.Redacted))
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+)
+
+// DirParams specifies how a missing working directory is created.
+type DirParams struct {
+	// Mode holds the permissions of the new directory. If zero, 0755
+	// is used.
+	Mode os.FileMode
+
+	// Owner and Group, if set, hold the user and group (by name or
+	// numeric ID) that will own the new directory. Setting ownership
+	// is not supported on Windows.
+	Owner string
+	Group string
+}
+
+// ensureWorkingDir checks that the working directory exists and is
+// usable, creating it first if r.CreateWorkingDir is set.
+func (r *RunParams) ensureWorkingDir() error {
+	if !r.EnsureWorkingDir && r.CreateWorkingDir == nil {
+		return nil
+	}
+	if r.WorkingDir == "" {
+		return nil
+	}
+	dir := r.hostPath(r.WorkingDir)
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) && r.CreateWorkingDir != nil {
+		if r.DryRun {
+			// The directory would be created.
+			return nil
+		}
+		if err := createDir(dir, *r.CreateWorkingDir); err != nil {
+			return errors.Annotatef(err, "cannot create working directory %q", r.WorkingDir)
+		}
+		info, err = os.Stat(dir)
+	}
+	if os.IsNotExist(err) {
+		return errors.NotFoundf("working directory %q", r.WorkingDir)
+	}
+	if err != nil {
+		return errors.Annotate(err, "cannot check working directory")
+	}
+	if !info.IsDir() {
+		return errors.Errorf("working directory %q is not a directory", r.WorkingDir)
+	}
+	if err := checkDirAccess(dir); err != nil {
+		return errors.Annotatef(err, "cannot use working directory %q", r.WorkingDir)
+	}
+	return nil
+}
+
+// createDir creates the directory at path, creating its parent if
+// necessary. The directory is created accessible only to the agent and
+// is given its final ownership and permissions before anyone else can
+// use it. If another process creates the directory concurrently, its
+// directory is used instead and left unchanged.
+func createDir(path string, params DirParams) error {
+	mode := params.Mode
+	if mode == 0 {
+		mode = 0755
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.Mkdir(path, 0700); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+	if err := setupDir(path, mode, params); err != nil {
+		os.Remove(path)
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// setupDir gives the new directory at path its ownership and mode.
+func setupDir(path string, mode os.FileMode, params DirParams) error {
+	if params.Owner != "" || params.Group != "" {
+		if err := chownDir(path, params.Owner, params.Group); err != nil {
+			return err
+		}
+	}
+	// Chmod explicitly so that the umask does not apply.
+	return os.Chmod(path, mode)
+}
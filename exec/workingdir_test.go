@@ -0,0 +1,81 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type workingDirSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&workingDirSuite{})
+
+func (*workingDirSuite) TestMissingWorkingDir(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "missing")
+	params := exec.RunParams{
+		Commands:         "exit 0",
+		WorkingDir:       dir,
+		EnsureWorkingDir: true,
+	}
+	err := params.Run()
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `working directory ".*missing" not found`)
+	c.Assert(params.Process(), gc.IsNil)
+}
+
+func (*workingDirSuite) TestWorkingDirNotDirectory(c *gc.C) {
+	file := filepath.Join(c.MkDir(), "file")
+	err := ioutil.WriteFile(file, nil, 0644)
+	c.Assert(err, gc.IsNil)
+	_, err = exec.RunCommands(exec.RunParams{
+		Commands:         "exit 0",
+		WorkingDir:       file,
+		EnsureWorkingDir: true,
+	})
+	c.Assert(err, gc.ErrorMatches, `working directory ".*file" is not a directory`)
+}
+
+func (*workingDirSuite) TestCreateWorkingDir(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "parent", "work")
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:   "exit 3",
+		WorkingDir: dir,
+		CreateWorkingDir: &exec.DirParams{
+			Mode: 0700,
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 3)
+	info, err := os.Stat(dir)
+	c.Assert(err, gc.IsNil)
+	c.Assert(info.IsDir(), jc.IsTrue)
+	if runtime.GOOS != "windows" {
+		c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0700))
+	}
+	entries, err := ioutil.ReadDir(filepath.Dir(dir))
+	c.Assert(err, gc.IsNil)
+	c.Assert(entries, gc.HasLen, 1)
+}
+
+func (*workingDirSuite) TestCreateWorkingDirExisting(c *gc.C) {
+	dir := c.MkDir()
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:         "exit 0",
+		WorkingDir:       dir,
+		CreateWorkingDir: &exec.DirParams{},
+	})
+	c.Assert(err, gc.IsNil)
+}
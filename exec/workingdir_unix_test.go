@@ -0,0 +1,70 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+func (*workingDirSuite) TestCreateWorkingDirOwnership(c *gc.C) {
+	dir := filepath.Join(c.MkDir(), "work")
+	uid, gid := os.Getuid(), os.Getgid()
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:   "pwd",
+		WorkingDir: dir,
+		CreateWorkingDir: &exec.DirParams{
+			Mode:  0750,
+			Owner: strconv.Itoa(uid),
+			Group: strconv.Itoa(gid),
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(result.Stdout), gc.Equals, dir+"\n")
+	info, err := os.Stat(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0750))
+	stat := info.Sys().(*syscall.Stat_t)
+	c.Assert(int(stat.Uid), gc.Equals, uid)
+	c.Assert(int(stat.Gid), gc.Equals, gid)
+}
+
+func (*workingDirSuite) TestCreateWorkingDirUnknownOwner(c *gc.C) {
+	parent := c.MkDir()
+	dir := filepath.Join(parent, "work")
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:   "exit 0",
+		WorkingDir: dir,
+		CreateWorkingDir: &exec.DirParams{
+			Owner: "no-such-user-for-exec",
+		},
+	})
+	c.Assert(err, gc.ErrorMatches, `cannot create working directory ".*work": cannot find user "no-such-user-for-exec": .*`)
+	entries, err := ioutil.ReadDir(parent)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(entries, gc.HasLen, 0)
+}
+
+func (*workingDirSuite) TestCreateDirExisting(c *gc.C) {
+	// A directory created concurrently by someone else, even an
+	// empty one, is not replaced.
+	dir := filepath.Join(c.MkDir(), "work")
+	err := os.Mkdir(dir, 0711)
+	c.Assert(err, jc.ErrorIsNil)
+	err = exec.CreateDir(dir, exec.DirParams{Mode: 0700})
+	c.Assert(err, jc.ErrorIsNil)
+	info, err := os.Stat(dir)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info.Mode().Perm(), gc.Equals, os.FileMode(0711))
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package exec_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+)
+
+type writersSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&writersSuite{})
+
+func (*writersSuite) TestStdoutStderrWriters(c *gc.C) {
+	var stdout, stderr bytes.Buffer
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo out; echo err >&2",
+		Stdout:   &stdout,
+		Stderr:   &stderr,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(stdout.String(), gc.Equals, "out\n")
+	c.Assert(stderr.String(), gc.Equals, "err\n")
+	c.Assert(resp.Stdout, gc.HasLen, 0)
+	c.Assert(resp.Stderr, gc.HasLen, 0)
+}
+
+func (*writersSuite) TestOnlyStdoutWriter(c *gc.C) {
+	var stdout bytes.Buffer
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo out; echo err >&2",
+		Stdout:   &stdout,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(stdout.String(), gc.Equals, "out\n")
+	c.Assert(resp.Stdout, gc.HasLen, 0)
+	c.Assert(string(resp.Stderr), gc.Equals, "err\n")
+}
+
+func (*writersSuite) TestSharedWriterWithTranscript(c *gc.C) {
+	var out, transcript bytes.Buffer
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:   "for i in 1 2 3; do echo out$i; echo err$i >&2; done",
+		Stdout:     &out,
+		Stderr:     &out,
+		Transcript: &transcript,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(out.Len(), gc.Equals, len("out1\nerr1\n")*3)
+	c.Assert(transcript.Len(), jc.GreaterThan, 0)
+}
+
+func (*writersSuite) TestWriterAndPathConflict(c *gc.C) {
+	var stdout bytes.Buffer
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:   "true",
+		Stdout:     &stdout,
+		StdoutPath: filepath.Join(c.MkDir(), "out"),
+	})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	c.Assert(err, gc.ErrorMatches, "setting both Stdout and StdoutPath not valid")
+}
+
+func (*writersSuite) TestLineCallbacks(c *gc.C) {
+	var stdoutLines, stderrLines []string
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "echo one; printf 'two\\r\\nthr'; sleep 0.05; printf 'ee\\n\\n'; echo err >&2; printf partial",
+		OnStdoutLine: func(line string) {
+			stdoutLines = append(stdoutLines, line)
+		},
+		OnStderrLine: func(line string) {
+			stderrLines = append(stderrLines, line)
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(stdoutLines, jc.DeepEquals, []string{"one", "two", "three", "", "partial"})
+	c.Assert(stderrLines, jc.DeepEquals, []string{"err"})
+	c.Assert(string(resp.Stdout), gc.Equals, "one\ntwo\r\nthree\n\npartial")
+}
+
+func (*writersSuite) TestStdinData(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "exec sort",
+		Stdin:    strings.NewReader("pear\napple\nfig\n"),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "apple\nfig\npear\n")
+}
+
+func (*writersSuite) TestStdinScript(c *gc.C) {
+	script := strings.Repeat("echo line\n", 10000)
+	resp, err := exec.RunCommands(exec.RunParams{
+		Stdin: strings.NewReader(script),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, strings.Repeat("line\n", 10000))
+}
+
+func (*writersSuite) TestStdinAfterCommands(c *gc.C) {
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands: "read first; echo got $first",
+		Stdin:    strings.NewReader("hello\necho done\n"),
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "got hello\ndone\n")
+}
+
+func (*writersSuite) TestMaxOutputBytes(c *gc.C) {
+	commands := "for i in $(seq 1000); do echo line$i; done; echo short >&2"
+	resp, err := exec.RunCommands(exec.RunParams{
+		Commands:       commands,
+		MaxOutputBytes: 12,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "line1\nline2\n")
+	c.Assert(resp.StdoutTruncated, jc.IsTrue)
+	c.Assert(string(resp.Stderr), gc.Equals, "short\n")
+	c.Assert(resp.StderrTruncated, jc.IsFalse)
+
+	resp, err = exec.RunCommands(exec.RunParams{
+		Commands:       commands,
+		MaxOutputBytes: 16,
+		KeepOutputTail: true,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "ine999\nline1000\n")
+	c.Assert(resp.StdoutTruncated, jc.IsTrue)
+	c.Assert(string(resp.Stderr), gc.Equals, "short\n")
+	c.Assert(resp.StderrTruncated, jc.IsFalse)
+}
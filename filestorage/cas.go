@@ -0,0 +1,125 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package filestorage
+
+import (
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/cas"
+)
+
+// Ensure casFileStorage implements RawFileStorage.
+var _ = RawFileStorage((*casFileStorage)(nil))
+
+type casFileStorage struct {
+	store *cas.Store
+	dir   string
+	mu    sync.Mutex
+}
+
+// NewCASFileStorage returns a RawFileStorage that keeps file content
+// in the given content-addressable store, so that files with the same
+// content are stored once however many IDs they are added under. The
+// digest stored under each ID is recorded in dir, which is created if
+// necessary, and each ID holds a reference to its blob, which is
+// released when the file is removed. Blobs left unreferenced are
+// removed by the store's GC method.
+func NewCASFileStorage(store *cas.Store, dir string) (RawFileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Annotate(err, "cannot create file index")
+	}
+	return &casFileStorage{
+		store: store,
+		dir:   dir,
+	}, nil
+}
+
+// File implements RawFileStorage.File.
+func (s *casFileStorage) File(id string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	digest, err := s.digest(id)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	file, err := s.store.Get(digest)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return file, nil
+}
+
+// AddFile implements RawFileStorage.AddFile. The content read from
+// file must be size bytes long.
+func (s *casFileStorage) AddFile(id string, file io.Reader, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.path(id)
+	if _, err := os.Stat(path); err == nil {
+		return errors.AlreadyExistsf("file for %q", id)
+	}
+	digest, n, err := s.store.Put(file)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if n != size {
+		// The blob is left unreferenced for the store to collect.
+		return errors.Errorf("file for %q has size %d, expected %d", id, n, size)
+	}
+	if err := s.store.Ref(digest); err != nil {
+		return errors.Trace(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(digest+"\n"), 0644); err != nil {
+		s.store.Unref(digest)
+		os.Remove(path)
+		return errors.Annotate(err, "cannot record file")
+	}
+	return nil
+}
+
+// RemoveFile implements RawFileStorage.RemoveFile.
+func (s *casFileStorage) RemoveFile(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	digest, err := s.digest(id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.Remove(s.path(id)); err != nil {
+		return errors.Annotate(err, "cannot remove file")
+	}
+	return errors.Trace(s.store.Unref(digest))
+}
+
+// Close implements io.Closer.Close.
+func (s *casFileStorage) Close() error {
+	return nil
+}
+
+// digest returns the digest of the blob holding the file stored for
+// id. It must be called with s.mu held.
+func (s *casFileStorage) digest(id string) (string, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return "", errors.NotFoundf("file for %q", id)
+	}
+	if err != nil {
+		return "", errors.Annotate(err, "cannot read file index")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// path returns the path of the index entry for id, which is hex
+// encoded so that any ID makes a valid file name.
+func (s *casFileStorage) path(id string) string {
+	return filepath.Join(s.dir, hex.EncodeToString([]byte(id)))
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package filestorage_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/cas"
+	"github.com/juju/utils/filestorage"
+)
+
+var _ = gc.Suite(&CASSuite{})
+
+type CASSuite struct {
+	testing.IsolationSuite
+	store   *cas.Store
+	rawstor filestorage.RawFileStorage
+}
+
+func (s *CASSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	var err error
+	s.store, err = cas.New(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	s.rawstor, err = filestorage.NewCASFileStorage(s.store, c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *CASSuite) add(c *gc.C, id, data string) {
+	err := s.rawstor.AddFile(id, bytes.NewBufferString(data), int64(len(data)))
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *CASSuite) TestAddFile(c *gc.C) {
+	s.add(c, "a/b", "hello")
+	file, err := s.rawstor.File("a/b")
+	c.Assert(err, jc.ErrorIsNil)
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(data), gc.Equals, "hello")
+}
+
+func (s *CASSuite) TestAddFileExists(c *gc.C) {
+	s.add(c, "a", "hello")
+	err := s.rawstor.AddFile("a", bytes.NewBufferString("other"), 5)
+	c.Check(err, jc.Satisfies, errors.IsAlreadyExists)
+}
+
+func (s *CASSuite) TestAddFileWrongSize(c *gc.C) {
+	err := s.rawstor.AddFile("a", bytes.NewBufferString("hello"), 4)
+	c.Check(err, gc.ErrorMatches, `file for "a" has size 5, expected 4`)
+	_, err = s.rawstor.File("a")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *CASSuite) TestFileNotFound(c *gc.C) {
+	_, err := s.rawstor.File("a")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *CASSuite) TestDeduplicates(c *gc.C) {
+	s.add(c, "a", "hello")
+	s.add(c, "b", "hello")
+	digest, _, err := s.store.Put(bytes.NewBufferString("hello"))
+	c.Assert(err, jc.ErrorIsNil)
+	refs, err := s.store.Refs(digest)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(refs, gc.Equals, 2)
+}
+
+func (s *CASSuite) TestRemoveFile(c *gc.C) {
+	s.add(c, "a", "hello")
+	s.add(c, "b", "hello")
+	digest, _, err := s.store.Put(bytes.NewBufferString("hello"))
+	c.Assert(err, jc.ErrorIsNil)
+
+	err = s.rawstor.RemoveFile("a")
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.rawstor.File("a")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+	removed, err := s.store.GC(-time.Hour)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(removed, gc.HasLen, 0)
+
+	err = s.rawstor.RemoveFile("b")
+	c.Assert(err, jc.ErrorIsNil)
+	removed, err = s.store.GC(-time.Hour)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(removed, jc.DeepEquals, []string{digest})
+}
+
+func (s *CASSuite) TestRemoveFileNotFound(c *gc.C) {
+	err := s.rawstor.RemoveFile("a")
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
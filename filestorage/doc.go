@@ -33,5 +33,9 @@ The doc storage is responsible to generating the unique IDs.  The raw
 file storage defers to the doc storage for any information about the
 file, including the ID.
 
+NewCASFileStorage provides a RawFileStorage that keeps files in a
+content-addressable store (see utils/cas), so that files with the same
+content are only stored once.
+
 */
 package filestorage
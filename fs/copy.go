@@ -8,6 +8,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+
+	"github.com/juju/utils/progress"
 )
 
 // Copy recursively copies the file, directory or symbolic link at src
@@ -17,6 +19,42 @@ import (
 // If the copy fails half way through, the destination might be left
 // partially written.
 func Copy(src, dst string) error {
+	return copyAll(src, dst, nil)
+}
+
+// CopyWithProgress is like Copy but reports the number of bytes of
+// regular file content copied to r.
+func CopyWithProgress(src, dst string, r progress.Reporter) (err error) {
+	total, err := contentSize(src)
+	if err != nil {
+		return err
+	}
+	t := progress.NewTracker(r, src, total, nil)
+	defer func() {
+		t.Done(err)
+	}()
+	return copyAll(src, dst, t)
+}
+
+// contentSize returns the total size of the regular files at or
+// below path.
+func contentSize(path string) (int64, error) {
+	var total int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// copyAll implements Copy, adding the bytes copied to t if it
+// is not nil.
+func copyAll(src, dst string, t *progress.Tracker) error {
 	srcInfo, srcErr := os.Lstat(src)
 	if srcErr != nil {
 		return srcErr
@@ -33,9 +71,9 @@ func Copy(src, dst string) error {
 	case os.ModeSymlink:
 		return copySymLink(src, dst)
 	case os.ModeDir:
-		return copyDir(src, dst, mode)
+		return copyDir(src, dst, mode, t)
 	case 0:
-		return copyFile(src, dst, mode)
+		return copyFile(src, dst, mode, t)
 	default:
 		return fmt.Errorf("cannot copy file with mode %v", mode)
 	}
@@ -49,7 +87,7 @@ func copySymLink(src, dst string) error {
 	return os.Symlink(target, dst)
 }
 
-func copyFile(src, dst string, mode os.FileMode) error {
+func copyFile(src, dst string, mode os.FileMode, t *progress.Tracker) error {
 	srcf, err := os.Open(src)
 	if err != nil {
 		return err
@@ -65,13 +103,17 @@ func copyFile(src, dst string, mode os.FileMode) error {
 	if err := os.Chmod(dstf.Name(), mode.Perm()); err != nil {
 		return err
 	}
-	if _, err := io.Copy(dstf, srcf); err != nil {
+	var w io.Writer = dstf
+	if t != nil {
+		w = progress.NewWriter(dstf, t)
+	}
+	if _, err := io.Copy(w, srcf); err != nil {
 		return fmt.Errorf("cannot copy %q to %q: %v", src, dst, err)
 	}
 	return nil
 }
 
-func copyDir(src, dst string, mode os.FileMode) error {
+func copyDir(src, dst string, mode os.FileMode, t *progress.Tracker) error {
 	srcf, err := os.Open(src)
 	if err != nil {
 		return err
@@ -90,7 +132,7 @@ func copyDir(src, dst string, mode os.FileMode) error {
 	for {
 		names, err := srcf.Readdirnames(100)
 		for _, name := range names {
-			if err := Copy(filepath.Join(src, name), filepath.Join(dst, name)); err != nil {
+			if err := copyAll(filepath.Join(src, name), filepath.Join(dst, name), t); err != nil {
 				return err
 			}
 		}
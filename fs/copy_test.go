@@ -11,6 +11,7 @@ import (
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/utils/fs"
+	"github.com/juju/utils/progress"
 )
 
 type copySuite struct{}
@@ -86,3 +87,23 @@ func (*copySuite) TestCopy(c *gc.C) {
 		}
 	}
 }
+
+func (*copySuite) TestCopyWithProgress(c *gc.C) {
+	src, dst := c.MkDir(), c.MkDir()
+	entries := copyTests[3].src
+	entries.Create(c, src)
+	var last progress.Progress
+	reporter := progress.ReporterFunc(func(p progress.Progress) {
+		last = p
+	})
+	err := fs.CopyWithProgress(
+		filepath.Join(src, "top"),
+		filepath.Join(dst, "top"),
+		reporter,
+	)
+	c.Assert(err, gc.IsNil)
+	entries.Check(c, dst)
+	c.Assert(last.Done, gc.Equals, true)
+	c.Assert(last.Total, gc.Equals, int64(len("foodata")+len("bardata")+len("anotherdata")))
+	c.Assert(last.Current, gc.Equals, last.Total)
+}
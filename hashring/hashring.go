@@ -0,0 +1,171 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package hashring implements consistent hashing, which assigns keys to
+// members such that adding or removing a member moves only the keys
+// that must move.
+//
+// Each member is placed on the ring at a number of points, its virtual
+// nodes, proportional to its weight. A key belongs to the member owning
+// the first point at or after the key's hash. Placement depends only on
+// the member names, weights and replica count, so rings built the same
+// way in different processes agree.
+package hashring
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// DefaultReplicas holds the number of virtual nodes per unit of weight
+// used when New is passed a non-positive replica count.
+const DefaultReplicas = 100
+
+// Ring is a consistent hash ring. Its methods may be called
+// concurrently.
+type Ring struct {
+	replicas int
+
+	mu      sync.RWMutex
+	weights map[string]int
+	points  []point
+}
+
+type point struct {
+	hash   uint64
+	member string
+}
+
+// New returns an empty ring placing the given number of virtual nodes
+// per unit of member weight.
+func New(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &Ring{
+		replicas: replicas,
+		weights:  make(map[string]int),
+	}
+}
+
+// Add adds a member with the given weight, or changes the weight of an
+// existing member.
+func (r *Ring) Add(member string, weight int) error {
+	if weight <= 0 {
+		return errors.NotValidf("weight %d", weight)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remove(member)
+	r.weights[member] = weight
+	for i := 0; i < weight*r.replicas; i++ {
+		r.points = append(r.points, point{
+			hash:   hash(member + "#" + strconv.Itoa(i)),
+			member: member,
+		})
+	}
+	sort.Sort(byHash(r.points))
+	return nil
+}
+
+// Remove removes a member from the ring. Removing a member that is not
+// present has no effect.
+func (r *Ring) Remove(member string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.remove(member)
+}
+
+func (r *Ring) remove(member string) {
+	if _, ok := r.weights[member]; !ok {
+		return
+	}
+	delete(r.weights, member)
+	points := r.points[:0]
+	for _, p := range r.points {
+		if p.member != member {
+			points = append(points, p)
+		}
+	}
+	r.points = points
+}
+
+// Members returns the names of the members, sorted.
+func (r *Ring) Members() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	members := make([]string, 0, len(r.weights))
+	for m := range r.weights {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Weight returns the weight of the given member, or zero if it is not
+// present.
+func (r *Ring) Weight(member string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.weights[member]
+}
+
+// Get returns the member that owns key. It returns false if the ring is
+// empty.
+func (r *Ring) Get(key string) (string, bool) {
+	members := r.GetN(key, 1)
+	if len(members) == 0 {
+		return "", false
+	}
+	return members[0], true
+}
+
+// GetN returns up to n distinct members for key, in ring order starting
+// with its owner. It is intended for placing replicas: the remaining
+// members are the ones that would successively own key were the earlier
+// ones removed.
+func (r *Ring) GetN(key string, n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if n > len(r.weights) {
+		n = len(r.weights)
+	}
+	if n <= 0 {
+		return nil
+	}
+	h := hash(key)
+	start := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	members := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; len(members) < n; i++ {
+		p := r.points[(start+i)%len(r.points)]
+		if !seen[p.member] {
+			seen[p.member] = true
+			members = append(members, p.member)
+		}
+	}
+	return members
+}
+
+type byHash []point
+
+func (p byHash) Len() int      { return len(p) }
+func (p byHash) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byHash) Less(i, j int) bool {
+	if p[i].hash != p[j].hash {
+		return p[i].hash < p[j].hash
+	}
+	return p[i].member < p[j].member
+}
+
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package hashring_test
+
+import (
+	"fmt"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/hashring"
+)
+
+type hashringSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&hashringSuite{})
+
+func newRing(c *gc.C, members ...string) *hashring.Ring {
+	r := hashring.New(0)
+	for _, m := range members {
+		c.Assert(r.Add(m, 1), gc.IsNil)
+	}
+	return r
+}
+
+func assign(r *hashring.Ring, n int) map[string]string {
+	owners := make(map[string]string)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprint("key", i)
+		owners[key], _ = r.Get(key)
+	}
+	return owners
+}
+
+func (*hashringSuite) TestEmpty(c *gc.C) {
+	r := hashring.New(10)
+	_, ok := r.Get("key")
+	c.Assert(ok, jc.IsFalse)
+	c.Assert(r.GetN("key", 3), gc.HasLen, 0)
+}
+
+func (*hashringSuite) TestDeterministic(c *gc.C) {
+	a := newRing(c, "agent-0", "agent-1", "agent-2")
+	b := newRing(c, "agent-2", "agent-0", "agent-1")
+	c.Assert(assign(a, 1000), jc.DeepEquals, assign(b, 1000))
+}
+
+func (*hashringSuite) TestBalance(c *gc.C) {
+	r := newRing(c, "a", "b", "c", "d")
+	counts := make(map[string]int)
+	for _, owner := range assign(r, 10000) {
+		counts[owner]++
+	}
+	for m, n := range counts {
+		c.Check(n > 1500 && n < 3500, jc.IsTrue, gc.Commentf("%s owns %d keys", m, n))
+	}
+}
+
+func (*hashringSuite) TestWeights(c *gc.C) {
+	r := hashring.New(0)
+	c.Assert(r.Add("small", 1), gc.IsNil)
+	c.Assert(r.Add("large", 3), gc.IsNil)
+	c.Assert(r.Weight("large"), gc.Equals, 3)
+	counts := make(map[string]int)
+	for _, owner := range assign(r, 10000) {
+		counts[owner]++
+	}
+	c.Assert(counts["large"] > 2*counts["small"], jc.IsTrue, gc.Commentf("%v", counts))
+
+	c.Assert(r.Add("bad", 0), gc.ErrorMatches, "weight 0 not valid")
+}
+
+func (*hashringSuite) TestMinimalDisruption(c *gc.C) {
+	r := newRing(c, "a", "b", "c")
+	before := assign(r, 3000)
+
+	c.Assert(r.Add("d", 1), gc.IsNil)
+	after := assign(r, 3000)
+	for key, owner := range after {
+		// Keys only ever move to the new member.
+		if owner != before[key] {
+			c.Assert(owner, gc.Equals, "d")
+		}
+	}
+
+	r.Remove("d")
+	c.Assert(assign(r, 3000), jc.DeepEquals, before)
+
+	r.Remove("b")
+	for key, owner := range assign(r, 3000) {
+		if before[key] != "b" {
+			c.Assert(owner, gc.Equals, before[key])
+		}
+	}
+	c.Assert(r.Members(), jc.DeepEquals, []string{"a", "c"})
+}
+
+func (*hashringSuite) TestGetN(c *gc.C) {
+	r := newRing(c, "a", "b", "c")
+	members := r.GetN("key", 2)
+	c.Assert(members, gc.HasLen, 2)
+	c.Assert(members[0], gc.Not(gc.Equals), members[1])
+	owner, _ := r.Get("key")
+	c.Assert(members[0], gc.Equals, owner)
+
+	c.Assert(r.GetN("key", 5), gc.HasLen, 3)
+
+	// The second member takes over when the owner goes.
+	r.Remove(members[0])
+	owner, _ = r.Get("key")
+	c.Assert(owner, gc.Equals, members[1])
+}
@@ -0,0 +1,176 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package hll implements the HyperLogLog cardinality estimator, which
+// approximates the number of distinct items added to it using a small,
+// fixed amount of memory.
+package hll
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// MinPrecision and MaxPrecision bound the precision accepted by
+	// New.
+	MinPrecision = 4
+	MaxPrecision = 16
+)
+
+// Sketch estimates the number of distinct items added to it. A sketch
+// of precision p uses 2^p bytes and has a standard error of about
+// 1.04/sqrt(2^p). Its methods may be called concurrently and do not
+// allocate.
+type Sketch struct {
+	mu        sync.Mutex
+	p         uint8
+	registers []uint8
+}
+
+// New returns an empty sketch with the given precision.
+func New(precision uint8) (*Sketch, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, errors.NotValidf("precision %d", precision)
+	}
+	return &Sketch{
+		p:         precision,
+		registers: make([]uint8, 1<<precision),
+	}, nil
+}
+
+// Precision returns the precision of the sketch.
+func (s *Sketch) Precision() uint8 {
+	return s.p
+}
+
+// Add adds data to the sketch.
+func (s *Sketch) Add(data []byte) {
+	x := hash(data)
+	idx := x >> (64 - s.p)
+	// The extra low bit bounds the rank when the remaining bits
+	// are all zero.
+	w := x<<s.p | 1<<(s.p-1)
+	rank := uint8(bits.LeadingZeros64(w)) + 1
+	s.mu.Lock()
+	if rank > s.registers[idx] {
+		s.registers[idx] = rank
+	}
+	s.mu.Unlock()
+}
+
+// AddString adds str to the sketch.
+func (s *Sketch) AddString(str string) {
+	s.Add([]byte(str))
+}
+
+// Count returns the estimated number of distinct items added.
+func (s *Sketch) Count() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := float64(len(s.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha(len(s.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Use linear counting for small cardinalities.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Merge adds all the items of other to s. Both sketches must have the
+// same precision.
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.p != other.p {
+		return errors.Errorf("cannot merge sketches of precision %d and %d", s.p, other.p)
+	}
+	if s == other {
+		return nil
+	}
+	other.mu.Lock()
+	registers := make([]uint8, len(other.registers))
+	copy(registers, other.registers)
+	other.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+	return nil
+}
+
+const (
+	magic   = "HLL"
+	version = 1
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := make([]byte, 0, len(magic)+2+len(s.registers))
+	data = append(data, magic...)
+	data = append(data, version, s.p)
+	return append(data, s.registers...), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < len(magic)+2 || string(data[:len(magic)]) != magic {
+		return errors.NotValidf("sketch data")
+	}
+	if v := data[len(magic)]; v != version {
+		return errors.NotSupportedf("sketch version %d", v)
+	}
+	p := data[len(magic)+1]
+	registers := data[len(magic)+2:]
+	if p < MinPrecision || p > MaxPrecision || len(registers) != 1<<p {
+		return errors.NotValidf("sketch data")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.p = p
+	s.registers = append([]uint8(nil), registers...)
+	return nil
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+// hash returns a well mixed 64 bit hash of data: FNV-1a followed by
+// the MurmurHash3 finalizer.
+func hash(data []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, b := range data {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
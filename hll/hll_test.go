@@ -0,0 +1,113 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package hll_test
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	stdtesting "testing"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/hll"
+)
+
+type hllSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&hllSuite{})
+
+func assertWithin(c *gc.C, got, want uint64, tolerance float64) {
+	diff := math.Abs(float64(got)-float64(want)) / float64(want)
+	c.Assert(diff <= tolerance, jc.IsTrue, gc.Commentf("estimate %d, actual %d", got, want))
+}
+
+func (*hllSuite) TestCount(c *gc.C) {
+	for _, n := range []int{10, 1000, 100000} {
+		c.Logf("%d items", n)
+		s, err := hll.New(14)
+		c.Assert(err, gc.IsNil)
+		for i := 0; i < n; i++ {
+			s.AddString(fmt.Sprint("item", i))
+			// Duplicates do not affect the count.
+			s.AddString(fmt.Sprint("item", i))
+		}
+		assertWithin(c, s.Count(), uint64(n), 0.05)
+	}
+}
+
+func (*hllSuite) TestEmpty(c *gc.C) {
+	s, err := hll.New(10)
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.Count(), gc.Equals, uint64(0))
+}
+
+func (*hllSuite) TestNewErrors(c *gc.C) {
+	_, err := hll.New(3)
+	c.Assert(err, gc.ErrorMatches, "precision 3 not valid")
+	_, err = hll.New(17)
+	c.Assert(err, gc.ErrorMatches, "precision 17 not valid")
+}
+
+func (*hllSuite) TestMerge(c *gc.C) {
+	a, _ := hll.New(12)
+	b, _ := hll.New(12)
+	for i := 0; i < 5000; i++ {
+		a.AddString(fmt.Sprint(i))
+		b.AddString(fmt.Sprint(i + 2500))
+	}
+	c.Assert(a.Merge(b), gc.IsNil)
+	assertWithin(c, a.Count(), 7500, 0.05)
+
+	other, _ := hll.New(10)
+	c.Assert(a.Merge(other), gc.ErrorMatches, "cannot merge sketches of precision 12 and 10")
+}
+
+func (*hllSuite) TestConcurrentAdd(c *gc.C) {
+	s, _ := hll.New(12)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				s.AddString(fmt.Sprint(g, "-", i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	assertWithin(c, s.Count(), 4000, 0.05)
+}
+
+func (*hllSuite) TestMarshalBinary(c *gc.C) {
+	s, _ := hll.New(8)
+	for i := 0; i < 100; i++ {
+		s.AddString(fmt.Sprint(i))
+	}
+	data, err := s.MarshalBinary()
+	c.Assert(err, gc.IsNil)
+	c.Assert(data, gc.HasLen, 5+256)
+
+	var t hll.Sketch
+	c.Assert(t.UnmarshalBinary(data), gc.IsNil)
+	c.Assert(t.Precision(), gc.Equals, uint8(8))
+	c.Assert(t.Count(), gc.Equals, s.Count())
+
+	c.Assert(t.UnmarshalBinary(data[:100]), gc.ErrorMatches, "sketch data not valid")
+	data[3] = 2
+	c.Assert(t.UnmarshalBinary(data), gc.ErrorMatches, "sketch version 2 not supported")
+}
+
+func (*hllSuite) TestAllocations(c *gc.C) {
+	s, _ := hll.New(10)
+	data := []byte("data")
+	allocs := stdtesting.AllocsPerRun(100, func() {
+		s.Add(data)
+	})
+	c.Assert(allocs, gc.Equals, float64(0))
+}
@@ -0,0 +1,207 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package ioutils provides small io.Reader, io.Writer and io.Closer
+// building blocks.
+package ioutils
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// ErrLimitExceeded is returned by LimitedWriter when a write would
+// exceed its limit.
+var ErrLimitExceeded = errors.New("write limit exceeded")
+
+// LimitedWriter writes to W but limits the amount of data written to
+// N bytes. Each call to Write decrements N by the number of bytes
+// written. A write that does not fit writes as much as possible and
+// then returns ErrLimitExceeded.
+type LimitedWriter struct {
+	W io.Writer
+	N int64
+}
+
+// NewLimitedWriter returns a LimitedWriter writing at most n bytes to
+// w.
+func NewLimitedWriter(w io.Writer, n int64) *LimitedWriter {
+	return &LimitedWriter{W: w, N: n}
+}
+
+// Write implements io.Writer.
+func (l *LimitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= l.N {
+		n, err := l.W.Write(p)
+		l.N -= int64(n)
+		return n, err
+	}
+	if l.N <= 0 {
+		return 0, ErrLimitExceeded
+	}
+	n, err := l.W.Write(p[:l.N])
+	l.N -= int64(n)
+	if err == nil {
+		err = ErrLimitExceeded
+	}
+	return n, err
+}
+
+// LimitedBuffer is an io.Writer that holds what is written to it in
+// memory, keeping at most max bytes if max is positive. Once the limit
+// is reached it keeps either the first or the most recent bytes
+// written. Unlike LimitedWriter, it always consumes all of each write
+// without error, so that a writer such as a running command is never
+// blocked or failed by the limit. It is not safe for concurrent use.
+type LimitedBuffer struct {
+	max       int
+	keepTail  bool
+	buf       []byte
+	truncated bool
+}
+
+// NewLimitedBuffer returns a LimitedBuffer keeping at most max bytes,
+// the most recent ones if keepTail is set.
+func NewLimitedBuffer(max int, keepTail bool) *LimitedBuffer {
+	return &LimitedBuffer{
+		max:      max,
+		keepTail: keepTail,
+	}
+}
+
+// Write implements io.Writer.
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	switch {
+	case b.max <= 0:
+		b.buf = append(b.buf, p...)
+	case b.keepTail:
+		b.buf = append(b.buf, p...)
+		// Only discard once the buffer is well over the limit so
+		// that the cost of copying is amortised.
+		if len(b.buf) > 2*b.max {
+			b.trim()
+		}
+	default:
+		room := b.max - len(b.buf)
+		if len(p) > room {
+			p = p[:room]
+			b.truncated = true
+		}
+		b.buf = append(b.buf, p...)
+	}
+	return n, nil
+}
+
+// trim discards the oldest bytes beyond the limit.
+func (b *LimitedBuffer) trim() {
+	if excess := len(b.buf) - b.max; excess > 0 {
+		b.buf = append([]byte(nil), b.buf[excess:]...)
+		b.truncated = true
+	}
+}
+
+// Bytes returns the bytes kept and whether any were discarded.
+func (b *LimitedBuffer) Bytes() ([]byte, bool) {
+	if b.keepTail && b.max > 0 {
+		b.trim()
+	}
+	return b.buf, b.truncated
+}
+
+// TeeReadCloser returns an io.ReadCloser that writes to w everything
+// read from r. Closing it closes r. Any error encountered while
+// writing is reported as a read error.
+func TeeReadCloser(r io.ReadCloser, w io.Writer) io.ReadCloser {
+	return &teeReadCloser{
+		Reader: io.TeeReader(r, w),
+		Closer: r,
+	}
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// CountingReader counts the bytes read through it. The count may be
+// read concurrently with calls to Read.
+type CountingReader struct {
+	r     io.Reader
+	count int64
+}
+
+// NewCountingReader returns a CountingReader reading from r.
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{r: r}
+}
+
+// Read implements io.Reader.
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.count, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes read so far.
+func (c *CountingReader) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+// CountingWriter counts the bytes written through it. The count may be
+// read concurrently with calls to Write.
+type CountingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+// NewCountingWriter returns a CountingWriter writing to w.
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	return &CountingWriter{w: w}
+}
+
+// Write implements io.Writer.
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.count, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes written so far.
+func (c *CountingWriter) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+// MultiCloser returns an io.Closer that closes each of the given
+// closers in turn, even if some fail. It returns the first error
+// encountered.
+func MultiCloser(closers ...io.Closer) io.Closer {
+	return multiCloser(append([]io.Closer(nil), closers...))
+}
+
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var first error
+	for _, c := range m {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// NopWriteCloser returns an io.WriteCloser wrapping w with a Close
+// method that does nothing.
+func NopWriteCloser(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ioutils_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/ioutils"
+)
+
+type ioutilsSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&ioutilsSuite{})
+
+func (*ioutilsSuite) TestLimitedWriter(c *gc.C) {
+	var buf bytes.Buffer
+	w := ioutils.NewLimitedWriter(&buf, 5)
+	n, err := w.Write([]byte("abc"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 3)
+	n, err = w.Write([]byte("defg"))
+	c.Assert(err, gc.Equals, ioutils.ErrLimitExceeded)
+	c.Assert(n, gc.Equals, 2)
+	n, err = w.Write([]byte("h"))
+	c.Assert(err, gc.Equals, ioutils.ErrLimitExceeded)
+	c.Assert(n, gc.Equals, 0)
+	c.Assert(buf.String(), gc.Equals, "abcde")
+	c.Assert(w.N, gc.Equals, int64(0))
+
+	// Empty writes never exceed the limit.
+	n, err = w.Write(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 0)
+}
+
+type closeRecorder struct {
+	name   string
+	closed *[]string
+	err    error
+}
+
+func (r closeRecorder) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (r closeRecorder) Close() error {
+	*r.closed = append(*r.closed, r.name)
+	return r.err
+}
+
+func (*ioutilsSuite) TestTeeReadCloser(c *gc.C) {
+	var closed []string
+	src := struct {
+		io.Reader
+		io.Closer
+	}{
+		strings.NewReader("hello world"),
+		closeRecorder{name: "src", closed: &closed},
+	}
+	var copy bytes.Buffer
+	r := ioutils.TeeReadCloser(src, &copy)
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "hello world")
+	c.Assert(copy.String(), gc.Equals, "hello world")
+	err = r.Close()
+	c.Assert(err, gc.IsNil)
+	c.Assert(closed, gc.DeepEquals, []string{"src"})
+}
+
+func (*ioutilsSuite) TestCountingReader(c *gc.C) {
+	r := ioutils.NewCountingReader(strings.NewReader("hello world"))
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(r, buf)
+	c.Assert(err, gc.IsNil)
+	c.Assert(r.Count(), gc.Equals, int64(4))
+	_, err = ioutil.ReadAll(r)
+	c.Assert(err, gc.IsNil)
+	c.Assert(r.Count(), gc.Equals, int64(11))
+}
+
+func (*ioutilsSuite) TestCountingWriter(c *gc.C) {
+	var buf bytes.Buffer
+	w := ioutils.NewCountingWriter(&buf)
+	io.WriteString(w, "hello")
+	io.WriteString(w, " world")
+	c.Assert(w.Count(), gc.Equals, int64(11))
+	c.Assert(buf.String(), gc.Equals, "hello world")
+
+	// Bytes not written due to an error are not counted.
+	lw := ioutils.NewCountingWriter(ioutils.NewLimitedWriter(ioutil.Discard, 3))
+	_, err := io.WriteString(lw, "hello")
+	c.Assert(err, gc.Equals, ioutils.ErrLimitExceeded)
+	c.Assert(lw.Count(), gc.Equals, int64(3))
+}
+
+func (*ioutilsSuite) TestMultiCloser(c *gc.C) {
+	var closed []string
+	err := ioutils.MultiCloser(
+		closeRecorder{name: "a", closed: &closed},
+		closeRecorder{name: "b", closed: &closed, err: errors.New("b failed")},
+		closeRecorder{name: "c", closed: &closed, err: errors.New("c failed")},
+	).Close()
+	c.Assert(err, gc.ErrorMatches, "b failed")
+	c.Assert(closed, gc.DeepEquals, []string{"a", "b", "c"})
+
+	c.Assert(ioutils.MultiCloser().Close(), gc.IsNil)
+}
+
+func (*ioutilsSuite) TestNopWriteCloser(c *gc.C) {
+	var buf bytes.Buffer
+	w := ioutils.NopWriteCloser(&buf)
+	_, err := io.WriteString(w, "data")
+	c.Assert(err, gc.IsNil)
+	c.Assert(w.Close(), gc.IsNil)
+	c.Assert(buf.String(), gc.Equals, "data")
+	_, isCloser := interface{}(&buf).(io.Closer)
+	c.Assert(isCloser, jc.IsFalse)
+}
+
+func (*ioutilsSuite) TestLimitedBuffer(c *gc.C) {
+	for i, test := range []struct {
+		about     string
+		max       int
+		keepTail  bool
+		expect    string
+		truncated bool
+	}{{
+		about:  "no limit",
+		expect: "abcdefghij",
+	}, {
+		about:  "within limit",
+		max:    10,
+		expect: "abcdefghij",
+	}, {
+		about:     "keep head",
+		max:       4,
+		expect:    "abcd",
+		truncated: true,
+	}, {
+		about:     "keep tail",
+		max:       4,
+		keepTail:  true,
+		expect:    "ghij",
+		truncated: true,
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		b := ioutils.NewLimitedBuffer(test.max, test.keepTail)
+		for _, s := range []string{"abc", "defg", "hij"} {
+			n, err := b.Write([]byte(s))
+			c.Assert(err, jc.ErrorIsNil)
+			c.Assert(n, gc.Equals, len(s))
+		}
+		data, truncated := b.Bytes()
+		c.Assert(string(data), gc.Equals, test.expect)
+		c.Assert(truncated, gc.Equals, test.truncated)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package kvstore implements a small embedded key-value store kept in a
+// single directory.
+//
+// The directory holds a write-ahead log (see package wal) of committed
+// transactions, so a transaction torn by a crash is discarded when the
+// store is reopened. The whole data set is indexed in memory, so the
+// store is suited to modest amounts of state such as timestamps and
+// cached results. Compact replaces the log with a snapshot of the live
+// entries.
+package kvstore
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/clock"
+	"github.com/juju/utils/wal"
+)
+
+// Options holds the options for a store.
+type Options struct {
+	// NoSync disables flushing each transaction to stable storage as
+	// it commits. Committed transactions may then be lost in a crash,
+	// though the store remains consistent.
+	NoSync bool
+
+	// Clock is used to expire keys. If nil, clock.WallClock is used.
+	Clock clock.Clock
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !e.expires.After(now)
+}
+
+// DB is a key-value store. Its methods may be called concurrently.
+// Transactions are serializable: read-only transactions run
+// concurrently with each other and update transactions run one at a
+// time.
+type DB struct {
+	dir  string
+	opts Options
+
+	mu     sync.RWMutex
+	closed bool
+	log    *wal.Log
+	data   map[string]entry
+}
+
+// Open opens the store in the directory dir, creating it if necessary.
+func Open(dir string, opts Options) (*DB, error) {
+	if opts.Clock == nil {
+		opts.Clock = clock.WallClock
+	}
+	db := &DB{
+		dir:  dir,
+		opts: opts,
+		data: make(map[string]entry),
+	}
+	if err := db.load(); err != nil {
+		return nil, errors.Annotatef(err, "cannot open store %q", dir)
+	}
+	return db, nil
+}
+
+// Close closes the store.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	return errors.Trace(db.log.Close())
+}
+
+// View runs f in a read-only transaction.
+func (db *DB) View(f func(tx *Tx) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return errors.New("store closed")
+	}
+	return f(&Tx{db: db, now: db.opts.Clock.Now()})
+}
+
+// Update runs f in a transaction that may modify the store. The
+// changes made by f are committed atomically if it returns nil and
+// discarded otherwise.
+func (db *DB) Update(f func(tx *Tx) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return errors.New("store closed")
+	}
+	tx := &Tx{
+		db:       db,
+		now:      db.opts.Clock.Now(),
+		writable: true,
+		writes:   make(map[string]*op),
+	}
+	if err := f(tx); err != nil {
+		return err
+	}
+	return errors.Trace(db.commit(tx))
+}
+
+// Get returns the value of key. It returns an error satisfying
+// errors.IsNotFound if the key is not present or has expired.
+func (db *DB) Get(key string) ([]byte, error) {
+	var value []byte
+	err := db.View(func(tx *Tx) error {
+		var err error
+		value, err = tx.Get(key)
+		return err
+	})
+	return value, err
+}
+
+// Put sets the value of key.
+func (db *DB) Put(key string, value []byte) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Put(key, value)
+	})
+}
+
+// PutTTL sets the value of key, which expires after ttl.
+func (db *DB) PutTTL(key string, value []byte, ttl time.Duration) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.PutTTL(key, value, ttl)
+	})
+}
+
+// Delete removes key. Deleting a key that is not present is not an
+// error.
+func (db *DB) Delete(key string) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+// Scan calls f for each key with the given prefix, in key order. See
+// Tx.Scan.
+func (db *DB) Scan(prefix string, f func(key string, value []byte) error) error {
+	return db.View(func(tx *Tx) error {
+		return tx.Scan(prefix, f)
+	})
+}
+
+// Tx is a transaction. It must not be used after the function it was
+// passed to returns.
+type Tx struct {
+	db       *DB
+	now      time.Time
+	writable bool
+	writes   map[string]*op
+	order    []string
+}
+
+// Get returns the value of key as seen by the transaction.
+func (tx *Tx) Get(key string) ([]byte, error) {
+	if o, ok := tx.writes[key]; ok {
+		if o.kind == opDelete {
+			return nil, errors.NotFoundf("key %q", key)
+		}
+		return copyBytes(o.value), nil
+	}
+	e, ok := tx.db.data[key]
+	if !ok || e.expired(tx.now) {
+		return nil, errors.NotFoundf("key %q", key)
+	}
+	return copyBytes(e.value), nil
+}
+
+// Put sets the value of key.
+func (tx *Tx) Put(key string, value []byte) error {
+	return tx.write(&op{kind: opPut, key: key, value: copyBytes(value)})
+}
+
+// PutTTL sets the value of key, which expires after ttl.
+func (tx *Tx) PutTTL(key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.NotValidf("TTL %v", ttl)
+	}
+	return tx.write(&op{kind: opPut, key: key, value: copyBytes(value), expires: tx.now.Add(ttl)})
+}
+
+// Delete removes key.
+func (tx *Tx) Delete(key string) error {
+	return tx.write(&op{kind: opDelete, key: key})
+}
+
+func (tx *Tx) write(o *op) error {
+	if !tx.writable {
+		return errors.New("transaction is read-only")
+	}
+	if o.key == "" {
+		return errors.NotValidf("empty key")
+	}
+	if _, ok := tx.writes[o.key]; !ok {
+		tx.order = append(tx.order, o.key)
+	}
+	tx.writes[o.key] = o
+	return nil
+}
+
+// Scan calls f for each key with the given prefix, in key order, as
+// seen by the transaction. If f returns an error, the scan stops and
+// the error is returned.
+func (tx *Tx) Scan(prefix string, f func(key string, value []byte) error) error {
+	var keys []string
+	for key, e := range tx.db.data {
+		if _, ok := tx.writes[key]; !ok && strings.HasPrefix(key, prefix) && !e.expired(tx.now) {
+			keys = append(keys, key)
+		}
+	}
+	for key, o := range tx.writes {
+		if o.kind == opPut && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := tx.Get(key)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := f(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,204 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package kvstore_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/kvstore"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type kvstoreSuite struct {
+	testing.IsolationSuite
+	path  string
+	clock *testclock.Clock
+}
+
+var _ = gc.Suite(&kvstoreSuite{})
+
+func (s *kvstoreSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.path = filepath.Join(c.MkDir(), "state")
+	s.clock = testclock.New(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func (s *kvstoreSuite) open(c *gc.C) *kvstore.DB {
+	db, err := kvstore.Open(s.path, kvstore.Options{Clock: s.clock})
+	c.Assert(err, gc.IsNil)
+	return db
+}
+
+func (s *kvstoreSuite) assertValue(c *gc.C, db *kvstore.DB, key, expect string) {
+	value, err := db.Get(key)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(value), gc.Equals, expect)
+}
+
+func (s *kvstoreSuite) TestPutGetDelete(c *gc.C) {
+	db := s.open(c)
+	defer db.Close()
+	_, err := db.Get("missing")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	c.Assert(db.Put("last-run", []byte("yesterday")), gc.IsNil)
+	s.assertValue(c, db, "last-run", "yesterday")
+	c.Assert(db.Put("last-run", []byte("today")), gc.IsNil)
+	s.assertValue(c, db, "last-run", "today")
+	c.Assert(db.Delete("last-run"), gc.IsNil)
+	_, err = db.Get("last-run")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	c.Assert(db.Put("", nil), gc.ErrorMatches, "empty key not valid")
+}
+
+func (s *kvstoreSuite) TestPersistence(c *gc.C) {
+	db := s.open(c)
+	c.Assert(db.Put("a", []byte("1")), gc.IsNil)
+	c.Assert(db.Put("b", []byte("2")), gc.IsNil)
+	c.Assert(db.Delete("a"), gc.IsNil)
+	c.Assert(db.Close(), gc.IsNil)
+
+	db = s.open(c)
+	defer db.Close()
+	_, err := db.Get("a")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	s.assertValue(c, db, "b", "2")
+}
+
+func (s *kvstoreSuite) TestTornTransaction(c *gc.C) {
+	db := s.open(c)
+	c.Assert(db.Put("a", []byte("1")), gc.IsNil)
+	size := db.Size()
+	c.Assert(db.Put("b", []byte("2")), gc.IsNil)
+	c.Assert(db.Close(), gc.IsNil)
+	segs, err := filepath.Glob(filepath.Join(s.path, "*.wal"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(segs, gc.HasLen, 1)
+	c.Assert(os.Truncate(segs[0], size+5), gc.IsNil)
+
+	db = s.open(c)
+	defer db.Close()
+	s.assertValue(c, db, "a", "1")
+	_, err = db.Get("b")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(db.Size(), gc.Equals, size)
+}
+
+func (s *kvstoreSuite) TestTransaction(c *gc.C) {
+	db := s.open(c)
+	defer db.Close()
+	c.Assert(db.Put("count", []byte("1")), gc.IsNil)
+
+	err := db.Update(func(tx *kvstore.Tx) error {
+		c.Assert(tx.Put("count", []byte("2")), gc.IsNil)
+		c.Assert(tx.Put("other", []byte("x")), gc.IsNil)
+		value, err := tx.Get("count")
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(value), gc.Equals, "2")
+		return fmt.Errorf("abort")
+	})
+	c.Assert(err, gc.ErrorMatches, "abort")
+	s.assertValue(c, db, "count", "1")
+	_, err = db.Get("other")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	err = db.Update(func(tx *kvstore.Tx) error {
+		if err := tx.Put("count", []byte("2")); err != nil {
+			return err
+		}
+		return tx.Delete("count")
+	})
+	c.Assert(err, gc.IsNil)
+	_, err = db.Get("count")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+
+	err = db.View(func(tx *kvstore.Tx) error {
+		return tx.Put("x", nil)
+	})
+	c.Assert(err, gc.ErrorMatches, "transaction is read-only")
+}
+
+func (s *kvstoreSuite) TestScan(c *gc.C) {
+	db := s.open(c)
+	defer db.Close()
+	for _, key := range []string{"detect/os", "detect/arch", "run/last", "detect/cpu"} {
+		c.Assert(db.Put(key, []byte(key)), gc.IsNil)
+	}
+	var keys []string
+	err := db.Update(func(tx *kvstore.Tx) error {
+		tx.Delete("detect/cpu")
+		tx.Put("detect/mem", []byte("m"))
+		return tx.Scan("detect/", func(key string, value []byte) error {
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(keys, jc.DeepEquals, []string{"detect/arch", "detect/mem", "detect/os"})
+
+	stop := fmt.Errorf("stop")
+	keys = nil
+	err = db.Scan("", func(key string, value []byte) error {
+		keys = append(keys, key)
+		return stop
+	})
+	c.Assert(err, gc.Equals, stop)
+	c.Assert(keys, jc.DeepEquals, []string{"detect/arch"})
+}
+
+func (s *kvstoreSuite) TestTTL(c *gc.C) {
+	db := s.open(c)
+	c.Assert(db.PutTTL("cache", []byte("v"), time.Minute), gc.IsNil)
+	c.Assert(db.PutTTL("bad", nil, 0), gc.ErrorMatches, "TTL 0s not valid")
+	s.assertValue(c, db, "cache", "v")
+
+	s.clock.Advance(time.Minute)
+	_, err := db.Get("cache")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	var keys []string
+	db.Scan("", func(key string, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	c.Assert(keys, gc.HasLen, 0)
+	c.Assert(db.Close(), gc.IsNil)
+
+	// Expiry survives reopening.
+	db = s.open(c)
+	defer db.Close()
+	_, err = db.Get("cache")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *kvstoreSuite) TestCompact(c *gc.C) {
+	db := s.open(c)
+	for i := 0; i < 100; i++ {
+		c.Assert(db.Put("key", []byte(fmt.Sprint(i))), gc.IsNil)
+	}
+	c.Assert(db.PutTTL("expiring", []byte("x"), time.Second), gc.IsNil)
+	s.clock.Advance(time.Second)
+	before := db.Size()
+	c.Assert(db.Compact(), gc.IsNil)
+	c.Assert(db.Size() < before/10, jc.IsTrue)
+	s.assertValue(c, db, "key", "99")
+
+	// The compacted store remains writable and reloads correctly.
+	c.Assert(db.Put("after", []byte("compact")), gc.IsNil)
+	c.Assert(db.Close(), gc.IsNil)
+	db = s.open(c)
+	defer db.Close()
+	s.assertValue(c, db, "key", "99")
+	s.assertValue(c, db, "after", "compact")
+	_, err := db.Get("expiring")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
@@ -0,0 +1,208 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+
+	"github.com/juju/utils/wal"
+)
+
+var logger = loggo.GetLogger("juju.utils.kvstore")
+
+type opKind byte
+
+const (
+	opPut    opKind = 1
+	opDelete opKind = 2
+
+	// opReset clears the store. It starts the snapshot written by
+	// Compact.
+	opReset opKind = 3
+)
+
+// op records a single change made by a transaction.
+type op struct {
+	kind    opKind
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+var errCorrupt = errors.New("corrupt transaction")
+
+// encodeOps encodes ops as the payload of a log record.
+func encodeOps(ops []*op) []byte {
+	var buf bytes.Buffer
+	var n [binary.MaxVarintLen64]byte
+	putUvarint := func(x uint64) {
+		buf.Write(n[:binary.PutUvarint(n[:], x)])
+	}
+	for _, o := range ops {
+		buf.WriteByte(byte(o.kind))
+		putUvarint(uint64(len(o.key)))
+		buf.WriteString(o.key)
+		if o.kind != opPut {
+			continue
+		}
+		putUvarint(uint64(len(o.value)))
+		buf.Write(o.value)
+		var expires int64
+		if !o.expires.IsZero() {
+			expires = o.expires.UnixNano()
+		}
+		buf.Write(n[:binary.PutVarint(n[:], expires)])
+	}
+	return buf.Bytes()
+}
+
+func decodeOps(data []byte) ([]*op, error) {
+	r := bytes.NewReader(data)
+	var ops []*op
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()) {
+			return nil, errCorrupt
+		}
+		b := make([]byte, n)
+		io.ReadFull(r, b)
+		return b, nil
+	}
+	for r.Len() > 0 {
+		kind, _ := r.ReadByte()
+		key, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		o := &op{kind: opKind(kind), key: string(key)}
+		switch o.kind {
+		case opPut:
+			if o.value, err = readBytes(); err != nil {
+				return nil, err
+			}
+			expires, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, errCorrupt
+			}
+			if expires != 0 {
+				o.expires = time.Unix(0, expires)
+			}
+		case opDelete, opReset:
+		default:
+			return nil, errCorrupt
+		}
+		ops = append(ops, o)
+	}
+	return ops, nil
+}
+
+// load replays the log into the index.
+func (db *DB) load() error {
+	sync := wal.SyncAlways
+	if db.opts.NoSync {
+		sync = wal.SyncNever
+	}
+	log, err := wal.Open(db.dir, wal.Options{Sync: sync})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = log.Replay(log.Start(), func(pos wal.Position, data []byte) error {
+		ops, err := decodeOps(data)
+		if err != nil {
+			return errors.Annotatef(err, "transaction at %v", pos)
+		}
+		db.apply(ops)
+		return nil
+	})
+	if err != nil {
+		log.Close()
+		return errors.Trace(err)
+	}
+	db.log = log
+	return nil
+}
+
+func (db *DB) apply(ops []*op) {
+	for _, o := range ops {
+		switch o.kind {
+		case opReset:
+			db.data = make(map[string]entry)
+		case opPut:
+			db.data[o.key] = entry{value: o.value, expires: o.expires}
+		case opDelete:
+			delete(db.data, o.key)
+		}
+	}
+}
+
+// commit appends the changes made by tx to the log and applies them.
+// It must be called with db.mu held.
+func (db *DB) commit(tx *Tx) error {
+	if len(tx.order) == 0 {
+		return nil
+	}
+	ops := make([]*op, len(tx.order))
+	for i, key := range tx.order {
+		ops[i] = tx.writes[key]
+	}
+	if _, err := db.log.Append(encodeOps(ops)); err != nil {
+		return errors.Annotate(err, "cannot write transaction")
+	}
+	db.apply(ops)
+	return nil
+}
+
+// Compact replaces the log with a snapshot of the entries that are
+// live, dropping overwritten, deleted and expired ones.
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return errors.New("store closed")
+	}
+	now := db.opts.Clock.Now()
+	ops := []*op{{kind: opReset}}
+	for key, e := range db.data {
+		if e.expired(now) {
+			delete(db.data, key)
+			continue
+		}
+		ops = append(ops, &op{kind: opPut, key: key, value: e.value, expires: e.expires})
+	}
+	// The snapshot starts a new segment so that everything before
+	// it can be removed. If we crash before then, replaying the old
+	// segments is harmless because the snapshot resets the store.
+	if err := db.log.Rotate(); err != nil {
+		return errors.Annotate(err, "cannot compact store")
+	}
+	pos, err := db.log.Append(encodeOps(ops))
+	if err == nil {
+		err = db.log.Sync()
+	}
+	if err == nil {
+		err = db.log.TruncateBefore(pos)
+	}
+	return errors.Annotate(err, "cannot compact store")
+}
+
+// Size returns the size in bytes of the log.
+func (db *DB) Size() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	segments, err := db.log.Segments()
+	if err != nil {
+		logger.Warningf("cannot determine size of store %q: %v", db.dir, err)
+	}
+	var size int64
+	for _, s := range segments {
+		size += s.Size
+	}
+	return size
+}
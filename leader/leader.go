@@ -0,0 +1,262 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package leader elects a single leader among processes on the same
+// host that compete for a lease stored in a shared directory.
+//
+// The lease records its holder and an expiry time, and is read and
+// written under an fslock.Lock. The leader renews the lease well before
+// it expires; other candidates take it over once it has expired. Each
+// change of leadership increments a fencing token, which the leader can
+// pass to the resources it manages so that they can reject requests
+// from a former leader that has not yet noticed its loss.
+package leader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	"launchpad.net/tomb"
+
+	"github.com/juju/utils"
+	"github.com/juju/utils/clock"
+	"github.com/juju/utils/fslock"
+)
+
+var logger = loggo.GetLogger("juju.utils.leader")
+
+// Params holds the parameters for New.
+type Params struct {
+	// Dir holds the directory shared by all the candidates.
+	Dir string
+
+	// Name names the lease. It must be a valid fslock lock name.
+	Name string
+
+	// ID identifies this candidate. It must be unique among the
+	// candidates.
+	ID string
+
+	// TTL holds how long a lease lasts without renewal. The leader
+	// renews it every TTL/3.
+	TTL time.Duration
+
+	// Clock is used to measure time. If nil, clock.WallClock is used.
+	Clock clock.Clock
+
+	// OnGain, if not nil, is called when this candidate becomes the
+	// leader, with the fencing token of its term.
+	OnGain func(token uint64)
+
+	// OnLoss, if not nil, is called when this candidate stops being
+	// the leader, including when the elector is stopped.
+	OnLoss func()
+}
+
+// lease holds the contents of the lease file.
+type lease struct {
+	Holder  string    `json:"holder"`
+	Token   uint64    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// Elector campaigns for leadership until it is stopped.
+type Elector struct {
+	params Params
+	lock   *fslock.Lock
+	tomb   tomb.Tomb
+
+	mu      sync.Mutex
+	leading bool
+	token   uint64
+	expires time.Time
+}
+
+// New starts campaigning for the lease described by params.
+func New(params Params) (*Elector, error) {
+	if params.ID == "" {
+		return nil, errors.NotValidf("empty candidate ID")
+	}
+	if params.TTL <= 0 {
+		return nil, errors.NotValidf("TTL %v", params.TTL)
+	}
+	if params.Clock == nil {
+		params.Clock = clock.WallClock
+	}
+	lock, err := fslock.NewLock(params.Dir, params.Name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	e := &Elector{
+		params: params,
+		lock:   lock,
+	}
+	go func() {
+		defer e.tomb.Done()
+		e.tomb.Kill(e.loop())
+	}()
+	return e, nil
+}
+
+// IsLeader reports whether the candidate currently holds the lease and,
+// if so, the fencing token of its term.
+func (e *Elector) IsLeader() (bool, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.leading {
+		return false, 0
+	}
+	return true, e.token
+}
+
+// Kill asks the elector to stop without waiting for it to do so. If it
+// is the leader, it resigns.
+func (e *Elector) Kill() {
+	e.tomb.Kill(nil)
+}
+
+// Wait waits for the elector to stop and returns any error encountered.
+func (e *Elector) Wait() error {
+	return e.tomb.Wait()
+}
+
+// Stop stops the elector and waits for it to finish.
+func (e *Elector) Stop() error {
+	e.Kill()
+	return e.Wait()
+}
+
+func (e *Elector) loop() error {
+	defer e.resign()
+	interval := e.params.TTL / 3
+	for {
+		e.campaign()
+		select {
+		case <-e.tomb.Dying():
+			return tomb.ErrDying
+		case <-e.params.Clock.After(interval):
+		}
+	}
+}
+
+// campaign tries to take or renew the lease, and reports any change in
+// leadership.
+func (e *Elector) campaign() {
+	now := e.params.Clock.Now()
+	var held lease
+	err := e.withLease(func(l *lease) bool {
+		if l.Holder != e.params.ID && l.Expires.After(now) {
+			held = *l
+			return false
+		}
+		if l.Holder != e.params.ID {
+			l.Token++
+			l.Holder = e.params.ID
+		}
+		l.Expires = now.Add(e.params.TTL)
+		held = *l
+		return true
+	})
+	if err != nil {
+		logger.Warningf("cannot renew lease %q: %v", e.params.Name, err)
+		e.mu.Lock()
+		expired := e.leading && !e.expires.After(now)
+		e.mu.Unlock()
+		if expired {
+			e.setLeader(false, 0, time.Time{})
+		}
+		return
+	}
+	if held.Holder == e.params.ID {
+		e.setLeader(true, held.Token, held.Expires)
+	} else {
+		e.setLeader(false, 0, time.Time{})
+	}
+}
+
+// resign gives up the lease if this candidate holds it.
+func (e *Elector) resign() {
+	e.mu.Lock()
+	leading := e.leading
+	e.mu.Unlock()
+	if !leading {
+		return
+	}
+	err := e.withLease(func(l *lease) bool {
+		if l.Holder != e.params.ID {
+			return false
+		}
+		l.Holder = ""
+		l.Expires = time.Time{}
+		return true
+	})
+	if err != nil {
+		logger.Warningf("cannot release lease %q: %v", e.params.Name, err)
+	}
+	e.setLeader(false, 0, time.Time{})
+}
+
+func (e *Elector) setLeader(leading bool, token uint64, expires time.Time) {
+	e.mu.Lock()
+	was := e.leading
+	e.leading, e.token, e.expires = leading, token, expires
+	e.mu.Unlock()
+	switch {
+	case leading && !was:
+		logger.Infof("%s became leader of %q with token %d", e.params.ID, e.params.Name, token)
+		if e.params.OnGain != nil {
+			e.params.OnGain(token)
+		}
+	case !leading && was:
+		logger.Infof("%s is no longer leader of %q", e.params.ID, e.params.Name)
+		if e.params.OnLoss != nil {
+			e.params.OnLoss()
+		}
+	}
+}
+
+// withLease calls f with the current lease while holding the lock, and
+// writes the lease back if f returns true. A lock left behind by a
+// candidate that died while holding it is broken after the TTL.
+func (e *Elector) withLease(f func(*lease) bool) error {
+	if err := e.lock.LockWithTimeout(e.params.TTL, e.params.ID); err != nil {
+		if err != fslock.ErrTimeout {
+			return errors.Trace(err)
+		}
+		logger.Warningf("breaking lock %q held by %q", e.params.Name, e.lock.Message())
+		if err := e.lock.BreakLock(); err != nil {
+			return errors.Trace(err)
+		}
+		if err := e.lock.LockWithTimeout(e.params.TTL, e.params.ID); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	defer e.lock.Unlock()
+
+	path := filepath.Join(e.params.Dir, e.params.Name+".lease")
+	var l lease
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return errors.Trace(err)
+	default:
+		if err := json.Unmarshal(data, &l); err != nil {
+			return errors.Annotate(err, "cannot parse lease")
+		}
+	}
+	if !f(&l) {
+		return nil
+	}
+	data, err = json.Marshal(l)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(utils.AtomicWriteFile(path, data, 0644))
+}
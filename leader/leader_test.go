@@ -0,0 +1,149 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package leader_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/fslock"
+	"github.com/juju/utils/leader"
+	"github.com/juju/utils/testing/leaktest"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type leaderSuite struct {
+	testing.IsolationSuite
+	dir   string
+	clock *testclock.Clock
+}
+
+var _ = gc.Suite(&leaderSuite{})
+
+const ttl = 30 * time.Second
+
+var epoch = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (s *leaderSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.PatchValue(&fslock.LockWaitDelay, time.Millisecond)
+	s.dir = c.MkDir()
+	s.clock = testclock.New(epoch)
+}
+
+type candidate struct {
+	*leader.Elector
+	events chan string
+}
+
+func (s *leaderSuite) start(c *gc.C, id string) *candidate {
+	events := make(chan string, 10)
+	e, err := leader.New(leader.Params{
+		Dir:   s.dir,
+		Name:  "shipper",
+		ID:    id,
+		TTL:   ttl,
+		Clock: s.clock,
+		OnGain: func(token uint64) {
+			events <- fmt.Sprintf("gain %d", token)
+		},
+		OnLoss: func() {
+			events <- "loss"
+		},
+	})
+	c.Assert(err, gc.IsNil)
+	return &candidate{e, events}
+}
+
+func (cand *candidate) assertEvent(c *gc.C, expect string) {
+	select {
+	case ev := <-cand.events:
+		c.Assert(ev, gc.Equals, expect)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timed out waiting for %q", expect)
+	}
+}
+
+func (cand *candidate) assertNoEvent(c *gc.C) {
+	select {
+	case ev := <-cand.events:
+		c.Fatalf("unexpected event %q", ev)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func (s *leaderSuite) TestSingleLeader(c *gc.C) {
+	defer leaktest.Check(c)()
+	a := s.start(c, "a")
+	defer a.Stop()
+	a.assertEvent(c, "gain 1")
+	ok, token := a.IsLeader()
+	c.Assert(ok, jc.IsTrue)
+	c.Assert(token, gc.Equals, uint64(1))
+
+	b := s.start(c, "b")
+	defer b.Stop()
+	// Wait for both to have campaigned.
+	c.Assert(s.clock.WaitAdvance(ttl/3, 5*time.Second, 2), gc.IsNil)
+	c.Assert(s.clock.WaitAdvance(ttl/3, 5*time.Second, 2), gc.IsNil)
+	b.assertNoEvent(c)
+	ok, _ = b.IsLeader()
+	c.Assert(ok, jc.IsFalse)
+
+	// Renewal keeps the lease with a beyond its original TTL.
+	c.Assert(s.clock.WaitAdvance(ttl/3, 5*time.Second, 2), gc.IsNil)
+	c.Assert(s.clock.WaitAdvance(ttl/3, 5*time.Second, 2), gc.IsNil)
+	a.assertNoEvent(c)
+	b.assertNoEvent(c)
+}
+
+func (s *leaderSuite) TestResignOnStop(c *gc.C) {
+	defer leaktest.Check(c)()
+	a := s.start(c, "a")
+	a.assertEvent(c, "gain 1")
+	b := s.start(c, "b")
+	defer b.Stop()
+	c.Assert(s.clock.WaitAdvance(0, 5*time.Second, 2), gc.IsNil)
+
+	c.Assert(a.Stop(), gc.IsNil)
+	a.assertEvent(c, "loss")
+	ok, _ := a.IsLeader()
+	c.Assert(ok, jc.IsFalse)
+
+	c.Assert(s.clock.WaitAdvance(ttl/3, 5*time.Second, 1), gc.IsNil)
+	b.assertEvent(c, "gain 2")
+}
+
+func (s *leaderSuite) TestTakeOverExpiredLease(c *gc.C) {
+	defer leaktest.Check(c)()
+	// A leader that died without resigning.
+	lease := fmt.Sprintf(`{"holder": "dead", "token": 7, "expires": %q}`, epoch.Add(ttl).Format(time.RFC3339))
+	err := ioutil.WriteFile(filepath.Join(s.dir, "shipper.lease"), []byte(lease), 0644)
+	c.Assert(err, gc.IsNil)
+
+	b := s.start(c, "b")
+	defer b.Stop()
+	for i := 0; i < 2; i++ {
+		c.Assert(s.clock.WaitAdvance(ttl/3, 5*time.Second, 1), gc.IsNil)
+	}
+	b.assertNoEvent(c)
+	c.Assert(s.clock.WaitAdvance(ttl/3, 5*time.Second, 1), gc.IsNil)
+	b.assertEvent(c, "gain 8")
+}
+
+func (s *leaderSuite) TestParamsErrors(c *gc.C) {
+	defer leaktest.Check(c)()
+	_, err := leader.New(leader.Params{Dir: s.dir, Name: "x", TTL: ttl})
+	c.Assert(err, gc.ErrorMatches, "empty candidate ID not valid")
+	_, err = leader.New(leader.Params{Dir: s.dir, Name: "x", ID: "a"})
+	c.Assert(err, gc.ErrorMatches, "TTL 0s not valid")
+	_, err = leader.New(leader.Params{Dir: s.dir, Name: "Bad Name", ID: "a", TTL: ttl})
+	c.Assert(err, gc.ErrorMatches, "Invalid lock name .*")
+}
@@ -0,0 +1,277 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package otp generates and validates one-time passwords as used for
+// two-factor authentication: counter-based HOTP codes (RFC 4226) and
+// time-based TOTP codes (RFC 6238).
+//
+// Secrets are handled in the base32 form that authenticator apps use,
+// and URI returns the otpauth:// URI that such apps enrol from,
+// usually by scanning it as a QR code.
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils"
+)
+
+// ErrInvalidCode is returned when a code does not validate.
+var ErrInvalidCode = errors.New("invalid one-time password")
+
+// Algorithm identifies the HMAC hash function used to generate codes.
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+func (a Algorithm) hash() (func() hash.Hash, error) {
+	switch a {
+	case SHA1, "":
+		return sha1.New, nil
+	case SHA256:
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
+	}
+	return nil, errors.NotValidf("algorithm %q", a)
+}
+
+// Options holds the parameters for generating and validating codes.
+// The zero value holds the parameters that authenticator apps assume.
+type Options struct {
+	// Digits holds the number of digits in a code, from 6 to 8. If
+	// zero, 6 is used.
+	Digits int
+
+	// Algorithm holds the hash function. If empty, SHA1 is used.
+	Algorithm Algorithm
+
+	// Period holds the time step for TOTP codes. If zero, 30
+	// seconds is used.
+	Period time.Duration
+
+	// Window holds the number of steps either side of the current
+	// time for which a TOTP code is accepted, allowing for clock
+	// drift, or the number of counters ahead of the expected one
+	// for which an HOTP code is accepted, allowing for codes that
+	// were generated but not used. If zero, no drift is allowed.
+	Window int
+}
+
+func (o Options) withDefaults() (Options, error) {
+	if o.Digits == 0 {
+		o.Digits = 6
+	}
+	if o.Digits < 6 || o.Digits > 8 {
+		return o, errors.NotValidf("%d digits", o.Digits)
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = SHA1
+	}
+	if o.Period == 0 {
+		o.Period = 30 * time.Second
+	}
+	if o.Period < time.Second {
+		return o, errors.NotValidf("period %v", o.Period)
+	}
+	if o.Window < 0 {
+		return o, errors.NotValidf("window %d", o.Window)
+	}
+	return o, nil
+}
+
+// GenerateSecret returns a new random 160-bit secret in base32.
+func GenerateSecret() (string, error) {
+	b, err := utils.RandomBytes(20)
+	if err != nil {
+		return "", errors.Annotate(err, "cannot generate secret")
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// decodeSecret decodes a base32 secret, ignoring case, spaces and
+// padding as authenticator apps do.
+func decodeSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	s = strings.TrimRight(s, "=")
+	if n := len(s) % 8; n != 0 {
+		s += strings.Repeat("=", 8-n)
+	}
+	key, err := base32.StdEncoding.DecodeString(s)
+	if err != nil || len(key) == 0 {
+		return nil, errors.NotValidf("secret")
+	}
+	return key, nil
+}
+
+// HOTP returns the code for the given counter.
+func HOTP(secret string, counter uint64, opts Options) (string, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return generate(key, counter, opts)
+}
+
+// TOTP returns the code for time t.
+func TOTP(secret string, t time.Time, opts Options) (string, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return HOTP(secret, step(t, opts.Period), opts)
+}
+
+func step(t time.Time, period time.Duration) uint64 {
+	return uint64(t.Unix()) / uint64(period/time.Second)
+}
+
+func generate(key []byte, counter uint64, opts Options) (string, error) {
+	h, err := opts.Algorithm.hash()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	m := hmac.New(h, key)
+	m.Write(msg[:])
+	sum := m.Sum(nil)
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < opts.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", opts.Digits, code%mod), nil
+}
+
+// ValidateHOTP checks code against the codes for counter and the
+// opts.Window counters after it. It returns the counter that matched;
+// the caller must store the next counter so that the code cannot be
+// used again. It returns ErrInvalidCode if no code matches.
+func ValidateHOTP(code, secret string, counter uint64, opts Options) (uint64, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return match(code, key, counter, counter+uint64(opts.Window), opts)
+}
+
+// ValidateTOTP checks code against the codes for time t and the
+// opts.Window time steps either side of it. It returns the time step
+// that matched; the caller should reject later codes for the same or
+// an earlier step so that a code cannot be used twice. It returns
+// ErrInvalidCode if no code matches.
+func ValidateTOTP(code, secret string, t time.Time, opts Options) (uint64, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	now := step(t, opts.Period)
+	first := uint64(0)
+	if now > uint64(opts.Window) {
+		first = now - uint64(opts.Window)
+	}
+	return match(code, key, first, now+uint64(opts.Window), opts)
+}
+
+// match returns the counter in [first, last] whose code is code. Every
+// candidate is compared in constant time, so the time taken does not
+// reveal which, if any, matched.
+func match(code string, key []byte, first, last uint64, opts Options) (uint64, error) {
+	found, matched := false, uint64(0)
+	for c := first; c <= last; c++ {
+		want, err := generate(key, c, opts)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 && !found {
+			found, matched = true, c
+		}
+	}
+	if !found {
+		return 0, ErrInvalidCode
+	}
+	return matched, nil
+}
+
+// Kind identifies the kind of one-time password in a provisioning URI.
+type Kind string
+
+const (
+	KindHOTP Kind = "hotp"
+	KindTOTP Kind = "totp"
+)
+
+// URI returns the otpauth:// URI from which authenticator apps enrol
+// an account. The issuer names the service and account the user's
+// account within it. For HOTP, counter holds the initial counter; it
+// is ignored for TOTP.
+func URI(kind Kind, issuer, account, secret string, counter uint64, opts Options) (string, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if _, err := decodeSecret(secret); err != nil {
+		return "", errors.Trace(err)
+	}
+	if _, err := opts.Algorithm.hash(); err != nil {
+		return "", errors.Trace(err)
+	}
+	label := account
+	if issuer != "" {
+		label = issuer + ":" + account
+	}
+	q := url.Values{}
+	q.Set("secret", strings.TrimRight(strings.ToUpper(strings.Replace(secret, " ", "", -1)), "="))
+	if issuer != "" {
+		q.Set("issuer", issuer)
+	}
+	q.Set("algorithm", string(opts.Algorithm))
+	q.Set("digits", fmt.Sprint(opts.Digits))
+	switch kind {
+	case KindTOTP:
+		q.Set("period", fmt.Sprint(int(opts.Period/time.Second)))
+	case KindHOTP:
+		q.Set("counter", fmt.Sprint(counter))
+	default:
+		return "", errors.NotValidf("kind %q", kind)
+	}
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     string(kind),
+		Path:     "/" + label,
+		RawQuery: q.Encode(),
+	}
+	return u.String(), nil
+}
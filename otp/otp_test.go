@@ -0,0 +1,126 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package otp_test
+
+import (
+	"encoding/base32"
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/otp"
+)
+
+type otpSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&otpSuite{})
+
+func secret(s string) string {
+	return base32.StdEncoding.EncodeToString([]byte(s))
+}
+
+// rfc4226Codes holds the test values from RFC 4226 appendix D.
+var rfc4226Codes = []string{
+	"755224", "287082", "359152", "969429", "338314",
+	"254676", "287922", "162583", "399871", "520489",
+}
+
+func (s *otpSuite) TestHOTP(c *gc.C) {
+	key := secret("12345678901234567890")
+	for i, expect := range rfc4226Codes {
+		code, err := otp.HOTP(key, uint64(i), otp.Options{})
+		c.Assert(err, gc.IsNil)
+		c.Assert(code, gc.Equals, expect)
+	}
+}
+
+func (s *otpSuite) TestTOTP(c *gc.C) {
+	// Test values from RFC 6238 appendix B.
+	keys := map[otp.Algorithm]string{
+		otp.SHA1:   secret("12345678901234567890"),
+		otp.SHA256: secret("12345678901234567890123456789012"),
+		otp.SHA512: secret("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	for i, test := range []struct {
+		time      int64
+		algorithm otp.Algorithm
+		expect    string
+	}{
+		{59, otp.SHA1, "94287082"},
+		{59, otp.SHA256, "46119246"},
+		{59, otp.SHA512, "90693936"},
+		{1111111109, otp.SHA1, "07081804"},
+		{1111111109, otp.SHA256, "68084774"},
+		{20000000000, otp.SHA512, "47863826"},
+	} {
+		c.Logf("test %d", i)
+		opts := otp.Options{Digits: 8, Algorithm: test.algorithm}
+		code, err := otp.TOTP(keys[test.algorithm], time.Unix(test.time, 0), opts)
+		c.Assert(err, gc.IsNil)
+		c.Assert(code, gc.Equals, test.expect)
+	}
+}
+
+func (s *otpSuite) TestValidateTOTP(c *gc.C) {
+	key, err := otp.GenerateSecret()
+	c.Assert(err, gc.IsNil)
+	now := time.Unix(1500000000, 0)
+	code, err := otp.TOTP(key, now, otp.Options{})
+	c.Assert(err, gc.IsNil)
+
+	step, err := otp.ValidateTOTP(code, key, now, otp.Options{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(step, gc.Equals, uint64(1500000000/30))
+
+	late := now.Add(40 * time.Second)
+	_, err = otp.ValidateTOTP(code, key, late, otp.Options{})
+	c.Assert(err, gc.Equals, otp.ErrInvalidCode)
+	step, err = otp.ValidateTOTP(code, key, late, otp.Options{Window: 1})
+	c.Assert(err, gc.IsNil)
+	c.Assert(step, gc.Equals, uint64(1500000000/30))
+}
+
+func (s *otpSuite) TestValidateHOTP(c *gc.C) {
+	key := secret("12345678901234567890")
+	counter, err := otp.ValidateHOTP(rfc4226Codes[3], key, 1, otp.Options{Window: 3})
+	c.Assert(err, gc.IsNil)
+	c.Assert(counter, gc.Equals, uint64(3))
+	_, err = otp.ValidateHOTP(rfc4226Codes[3], key, 4, otp.Options{Window: 3})
+	c.Assert(err, gc.Equals, otp.ErrInvalidCode)
+	_, err = otp.ValidateHOTP(rfc4226Codes[3], key, 0, otp.Options{Window: 2})
+	c.Assert(err, gc.Equals, otp.ErrInvalidCode)
+}
+
+func (s *otpSuite) TestSecretForms(c *gc.C) {
+	key := secret("12345678901234567890")
+	loose := "gezd gnbv gy3t qojq gezd gnbv gy3t qojq"
+	c.Assert(key, gc.Equals, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	code, err := otp.HOTP(loose, 0, otp.Options{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(code, gc.Equals, rfc4226Codes[0])
+
+	_, err = otp.HOTP("not base32!", 0, otp.Options{})
+	c.Assert(err, gc.ErrorMatches, "secret not valid")
+	_, err = otp.HOTP(key, 0, otp.Options{Digits: 4})
+	c.Assert(err, gc.ErrorMatches, "4 digits not valid")
+	_, err = otp.HOTP(key, 0, otp.Options{Algorithm: "MD5"})
+	c.Assert(err, gc.ErrorMatches, `algorithm "MD5" not valid`)
+}
+
+func (s *otpSuite) TestURI(c *gc.C) {
+	key := "JBSWY3DPEHPK3PXP"
+	uri, err := otp.URI(otp.KindTOTP, "Example", "alice@example.com", key, 0, otp.Options{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(uri, gc.Equals, "otpauth://totp/Example:alice@example.com?algorithm=SHA1&digits=6&issuer=Example&period=30&secret=JBSWY3DPEHPK3PXP")
+
+	uri, err = otp.URI(otp.KindHOTP, "", "bob", key, 7, otp.Options{Digits: 8})
+	c.Assert(err, gc.IsNil)
+	c.Assert(uri, gc.Equals, "otpauth://hotp/bob?algorithm=SHA1&counter=7&digits=8&secret=JBSWY3DPEHPK3PXP")
+
+	_, err = otp.URI("sms", "", "bob", key, 0, otp.Options{})
+	c.Assert(err, gc.ErrorMatches, `kind "sms" not valid`)
+}
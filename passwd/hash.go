@@ -0,0 +1,217 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package passwd hashes and verifies passwords for local accounts and
+// checks them against a password policy.
+//
+// Hashes are self-describing strings: argon2id hashes use the PHC
+// string format ("$argon2id$v=19$m=...,t=...,p=...$salt$hash") and
+// bcrypt hashes use the usual "$2a$" format. The prefix records the
+// algorithm and its parameters, so stored hashes can be upgraded to
+// stronger parameters when a user next logs in; see VerifyUpgrade.
+package passwd
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/juju/utils"
+)
+
+// ErrMismatch is returned by Verify and VerifyUpgrade when the password
+// does not match the hash.
+var ErrMismatch = errors.New("password does not match")
+
+// Algorithm identifies a password hashing algorithm.
+type Algorithm string
+
+const (
+	Argon2id Algorithm = "argon2id"
+	Bcrypt   Algorithm = "bcrypt"
+)
+
+// Params holds the algorithm and parameters used to hash passwords.
+type Params struct {
+	Algorithm Algorithm
+
+	// Time, Memory (in KiB) and Threads are the argon2id
+	// parameters.
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+
+	// Cost is the bcrypt cost.
+	Cost int
+}
+
+// Default holds the parameters used by Hash.
+var Default = Params{
+	Algorithm: Argon2id,
+	Time:      3,
+	Memory:    64 * 1024,
+	Threads:   4,
+}
+
+const (
+	argon2Version = 0x13
+	saltSize      = 16
+	keySize       = 32
+)
+
+// Hash returns the hash of password using the Default parameters.
+func Hash(password string) (string, error) {
+	return HashWith(password, Default)
+}
+
+// HashWith returns the hash of password using the given parameters.
+func HashWith(password string, p Params) (string, error) {
+	switch p.Algorithm {
+	case Argon2id:
+		if err := p.validate(); err != nil {
+			return "", errors.Trace(err)
+		}
+		salt, err := utils.RandomBytes(saltSize)
+		if err != nil {
+			return "", errors.Annotate(err, "cannot generate salt")
+		}
+		key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, keySize)
+		return formatArgon2(p, salt, key), nil
+	case Bcrypt:
+		if p.Cost < bcrypt.MinCost || p.Cost > bcrypt.MaxCost {
+			return "", errors.NotValidf("bcrypt cost %d", p.Cost)
+		}
+		h, err := bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+		if err != nil {
+			return "", errors.Annotate(err, "cannot hash password")
+		}
+		return string(h), nil
+	}
+	return "", errors.NotValidf("password hash algorithm %q", p.Algorithm)
+}
+
+// maxMemory limits the memory, in KiB, that verifying an argon2id hash
+// may demand.
+const maxMemory = 4 * 1024 * 1024
+
+func (p Params) validate() error {
+	if p.Time < 1 || p.Threads < 1 || p.Memory < 8*uint32(p.Threads) || p.Memory > maxMemory {
+		return errors.NotValidf("argon2id parameters t=%d m=%d p=%d", p.Time, p.Memory, p.Threads)
+	}
+	return nil
+}
+
+func formatArgon2(p Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// parsed holds a decoded hash.
+type parsed struct {
+	params Params
+	salt   []byte
+	key    []byte
+}
+
+func parse(hash string) (*parsed, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		p := Params{Algorithm: Argon2id}
+		var version int
+		fields := strings.Split(hash, "$")
+		if len(fields) != 6 {
+			return nil, errors.NotValidf("argon2id hash")
+		}
+		if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2Version {
+			return nil, errors.NotSupportedf("argon2id version %q", fields[2])
+		}
+		if _, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil || p.validate() != nil {
+			return nil, errors.NotValidf("argon2id parameters %q", fields[3])
+		}
+		salt, err1 := base64.RawStdEncoding.DecodeString(fields[4])
+		key, err2 := base64.RawStdEncoding.DecodeString(fields[5])
+		if err1 != nil || err2 != nil || len(key) == 0 {
+			return nil, errors.NotValidf("argon2id hash")
+		}
+		return &parsed{params: p, salt: salt, key: key}, nil
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return nil, errors.NotValidf("bcrypt hash")
+		}
+		return &parsed{params: Params{Algorithm: Bcrypt, Cost: cost}}, nil
+	}
+	return nil, errors.NotValidf("password hash format")
+}
+
+// Verify checks password against hash, which must have been returned by
+// Hash or HashWith. It returns ErrMismatch if the password is wrong.
+func Verify(password, hash string) error {
+	p, err := parse(hash)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch p.params.Algorithm {
+	case Argon2id:
+		key := argon2.IDKey([]byte(password), p.salt, p.params.Time, p.params.Memory, p.params.Threads, uint32(len(p.key)))
+		if subtle.ConstantTimeCompare(key, p.key) != 1 {
+			return ErrMismatch
+		}
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return ErrMismatch
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// NeedsRehash reports whether hash was made with an algorithm or
+// parameters other than p.
+func NeedsRehash(hash string, p Params) bool {
+	h, err := parse(hash)
+	if err != nil {
+		return true
+	}
+	if h.params.Algorithm != p.Algorithm {
+		return true
+	}
+	switch p.Algorithm {
+	case Argon2id:
+		return h.params.Time != p.Time || h.params.Memory != p.Memory ||
+			h.params.Threads != p.Threads || len(h.key) != keySize
+	case Bcrypt:
+		return h.params.Cost != p.Cost
+	}
+	return true
+}
+
+// VerifyUpgrade checks password against hash as Verify does. If the
+// password is correct, it returns the hash to store from now on: hash
+// itself if it already uses the parameters p, or a new hash of the
+// password made with p. Callers should store the result whenever it
+// differs from hash.
+func VerifyUpgrade(password, hash string, p Params) (string, error) {
+	if err := Verify(password, hash); err != nil {
+		return "", err
+	}
+	if !NeedsRehash(hash, p) {
+		return hash, nil
+	}
+	newHash, err := HashWith(password, p)
+	if err != nil {
+		return "", errors.Annotate(err, "cannot upgrade password hash")
+	}
+	return newHash, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package passwd_test
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/passwd"
+)
+
+type hashSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&hashSuite{})
+
+// Cheap parameters keep the tests fast.
+var (
+	fastArgon2id = passwd.Params{Algorithm: passwd.Argon2id, Time: 1, Memory: 64, Threads: 1}
+	fastBcrypt   = passwd.Params{Algorithm: passwd.Bcrypt, Cost: 4}
+)
+
+func (s *hashSuite) TestHashVerify(c *gc.C) {
+	for _, p := range []passwd.Params{fastArgon2id, fastBcrypt} {
+		c.Logf("algorithm %s", p.Algorithm)
+		h, err := passwd.HashWith("s3cret", p)
+		c.Assert(err, gc.IsNil)
+		c.Assert(passwd.Verify("s3cret", h), gc.IsNil)
+		c.Assert(passwd.Verify("wrong", h), gc.Equals, passwd.ErrMismatch)
+
+		other, err := passwd.HashWith("s3cret", p)
+		c.Assert(err, gc.IsNil)
+		c.Assert(other, gc.Not(gc.Equals), h)
+	}
+}
+
+func (s *hashSuite) TestArgon2idFormat(c *gc.C) {
+	h, err := passwd.HashWith("pw", fastArgon2id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(h, gc.Matches, `\$argon2id\$v=19\$m=64,t=1,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}`)
+}
+
+func (s *hashSuite) TestInvalidHashes(c *gc.C) {
+	for _, h := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=64,t=1,p=1$salt",
+		"$argon2id$v=19$m=bad$c2FsdA$a2V5",
+		"$argon2id$v=19$m=99999999999,t=1,p=1$c2FsdA$a2V5",
+		"$2a$xx$notbcrypt",
+	} {
+		c.Logf("hash %q", h)
+		err := passwd.Verify("pw", h)
+		c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	}
+	err := passwd.Verify("pw", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5")
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+
+	_, err = passwd.HashWith("pw", passwd.Params{Algorithm: "md5"})
+	c.Assert(err, gc.ErrorMatches, `password hash algorithm "md5" not valid`)
+	_, err = passwd.HashWith("pw", passwd.Params{Algorithm: passwd.Bcrypt, Cost: 100})
+	c.Assert(err, gc.ErrorMatches, "bcrypt cost 100 not valid")
+}
+
+func (s *hashSuite) TestVerifyUpgrade(c *gc.C) {
+	old, err := passwd.HashWith("pw", fastBcrypt)
+	c.Assert(err, gc.IsNil)
+	c.Assert(passwd.NeedsRehash(old, fastBcrypt), jc.IsFalse)
+	c.Assert(passwd.NeedsRehash(old, fastArgon2id), jc.IsTrue)
+
+	_, err = passwd.VerifyUpgrade("wrong", old, fastArgon2id)
+	c.Assert(err, gc.Equals, passwd.ErrMismatch)
+
+	same, err := passwd.VerifyUpgrade("pw", old, fastBcrypt)
+	c.Assert(err, gc.IsNil)
+	c.Assert(same, gc.Equals, old)
+
+	upgraded, err := passwd.VerifyUpgrade("pw", old, fastArgon2id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(strings.HasPrefix(upgraded, "$argon2id$"), jc.IsTrue)
+	c.Assert(passwd.Verify("pw", upgraded), gc.IsNil)
+
+	// Stronger parameters for the same algorithm also upgrade.
+	stronger := fastArgon2id
+	stronger.Time = 2
+	c.Assert(passwd.NeedsRehash(upgraded, stronger), jc.IsTrue)
+	upgraded, err = passwd.VerifyUpgrade("pw", upgraded, stronger)
+	c.Assert(err, gc.IsNil)
+	c.Assert(upgraded, gc.Matches, `\$argon2id\$v=19\$m=64,t=2,p=1\$.*`)
+}
@@ -0,0 +1,138 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package passwd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/juju/errors"
+)
+
+// Policy describes the passwords that are acceptable.
+type Policy struct {
+	// MinLength and MaxLength, if non-zero, bound the length of
+	// the password in characters.
+	MinLength int
+	MaxLength int
+
+	// MinEntropy, if non-zero, holds the minimum entropy in bits,
+	// as estimated by Entropy.
+	MinEntropy float64
+
+	// Denylist holds passwords that are not allowed, compared
+	// without regard to case.
+	Denylist []string
+}
+
+// DefaultPolicy holds a reasonable policy for interactive accounts.
+var DefaultPolicy = Policy{
+	MinLength:  10,
+	MaxLength:  1024,
+	MinEntropy: 45,
+	Denylist:   CommonPasswords,
+}
+
+// CommonPasswords holds some of the most commonly used passwords.
+var CommonPasswords = []string{
+	"123456", "123456789", "12345678", "1234567890", "password",
+	"password1", "password123", "qwerty", "qwerty123", "qwertyuiop",
+	"abc123", "111111", "1q2w3e4r", "iloveyou", "letmein",
+	"welcome", "admin", "administrator", "changeme", "passw0rd",
+	"trustno1", "sunshine", "monkey", "dragon", "football",
+}
+
+// PolicyError is returned by Policy.Check when a password does not
+// satisfy the policy.
+type PolicyError struct {
+	// Problems holds a description of each way in which the
+	// password fails the policy.
+	Problems []string
+}
+
+// Error implements error.
+func (e *PolicyError) Error() string {
+	return "password not acceptable: " + strings.Join(e.Problems, "; ")
+}
+
+// IsPolicyError reports whether the cause of err is a *PolicyError.
+func IsPolicyError(err error) bool {
+	_, ok := errors.Cause(err).(*PolicyError)
+	return ok
+}
+
+// Check returns a *PolicyError if password does not satisfy the policy.
+func (p Policy) Check(password string) error {
+	var problems []string
+	n := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && n < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d characters", p.MaxLength))
+	}
+	for _, denied := range p.Denylist {
+		if strings.EqualFold(password, denied) {
+			problems = append(problems, "is too common")
+			break
+		}
+	}
+	if p.MinEntropy > 0 && Entropy(password) < p.MinEntropy {
+		problems = append(problems, "is too easy to guess")
+	}
+	if len(problems) > 0 {
+		return &PolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// Entropy returns a rough estimate in bits of the entropy of password,
+// assuming each character is drawn at random from the classes of
+// character (lower case, upper case, digits, symbols and others) that
+// the password uses. Characters that repeat an earlier one count for
+// less, so "aaaaaaaa" scores much lower than "abcdefgh".
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	seen := make(map[rune]int)
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+		seen[r]++
+	}
+	pool := 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if c.used {
+			pool += c.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+	var bits float64
+	for _, count := range seen {
+		// The first occurrence counts fully, each repeat half as
+		// much as the one before.
+		for i := 0; i < count; i++ {
+			bits += perChar / math.Pow(2, float64(i))
+		}
+	}
+	return bits
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package passwd_test
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/passwd"
+)
+
+type policySuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&policySuite{})
+
+func (s *policySuite) TestCheck(c *gc.C) {
+	policy := passwd.Policy{
+		MinLength:  8,
+		MaxLength:  20,
+		MinEntropy: 30,
+		Denylist:   []string{"Password123"},
+	}
+	for i, test := range []struct {
+		password string
+		expect   string
+	}{{
+		password: "k9#Lm2!vQz",
+	}, {
+		password: "short",
+		expect:   "password not acceptable: must be at least 8 characters; is too easy to guess",
+	}, {
+		password: "password123",
+		expect:   "password not acceptable: is too common",
+	}, {
+		password: "aaaaaaaaaaaa",
+		expect:   "password not acceptable: is too easy to guess",
+	}, {
+		password: "this password is far too long",
+		expect:   "password not acceptable: must be at most 20 characters",
+	}} {
+		c.Logf("test %d: %q", i, test.password)
+		err := policy.Check(test.password)
+		if test.expect == "" {
+			c.Assert(err, gc.IsNil)
+			continue
+		}
+		c.Assert(err, gc.ErrorMatches, test.expect)
+		c.Assert(err, jc.Satisfies, passwd.IsPolicyError)
+	}
+	c.Assert(passwd.IsPolicyError(errors.Annotate(policy.Check(""), "x")), jc.IsTrue)
+	c.Assert(passwd.IsPolicyError(fmt.Errorf("other")), jc.IsFalse)
+}
+
+func (s *policySuite) TestDefaultPolicy(c *gc.C) {
+	c.Assert(passwd.DefaultPolicy.Check("letmein"), gc.ErrorMatches, ".*is too common.*")
+	c.Assert(passwd.DefaultPolicy.Check("correct horse battery staple"), gc.IsNil)
+}
+
+func (s *policySuite) TestEntropy(c *gc.C) {
+	c.Assert(passwd.Entropy(""), gc.Equals, 0.0)
+	c.Assert(passwd.Entropy("abcdefgh") > 3*passwd.Entropy("aaaaaaaa"), jc.IsTrue)
+	c.Assert(passwd.Entropy("abcd1234") > passwd.Entropy("abcdefgh"), jc.IsTrue)
+	c.Assert(passwd.Entropy("aB3$") > passwd.Entropy("abcd"), jc.IsTrue)
+}
@@ -4,7 +4,6 @@
 package utils
 
 import (
-	"crypto/rand"
 	"crypto/sha512"
 	"encoding/base64"
 	"fmt"
@@ -27,7 +26,7 @@ var MinAgentPasswordLength = base64.StdEncoding.EncodedLen(randomPasswordBytes)
 // RandomBytes returns n random bytes.
 func RandomBytes(n int) ([]byte, error) {
 	buf := make([]byte, n)
-	_, err := io.ReadFull(rand.Reader, buf)
+	_, err := io.ReadFull(randReader, buf)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read random bytes: %v", err)
 	}
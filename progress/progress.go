@@ -0,0 +1,232 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package progress reports the progress of long running byte
+// transfers, such as copies and archive creation, to a Reporter.
+//
+// A Tracker counts the bytes transferred and works out the rate and
+// estimated time remaining; NewReader and NewWriter wrap an io.Reader or
+// io.Writer so that the bytes passing through them are counted. The Bar
+// and Log renderers display the reports, for a terminal and for a log
+// respectively.
+package progress
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/juju/utils/clock"
+)
+
+// Progress is a snapshot of the progress of a transfer.
+type Progress struct {
+	// Name describes the transfer.
+	Name string
+
+	// Current holds the number of bytes transferred so far.
+	Current int64
+
+	// Total holds the number of bytes expected to be transferred,
+	// or -1 if that is not known.
+	Total int64
+
+	// Elapsed holds the time since the transfer started.
+	Elapsed time.Duration
+
+	// Rate holds the average transfer rate in bytes per second.
+	Rate float64
+
+	// ETA holds the estimated time until the transfer completes. It
+	// is zero if that cannot be estimated.
+	ETA time.Duration
+
+	// Done is true for the final report of a transfer.
+	Done bool
+
+	// Err holds the error that ended the transfer, if any. It is
+	// only set when Done is true.
+	Err error
+}
+
+// Fraction returns the proportion of the transfer that has completed,
+// between 0 and 1, or -1 if the total is not known.
+func (p Progress) Fraction() float64 {
+	if p.Total < 0 {
+		return -1
+	}
+	if p.Total == 0 || p.Current >= p.Total {
+		return 1
+	}
+	return float64(p.Current) / float64(p.Total)
+}
+
+// Reporter is implemented by types that display or record progress.
+// Report is never called concurrently for the same Tracker.
+type Reporter interface {
+	Report(p Progress)
+}
+
+// ReporterFunc adapts a function to the Reporter interface.
+type ReporterFunc func(p Progress)
+
+// Report implements Reporter.
+func (f ReporterFunc) Report(p Progress) {
+	f(p)
+}
+
+// Discard is a Reporter that ignores all reports.
+var Discard Reporter = ReporterFunc(func(Progress) {})
+
+// DefaultInterval is the default minimum time between reports from a
+// Tracker.
+const DefaultInterval = 200 * time.Millisecond
+
+// Tracker counts the bytes of a single transfer and reports its
+// progress. It is safe to use from multiple goroutines.
+type Tracker struct {
+	// Interval holds the minimum time between reports. The first
+	// and final reports are always made. If it is zero,
+	// DefaultInterval is used.
+	Interval time.Duration
+
+	reporter Reporter
+	clock    clock.Clock
+	name     string
+	total    int64
+	start    time.Time
+
+	mu         sync.Mutex
+	current    int64
+	lastReport time.Time
+	reported   bool
+	done       bool
+}
+
+// NewTracker returns a Tracker for a transfer of total bytes (-1 if
+// unknown) that reports to r. If r is nil, reports are discarded; if
+// clk is nil, the wall clock is used.
+func NewTracker(r Reporter, name string, total int64, clk clock.Clock) *Tracker {
+	if r == nil {
+		r = Discard
+	}
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return &Tracker{
+		reporter: r,
+		clock:    clk,
+		name:     name,
+		total:    total,
+		start:    clk.Now(),
+	}
+}
+
+// Add records that n more bytes have been transferred.
+func (t *Tracker) Add(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.current += n
+	now := t.clock.Now()
+	interval := t.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	if t.reported && now.Sub(t.lastReport) < interval {
+		return
+	}
+	t.report(now, false, nil)
+}
+
+// Done makes the final report for the transfer, which ended with the
+// given error. Calls after the first have no effect.
+func (t *Tracker) Done(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	t.report(t.clock.Now(), true, err)
+}
+
+// Progress returns the current progress of the transfer.
+func (t *Tracker) Progress() Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.progress(t.clock.Now())
+}
+
+func (t *Tracker) report(now time.Time, done bool, err error) {
+	t.lastReport = now
+	t.reported = true
+	p := t.progress(now)
+	p.Done = done
+	p.Err = err
+	if done {
+		p.ETA = 0
+	}
+	t.reporter.Report(p)
+}
+
+// progress must be called with t.mu held.
+func (t *Tracker) progress(now time.Time) Progress {
+	p := Progress{
+		Name:    t.name,
+		Current: t.current,
+		Total:   t.total,
+		Elapsed: now.Sub(t.start),
+	}
+	if p.Elapsed > 0 {
+		p.Rate = float64(p.Current) / p.Elapsed.Seconds()
+	}
+	if p.Rate > 0 && p.Total > p.Current {
+		remaining := float64(p.Total-p.Current) / p.Rate
+		p.ETA = time.Duration(remaining * float64(time.Second))
+	}
+	return p
+}
+
+// NewReader returns a reader that reads from r and adds the bytes
+// read to t. Reaching the end of r does not complete the transfer;
+// call t.Done for that.
+func NewReader(r io.Reader, t *Tracker) io.Reader {
+	return &reader{r: r, t: t}
+}
+
+type reader struct {
+	r io.Reader
+	t *Tracker
+}
+
+// Read implements io.Reader.
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.t.Add(int64(n))
+	}
+	return n, err
+}
+
+// NewWriter returns a writer that writes to w and adds the bytes
+// written to t.
+func NewWriter(w io.Writer, t *Tracker) io.Writer {
+	return &writer{w: w, t: t}
+}
+
+type writer struct {
+	w io.Writer
+	t *Tracker
+}
+
+// Write implements io.Writer.
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.t.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,161 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package progress_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/progress"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type progressSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&progressSuite{})
+
+type recorder []progress.Progress
+
+func (r *recorder) Report(p progress.Progress) {
+	*r = append(*r, p)
+}
+
+func (s *progressSuite) TestTrackerRateAndETA(c *gc.C) {
+	clk := testclock.New(time.Now())
+	var reports recorder
+	t := progress.NewTracker(&reports, "download", 1000, clk)
+	clk.Advance(time.Second)
+	t.Add(100)
+	clk.Advance(time.Second)
+	t.Add(100)
+	c.Assert(reports, gc.HasLen, 2)
+	c.Assert(reports[1], jc.DeepEquals, progress.Progress{
+		Name:    "download",
+		Current: 200,
+		Total:   1000,
+		Elapsed: 2 * time.Second,
+		Rate:    100,
+		ETA:     8 * time.Second,
+	})
+	c.Assert(reports[1].Fraction(), gc.Equals, 0.2)
+
+	t.Done(nil)
+	t.Done(nil)
+	c.Assert(reports, gc.HasLen, 3)
+	c.Assert(reports[2].Done, jc.IsTrue)
+	c.Assert(reports[2].ETA, gc.Equals, time.Duration(0))
+}
+
+func (s *progressSuite) TestTrackerInterval(c *gc.C) {
+	clk := testclock.New(time.Now())
+	var reports recorder
+	t := progress.NewTracker(&reports, "", -1, clk)
+	t.Interval = time.Second
+	t.Add(1)
+	t.Add(1)
+	clk.Advance(500 * time.Millisecond)
+	t.Add(1)
+	c.Assert(reports, gc.HasLen, 1)
+	clk.Advance(500 * time.Millisecond)
+	t.Add(1)
+	c.Assert(reports, gc.HasLen, 2)
+	c.Assert(reports[1].Current, gc.Equals, int64(4))
+	c.Assert(reports[1].Fraction(), gc.Equals, -1.0)
+	c.Assert(reports[1].ETA, gc.Equals, time.Duration(0))
+
+	err := errors.New("boom")
+	t.Done(err)
+	c.Assert(reports, gc.HasLen, 3)
+	c.Assert(reports[2].Err, gc.Equals, err)
+	t.Add(1)
+	c.Assert(reports, gc.HasLen, 3)
+}
+
+func (s *progressSuite) TestReaderWriter(c *gc.C) {
+	var reports recorder
+	t := progress.NewTracker(&reports, "", 10, nil)
+	t.Interval = time.Nanosecond
+	data, err := ioutil.ReadAll(progress.NewReader(strings.NewReader("hello"), t))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "hello")
+	var buf bytes.Buffer
+	n, err := progress.NewWriter(&buf, t).Write([]byte("world"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 5)
+	c.Assert(buf.String(), gc.Equals, "world")
+	c.Assert(t.Progress().Current, gc.Equals, int64(10))
+	c.Assert(t.Progress().Fraction(), gc.Equals, 1.0)
+}
+
+func (s *progressSuite) TestNilReporter(c *gc.C) {
+	t := progress.NewTracker(nil, "", 1, nil)
+	t.Add(1)
+	t.Done(nil)
+}
+
+func (s *progressSuite) TestBar(c *gc.C) {
+	var buf bytes.Buffer
+	bar := progress.NewBar(&buf, 50)
+	bar.Report(progress.Progress{
+		Name:    "x",
+		Current: 512,
+		Total:   1024,
+		Rate:    256,
+		ETA:     2 * time.Second,
+	})
+	c.Assert(buf.String(), gc.Equals, "\r\x1b[2Kx [=======>      ]  50% 512B/1.0KiB 256B/s ETA 2s")
+	buf.Reset()
+	bar.Report(progress.Progress{
+		Current: 1 << 20,
+		Total:   -1,
+		Done:    true,
+	})
+	c.Assert(buf.String(), gc.Equals, "\r\x1b[2K1.0MiB\n")
+}
+
+func (s *progressSuite) TestLog(c *gc.C) {
+	var lines []string
+	logf := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	l := progress.NewLog(logf, 10*time.Second)
+	for i := 0; i <= 25; i++ {
+		l.Report(progress.Progress{
+			Name:    "upload",
+			Current: int64(i * 1024),
+			Total:   25 * 1024,
+			Elapsed: time.Duration(i) * time.Second,
+		})
+	}
+	l.Report(progress.Progress{
+		Name:    "upload",
+		Current: 25 * 1024,
+		Total:   25 * 1024,
+		Elapsed: 25 * time.Second,
+		Done:    true,
+	})
+	l.Report(progress.Progress{
+		Current: 3,
+		Total:   -1,
+		Done:    true,
+		Err:     errors.New("oops"),
+	})
+	c.Assert(lines, jc.DeepEquals, []string{
+		"upload: 0% 0B/25.0KiB",
+		"upload: 40% 10.0KiB/25.0KiB",
+		"upload: 80% 20.0KiB/25.0KiB",
+		"upload complete: 25.0KiB in 25s",
+		"transfer failed after 3B: oops",
+	})
+}
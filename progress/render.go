@@ -0,0 +1,148 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juju/utils/term"
+)
+
+// defaultBarWidth is the width of a progress bar, including its
+// labels, when the terminal width is not known.
+const defaultBarWidth = 80
+
+// NewRenderer returns a Reporter suitable for f: a Bar if f is a
+// terminal and a Log writing lines to f otherwise.
+func NewRenderer(f *os.File) Reporter {
+	if !term.IsTerminal(f) {
+		return NewLog(func(format string, args ...interface{}) {
+			fmt.Fprintf(f, format+"\n", args...)
+		}, 0)
+	}
+	width := defaultBarWidth
+	if size, err := term.GetSize(f); err == nil && size.Width > 0 {
+		width = size.Width
+	}
+	return NewBar(f, width)
+}
+
+// Bar is a Reporter that draws a progress bar using ANSI escape
+// sequences, redrawing the same line on each report.
+type Bar struct {
+	w     io.Writer
+	width int
+}
+
+// NewBar returns a Bar that writes to w, filling lines of the given
+// width.
+func NewBar(w io.Writer, width int) *Bar {
+	return &Bar{w: w, width: width}
+}
+
+// Report implements Reporter.
+func (b *Bar) Report(p Progress) {
+	var line string
+	if p.Name != "" {
+		line = p.Name + " "
+	}
+	stats := stats(p)
+	if f := p.Fraction(); f >= 0 {
+		stats = fmt.Sprintf("%3.0f%% %s", f*100, stats)
+		// Leave room for the brackets and the final column, which
+		// some terminals wrap when written to.
+		if inner := b.width - len(line) - len(stats) - 4; inner > 0 {
+			filled := int(f * float64(inner))
+			line += "[" + strings.Repeat("=", filled)
+			if filled < inner {
+				line += ">" + strings.Repeat(" ", inner-filled-1)
+			}
+			line += "] "
+		}
+	}
+	line += stats
+	if p.Done {
+		line += "\n"
+	}
+	// Return to the start of the line and clear it before drawing.
+	io.WriteString(b.w, "\r\x1b[2K"+line)
+}
+
+// Log is a Reporter that writes progress as plain lines of text, for
+// output that is not a terminal.
+type Log struct {
+	logf     func(format string, args ...interface{})
+	interval time.Duration
+	last     time.Duration
+	logged   bool
+}
+
+// NewLog returns a Log that writes a line with logf at most once per
+// interval, as well as a final line when the transfer is done. If
+// interval is zero, a line is written every 10 seconds.
+func NewLog(logf func(format string, args ...interface{}), interval time.Duration) *Log {
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	return &Log{
+		logf:     logf,
+		interval: interval,
+	}
+}
+
+// Report implements Reporter.
+func (l *Log) Report(p Progress) {
+	if !p.Done && l.logged && p.Elapsed-l.last < l.interval {
+		return
+	}
+	l.logged = true
+	l.last = p.Elapsed
+	name := p.Name
+	if name == "" {
+		name = "transfer"
+	}
+	switch {
+	case p.Err != nil:
+		l.logf("%s failed after %s: %v", name, formatBytes(p.Current), p.Err)
+	case p.Done:
+		l.logf("%s complete: %s in %s", name, formatBytes(p.Current), p.Elapsed.Round(time.Millisecond))
+	case p.Total >= 0:
+		l.logf("%s: %.0f%% %s", name, p.Fraction()*100, stats(p))
+	default:
+		l.logf("%s: %s", name, stats(p))
+	}
+}
+
+// stats returns the amount transferred, rate and ETA of p.
+func stats(p Progress) string {
+	s := formatBytes(p.Current)
+	if p.Total >= 0 {
+		s += "/" + formatBytes(p.Total)
+	}
+	if p.Rate > 0 {
+		s += " " + formatBytes(int64(p.Rate)) + "/s"
+	}
+	if p.ETA > 0 {
+		s += " ETA " + p.ETA.Round(time.Second).String()
+	}
+	return s
+}
+
+// formatBytes formats n using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
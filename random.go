@@ -0,0 +1,59 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+)
+
+// randReader is the source of randomness for the functions in this
+// file and for RandomBytes. It is always crypto/rand except in tests:
+// these functions report an error rather than fall back to a weaker
+// source.
+var randReader = rand.Reader
+
+// RandInt returns a uniformly distributed random integer in [0, max).
+// It panics if max <= 0.
+func RandInt(max int64) (int64, error) {
+	if max <= 0 {
+		panic("RandInt: max must be positive")
+	}
+	n, err := rand.Int(randReader, big.NewInt(max))
+	if err != nil {
+		return 0, fmt.Errorf("cannot generate random number: %v", err)
+	}
+	return n.Int64(), nil
+}
+
+// RandDuration returns a uniformly distributed random duration in
+// [min, max), suitable for adding jitter to delays. It returns min if
+// max <= min.
+func RandDuration(min, max time.Duration) (time.Duration, error) {
+	if max <= min {
+		return min, nil
+	}
+	n, err := RandInt(int64(max - min))
+	if err != nil {
+		return 0, err
+	}
+	return min + time.Duration(n), nil
+}
+
+// Shuffle randomly permutes the elements of slice, which must be a
+// slice. It panics if it is not.
+func Shuffle(slice interface{}) error {
+	swap := reflect.Swapper(slice)
+	for i := reflect.ValueOf(slice).Len() - 1; i > 0; i-- {
+		j, err := RandInt(int64(i + 1))
+		if err != nil {
+			return err
+		}
+		swap(i, int(j))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package utils_test
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils"
+)
+
+type randomSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&randomSuite{})
+
+func (s *randomSuite) TestRandInt(c *gc.C) {
+	seen := make(map[int64]bool)
+	for i := 0; i < 1000; i++ {
+		n, err := utils.RandInt(10)
+		c.Assert(err, gc.IsNil)
+		c.Assert(n >= 0 && n < 10, jc.IsTrue)
+		seen[n] = true
+	}
+	c.Assert(seen, gc.HasLen, 10)
+	c.Assert(func() { utils.RandInt(0) }, gc.PanicMatches, "RandInt: max must be positive")
+}
+
+func (s *randomSuite) TestRandDuration(c *gc.C) {
+	for i := 0; i < 100; i++ {
+		d, err := utils.RandDuration(time.Second, 2*time.Second)
+		c.Assert(err, gc.IsNil)
+		c.Assert(d >= time.Second && d < 2*time.Second, jc.IsTrue)
+	}
+	d, err := utils.RandDuration(time.Second, time.Second)
+	c.Assert(err, gc.IsNil)
+	c.Assert(d, gc.Equals, time.Second)
+}
+
+func (s *randomSuite) TestShuffle(c *gc.C) {
+	values := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	orig := strings.Join(values, "")
+	changed := false
+	for i := 0; i < 20 && !changed; i++ {
+		c.Assert(utils.Shuffle(values), gc.IsNil)
+		changed = strings.Join(values, "") != orig
+	}
+	c.Assert(changed, jc.IsTrue)
+	sort.Strings(values)
+	c.Assert(strings.Join(values, ""), gc.Equals, orig)
+	c.Assert(utils.Shuffle([]int{}), gc.IsNil)
+}
+
+func (s *randomSuite) TestNoFallback(c *gc.C) {
+	s.PatchValue(utils.RandReader, strings.NewReader(""))
+	_, err := utils.RandInt(10)
+	c.Assert(err, gc.ErrorMatches, "cannot generate random number: EOF")
+	_, err = utils.RandDuration(0, time.Second)
+	c.Assert(err, gc.NotNil)
+	c.Assert(utils.Shuffle([]int{1, 2}), gc.NotNil)
+	_, err = utils.RandomPassword()
+	c.Assert(err, gc.ErrorMatches, "cannot read random bytes: EOF")
+}
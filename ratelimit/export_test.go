@@ -0,0 +1,11 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ratelimit
+
+import "time"
+
+// SetNow sets the function used by k to obtain the current time.
+func SetNow(k *Keyed, now func() time.Time) {
+	k.now = now
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyFunc returns the rate limiting key for an HTTP request.
+type KeyFunc func(req *http.Request) string
+
+// ByHost keys requests by the host of their URL. It is intended for use
+// with Transport.
+func ByHost(req *http.Request) string {
+	return req.URL.Host
+}
+
+// ByRemoteAddr keys requests by the IP address of the remote client. It
+// is intended for use with Handler.
+func ByRemoteAddr(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// Handler returns a handler that passes requests on to h while the
+// limiter allows them, and otherwise responds with 429 Too Many
+// Requests and a Retry-After header.
+func Handler(l *Keyed, key KeyFunc, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		k := key(req)
+		if l.Allow(k) {
+			h.ServeHTTP(w, req)
+			return
+		}
+		retry := (l.Delay(k) + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(retry), 10))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	})
+}
+
+// Transport returns a round tripper that waits until the limiter allows
+// each request before sending it with rt. If rt is nil,
+// http.DefaultTransport is used. Waiting is abandoned if the request's
+// context is cancelled.
+func Transport(l *Keyed, key KeyFunc, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if !l.Wait(key(req), req.Context().Done()) {
+			return nil, req.Context().Err()
+		}
+		return rt.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
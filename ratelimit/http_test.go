@@ -0,0 +1,65 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/ratelimit"
+	"github.com/juju/utils/testing/leaktest"
+)
+
+type httpSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&httpSuite{})
+
+func (*httpSuite) TestHandler(c *gc.C) {
+	defer leaktest.Check(c)()
+	l := ratelimit.NewKeyed(0.5, 1, 10)
+	h := ratelimit.Handler(l, ratelimit.ByRemoteAddr, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	serve := func(addr string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/", nil)
+		c.Assert(err, gc.IsNil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	c.Assert(serve("10.0.0.1:1234").Code, gc.Equals, http.StatusOK)
+	rec := serve("10.0.0.1:5678")
+	c.Assert(rec.Code, gc.Equals, http.StatusTooManyRequests)
+	c.Assert(rec.Header().Get("Retry-After"), gc.Equals, "2")
+	c.Assert(serve("10.0.0.2:1234").Code, gc.Equals, http.StatusOK)
+}
+
+func (*httpSuite) TestTransport(c *gc.C) {
+	defer leaktest.Check(c)()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	l := ratelimit.NewKeyed(50, 1, 10)
+	client := &http.Client{Transport: ratelimit.Transport(l, ratelimit.ByHost, nil)}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		c.Assert(err, gc.IsNil)
+		resp.Body.Close()
+	}
+	c.Assert(requests, gc.Equals, 3)
+	c.Assert(time.Since(start) >= 30*time.Millisecond, jc.IsTrue)
+}
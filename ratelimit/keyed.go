@@ -0,0 +1,152 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package ratelimit provides rate limiting keyed by an arbitrary string,
+// such as a host name, URL or user.
+package ratelimit
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+// Keyed limits the rate of events separately for each key using a token
+// bucket per key. Each bucket holds up to burst tokens and is refilled
+// at rate tokens per second; an event is allowed if a token is
+// available.
+//
+// At most maxKeys buckets are tracked. When a new key would exceed that
+// number, the bucket for the least recently used key is discarded, so
+// that key will start again with a full bucket.
+//
+// The methods of Keyed may be called concurrently.
+type Keyed struct {
+	rate    float64
+	burst   float64
+	maxKeys int
+	now     func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	buckets map[string]*list.Element
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// NewKeyed returns a limiter allowing rate events per second with bursts
+// of up to burst events for each key, tracking at most maxKeys keys.
+func NewKeyed(rate float64, burst, maxKeys int) *Keyed {
+	if burst < 1 {
+		burst = 1
+	}
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	return &Keyed{
+		rate:    rate,
+		burst:   float64(burst),
+		maxKeys: maxKeys,
+		now:     time.Now,
+		lru:     list.New(),
+		buckets: make(map[string]*list.Element),
+	}
+}
+
+// Allow reports whether an event for key may happen now, consuming a
+// token if so.
+func (k *Keyed) Allow(key string) bool {
+	return k.AllowN(key, 1)
+}
+
+// AllowN reports whether n events for key may happen now, consuming n
+// tokens if so.
+func (k *Keyed) AllowN(key string, n int) bool {
+	return k.take(key, float64(n), false) == 0
+}
+
+// Wait waits until an event for key may happen and consumes a token. It
+// returns false without consuming a token if stop is closed first.
+func (k *Keyed) Wait(key string, stop <-chan struct{}) bool {
+	for {
+		delay := k.take(key, 1, false)
+		if delay == 0 {
+			return true
+		}
+		select {
+		case <-stop:
+			return false
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Delay returns how long it will be before an event for key is allowed,
+// without consuming a token.
+func (k *Keyed) Delay(key string) time.Duration {
+	return k.take(key, 1, true)
+}
+
+// Forget discards the bucket for key.
+func (k *Keyed) Forget(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if e, ok := k.buckets[key]; ok {
+		k.lru.Remove(e)
+		delete(k.buckets, key)
+	}
+}
+
+// Len returns the number of keys currently tracked.
+func (k *Keyed) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.buckets)
+}
+
+// take consumes n tokens from the bucket for key if they are available
+// and returns zero, or returns how long it will be until they are.
+// If peek is true, no tokens are consumed.
+func (k *Keyed) take(key string, n float64, peek bool) time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := k.now()
+	b := k.bucket(key, now)
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(k.burst, b.tokens+elapsed.Seconds()*k.rate)
+		b.last = now
+	}
+	if b.tokens >= n {
+		if !peek {
+			b.tokens -= n
+		}
+		return 0
+	}
+	if k.rate <= 0 || n > k.burst {
+		// The tokens will never become available.
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((n - b.tokens) / k.rate * float64(time.Second))
+}
+
+// bucket returns the bucket for key, creating it if necessary. It must
+// be called with k.mu held.
+func (k *Keyed) bucket(key string, now time.Time) *bucket {
+	if e, ok := k.buckets[key]; ok {
+		k.lru.MoveToFront(e)
+		return e.Value.(*bucket)
+	}
+	if k.lru.Len() >= k.maxKeys {
+		oldest := k.lru.Back()
+		k.lru.Remove(oldest)
+		delete(k.buckets, oldest.Value.(*bucket).key)
+	}
+	b := &bucket{key: key, tokens: k.burst, last: now}
+	k.buckets[key] = k.lru.PushFront(b)
+	return b
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package ratelimit_test
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/ratelimit"
+	"github.com/juju/utils/testing/leaktest"
+)
+
+type keyedSuite struct {
+	testing.IsolationSuite
+	now time.Time
+}
+
+var _ = gc.Suite(&keyedSuite{})
+
+func (s *keyedSuite) newKeyed(rate float64, burst, maxKeys int) *ratelimit.Keyed {
+	s.now = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := ratelimit.NewKeyed(rate, burst, maxKeys)
+	ratelimit.SetNow(l, func() time.Time { return s.now })
+	return l
+}
+
+func (s *keyedSuite) TestBurstAndRefill(c *gc.C) {
+	defer leaktest.Check(c)()
+	l := s.newKeyed(2, 3, 10)
+	for i := 0; i < 3; i++ {
+		c.Assert(l.Allow("host"), jc.IsTrue)
+	}
+	c.Assert(l.Allow("host"), jc.IsFalse)
+	c.Assert(l.Delay("host"), gc.Equals, 500*time.Millisecond)
+
+	s.now = s.now.Add(500 * time.Millisecond)
+	c.Assert(l.Delay("host"), gc.Equals, time.Duration(0))
+	c.Assert(l.Allow("host"), jc.IsTrue)
+	c.Assert(l.Allow("host"), jc.IsFalse)
+
+	// Buckets never fill beyond the burst size.
+	s.now = s.now.Add(time.Hour)
+	c.Assert(l.AllowN("host", 3), jc.IsTrue)
+	c.Assert(l.Allow("host"), jc.IsFalse)
+}
+
+func (s *keyedSuite) TestKeysIndependent(c *gc.C) {
+	defer leaktest.Check(c)()
+	l := s.newKeyed(1, 1, 10)
+	c.Assert(l.Allow("a"), jc.IsTrue)
+	c.Assert(l.Allow("a"), jc.IsFalse)
+	c.Assert(l.Allow("b"), jc.IsTrue)
+	c.Assert(l.Len(), gc.Equals, 2)
+}
+
+func (s *keyedSuite) TestLRUEviction(c *gc.C) {
+	defer leaktest.Check(c)()
+	l := s.newKeyed(1, 1, 2)
+	c.Assert(l.Allow("a"), jc.IsTrue)
+	c.Assert(l.Allow("b"), jc.IsTrue)
+	// Touch a so that b is the least recently used.
+	c.Assert(l.Allow("a"), jc.IsFalse)
+	c.Assert(l.Allow("c"), jc.IsTrue)
+	c.Assert(l.Len(), gc.Equals, 2)
+
+	// b was evicted so it starts afresh; a was kept.
+	c.Assert(l.Allow("b"), jc.IsTrue)
+	c.Assert(l.Allow("c"), jc.IsFalse)
+}
+
+func (s *keyedSuite) TestForget(c *gc.C) {
+	defer leaktest.Check(c)()
+	l := s.newKeyed(1, 1, 10)
+	c.Assert(l.Allow("a"), jc.IsTrue)
+	l.Forget("a")
+	c.Assert(l.Len(), gc.Equals, 0)
+	c.Assert(l.Allow("a"), jc.IsTrue)
+}
+
+func (s *keyedSuite) TestNeverAllowed(c *gc.C) {
+	defer leaktest.Check(c)()
+	l := s.newKeyed(0, 1, 10)
+	c.Assert(l.Allow("a"), jc.IsTrue)
+	c.Assert(l.Delay("a") > 1000*time.Hour, jc.IsTrue)
+	c.Assert(l.AllowN("b", 2), jc.IsFalse)
+}
+
+func (*keyedSuite) TestWait(c *gc.C) {
+	defer leaktest.Check(c)()
+	l := ratelimit.NewKeyed(100, 1, 10)
+	c.Assert(l.Allow("a"), jc.IsTrue)
+	start := time.Now()
+	c.Assert(l.Wait("a", nil), jc.IsTrue)
+	c.Assert(time.Since(start) >= 5*time.Millisecond, jc.IsTrue)
+
+	l = ratelimit.NewKeyed(0, 1, 10)
+	c.Assert(l.Allow("a"), jc.IsTrue)
+	stop := make(chan struct{})
+	close(stop)
+	c.Assert(l.Wait("a", stop), jc.IsFalse)
+}
@@ -1,16 +1,113 @@
 // Copyright 2014 Canonical Ltd.
 // Licensed under the LGPLv3, see LICENCE file for details.
 
+// Package readpass reads passwords and other secrets interactively.
+//
+// When the input is a terminal, echo is turned off while the secret is
+// typed (using termios, or the console API on Windows). Otherwise the
+// secret is read as a line of plain input, so that secrets can be piped
+// in by scripts.
 package readpass
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"code.google.com/p/go.crypto/ssh/terminal"
+	"github.com/juju/errors"
 )
 
+// ErrMismatch is returned by ReadConfirmed when the secret and its
+// confirmation differ.
+var ErrMismatch = errors.New("passwords do not match")
+
+// Prompter reads secrets, prompting for each one.
+type Prompter struct {
+	// In holds the input. If nil, os.Stdin is used.
+	In *os.File
+
+	// Out receives the prompts. If nil, os.Stderr is used, so that
+	// prompts are not mixed with a program's output.
+	Out io.Writer
+
+	lines *bufio.Reader
+}
+
+func (p *Prompter) in() *os.File {
+	if p.In == nil {
+		return os.Stdin
+	}
+	return p.In
+}
+
+func (p *Prompter) out() io.Writer {
+	if p.Out == nil {
+		return os.Stderr
+	}
+	return p.Out
+}
+
+// Read writes prompt and reads a secret.
+func (p *Prompter) Read(prompt string) (string, error) {
+	in := p.in()
+	fmt.Fprint(p.out(), prompt)
+	fd := int(in.Fd())
+	if terminal.IsTerminal(fd) {
+		pass, err := terminal.ReadPassword(fd)
+		// The newline typed by the user was not echoed.
+		fmt.Fprintln(p.out())
+		if err != nil {
+			return "", errors.Annotate(err, "cannot read password")
+		}
+		return string(pass), nil
+	}
+	if p.lines == nil {
+		p.lines = bufio.NewReader(in)
+	}
+	line, err := p.lines.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", errors.Annotate(err, "cannot read password")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ReadConfirmed reads a secret twice, prompting with prompt and then
+// with confirm, and returns ErrMismatch if the two differ.
+func (p *Prompter) ReadConfirmed(prompt, confirm string) (string, error) {
+	pass, err := p.Read(prompt)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	again, err := p.Read(confirm)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if pass != again {
+		return "", ErrMismatch
+	}
+	return pass, nil
+}
+
+// ReadPassword reads a password from standard input without a prompt.
 func ReadPassword() (string, error) {
-	fd := os.Stdin.Fd()
-	pass, err := terminal.ReadPassword(int(fd))
-	return string(pass), err
+	return (&Prompter{}).Read("")
+}
+
+// Prompt writes prompt to standard error and reads a password from
+// standard input.
+func Prompt(prompt string) (string, error) {
+	return (&Prompter{}).Read(prompt)
+}
+
+// PromptConfirmed prompts for a password twice on standard error, reads
+// it from standard input both times and returns ErrMismatch if the two
+// differ.
+func PromptConfirmed(prompt, confirm string) (string, error) {
+	return (&Prompter{}).ReadConfirmed(prompt, confirm)
 }
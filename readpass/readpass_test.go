@@ -0,0 +1,59 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package readpass_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/readpass"
+)
+
+type readpassSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&readpassSuite{})
+
+func input(c *gc.C, data string) *os.File {
+	path := filepath.Join(c.MkDir(), "input")
+	c.Assert(ioutil.WriteFile(path, []byte(data), 0600), gc.IsNil)
+	f, err := os.Open(path)
+	c.Assert(err, gc.IsNil)
+	return f
+}
+
+func (s *readpassSuite) TestReadNotTerminal(c *gc.C) {
+	in := input(c, "s3cret\r\nnext\nlast")
+	defer in.Close()
+	var out bytes.Buffer
+	p := &readpass.Prompter{In: in, Out: &out}
+	for _, expect := range []string{"s3cret", "next", "last"} {
+		pass, err := p.Read("Password: ")
+		c.Assert(err, gc.IsNil)
+		c.Assert(pass, gc.Equals, expect)
+	}
+	_, err := p.Read("Password: ")
+	c.Assert(err, gc.ErrorMatches, "cannot read password: EOF")
+	c.Assert(out.String(), gc.Equals, "Password: Password: Password: Password: ")
+}
+
+func (s *readpassSuite) TestReadConfirmed(c *gc.C) {
+	in := input(c, "one\none\none\ntwo\n")
+	defer in.Close()
+	var out bytes.Buffer
+	p := &readpass.Prompter{In: in, Out: &out}
+	pass, err := p.ReadConfirmed("New password: ", "Again: ")
+	c.Assert(err, gc.IsNil)
+	c.Assert(pass, gc.Equals, "one")
+	c.Assert(out.String(), gc.Equals, "New password: Again: ")
+
+	_, err = p.ReadConfirmed("New password: ", "Again: ")
+	c.Assert(err, gc.Equals, readpass.ErrMismatch)
+}
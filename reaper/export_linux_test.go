@@ -0,0 +1,21 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package reaper
+
+var ProcDir = &procDir
+
+func ParseStat(stat string) (pid int, state string, ppid, pgrp int, ok bool) {
+	p, ok := parseStat(stat)
+	return p.pid, p.state, p.ppid, p.pgrp, ok
+}
+
+// Orphans returns the result of orphans for the processes in procDir.
+func Orphans(ppid int, owned, reapable map[int]bool, all bool) (zombies, empty []int, err error) {
+	procs, err := processes()
+	if err != nil {
+		return nil, nil, err
+	}
+	zombies, empty = orphans(procs, ppid, owned, reapable, all)
+	return zombies, empty, nil
+}
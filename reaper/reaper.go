@@ -0,0 +1,75 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package reaper collects the exit status of orphaned descendant
+// processes so that they do not accumulate as zombies.
+//
+// A process running as PID 1 (for example as the init process of a
+// container) inherits every orphaned process in its namespace. If it
+// never waits for them, they remain as zombies. On Linux any other
+// process can ask to be treated the same way for its own descendants
+// by becoming a "child subreaper".
+//
+// As PID 1, the reaper collects every zombie child other than the
+// commands being run by the exec package, including children started
+// by other means, such as os/exec, which must not be waited for
+// elsewhere.
+//
+// As a subreaper, reaping is opt-in per command: the reaper only
+// collects zombies in the process group of a command run by the exec
+// package with RunParams.ReapOrphans set, and never the command
+// itself, so exit statuses are not stolen from RunParams.Wait or from
+// children started by other means. Orphans that leave the command's
+// process group, as daemons usually do, are not collected.
+package reaper
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/juju/loggo"
+	"launchpad.net/tomb"
+)
+
+var logger = loggo.GetLogger("juju.utils.reaper")
+
+// ErrNotNeeded is returned by Start when the process is neither PID 1
+// nor asked to become a subreaper, so orphans will never be re-parented
+// to it.
+var ErrNotNeeded = errors.New("not running as PID 1 and subreaper not requested")
+
+// PollInterval holds how often the reaper looks for zombies in the
+// absence of SIGCHLD notifications.
+var PollInterval = 5 * time.Second
+
+// Reaper collects orphaned zombie processes until it is stopped.
+type Reaper struct {
+	tomb   tomb.Tomb
+	all    bool
+	mu     sync.Mutex
+	reaped int
+}
+
+// Reaped returns the number of processes collected so far.
+func (r *Reaper) Reaped() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reaped
+}
+
+// Kill asks the reaper to stop without waiting for it to do so.
+func (r *Reaper) Kill() {
+	r.tomb.Kill(nil)
+}
+
+// Wait waits for the reaper to stop and returns any error encountered.
+func (r *Reaper) Wait() error {
+	return r.tomb.Wait()
+}
+
+// Stop stops the reaper and waits for it to finish.
+func (r *Reaper) Stop() error {
+	r.Kill()
+	return r.Wait()
+}
@@ -0,0 +1,195 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package reaper
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+	"launchpad.net/tomb"
+
+	"github.com/juju/utils/exec"
+)
+
+// prSetChildSubreaper is the prctl option marking the calling process
+// as a subreaper for its descendants (see prctl(2)).
+const prSetChildSubreaper = 36
+
+// procDir is overridden in tests.
+var procDir = "/proc"
+
+// Start starts reaping orphaned zombie processes. If the current
+// process is PID 1 it already inherits orphans, and collects all of
+// them. Otherwise, if subreaper is true, it is marked as a child
+// subreaper for its own descendants, and collects only the orphans of
+// commands run with exec.RunParams.ReapOrphans. If neither applies,
+// ErrNotNeeded is returned.
+func Start(subreaper bool) (*Reaper, error) {
+	all := os.Getpid() == 1
+	if !all {
+		if !subreaper {
+			return nil, ErrNotNeeded
+		}
+		if err := setSubreaper(); err != nil {
+			return nil, errors.Annotate(err, "cannot become child subreaper")
+		}
+	}
+	r := &Reaper{all: all}
+	exec.StartReaping()
+	go func() {
+		defer r.tomb.Done()
+		defer exec.StopReaping()
+		r.tomb.Kill(r.loop())
+	}()
+	return r, nil
+}
+
+func setSubreaper() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (r *Reaper) loop() error {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGCHLD)
+	defer signal.Stop(sigc)
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		r.reap()
+		select {
+		case <-r.tomb.Dying():
+			return tomb.ErrDying
+		case <-sigc:
+		case <-ticker.C:
+		}
+	}
+}
+
+// reap collects the zombie children of this process that belong to the
+// process group of a command run with exec.RunParams.ReapOrphans, or
+// all of them when running as PID 1, other than those owned by the
+// exec package, and releases the groups that no longer hold any
+// process.
+func (r *Reaper) reap() {
+	exec.WithOwnedProcesses(func(owned, reapable map[int]bool) {
+		if !r.all && len(reapable) == 0 {
+			return
+		}
+		procs, err := processes()
+		if err != nil {
+			logger.Warningf("cannot find zombie processes: %v", err)
+			return
+		}
+		zombies, empty := orphans(procs, os.Getpid(), owned, reapable, r.all)
+		for _, pid := range zombies {
+			var status syscall.WaitStatus
+			wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+			if err != nil || wpid != pid {
+				continue
+			}
+			logger.Debugf("reaped orphaned process %d (exit status %d)", pid, status.ExitStatus())
+			r.mu.Lock()
+			r.reaped++
+			r.mu.Unlock()
+		}
+		for _, pgid := range empty {
+			exec.ReleaseOrphanGroup(pgid)
+		}
+	})
+}
+
+// process holds the fields of a /proc/<pid>/stat file that the reaper
+// uses.
+type process struct {
+	pid   int
+	state string
+	ppid  int
+	pgrp  int
+}
+
+// orphans returns the zombie children of ppid in procs that are not
+// owned and, unless all is true, belong to one of the reapable process
+// groups, and the reapable groups, other than those of owned processes,
+// to which no process in procs belongs.
+func orphans(procs []process, ppid int, owned, reapable map[int]bool, all bool) (zombies, empty []int) {
+	inUse := make(map[int]bool)
+	for _, p := range procs {
+		inUse[p.pgrp] = true
+		if p.state == "Z" && p.ppid == ppid && (all || reapable[p.pgrp]) && !owned[p.pid] {
+			zombies = append(zombies, p.pid)
+		}
+	}
+	for pgid := range reapable {
+		if !inUse[pgid] && !owned[pgid] {
+			empty = append(empty, pgid)
+		}
+	}
+	sort.Ints(zombies)
+	sort.Ints(empty)
+	return zombies, empty
+}
+
+// processes returns the processes listed in procDir.
+func processes() ([]process, error) {
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var procs []process
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(procDir, entry.Name(), "stat"))
+		if err != nil {
+			// The process has probably gone away.
+			continue
+		}
+		if p, ok := parseStat(string(data)); ok {
+			procs = append(procs, p)
+		}
+	}
+	return procs, nil
+}
+
+// parseStat extracts the process ID, state, parent process ID and
+// process group from the contents of a /proc/<pid>/stat file. The
+// command name may itself contain spaces and parentheses, so the
+// fields following it are found after the last ')'.
+func parseStat(stat string) (process, bool) {
+	open := strings.Index(stat, " (")
+	end := strings.LastIndex(stat, ")")
+	if open < 0 || end < open {
+		return process{}, false
+	}
+	pid, err := strconv.Atoi(stat[:open])
+	if err != nil {
+		return process{}, false
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 3 {
+		return process{}, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return process{}, false
+	}
+	pgrp, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return process{}, false
+	}
+	return process{pid: pid, state: fields[0], ppid: ppid, pgrp: pgrp}, true
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package reaper_test
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/reaper"
+)
+
+type reaperSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&reaperSuite{})
+
+func (*reaperSuite) TestParseStat(c *gc.C) {
+	for i, test := range []struct {
+		stat  string
+		pid   int
+		state string
+		ppid  int
+		pgrp  int
+		ok    bool
+	}{{
+		stat:  "1234 (bash) S 1 1234 1234 0 -1",
+		pid:   1234,
+		state: "S",
+		ppid:  1,
+		pgrp:  1234,
+		ok:    true,
+	}, {
+		stat:  "99 (weird) name) Z 42 98 98",
+		pid:   99,
+		state: "Z",
+		ppid:  42,
+		pgrp:  98,
+		ok:    true,
+	}, {
+		stat: "garbage",
+	}, {
+		stat: "12 (short) Z 1",
+	}} {
+		c.Logf("test %d: %q", i, test.stat)
+		pid, state, ppid, pgrp, ok := reaper.ParseStat(test.stat)
+		c.Check(ok, gc.Equals, test.ok)
+		c.Check(pid, gc.Equals, test.pid)
+		c.Check(state, gc.Equals, test.state)
+		c.Check(ppid, gc.Equals, test.ppid)
+		c.Check(pgrp, gc.Equals, test.pgrp)
+	}
+}
+
+func (s *reaperSuite) TestOrphans(c *gc.C) {
+	dir := c.MkDir()
+	s.PatchValue(reaper.ProcDir, dir)
+	for pid, stat := range map[string]string{
+		// The leader of group 20, which is still owned.
+		"20": "20 (a) S 5 20 20",
+		// An orphan in group 20.
+		"21": "21 (b) Z 5 20 20",
+		// Orphans still running, or with another parent.
+		"22": "22 (c) S 5 20 20",
+		"23": "23 (d) Z 6 20 20",
+		// A child in a group that is not reapable.
+		"30": "30 (e) Z 5 30 30",
+		// An orphan in group 40, whose leader has been waited for.
+		"41":   "41 (f) Z 5 40 40",
+		"self": "13 (g) Z 5 20 20",
+	} {
+		err := os.Mkdir(filepath.Join(dir, pid), 0755)
+		c.Assert(err, gc.IsNil)
+		err = ioutil.WriteFile(filepath.Join(dir, pid, "stat"), []byte(stat), 0644)
+		c.Assert(err, gc.IsNil)
+	}
+	owned := map[int]bool{20: true, 60: true}
+	reapable := map[int]bool{20: true, 40: true, 50: true, 60: true}
+	zombies, empty, err := reaper.Orphans(5, owned, reapable, false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(zombies, gc.DeepEquals, []int{21, 41})
+	c.Assert(empty, gc.DeepEquals, []int{50})
+
+	// As PID 1, zombie children in any group are collected.
+	zombies, empty, err = reaper.Orphans(5, owned, reapable, true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(zombies, gc.DeepEquals, []int{21, 30, 41})
+	c.Assert(empty, gc.DeepEquals, []int{50})
+}
+
+func (*reaperSuite) TestNotNeeded(c *gc.C) {
+	if os.Getpid() == 1 {
+		c.Skip("running as PID 1")
+	}
+	r, err := reaper.Start(false)
+	c.Assert(err, gc.Equals, reaper.ErrNotNeeded)
+	c.Assert(r, gc.IsNil)
+}
+
+func (s *reaperSuite) TestReapsOrphans(c *gc.C) {
+	s.PatchValue(&reaper.PollInterval, 10*time.Millisecond)
+	r, err := reaper.Start(true)
+	c.Assert(err, gc.IsNil)
+	defer func() {
+		c.Assert(r.Stop(), gc.IsNil)
+	}()
+
+	// The shell exits immediately, orphaning the backgrounded sleep,
+	// which is re-parented to this process.
+	result, err := exec.RunCommands(exec.RunParams{
+		Commands:    "sleep 0.1 &\nexit 3",
+		ReapOrphans: true,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(result.Code, gc.Equals, 3)
+
+	for a := 0; a < 100 && r.Reaped() == 0; a++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Assert(r.Reaped(), gc.Equals, 1)
+}
+
+func (s *reaperSuite) TestLeavesOtherChildren(c *gc.C) {
+	s.PatchValue(&reaper.PollInterval, 10*time.Millisecond)
+	r, err := reaper.Start(true)
+	c.Assert(err, gc.IsNil)
+	defer func() {
+		c.Assert(r.Stop(), gc.IsNil)
+	}()
+
+	// A command run with ReapOrphans makes the reaper look for
+	// zombies, but it must not take the exit status of a child
+	// started by os/exec, even one that has exited.
+	_, err = exec.RunCommands(exec.RunParams{
+		Commands:    "sleep 0.2 &",
+		ReapOrphans: true,
+	})
+	c.Assert(err, gc.IsNil)
+	cmd := osexec.Command("/bin/sh", "-c", "exit 4")
+	c.Assert(cmd.Start(), gc.IsNil)
+	time.Sleep(100 * time.Millisecond)
+	err = cmd.Wait()
+	c.Assert(err, gc.ErrorMatches, "exit status 4")
+}
+
+func (s *reaperSuite) TestGroupsReleasedWithoutReaper(c *gc.C) {
+	// With no reaper running, nothing would ever release the group
+	// of a command once it has been waited for.
+	_, err := exec.RunCommands(exec.RunParams{
+		Commands:    "sleep 0.1 &",
+		ReapOrphans: true,
+	})
+	c.Assert(err, gc.IsNil)
+	exec.WithOwnedProcesses(func(owned, reapable map[int]bool) {
+		c.Check(reapable, gc.HasLen, 0)
+	})
+}
@@ -0,0 +1,15 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !linux
+
+package reaper
+
+import (
+	"github.com/juju/errors"
+)
+
+// Start is not supported on this platform.
+func Start(subreaper bool) (*Reaper, error) {
+	return nil, errors.NotSupportedf("reaping orphaned processes")
+}
@@ -0,0 +1,126 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package registry
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Info holds metadata describing a registered value.
+type Info struct {
+	// Description holds a short human readable description.
+	Description string
+
+	// Attrs holds any further metadata the subsystem chooses to
+	// record, such as the platforms a backend supports.
+	Attrs map[string]string
+}
+
+// Entry describes a value held in a Registry.
+type Entry[T any] struct {
+	Name  string
+	Value T
+	Info  Info
+}
+
+// Registry holds values of type T under unique names, so that a
+// subsystem with pluggable backends can look them up by name. T is
+// usually a factory function type that creates a backend, such as
+// func(Config) (Backend, error).
+//
+// The zero value is an empty registry ready for use. It is safe for
+// concurrent use.
+type Registry[T any] struct {
+	mu      sync.RWMutex
+	entries map[string]Entry[T]
+}
+
+// Register adds value to the registry under name. It returns an
+// error satisfying errors.IsAlreadyExists if the name is already
+// registered, and an errors.NotValid error if it is empty.
+func (r *Registry[T]) Register(name string, value T, info Info) error {
+	if name == "" {
+		return errors.NotValidf("empty name")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[name]; ok {
+		return errors.AlreadyExistsf("%q", name)
+	}
+	if r.entries == nil {
+		r.entries = make(map[string]Entry[T])
+	}
+	r.entries[name] = Entry[T]{
+		Name:  name,
+		Value: value,
+		Info:  info,
+	}
+	return nil
+}
+
+// MustRegister is like Register but panics on error. It is intended
+// for registering built-in values from init functions.
+func (r *Registry[T]) MustRegister(name string, value T, info Info) {
+	if err := r.Register(name, value, info); err != nil {
+		panic(err)
+	}
+}
+
+// Unregister removes the value registered under name, reporting
+// whether there was one.
+func (r *Registry[T]) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.entries[name]
+	delete(r.entries, name)
+	return ok
+}
+
+// Lookup returns the value registered under name. If there is none, it
+// returns an error satisfying errors.IsNotFound.
+func (r *Registry[T]) Lookup(name string) (T, error) {
+	entry, err := r.Entry(name)
+	return entry.Value, err
+}
+
+// Entry returns the entry for name. If there is none, it returns an
+// error satisfying errors.IsNotFound.
+func (r *Registry[T]) Entry(name string) (Entry[T], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.entries[name]
+	if !ok {
+		return Entry[T]{}, errors.NotFoundf("%q", name)
+	}
+	return entry, nil
+}
+
+// Names returns the registered names in sorted order.
+func (r *Registry[T]) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Entries returns all the entries, sorted by name.
+func (r *Registry[T]) Entries() []Entry[T] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := make([]Entry[T], 0, len(r.entries))
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
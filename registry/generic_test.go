@@ -0,0 +1,91 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package registry_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/registry"
+)
+
+type genericSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&genericSuite{})
+
+type shell interface {
+	Name() string
+}
+
+type bash struct{}
+
+func (bash) Name() string { return "bash" }
+
+type shellFactory func() shell
+
+func (s *genericSuite) TestRegisterLookup(c *gc.C) {
+	var r registry.Registry[shellFactory]
+	info := registry.Info{
+		Description: "GNU bash",
+		Attrs:       map[string]string{"os": "linux"},
+	}
+	err := r.Register("bash", func() shell { return bash{} }, info)
+	c.Assert(err, gc.IsNil)
+
+	factory, err := r.Lookup("bash")
+	c.Assert(err, gc.IsNil)
+	c.Assert(factory().Name(), gc.Equals, "bash")
+
+	entry, err := r.Entry("bash")
+	c.Assert(err, gc.IsNil)
+	c.Assert(entry.Name, gc.Equals, "bash")
+	c.Assert(entry.Info, jc.DeepEquals, info)
+
+	_, err = r.Lookup("zsh")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `"zsh" not found`)
+}
+
+func (s *genericSuite) TestDuplicate(c *gc.C) {
+	var r registry.Registry[int]
+	c.Assert(r.Register("one", 1, registry.Info{}), gc.IsNil)
+	err := r.Register("one", 2, registry.Info{})
+	c.Assert(err, jc.Satisfies, errors.IsAlreadyExists)
+	c.Assert(err, gc.ErrorMatches, `"one" already exists`)
+	v, err := r.Lookup("one")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, 1)
+
+	c.Assert(func() {
+		r.MustRegister("one", 3, registry.Info{})
+	}, gc.PanicMatches, `"one" already exists`)
+}
+
+func (s *genericSuite) TestEmptyName(c *gc.C) {
+	var r registry.Registry[int]
+	err := r.Register("", 1, registry.Info{})
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *genericSuite) TestEnumerate(c *gc.C) {
+	var r registry.Registry[int]
+	c.Assert(r.Names(), gc.HasLen, 0)
+	for i, name := range []string{"c", "a", "b"} {
+		r.MustRegister(name, i, registry.Info{})
+	}
+	c.Assert(r.Names(), jc.DeepEquals, []string{"a", "b", "c"})
+	c.Assert(r.Entries(), jc.DeepEquals, []registry.Entry[int]{
+		{Name: "a", Value: 1},
+		{Name: "b", Value: 2},
+		{Name: "c", Value: 0},
+	})
+
+	c.Assert(r.Unregister("b"), jc.IsTrue)
+	c.Assert(r.Unregister("b"), jc.IsFalse)
+	c.Assert(r.Names(), jc.DeepEquals, []string{"a", "c"})
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("juju.utils.registry")
+
+// Plugin describes an executable found by DiscoverPlugins.
+type Plugin struct {
+	// Name holds the plugin name: the executable's file name
+	// without the prefix and, on Windows, the extension.
+	Name string
+
+	// Path holds the full path of the executable.
+	Path string
+}
+
+// DiscoverPlugins searches the directories in path, a list in the
+// format of $PATH, for executables whose names start with prefix,
+// such as "juju-storage-". When executables with the same name are
+// found in more than one directory, the first wins, as it would when
+// run by the shell. Directories that do not exist are ignored. The
+// plugins are returned in name order.
+func DiscoverPlugins(prefix, path string) ([]Plugin, error) {
+	if prefix == "" {
+		return nil, errors.NotValidf("empty plugin prefix")
+	}
+	found := make(map[string]bool)
+	var plugins []Plugin
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			// An empty element means the current directory,
+			// which is never searched for plugins.
+			continue
+		}
+		infos, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "cannot search %q for plugins", dir)
+		}
+		for _, info := range infos {
+			name := info.Name()
+			if !strings.HasPrefix(name, prefix) || info.IsDir() {
+				continue
+			}
+			name, ok := executableName(name, info.Mode())
+			name = strings.TrimPrefix(name, prefix)
+			if !ok || name == "" || found[name] {
+				continue
+			}
+			found[name] = true
+			plugins = append(plugins, Plugin{
+				Name: name,
+				Path: filepath.Join(dir, info.Name()),
+			})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins, nil
+}
+
+// RegisterPlugins registers in r the value returned by newValue for
+// each plugin found by DiscoverPlugins in the directories of $PATH.
+// Plugins with the same name as a value already registered are
+// skipped, so that built-in values cannot be displaced. It returns the
+// plugins that were registered.
+func RegisterPlugins[T any](r *Registry[T], prefix string, newValue func(p Plugin) T) ([]Plugin, error) {
+	plugins, err := DiscoverPlugins(prefix, os.Getenv("PATH"))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var registered []Plugin
+	for _, p := range plugins {
+		info := Info{
+			Description: "plugin " + p.Path,
+			Attrs:       map[string]string{"path": p.Path},
+		}
+		err := r.Register(p.Name, newValue(p), info)
+		if errors.IsAlreadyExists(err) {
+			logger.Debugf("ignoring plugin %q: %q already registered", p.Path, p.Name)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		registered = append(registered, p)
+	}
+	return registered, nil
+}
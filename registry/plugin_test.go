@@ -0,0 +1,76 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package registry_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/registry"
+)
+
+type pluginSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&pluginSuite{})
+
+func writeFile(c *gc.C, path string, mode os.FileMode) {
+	err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"), mode)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *pluginSuite) setUpPath(c *gc.C) (string, string) {
+	dir1, dir2 := c.MkDir(), c.MkDir()
+	writeFile(c, filepath.Join(dir1, "myapp-backend-zeta"), 0755)
+	writeFile(c, filepath.Join(dir1, "myapp-backend-alpha"), 0755)
+	writeFile(c, filepath.Join(dir1, "myapp-backend-data"), 0644)
+	writeFile(c, filepath.Join(dir1, "other-tool"), 0755)
+	writeFile(c, filepath.Join(dir2, "myapp-backend-alpha"), 0755)
+	writeFile(c, filepath.Join(dir2, "myapp-backend-beta"), 0755)
+	err := os.Mkdir(filepath.Join(dir2, "myapp-backend-dir"), 0755)
+	c.Assert(err, gc.IsNil)
+	return dir1, dir2
+}
+
+func (s *pluginSuite) TestDiscoverPlugins(c *gc.C) {
+	dir1, dir2 := s.setUpPath(c)
+	path := dir1 + string(os.PathListSeparator) + "/no/such/dir" + string(os.PathListSeparator) + dir2
+	plugins, err := registry.DiscoverPlugins("myapp-backend-", path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(plugins, jc.DeepEquals, []registry.Plugin{
+		{Name: "alpha", Path: filepath.Join(dir1, "myapp-backend-alpha")},
+		{Name: "beta", Path: filepath.Join(dir2, "myapp-backend-beta")},
+		{Name: "zeta", Path: filepath.Join(dir1, "myapp-backend-zeta")},
+	})
+}
+
+func (s *pluginSuite) TestRegisterPlugins(c *gc.C) {
+	dir1, dir2 := s.setUpPath(c)
+	s.PatchEnvironment("PATH", dir1+string(os.PathListSeparator)+dir2)
+
+	var r registry.Registry[string]
+	r.MustRegister("beta", "builtin", registry.Info{})
+	registered, err := registry.RegisterPlugins(&r, "myapp-backend-", func(p registry.Plugin) string {
+		return p.Path
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(registered, gc.HasLen, 2)
+	c.Assert(r.Names(), jc.DeepEquals, []string{"alpha", "beta", "zeta"})
+
+	v, err := r.Lookup("beta")
+	c.Assert(err, gc.IsNil)
+	c.Assert(v, gc.Equals, "builtin")
+	entry, err := r.Entry("alpha")
+	c.Assert(err, gc.IsNil)
+	c.Assert(entry.Value, gc.Equals, filepath.Join(dir1, "myapp-backend-alpha"))
+	c.Assert(entry.Info.Attrs["path"], gc.Equals, entry.Value)
+}
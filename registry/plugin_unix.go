@@ -0,0 +1,14 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package registry
+
+import "os"
+
+// executableName returns the plugin file name and whether a file with
+// the given name and mode can be executed.
+func executableName(name string, mode os.FileMode) (string, bool) {
+	return name, mode&0111 != 0
+}
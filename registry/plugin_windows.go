@@ -0,0 +1,29 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// executableName returns the file name without its extension and
+// whether the extension is one listed in %PATHEXT%.
+func executableName(name string, mode os.FileMode) (string, bool) {
+	pathext := os.Getenv("PATHEXT")
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd"
+	}
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return name, false
+	}
+	for _, e := range filepath.SplitList(pathext) {
+		if strings.EqualFold(e, ext) {
+			return strings.TrimSuffix(name, ext), true
+		}
+	}
+	return name, false
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry
+
+import (
+	"math"
+	"time"
+)
+
+// Backoff computes the delay before the next attempt from
+// Strategy.Delay and the number of attempts made so far, which is at
+// least one.
+type Backoff func(delay time.Duration, attempts int) time.Duration
+
+// maxDuration is the longest time.Duration.
+const maxDuration = time.Duration(math.MaxInt64)
+
+// Constant waits for the same delay between every attempt.
+func Constant(delay time.Duration, attempts int) time.Duration {
+	return delay
+}
+
+// Linear waits for the delay multiplied by the number of attempts made
+// so far, so the delays grow as 1x, 2x, 3x and so on.
+func Linear(delay time.Duration, attempts int) time.Duration {
+	if delay > 0 && time.Duration(attempts) > maxDuration/delay {
+		return maxDuration
+	}
+	return delay * time.Duration(attempts)
+}
+
+// Exponential returns a Backoff that multiplies the delay by factor
+// after every attempt, so the delays grow as 1x, factor, factor² and
+// so on. A factor of 1 or less gives constant delays.
+func Exponential(factor float64) Backoff {
+	return func(delay time.Duration, attempts int) time.Duration {
+		if factor <= 1 {
+			return delay
+		}
+		d := float64(delay) * math.Pow(factor, float64(attempts-1))
+		if d >= float64(maxDuration) {
+			return maxDuration
+		}
+		return time.Duration(d)
+	}
+}
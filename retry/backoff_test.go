@@ -0,0 +1,74 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"math"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/retry"
+)
+
+type backoffSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&backoffSuite{})
+
+func (*backoffSuite) TestBackoff(c *gc.C) {
+	for i, test := range []struct {
+		about    string
+		backoff  retry.Backoff
+		expected []time.Duration
+	}{{
+		about:    "constant",
+		backoff:  retry.Constant,
+		expected: []time.Duration{time.Second, time.Second, time.Second, time.Second},
+	}, {
+		about:    "linear",
+		backoff:  retry.Linear,
+		expected: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second},
+	}, {
+		about:    "exponential",
+		backoff:  retry.Exponential(2),
+		expected: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+	}, {
+		about:    "exponential with small factor",
+		backoff:  retry.Exponential(0.5),
+		expected: []time.Duration{time.Second, time.Second, time.Second, time.Second},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		var delays []time.Duration
+		for attempts := 1; attempts <= len(test.expected); attempts++ {
+			delays = append(delays, test.backoff(time.Second, attempts))
+		}
+		c.Assert(delays, jc.DeepEquals, test.expected)
+	}
+}
+
+func (*backoffSuite) TestOverflow(c *gc.C) {
+	max := time.Duration(math.MaxInt64)
+	c.Assert(retry.Linear(time.Hour, math.MaxInt32), gc.Equals, max)
+	c.Assert(retry.Exponential(10)(time.Hour, 100), gc.Equals, max)
+}
+
+func (*backoffSuite) TestStrategyDelay(c *gc.C) {
+	s := retry.Strategy{Delay: time.Second}
+	c.Assert(s.DelayAfter(3), gc.Equals, time.Second)
+
+	s.Backoff = retry.Exponential(2)
+	s.MaxDelay = 5 * time.Second
+	c.Assert(s.DelayAfter(3), gc.Equals, 4*time.Second)
+	c.Assert(s.DelayAfter(4), gc.Equals, 5*time.Second)
+
+	s.Jitter = true
+	for i := 0; i < 100; i++ {
+		d := s.DelayAfter(4)
+		c.Assert(d >= 2500*time.Millisecond && d <= 5*time.Second, jc.IsTrue, gc.Commentf("delay %v", d))
+	}
+}
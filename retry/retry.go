@@ -0,0 +1,189 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package retry repeats operations that may fail transiently, waiting
+// between attempts according to a Strategy. Attempt iterates over the
+// attempts by hand; Call runs a function until it succeeds.
+package retry
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils"
+	"github.com/juju/utils/clock"
+)
+
+// ErrStopped is the cause of the error returned by Call when
+// Strategy.Stop is closed before the function succeeds.
+var ErrStopped = errors.New("retry stopped")
+
+// Strategy describes how often and for how long an operation is
+// attempted. A Strategy without MaxAttempts or MaxDuration retries
+// until the operation succeeds or Stop is closed.
+type Strategy struct {
+	// Delay holds the delay after the first attempt, as adjusted for
+	// later attempts by Backoff.
+	Delay time.Duration
+
+	// Backoff computes the delay before each attempt after the
+	// first. If nil, Constant is used.
+	Backoff Backoff
+
+	// MaxDelay, if positive, bounds the delay between attempts.
+	MaxDelay time.Duration
+
+	// Jitter causes each delay to be chosen at random between half
+	// its value and its value, so that many clients retrying at
+	// once spread out.
+	Jitter bool
+
+	// MaxAttempts, if positive, bounds the number of attempts.
+	MaxAttempts int
+
+	// MaxDuration, if positive, bounds the time from the first
+	// attempt to the start of the last one. An attempt that would
+	// start later is not made.
+	MaxDuration time.Duration
+
+	// Stop, if not nil, abandons the attempts when it is closed,
+	// including while waiting between them.
+	Stop <-chan struct{}
+
+	// Clock is used to wait between attempts. If nil,
+	// clock.WallClock is used.
+	Clock clock.Clock
+}
+
+// DelayAfter returns the time to wait after the given number of
+// attempts, which is at least one.
+func (s Strategy) DelayAfter(attempts int) time.Duration {
+	backoff := s.Backoff
+	if backoff == nil {
+		backoff = Constant
+	}
+	d := backoff(s.Delay, attempts)
+	if s.MaxDelay > 0 && d > s.MaxDelay {
+		d = s.MaxDelay
+	}
+	if s.Jitter {
+		if jittered, err := utils.RandDuration(d/2, d); err == nil {
+			d = jittered
+		}
+	}
+	return d
+}
+
+// Attempt iterates over the attempts made under a Strategy:
+//
+//	for a := strategy.Start(); a.Next(); {
+//		if err := try(); err == nil {
+//			break
+//		}
+//	}
+type Attempt struct {
+	strategy Strategy
+	clock    clock.Clock
+	start    time.Time
+	count    int
+	stopped  bool
+}
+
+// Start begins a new sequence of attempts for the strategy.
+func (s Strategy) Start() *Attempt {
+	clk := s.Clock
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return &Attempt{
+		strategy: s,
+		clock:    clk,
+		start:    clk.Now(),
+	}
+}
+
+// Next waits until it is time for the next attempt and returns true,
+// or returns false if no more attempts should be made. The first call
+// returns true immediately unless Stop has been closed.
+func (a *Attempt) Next() bool {
+	select {
+	case <-a.strategy.Stop:
+		a.stopped = true
+		return false
+	default:
+	}
+	if a.count == 0 {
+		a.count++
+		return true
+	}
+	if a.strategy.MaxAttempts > 0 && a.count >= a.strategy.MaxAttempts {
+		return false
+	}
+	delay := a.strategy.DelayAfter(a.count)
+	if max := a.strategy.MaxDuration; max > 0 && a.clock.Now().Add(delay).Sub(a.start) > max {
+		return false
+	}
+	select {
+	case <-a.clock.After(delay):
+	case <-a.strategy.Stop:
+		a.stopped = true
+		return false
+	}
+	a.count++
+	return true
+}
+
+// Count returns the number of attempts that Next has allowed.
+func (a *Attempt) Count() int {
+	return a.count
+}
+
+// Stopped reports whether Next returned false because Strategy.Stop
+// was closed.
+func (a *Attempt) Stopped() bool {
+	return a.stopped
+}
+
+// Call calls f until it succeeds, returns an error for which
+// isRetryable returns false, or the strategy allows no more attempts.
+// If isRetryable is nil, every error is retried. An error that is not
+// retryable is returned as it is. Otherwise the last error is returned
+// annotated with the number of attempts or, if Strategy.Stop was
+// closed, in an error whose cause is ErrStopped but whose message
+// still includes it.
+func Call(s Strategy, f func() error, isRetryable func(error) bool) error {
+	var err error
+	a := s.Start()
+	for a.Next() {
+		if err = f(); err == nil {
+			return nil
+		}
+		if isRetryable != nil && !isRetryable(err) {
+			return err
+		}
+	}
+	if a.Stopped() {
+		if err == nil {
+			return ErrStopped
+		}
+		return &stoppedError{last: err}
+	}
+	return errors.Annotatef(err, "giving up after %d attempts", a.Count())
+}
+
+// stoppedError is returned by Call when Strategy.Stop is closed after
+// a failed attempt.
+type stoppedError struct {
+	last error
+}
+
+// Error implements error.
+func (e *stoppedError) Error() string {
+	return ErrStopped.Error() + ": " + e.last.Error()
+}
+
+// Cause returns ErrStopped, so that errors.Cause does.
+func (e *stoppedError) Cause() error {
+	return ErrStopped
+}
@@ -0,0 +1,177 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package retry_test
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/retry"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type retrySuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+}
+
+var _ = gc.Suite(&retrySuite{})
+
+func (s *retrySuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.New(time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// advance advances the clock by d once something is waiting on it.
+func (s *retrySuite) advance(c *gc.C, d time.Duration) {
+	err := s.clock.WaitAdvance(d, 10*time.Second, 1)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *retrySuite) TestAttemptMaxAttempts(c *gc.C) {
+	a := retry.Strategy{
+		Delay:       time.Second,
+		MaxAttempts: 3,
+		Clock:       s.clock,
+	}.Start()
+	c.Assert(a.Next(), jc.IsTrue)
+	c.Assert(a.Count(), gc.Equals, 1)
+
+	next := make(chan bool)
+	go func() { next <- a.Next() }()
+	s.advance(c, time.Second)
+	c.Assert(<-next, jc.IsTrue)
+	go func() { next <- a.Next() }()
+	s.advance(c, time.Second)
+	c.Assert(<-next, jc.IsTrue)
+	c.Assert(a.Count(), gc.Equals, 3)
+
+	// The limit is reached without waiting.
+	c.Assert(a.Next(), jc.IsFalse)
+	c.Assert(a.Stopped(), jc.IsFalse)
+	c.Assert(s.clock.Waiters(), gc.Equals, 0)
+}
+
+func (s *retrySuite) TestAttemptMaxDuration(c *gc.C) {
+	a := retry.Strategy{
+		Delay:       time.Second,
+		Backoff:     retry.Linear,
+		MaxDuration: 2 * time.Second,
+		Clock:       s.clock,
+	}.Start()
+	c.Assert(a.Next(), jc.IsTrue)
+	next := make(chan bool)
+	go func() { next <- a.Next() }()
+	s.advance(c, time.Second)
+	c.Assert(<-next, jc.IsTrue)
+
+	// The next attempt would start 3s after the first.
+	c.Assert(a.Next(), jc.IsFalse)
+	c.Assert(a.Count(), gc.Equals, 2)
+}
+
+func (s *retrySuite) TestAttemptStop(c *gc.C) {
+	stop := make(chan struct{})
+	a := retry.Strategy{
+		Delay: time.Minute,
+		Stop:  stop,
+		Clock: s.clock,
+	}.Start()
+	c.Assert(a.Next(), jc.IsTrue)
+	next := make(chan bool)
+	go func() { next <- a.Next() }()
+	err := s.clock.WaitAdvance(0, 10*time.Second, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	close(stop)
+	c.Assert(<-next, jc.IsFalse)
+	c.Assert(a.Stopped(), jc.IsTrue)
+	c.Assert(a.Count(), gc.Equals, 1)
+}
+
+func (s *retrySuite) TestCall(c *gc.C) {
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- retry.Call(retry.Strategy{
+			Delay:       time.Second,
+			Backoff:     retry.Exponential(2),
+			MaxAttempts: 5,
+			Clock:       s.clock,
+		}, func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		}, nil)
+	}()
+	s.advance(c, time.Second)
+	s.advance(c, 2*time.Second)
+	c.Assert(<-done, jc.ErrorIsNil)
+	c.Assert(calls, gc.Equals, 3)
+}
+
+func (s *retrySuite) TestCallGivesUp(c *gc.C) {
+	failure := errors.New("failed")
+	calls := 0
+	err := retry.Call(retry.Strategy{
+		MaxAttempts: 3,
+		Clock:       s.clock,
+	}, func() error {
+		calls++
+		return failure
+	}, nil)
+	c.Assert(err, gc.ErrorMatches, "giving up after 3 attempts: failed")
+	c.Assert(errors.Cause(err), gc.Equals, failure)
+	c.Assert(calls, gc.Equals, 3)
+}
+
+func (s *retrySuite) TestCallNotRetryable(c *gc.C) {
+	fatal := errors.NotFoundf("thing")
+	calls := 0
+	err := retry.Call(retry.Strategy{
+		MaxAttempts: 3,
+		Clock:       s.clock,
+	}, func() error {
+		calls++
+		if calls == 1 {
+			return errors.New("transient")
+		}
+		return fatal
+	}, func(err error) bool {
+		return !errors.IsNotFound(err)
+	})
+	c.Assert(err, gc.Equals, fatal)
+	c.Assert(calls, gc.Equals, 2)
+}
+
+func (s *retrySuite) TestCallStopped(c *gc.C) {
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- retry.Call(retry.Strategy{
+			Delay: time.Minute,
+			Stop:  stop,
+			Clock: s.clock,
+		}, func() error {
+			return errors.New("failed")
+		}, nil)
+	}()
+	err := s.clock.WaitAdvance(0, 10*time.Second, 1)
+	c.Assert(err, jc.ErrorIsNil)
+	close(stop)
+	err = <-done
+	c.Assert(errors.Cause(err), gc.Equals, retry.ErrStopped)
+	c.Assert(err, gc.ErrorMatches, "retry stopped: failed")
+
+	err = retry.Call(retry.Strategy{Stop: stop}, func() error {
+		c.Fatalf("called after stop")
+		return nil
+	}, nil)
+	c.Assert(err, gc.Equals, retry.ErrStopped)
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package syncutil provides synchronisation primitives that go beyond
+// those in the sync package.
+package syncutil
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("juju.utils.syncutil")
+
+// warningf logs warnings. It is replaced in tests.
+var warningf = logger.Warningf
+
+// Mutex is a mutual exclusion lock whose acquisition can be abandoned
+// after a timeout or when a context is done. It can also log a warning,
+// with the stack of the goroutine that acquired it, when it is held or
+// waited for for too long, which helps find the cause of stuck
+// goroutines without a full goroutine dump.
+//
+// The zero value is an unlocked mutex with no warnings. A Mutex must
+// not be copied after first use.
+type Mutex struct {
+	// Name identifies the mutex in warnings.
+	Name string
+
+	// HoldWarning, if non-zero, causes a warning to be logged when
+	// the mutex has been held for longer than this.
+	HoldWarning time.Duration
+
+	// WaitWarning, if non-zero, causes a warning to be logged when
+	// a goroutine has waited for longer than this to acquire the
+	// mutex. The warning includes the stack of the holder.
+	WaitWarning time.Duration
+
+	once sync.Once
+	ch   chan struct{}
+
+	mu    sync.Mutex
+	stack []byte
+	timer *time.Timer
+}
+
+func (m *Mutex) init() {
+	m.once.Do(func() {
+		m.ch = make(chan struct{}, 1)
+	})
+}
+
+// Lock acquires the mutex, waiting as long as necessary.
+func (m *Mutex) Lock() {
+	m.LockContext(context.Background())
+}
+
+// LockContext acquires the mutex, unless ctx is done first, in which
+// case it returns ctx.Err().
+func (m *Mutex) LockContext(ctx context.Context) error {
+	m.init()
+	select {
+	case m.ch <- struct{}{}:
+		m.acquired()
+		return nil
+	default:
+	}
+	var warn <-chan time.Time
+	if m.WaitWarning > 0 {
+		t := time.NewTimer(m.WaitWarning)
+		defer t.Stop()
+		warn = t.C
+	}
+	start := time.Now()
+	for {
+		select {
+		case m.ch <- struct{}{}:
+			m.acquired()
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-warn:
+			warn = nil
+			m.mu.Lock()
+			stack := m.stack
+			m.mu.Unlock()
+			if stack == nil {
+				warningf("waited %v for mutex %q", time.Since(start), m.Name)
+			} else {
+				warningf("waited %v for mutex %q, held since acquired at:\n%s", time.Since(start), m.Name, stack)
+			}
+		}
+	}
+}
+
+// TryLock acquires the mutex if it is not held and reports whether it
+// did so.
+func (m *Mutex) TryLock() bool {
+	m.init()
+	select {
+	case m.ch <- struct{}{}:
+		m.acquired()
+		return true
+	default:
+		return false
+	}
+}
+
+// TryLockFor acquires the mutex if it becomes free within d and
+// reports whether it did so.
+func (m *Mutex) TryLockFor(d time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return m.LockContext(ctx) == nil
+}
+
+// Unlock releases the mutex. It panics if the mutex is not held.
+func (m *Mutex) Unlock() {
+	m.init()
+	m.mu.Lock()
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	m.stack = nil
+	m.mu.Unlock()
+	select {
+	case <-m.ch:
+	default:
+		panic("syncutil: unlock of unlocked mutex")
+	}
+}
+
+// acquired records the acquisition of the mutex when warnings are
+// enabled.
+func (m *Mutex) acquired() {
+	if m.HoldWarning <= 0 && m.WaitWarning <= 0 {
+		return
+	}
+	stack := make([]byte, 8192)
+	stack = stack[:runtime.Stack(stack, false)]
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stack = stack
+	if m.HoldWarning > 0 {
+		since := time.Now()
+		m.timer = time.AfterFunc(m.HoldWarning, func() {
+			warningf("mutex %q held for more than %v since %v; acquired at:\n%s", m.Name, m.HoldWarning, since.Format(time.RFC3339), stack)
+		})
+	}
+}
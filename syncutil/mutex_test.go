@@ -0,0 +1,135 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package syncutil_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/syncutil"
+	"github.com/juju/utils/testing/leaktest"
+)
+
+type mutexSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&mutexSuite{})
+
+func (s *mutexSuite) TestLockUnlock(c *gc.C) {
+	defer leaktest.Check(c)()
+	var m syncutil.Mutex
+	m.Lock()
+	c.Assert(m.TryLock(), jc.IsFalse)
+	m.Unlock()
+	c.Assert(m.TryLock(), jc.IsTrue)
+	m.Unlock()
+	c.Assert(func() { m.Unlock() }, gc.PanicMatches, "syncutil: unlock of unlocked mutex")
+}
+
+func (s *mutexSuite) TestTryLockFor(c *gc.C) {
+	defer leaktest.Check(c)()
+	var m syncutil.Mutex
+	m.Lock()
+	c.Assert(m.TryLockFor(10*time.Millisecond), jc.IsFalse)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		m.Unlock()
+	}()
+	c.Assert(m.TryLockFor(5*time.Second), jc.IsTrue)
+	m.Unlock()
+}
+
+func (s *mutexSuite) TestLockContext(c *gc.C) {
+	defer leaktest.Check(c)()
+	var m syncutil.Mutex
+	m.Lock()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- m.LockContext(ctx)
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		c.Assert(err, gc.Equals, context.Canceled)
+	case <-time.After(5 * time.Second):
+		c.Fatalf("LockContext not cancelled")
+	}
+	m.Unlock()
+	c.Assert(m.LockContext(context.Background()), gc.IsNil)
+	m.Unlock()
+}
+
+func (s *mutexSuite) TestMutualExclusion(c *gc.C) {
+	defer leaktest.Check(c)()
+	var m syncutil.Mutex
+	counter := 0
+	done := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				m.Lock()
+				counter++
+				m.Unlock()
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	c.Assert(counter, gc.Equals, 1000)
+}
+
+func (s *mutexSuite) TestWarnings(c *gc.C) {
+	defer leaktest.Check(c)()
+	messages := make(chan string, 10)
+	s.PatchValue(syncutil.Warningf, func(format string, args ...interface{}) {
+		messages <- fmt.Sprintf(format, args...)
+	})
+	m := syncutil.Mutex{
+		Name:        "state",
+		HoldWarning: 10 * time.Millisecond,
+		WaitWarning: 10 * time.Millisecond,
+	}
+	m.Lock()
+	c.Assert(m.TryLockFor(50*time.Millisecond), jc.IsFalse)
+	m.Unlock()
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case msg := <-messages:
+			got = append(got, msg)
+		case <-time.After(5 * time.Second):
+			c.Fatalf("missing warnings; got %q", got)
+		}
+	}
+	sort.Strings(got)
+	c.Check(got[0], gc.Matches, `(?s)mutex "state" held for more than 10ms since .*; acquired at:\n.*TestWarnings.*`)
+	c.Check(got[1], gc.Matches, `(?s)waited .* for mutex "state", held since acquired at:\n.*TestWarnings.*`)
+}
+
+func (s *mutexSuite) TestNoWarningAfterUnlock(c *gc.C) {
+	defer leaktest.Check(c)()
+	messages := make(chan string, 10)
+	s.PatchValue(syncutil.Warningf, func(format string, args ...interface{}) {
+		messages <- fmt.Sprintf(format, args...)
+	})
+	m := syncutil.Mutex{HoldWarning: 20 * time.Millisecond}
+	m.Lock()
+	m.Unlock()
+	select {
+	case msg := <-messages:
+		c.Fatalf("unexpected warning %q", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
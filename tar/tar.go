@@ -14,9 +14,14 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
+
+	"github.com/juju/utils/bufpool"
+	"github.com/juju/utils/progress"
 	"github.com/juju/utils/symlink"
 )
 
@@ -50,15 +55,107 @@ func FindFile(tarFile io.Reader, filename string) (*tar.Header, io.Reader, error
 // We use a base64 encoded sha1 hash, because this is the hash
 // used by RFC 3230 Digest headers in http responses
 func TarFiles(fileList []string, target io.Writer, strip string) (shaSum string, err error) {
+	return TarFilesWithOptions(fileList, target, strip, Options{})
+}
+
+// TarFilesWithProgress is like TarFiles but reports the number of
+// bytes of file content archived to r.
+func TarFilesWithProgress(fileList []string, target io.Writer, strip string, r progress.Reporter) (shaSum string, err error) {
+	return TarFilesWithOptions(fileList, target, strip, Options{Reporter: r})
+}
+
+// Options holds options for TarFilesWithOptions.
+type Options struct {
+	// Reproducible causes the archive to depend only on the names,
+	// contents, modes and link targets of the files, so that the same
+	// files always produce a byte-identical archive. Entries are
+	// written in name order within each directory and in fileList,
+	// every entry is given the modification time ModTime, and owner
+	// and group information is cleared.
+	Reproducible bool
+
+	// ModTime holds the modification time recorded for every entry
+	// when Reproducible is set. If it is zero, the Unix epoch is
+	// used.
+	ModTime time.Time
+
+	// Reporter, if not nil, is sent the number of bytes of file
+	// content archived.
+	Reporter progress.Reporter
+}
+
+// TarFilesWithOptions is like TarFiles but allows the archive to be
+// tailored with opts.
+func TarFilesWithOptions(fileList []string, target io.Writer, strip string, opts Options) (shaSum string, err error) {
+	tw := &tarWriter{
+		strip:        strip,
+		reproducible: opts.Reproducible,
+		modTime:      opts.ModTime,
+	}
+	if tw.modTime.IsZero() {
+		tw.modTime = time.Unix(0, 0)
+	}
+	if opts.Reproducible {
+		fileList = append([]string(nil), fileList...)
+		sort.Slice(fileList, func(i, j int) bool {
+			return tw.name(fileList[i]) < tw.name(fileList[j])
+		})
+	}
+	if opts.Reporter != nil {
+		total, err := contentSize(fileList)
+		if err != nil {
+			return "", err
+		}
+		tw.tracker = progress.NewTracker(opts.Reporter, "tar", total, nil)
+		defer func() {
+			tw.tracker.Done(err)
+		}()
+	}
 	shahash := sha1.New()
-	if err := tarAndHashFiles(fileList, target, strip, shahash); err != nil {
+	if err := tw.tarAndHashFiles(fileList, target, shahash); err != nil {
 		return "", err
 	}
 	encodedHash := base64.StdEncoding.EncodeToString(shahash.Sum(nil))
 	return encodedHash, nil
 }
 
-func tarAndHashFiles(fileList []string, target io.Writer, strip string, hashw io.Writer) (err error) {
+// contentSize returns the total size of the regular files at or below
+// the paths in fileList.
+func contentSize(fileList []string) (int64, error) {
+	var total int64
+	for _, ent := range fileList {
+		err := filepath.Walk(ent, func(_ string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				total += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// tarWriter writes files to a tar archive as specified by the
+// Options passed to TarFilesWithOptions.
+type tarWriter struct {
+	tarw         *tar.Writer
+	strip        string
+	reproducible bool
+	modTime      time.Time
+	tracker      *progress.Tracker
+}
+
+// name returns the name under which fileName is stored.
+func (tw *tarWriter) name(fileName string) string {
+	return filepath.ToSlash(strings.TrimPrefix(fileName, tw.strip))
+}
+
+func (tw *tarWriter) tarAndHashFiles(fileList []string, target io.Writer, hashw io.Writer) (err error) {
 	checkClose := func(w io.Closer) {
 		if closeErr := w.Close(); closeErr != nil && err == nil {
 			err = fmt.Errorf("error closing tar writer: %v", closeErr)
@@ -66,10 +163,10 @@ func tarAndHashFiles(fileList []string, target io.Writer, strip string, hashw io
 	}
 
 	w := io.MultiWriter(target, hashw)
-	tarw := tar.NewWriter(w)
-	defer checkClose(tarw)
+	tw.tarw = tar.NewWriter(w)
+	defer checkClose(tw.tarw)
 	for _, ent := range fileList {
-		if err := writeContents(ent, strip, tarw); err != nil {
+		if err := tw.writeContents(ent); err != nil {
 			return fmt.Errorf("write to tar file failed: %v", err)
 		}
 	}
@@ -78,7 +175,7 @@ func tarAndHashFiles(fileList []string, target io.Writer, strip string, hashw io
 
 // writeContents creates an entry for the given file
 // or directory in the given tar archive.
-func writeContents(fileName, strip string, tarw *tar.Writer) error {
+func (tw *tarWriter) writeContents(fileName string) error {
 	f, err := os.Open(fileName)
 	if err != nil {
 		return err
@@ -102,37 +199,65 @@ func writeContents(fileName, strip string, tarw *tar.Writer) error {
 	if err != nil {
 		return fmt.Errorf("cannot create tar header for %q: %v", fileName, err)
 	}
-	h.Name = filepath.ToSlash(strings.TrimPrefix(fileName, strip))
-	if err := tarw.WriteHeader(h); err != nil {
+	h.Name = tw.name(fileName)
+	if tw.reproducible {
+		tw.normalise(h)
+	}
+	if err := tw.tarw.WriteHeader(h); err != nil {
 		return fmt.Errorf("cannot write header for %q: %v", fileName, err)
 	}
 	if fInfo.Mode()&os.ModeSymlink == os.ModeSymlink {
 		return nil
 	}
 	if !fInfo.IsDir() {
-		if _, err := io.Copy(tarw, f); err != nil {
+		var w io.Writer = tw.tarw
+		if tw.tracker != nil {
+			w = progress.NewWriter(tw.tarw, tw.tracker)
+		}
+		if _, err := bufpool.Copy(w, f); err != nil {
 			return fmt.Errorf("failed to write %q: %v", fileName, err)
 		}
 		return nil
 	}
 
+	var names []string
 	for {
-		names, err := f.Readdirnames(100)
 		// will return at most 100 names and if less than 100 remaining
 		// next call will return io.EOF and no names
+		batch, err := f.Readdirnames(100)
+		names = append(names, batch...)
 		if err == io.EOF {
-			return nil
+			break
 		}
 		if err != nil {
 			return fmt.Errorf("error reading directory %q: %v", fileName, err)
 		}
-		for _, name := range names {
-			if err := writeContents(filepath.Join(fileName, name), strip, tarw); err != nil {
-				return err
-			}
+	}
+	if tw.reproducible {
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if err := tw.writeContents(filepath.Join(fileName, name)); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// normalise clears the parts of h that depend on when and by whom
+// the file was created.
+func (tw *tarWriter) normalise(h *tar.Header) {
+	h.ModTime = tw.modTime.Truncate(time.Second)
+	h.AccessTime = time.Time{}
+	h.ChangeTime = time.Time{}
+	h.Uid = 0
+	h.Gid = 0
+	h.Uname = ""
+	h.Gname = ""
+	h.Devmajor = 0
+	h.Devminor = 0
+	h.Xattrs = nil
+	h.PAXRecords = nil
 }
 
 func createAndFill(filePath string, mode int64, content io.Reader) error {
@@ -141,7 +266,7 @@ func createAndFill(filePath string, mode int64, content io.Reader) error {
 	if err != nil {
 		return fmt.Errorf("some of the tar contents cannot be written to disk: %v", err)
 	}
-	_, err = io.Copy(fh, content)
+	_, err = bufpool.Copy(fh, content)
 	if err != nil {
 		return fmt.Errorf("failed while reading tar contents: %v", err)
 	}
@@ -152,6 +277,17 @@ func createAndFill(filePath string, mode int64, content io.Reader) error {
 	return nil
 }
 
+// UntarFilesWithProgress is like UntarFiles but reports the number
+// of bytes read from tarFile to r. The total size of the archive is
+// given by size, which may be -1 if it is not known.
+func UntarFilesWithProgress(tarFile io.Reader, outputFolder string, size int64, r progress.Reporter) (err error) {
+	t := progress.NewTracker(r, "untar", size, nil)
+	defer func() {
+		t.Done(err)
+	}()
+	return UntarFiles(progress.NewReader(tarFile, t), outputFolder)
+}
+
 // UntarFiles will extract the contents of tarFile using
 // outputFolder as root
 func UntarFiles(tarFile io.Reader, outputFolder string) error {
@@ -15,9 +15,12 @@ import (
 	"path/filepath"
 	"strings"
 	stdtesting "testing"
+	"time"
 
 	"github.com/juju/testing"
 	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/progress"
 )
 
 func TestPackage(t *stdtesting.T) {
@@ -256,6 +259,93 @@ func (t *TarSuite) TestUnTarFilesUncompressed(c *gc.C) {
 	t.assertFilesWhereUntared(c, testExpectedTarContents, outputDir)
 }
 
+func (t *TarSuite) TestTarUntarWithProgress(c *gc.C) {
+	t.createTestFiles(c)
+	var reports []progress.Progress
+	reporter := progress.ReporterFunc(func(p progress.Progress) {
+		reports = append(reports, p)
+	})
+	var outputTar bytes.Buffer
+	trimPath := fmt.Sprintf("%s/", t.cwd)
+	_, err := TarFilesWithProgress(t.testFiles, &outputTar, trimPath, reporter)
+	c.Assert(err, gc.IsNil)
+	last := reports[len(reports)-1]
+	c.Assert(last.Done, gc.Equals, true)
+	c.Assert(last.Total, gc.Equals, int64(len("TarSubFile1TarFile1TarFile2")))
+	c.Assert(last.Current, gc.Equals, last.Total)
+	t.removeTestFiles(c)
+
+	outputDir := filepath.Join(t.cwd, "TarOuputFolder")
+	err = os.Mkdir(outputDir, os.FileMode(0755))
+	c.Check(err, gc.IsNil)
+
+	size := int64(outputTar.Len())
+	reports = nil
+	err = UntarFilesWithProgress(&outputTar, outputDir, size, reporter)
+	c.Assert(err, gc.IsNil)
+	t.assertFilesWhereUntared(c, testExpectedTarContents, outputDir)
+	last = reports[len(reports)-1]
+	c.Assert(last.Done, gc.Equals, true)
+	c.Assert(last.Total, gc.Equals, size)
+	c.Assert(last.Current > 0, gc.Equals, true)
+}
+
+func (t *TarSuite) TestTarFilesReproducible(c *gc.C) {
+	t.createTestFiles(c)
+	trimPath := fmt.Sprintf("%s/", t.cwd)
+	modTime := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	opts := Options{
+		Reproducible: true,
+		ModTime:      modTime,
+	}
+	var first bytes.Buffer
+	_, err := TarFilesWithOptions(t.testFiles, &first, trimPath, opts)
+	c.Assert(err, gc.IsNil)
+
+	// Change the times of the files and reverse the order in which
+	// they are listed; neither should change the archive.
+	later := time.Now().Add(time.Hour)
+	err = filepath.Walk(t.cwd, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		return os.Chtimes(path, later, later)
+	})
+	c.Assert(err, gc.IsNil)
+	reversed := make([]string, len(t.testFiles))
+	for i, f := range t.testFiles {
+		reversed[len(reversed)-1-i] = f
+	}
+	var second bytes.Buffer
+	_, err = TarFilesWithOptions(reversed, &second, trimPath, opts)
+	c.Assert(err, gc.IsNil)
+	c.Assert(second.Bytes(), gc.DeepEquals, first.Bytes())
+
+	var names []string
+	tr := tar.NewReader(&first)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, gc.IsNil)
+		names = append(names, hdr.Name)
+		c.Check(hdr.ModTime.Equal(modTime), gc.Equals, true)
+		c.Check(hdr.Uid, gc.Equals, 0)
+		c.Check(hdr.Uname, gc.Equals, "")
+	}
+	c.Assert(names, gc.DeepEquals, []string{
+		"TarDirectoryEmpty",
+		"TarDirectoryPopulated",
+		"TarDirectoryPopulated/TarDirectoryPopulatedSubDirectory",
+		"TarDirectoryPopulated/TarSubFile1",
+		"TarDirectoryPopulated/TarSubLink",
+		"TarFile1",
+		"TarFile2",
+		"TarLink",
+	})
+}
+
 func (t *TarSuite) TestFindFileFound(c *gc.C) {
 	t.createTestFiles(c)
 	var outputTar bytes.Buffer
@@ -0,0 +1,99 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package term
+
+import (
+	"bytes"
+	"io"
+)
+
+const (
+	esc = 0x1b
+	bel = 0x07
+)
+
+type ansiState int
+
+const (
+	stateText ansiState = iota
+	stateEscape
+	stateCSI
+	stateString
+	stateStringEscape
+)
+
+// StripWriter removes ANSI escape sequences, such as color and cursor
+// movement, from the data written to it before writing it on. A
+// sequence may be split across writes.
+type StripWriter struct {
+	w     io.Writer
+	state ansiState
+	buf   bytes.Buffer
+}
+
+// NewStripWriter returns a StripWriter that writes to w.
+func NewStripWriter(w io.Writer) *StripWriter {
+	return &StripWriter{w: w}
+}
+
+// Write implements io.Writer. It returns len(p) if the stripped data was
+// written successfully.
+func (s *StripWriter) Write(p []byte) (int, error) {
+	s.buf.Reset()
+	for _, b := range p {
+		switch s.state {
+		case stateText:
+			if b == esc {
+				s.state = stateEscape
+			} else {
+				s.buf.WriteByte(b)
+			}
+		case stateEscape:
+			switch {
+			case b == '[':
+				s.state = stateCSI
+			case b == ']' || b == 'P' || b == '_' || b == '^' || b == 'X':
+				// OSC, DCS, APC, PM and SOS strings run until a
+				// string terminator.
+				s.state = stateString
+			case b >= 0x20 && b <= 0x2f:
+				// Intermediate bytes of a longer escape; the
+				// sequence ends with the next final byte.
+			default:
+				s.state = stateText
+			}
+		case stateCSI:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = stateText
+			}
+		case stateString:
+			switch b {
+			case bel:
+				s.state = stateText
+			case esc:
+				s.state = stateStringEscape
+			}
+		case stateStringEscape:
+			if b == '\\' {
+				s.state = stateText
+			} else if b != esc {
+				s.state = stateString
+			}
+		}
+	}
+	if s.buf.Len() == 0 {
+		return len(p), nil
+	}
+	if _, err := s.w.Write(s.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// StripANSI returns s with ANSI escape sequences removed.
+func StripANSI(s string) string {
+	var buf bytes.Buffer
+	NewStripWriter(&buf).Write([]byte(s))
+	return buf.String()
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package term
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// NotifyResize sends the new size of the terminal f on ch whenever the
+// terminal is resized, until the returned function is called. Sizes are
+// dropped if ch is not ready to receive them.
+func NotifyResize(f *os.File, ch chan<- Size) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				if size, err := GetSize(f); err == nil {
+					select {
+					case ch <- size:
+					default:
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
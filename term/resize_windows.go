@@ -0,0 +1,44 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package term
+
+import (
+	"os"
+	"time"
+)
+
+// resizePollInterval is how often the console size is checked, as
+// Windows sends no signal when a console is resized.
+const resizePollInterval = 250 * time.Millisecond
+
+// NotifyResize sends the new size of the terminal f on ch whenever the
+// terminal is resized, until the returned function is called. Sizes are
+// dropped if ch is not ready to receive them.
+func NotifyResize(f *os.File, ch chan<- Size) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		last, _ := GetSize(f)
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				size, err := GetSize(f)
+				if err != nil || size == last {
+					continue
+				}
+				last = size
+				select {
+				case ch <- size:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package term answers questions about the terminal a program is
+// attached to: whether there is one, its size, and how much color it
+// supports. It also removes ANSI escape sequences from output that is
+// not going to a terminal.
+package term
+
+import (
+	"os"
+	"strings"
+
+	"code.google.com/p/go.crypto/ssh/terminal"
+	"github.com/juju/errors"
+)
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(f *os.File) bool {
+	return terminal.IsTerminal(int(f.Fd()))
+}
+
+// Size holds the dimensions of a terminal in characters.
+type Size struct {
+	Width  int
+	Height int
+}
+
+// GetSize returns the size of the terminal f.
+func GetSize(f *os.File) (Size, error) {
+	w, h, err := terminal.GetSize(int(f.Fd()))
+	if err != nil {
+		return Size{}, errors.Annotate(err, "cannot get terminal size")
+	}
+	return Size{Width: w, Height: h}, nil
+}
+
+// ColorLevel describes how much color a terminal supports.
+type ColorLevel int
+
+const (
+	// NoColor means that escape sequences for color should not be
+	// written.
+	NoColor ColorLevel = iota
+
+	// Color16 means the 16 basic ANSI colors are supported.
+	Color16
+
+	// Color256 means the xterm 256 color palette is supported.
+	Color256
+
+	// TrueColor means 24-bit color is supported.
+	TrueColor
+)
+
+// Color returns the level of color support for output written to f. It
+// honours the NO_COLOR convention (https://no-color.org), and
+// FORCE_COLOR for forcing color on output that is not a terminal.
+func Color(f *os.File) ColorLevel {
+	return colorLevel(IsTerminal(f), os.Getenv)
+}
+
+func colorLevel(isTerminal bool, getenv func(string) string) ColorLevel {
+	if getenv("NO_COLOR") != "" {
+		return NoColor
+	}
+	term := getenv("TERM")
+	force := getenv("FORCE_COLOR")
+	switch force {
+	case "", "0", "false":
+		force = ""
+		if !isTerminal || term == "dumb" {
+			return NoColor
+		}
+	}
+	switch colorterm := strings.ToLower(getenv("COLORTERM")); {
+	case colorterm == "truecolor" || colorterm == "24bit":
+		return TrueColor
+	case strings.Contains(term, "256color"):
+		return Color256
+	case force == "2":
+		return Color256
+	case force == "3":
+		return TrueColor
+	}
+	return Color16
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package term_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/term"
+)
+
+type termSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&termSuite{})
+
+func (s *termSuite) TestNotTerminal(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(path, nil, 0644), gc.IsNil)
+	f, err := os.Open(path)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	c.Assert(term.IsTerminal(f), jc.IsFalse)
+	_, err = term.GetSize(f)
+	c.Assert(err, gc.ErrorMatches, "cannot get terminal size: .*")
+	c.Assert(term.Color(f), gc.Equals, term.NoColor)
+}
+
+func (s *termSuite) TestColorLevel(c *gc.C) {
+	for i, test := range []struct {
+		terminal bool
+		env      map[string]string
+		expect   term.ColorLevel
+	}{
+		{false, nil, term.NoColor},
+		{true, map[string]string{"TERM": "xterm"}, term.Color16},
+		{true, map[string]string{"TERM": "xterm-256color"}, term.Color256},
+		{true, map[string]string{"TERM": "xterm", "COLORTERM": "truecolor"}, term.TrueColor},
+		{true, map[string]string{"TERM": "dumb"}, term.NoColor},
+		{true, map[string]string{"TERM": "xterm-256color", "NO_COLOR": "1"}, term.NoColor},
+		{false, map[string]string{"FORCE_COLOR": "1"}, term.Color16},
+		{false, map[string]string{"FORCE_COLOR": "3"}, term.TrueColor},
+		{false, map[string]string{"FORCE_COLOR": "0"}, term.NoColor},
+		{false, map[string]string{"FORCE_COLOR": "1", "NO_COLOR": "x"}, term.NoColor},
+	} {
+		c.Logf("test %d", i)
+		getenv := func(name string) string { return test.env[name] }
+		c.Check(term.ColorLevelFromEnv(test.terminal, getenv), gc.Equals, test.expect)
+	}
+}
+
+func (s *termSuite) TestStripANSI(c *gc.C) {
+	for i, test := range []struct {
+		in, out string
+	}{
+		{"plain text\n", "plain text\n"},
+		{"\x1b[1;31merror\x1b[0m: failed", "error: failed"},
+		{"\x1b[2K\x1b[1Gprogress 50%", "progress 50%"},
+		{"\x1b]0;window title\x07after", "after"},
+		{"\x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"\x1b(Bcharset", "charset"},
+		{"\x1b7saved\x1b8", "saved"},
+		{"unicode ✓ \x1b[32mok\x1b[m", "unicode ✓ ok"},
+	} {
+		c.Logf("test %d: %q", i, test.in)
+		c.Check(term.StripANSI(test.in), gc.Equals, test.out)
+	}
+}
+
+func (s *termSuite) TestStripWriterSplitSequence(c *gc.C) {
+	var buf bytes.Buffer
+	w := term.NewStripWriter(&buf)
+	in := "a\x1b[38;5;196mred\x1b[0mb"
+	for i := 0; i < len(in); i++ {
+		n, err := w.Write([]byte{in[i]})
+		c.Assert(err, gc.IsNil)
+		c.Assert(n, gc.Equals, 1)
+	}
+	c.Assert(buf.String(), gc.Equals, "aredb")
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package exectest provides a fake exec.Runner that records the
+// commands it is asked to run and replies with scripted responses.
+package exectest
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/exec"
+)
+
+// Runner is an exec.Runner that runs nothing. Each command is matched
+// against the rules added with Add and AddOnce, in the order they were
+// added, and the response of the first matching rule is returned. The
+// zero value has no rules and is ready for use. Its methods may be
+// called concurrently.
+type Runner struct {
+	mu    sync.Mutex
+	rules []*rule
+	calls []exec.RunParams
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	resp    *exec.ExecResponse
+	err     error
+	once    bool
+	used    bool
+}
+
+var _ exec.Runner = (*Runner)(nil)
+
+// Add adds a rule that gives the response resp and error err to every
+// command whose command line, as returned by CommandLine, matches the
+// regular expression pattern. It panics if pattern is not valid.
+func (r *Runner) Add(pattern string, resp *exec.ExecResponse, err error) {
+	r.add(pattern, resp, err, false)
+}
+
+// AddOnce is like Add, but the rule only applies to the first
+// command that matches it, so that a sequence of responses to the same
+// command can be scripted.
+func (r *Runner) AddOnce(pattern string, resp *exec.ExecResponse, err error) {
+	r.add(pattern, resp, err, true)
+}
+
+func (r *Runner) add(pattern string, resp *exec.ExecResponse, err error, once bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, &rule{
+		pattern: regexp.MustCompile(pattern),
+		resp:    resp,
+		err:     err,
+		once:    once,
+	})
+}
+
+// RunCommands implements exec.Runner. The command is recorded and the
+// scripted response returned; a command that matches no rule results
+// in an error satisfying errors.IsNotFound. The response is a copy, so
+// that callers may modify it. Output in the response is written to
+// run.Stdout and run.Stderr, and passed to run.OnStdoutLine and
+// run.OnStderrLine, as it would be by a real command.
+func (r *Runner) RunCommands(run exec.RunParams) (*exec.ExecResponse, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, run)
+	var found *rule
+	line := CommandLine(run)
+	for _, rule := range r.rules {
+		if rule.used || !rule.pattern.MatchString(line) {
+			continue
+		}
+		rule.used = rule.once
+		found = rule
+		break
+	}
+	r.mu.Unlock()
+	if found == nil {
+		return nil, errors.NotFoundf("response for command %q", line)
+	}
+	if found.resp == nil {
+		return nil, found.err
+	}
+	resp := *found.resp
+	resp.Stdout = deliver(resp.Stdout, run.Stdout, run.OnStdoutLine)
+	resp.Stderr = deliver(resp.Stderr, run.Stderr, run.OnStderrLine)
+	return &resp, found.err
+}
+
+// deliver sends output to w and onLine, if set, and returns what
+// should be left in the response.
+func deliver(output []byte, w io.Writer, onLine func(string)) []byte {
+	if onLine != nil && len(output) > 0 {
+		for _, line := range strings.SplitAfter(string(output), "\n") {
+			if line != "" {
+				onLine(strings.TrimSuffix(line, "\n"))
+			}
+		}
+	}
+	if w == nil {
+		return append([]byte(nil), output...)
+	}
+	w.Write(output)
+	return nil
+}
+
+// Calls returns the parameters of every command run so far, in the
+// order in which they were run.
+func (r *Runner) Calls() []exec.RunParams {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]exec.RunParams(nil), r.calls...)
+}
+
+// CommandLines returns the command line of every command run so far,
+// as returned by CommandLine.
+func (r *Runner) CommandLines() []string {
+	calls := r.Calls()
+	lines := make([]string, len(calls))
+	for i, run := range calls {
+		lines[i] = CommandLine(run)
+	}
+	return lines
+}
+
+// CommandLine returns the text that rules are matched against for
+// run: its Commands or, if it has Args, the arguments joined by
+// spaces.
+func CommandLine(run exec.RunParams) string {
+	if len(run.Args) > 0 {
+		return strings.Join(run.Args, " ")
+	}
+	return run.Commands
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package exectest_test
+
+import (
+	"bytes"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/exec"
+	"github.com/juju/utils/testing/exectest"
+)
+
+type exectestSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&exectestSuite{})
+
+func (*exectestSuite) TestRules(c *gc.C) {
+	var r exectest.Runner
+	r.AddOnce(`^apt-get update$`, &exec.ExecResponse{Code: 100}, nil)
+	r.Add(`^apt-get `, &exec.ExecResponse{Stdout: []byte("ok\n")}, nil)
+	r.Add(`^reboot`, nil, errors.New("not allowed"))
+
+	var runner exec.Runner = &r
+	resp, err := runner.RunCommands(exec.RunParams{Commands: "apt-get update"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 100)
+
+	resp, err = runner.RunCommands(exec.RunParams{Args: []string{"apt-get", "update"}})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(resp.Code, gc.Equals, 0)
+	c.Assert(string(resp.Stdout), gc.Equals, "ok\n")
+
+	_, err = runner.RunCommands(exec.RunParams{Commands: "reboot now"})
+	c.Assert(err, gc.ErrorMatches, "not allowed")
+
+	_, err = runner.RunCommands(exec.RunParams{Commands: "ls"})
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	c.Assert(err, gc.ErrorMatches, `response for command "ls" not found`)
+
+	c.Assert(r.CommandLines(), jc.DeepEquals, []string{
+		"apt-get update", "apt-get update", "reboot now", "ls",
+	})
+	c.Assert(r.Calls()[1].Args, jc.DeepEquals, []string{"apt-get", "update"})
+}
+
+func (*exectestSuite) TestResponseCopied(c *gc.C) {
+	var r exectest.Runner
+	r.Add(`.*`, &exec.ExecResponse{Stdout: []byte("out")}, nil)
+	resp, err := r.RunCommands(exec.RunParams{})
+	c.Assert(err, jc.ErrorIsNil)
+	resp.Stdout[0] = 'X'
+	resp.Code = 1
+	resp, err = r.RunCommands(exec.RunParams{})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "out")
+	c.Assert(resp.Code, gc.Equals, 0)
+}
+
+func (*exectestSuite) TestOutputDelivered(c *gc.C) {
+	var r exectest.Runner
+	r.Add(`.*`, &exec.ExecResponse{
+		Stdout: []byte("one\ntwo\n"),
+		Stderr: []byte("oops"),
+	}, nil)
+	var stderr bytes.Buffer
+	var lines []string
+	resp, err := r.RunCommands(exec.RunParams{
+		Stderr: &stderr,
+		OnStdoutLine: func(line string) {
+			lines = append(lines, line)
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(resp.Stdout), gc.Equals, "one\ntwo\n")
+	c.Assert(resp.Stderr, gc.HasLen, 0)
+	c.Assert(stderr.String(), gc.Equals, "oops")
+	c.Assert(lines, jc.DeepEquals, []string{"one", "two"})
+}
@@ -0,0 +1,229 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package leaktest provides a helper for detecting goroutines that
+// are left running at the end of a test.
+//
+// Typical use in a gocheck test:
+//
+//	func (s *mySuite) TestSomething(c *gc.C) {
+//	    defer leaktest.Check(c)()
+//	    ...
+//	}
+package leaktest
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TestingT is the subset of *gc.C and *testing.T used to report leaks.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Allowed holds prefixes of function names identifying goroutines that
+// are expected to outlive any single test. A goroutine is ignored if
+// the function at the top of its stack, or the function that created
+// it, starts with one of these prefixes; functions further down the
+// stack are not considered, so that a goroutine blocked in a read or a
+// channel operation is still reported whatever called it.
+var Allowed = []string{
+	// The runtime, the testing framework and gocheck.
+	"runtime.ensureSigM",
+	"runtime/trace.Start",
+	"testing.(*M).",
+	"testing.(*T).Run",
+	"testing.tRunner",
+	"testing.runTests",
+	"gopkg.in/check%2ev1.(*resultTracker).",
+	"gopkg.in/check%2ev1.(*suiteRunner).forkCall",
+	// Long lived standard library workers: signal delivery, and
+	// the read and write loops of idle HTTP client connections.
+	"os/signal.signal_recv",
+	"os/signal.Notify.",
+	"net/http.(*Transport).dialConn",
+	// This repository's own process-wide workers: the zombie reaper
+	// supervising the process's children, the waiters that reap
+	// detached commands, which deliberately outlive the call that
+	// started them, and the debug status server. Per-instance
+	// workers, such as config watchers, tailers and parallel.Run
+	// pools, must be stopped by the code that starts them and are
+	// reported if they are not.
+	"github.com/juju/utils/reaper.Start",
+	"github.com/juju/utils/exec.(*RunParams).startDetached",
+	"github.com/juju/utils/debugstatus.ServeUnix",
+}
+
+// Deadline holds how long Check waits for goroutines started during
+// the test to finish before reporting them as leaked.
+var Deadline = 5 * time.Second
+
+// Goroutine describes a single goroutine found in a snapshot.
+type Goroutine struct {
+	// ID holds the runtime's goroutine identifier.
+	ID int
+
+	// State holds the scheduler state, for example "chan receive".
+	State string
+
+	// Function holds the name of the function at the top of the stack.
+	Function string
+
+	// CreatedBy holds the name of the function that started the
+	// goroutine, if known.
+	CreatedBy string
+
+	// Stack holds the complete stack trace of the goroutine.
+	Stack string
+}
+
+// Label returns a short human readable description of the goroutine,
+// suitable for identifying it in test failure output.
+func (g Goroutine) Label() string {
+	label := fmt.Sprintf("goroutine %d [%s] in %s", g.ID, g.State, g.Function)
+	if g.CreatedBy != "" {
+		label += " (created by " + g.CreatedBy + ")"
+	}
+	return label
+}
+
+func (g Goroutine) allowed(allowed []string) bool {
+	for _, prefix := range allowed {
+		if strings.HasPrefix(g.Function, prefix) || strings.HasPrefix(g.CreatedBy, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot returns all goroutines currently running, other than the
+// calling goroutine, sorted by ID.
+func Snapshot() []Goroutine {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	var result []Goroutine
+	// The first goroutine in a dump is always the current one.
+	for i, block := range strings.Split(string(buf), "\n\n") {
+		if i == 0 {
+			continue
+		}
+		if g, ok := parseGoroutine(block); ok {
+			result = append(result, g)
+		}
+	}
+	sort.Sort(byID(result))
+	return result
+}
+
+type byID []Goroutine
+
+func (b byID) Len() int           { return len(b) }
+func (b byID) Less(i, j int) bool { return b[i].ID < b[j].ID }
+func (b byID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// parseGoroutine parses a single goroutine block as produced by
+// runtime.Stack.
+func parseGoroutine(block string) (Goroutine, bool) {
+	lines := strings.Split(strings.TrimSpace(block), "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "goroutine ") {
+		return Goroutine{}, false
+	}
+	header := strings.TrimPrefix(lines[0], "goroutine ")
+	space := strings.Index(header, " ")
+	if space < 0 {
+		return Goroutine{}, false
+	}
+	id, err := strconv.Atoi(header[:space])
+	if err != nil {
+		return Goroutine{}, false
+	}
+	state := strings.TrimSuffix(strings.TrimSpace(header[space:]), ":")
+	state = strings.TrimSuffix(strings.TrimPrefix(state, "["), "]")
+	g := Goroutine{
+		ID:    id,
+		State: state,
+		Stack: strings.Join(lines, "\n"),
+	}
+	if len(lines) > 1 {
+		g.Function = funcName(lines[1])
+	}
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "created by ") {
+			g.CreatedBy = funcName(strings.TrimPrefix(line, "created by "))
+		}
+	}
+	return g, true
+}
+
+// funcName strips the arguments and goroutine annotations from a
+// stack trace function line.
+func funcName(line string) string {
+	if i := strings.Index(line, " in goroutine "); i >= 0 {
+		line = line[:i]
+	}
+	if i := strings.LastIndex(line, "("); i > 0 && strings.HasSuffix(line, ")") {
+		line = line[:i]
+	}
+	return line
+}
+
+// Check takes a snapshot of the currently running goroutines and
+// returns a function that reports, through t, every goroutine started
+// since the snapshot that is still running - other than those matched
+// by Allowed or by the given extra function name prefixes. The returned
+// function waits up to Deadline for goroutines to finish before
+// reporting them.
+func Check(t TestingT, allowed ...string) func() {
+	before := make(map[int]bool)
+	for _, g := range Snapshot() {
+		before[g.ID] = true
+	}
+	// The prefixes are copied so that the caller's slice is never
+	// written to.
+	allowed = append(append([]string(nil), allowed...), Allowed...)
+	return func() {
+		var leaked []Goroutine
+		deadline := time.Now().Add(Deadline)
+		for {
+			leaked = Leaked(before, allowed)
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(leaked) == 0 {
+			return
+		}
+		var report []string
+		for _, g := range leaked {
+			report = append(report, g.Label()+"\n"+g.Stack)
+		}
+		t.Errorf("%d goroutine(s) leaked:\n%s", len(leaked), strings.Join(report, "\n\n"))
+	}
+}
+
+// Leaked returns the goroutines currently running whose IDs are not
+// recorded in before and that are not matched by any of the allowed
+// function name prefixes.
+func Leaked(before map[int]bool, allowed []string) []Goroutine {
+	var leaked []Goroutine
+	for _, g := range Snapshot() {
+		if before[g.ID] || g.allowed(allowed) {
+			continue
+		}
+		leaked = append(leaked, g)
+	}
+	return leaked
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package leaktest_test
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/testing/leaktest"
+)
+
+type leaktestSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&leaktestSuite{})
+
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func leakyWorker(stop <-chan struct{}) {
+	<-stop
+}
+
+func callsLeakyWorker(stop <-chan struct{}) {
+	leakyWorker(stop)
+}
+
+func blockedReader(f *os.File) {
+	f.Read(make([]byte, 1))
+}
+
+func (s *leaktestSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.PatchValue(&leaktest.Deadline, 100*time.Millisecond)
+}
+
+func (*leaktestSuite) TestNoLeak(c *gc.C) {
+	var r recorder
+	check := leaktest.Check(&r)
+	done := make(chan struct{})
+	go func() {
+		close(done)
+	}()
+	<-done
+	check()
+	c.Assert(r.errors, gc.HasLen, 0)
+}
+
+func (*leaktestSuite) TestWaitsForGoroutinesToFinish(c *gc.C) {
+	var r recorder
+	check := leaktest.Check(&r)
+	go time.Sleep(20 * time.Millisecond)
+	check()
+	c.Assert(r.errors, gc.HasLen, 0)
+}
+
+func (*leaktestSuite) TestLeakReported(c *gc.C) {
+	var r recorder
+	check := leaktest.Check(&r)
+	stop := make(chan struct{})
+	defer close(stop)
+	go leakyWorker(stop)
+	check()
+	c.Assert(r.errors, gc.HasLen, 1)
+	c.Assert(r.errors[0], jc.Contains, "1 goroutine(s) leaked")
+	c.Assert(r.errors[0], jc.Contains, "[chan receive] in github.com/juju/utils/testing/leaktest_test.leakyWorker")
+	c.Assert(r.errors[0], jc.Contains, "created by github.com/juju/utils/testing/leaktest_test.(*leaktestSuite).TestLeakReported")
+}
+
+func (*leaktestSuite) TestAllowedPrefix(c *gc.C) {
+	var r recorder
+	check := leaktest.Check(&r, "github.com/juju/utils/testing/leaktest_test.leakyWorker")
+	stop := make(chan struct{})
+	defer close(stop)
+	go leakyWorker(stop)
+	check()
+	c.Assert(r.errors, gc.HasLen, 0)
+}
+
+func (*leaktestSuite) TestAllowedNotModified(c *gc.C) {
+	allowed := make([]string, 1, 10)
+	allowed[0] = "github.com/juju/utils/testing/leaktest_test.leakyWorker"
+	var r recorder
+	check := leaktest.Check(&r, allowed...)
+	c.Assert(allowed[:cap(allowed)][1:], jc.DeepEquals, make([]string, 9))
+	check()
+	c.Assert(r.errors, gc.HasLen, 0)
+}
+
+func (*leaktestSuite) TestPipeReadLeakReported(c *gc.C) {
+	pr, pw, err := os.Pipe()
+	c.Assert(err, jc.ErrorIsNil)
+	defer pr.Close()
+	defer pw.Close()
+	var r recorder
+	check := leaktest.Check(&r)
+	go blockedReader(pr)
+	check()
+	c.Assert(r.errors, gc.HasLen, 1)
+	c.Assert(r.errors[0], jc.Contains, "1 goroutine(s) leaked")
+	c.Assert(r.errors[0], jc.Contains, "created by github.com/juju/utils/testing/leaktest_test.(*leaktestSuite).TestPipeReadLeakReported")
+}
+
+func (*leaktestSuite) TestAllowedMatchesOnlyTopOrCreator(c *gc.C) {
+	var r recorder
+	check := leaktest.Check(&r, "github.com/juju/utils/testing/leaktest_test.callsLeakyWorker")
+	stop := make(chan struct{})
+	defer close(stop)
+	go callsLeakyWorker(stop)
+	check()
+	c.Assert(r.errors, gc.HasLen, 1)
+	c.Assert(r.errors[0], jc.Contains, "in github.com/juju/utils/testing/leaktest_test.leakyWorker")
+}
+
+func (*leaktestSuite) TestSnapshotExcludesCurrentGoroutine(c *gc.C) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go leakyWorker(stop)
+	time.Sleep(10 * time.Millisecond)
+	found := false
+	for _, g := range leaktest.Snapshot() {
+		c.Check(g.Function, gc.Not(gc.Equals), "runtime/debug.Stack")
+		if g.Function == "github.com/juju/utils/testing/leaktest_test.leakyWorker" {
+			found = true
+			c.Check(g.State, gc.Equals, "chan receive")
+		}
+	}
+	c.Assert(found, jc.IsTrue)
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package testclock provides a clock.Clock whose time only moves when
+// a test advances it.
+package testclock
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Clock is a clock.Clock that starts at a given time and advances only
+// when Advance is called. Its methods may be called concurrently.
+type Clock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// New returns a clock whose current time is now.
+func New(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now implements clock.Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After implements clock.Clock.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{deadline: c.now.Add(d), c: ch})
+	sort.Sort(byDeadline(c.waiters))
+	c.cond.Broadcast()
+	return ch
+}
+
+// Advance moves the clock forward by d, notifying any waiters whose
+// deadlines have been reached.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = remaining
+}
+
+// Waiters returns the number of outstanding calls to After.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// WaitAdvance waits until there are at least n outstanding calls to
+// After and then advances the clock by d. It returns an error if that
+// does not happen within the given real time.
+func (c *Clock) WaitAdvance(d, timeout time.Duration, n int) error {
+	done := make(chan struct{})
+	timedOut := false
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			c.mu.Lock()
+			timedOut = true
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		}
+	}()
+	defer close(done)
+	c.mu.Lock()
+	for len(c.waiters) < n && !timedOut {
+		c.cond.Wait()
+	}
+	got := len(c.waiters)
+	c.mu.Unlock()
+	if got < n {
+		return errors.Errorf("got %d waiters, want %d", got, n)
+	}
+	c.Advance(d)
+	return nil
+}
+
+type byDeadline []waiter
+
+func (w byDeadline) Len() int           { return len(w) }
+func (w byDeadline) Less(i, j int) bool { return w[i].deadline.Before(w[j].deadline) }
+func (w byDeadline) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
@@ -0,0 +1,64 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package testclock_test
+
+import (
+	"time"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/clock"
+	"github.com/juju/utils/testing/testclock"
+)
+
+type testclockSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&testclockSuite{})
+
+var _ clock.Clock = (*testclock.Clock)(nil)
+
+var epoch = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (*testclockSuite) TestAdvance(c *gc.C) {
+	clk := testclock.New(epoch)
+	c.Assert(clk.Now(), gc.Equals, epoch)
+	short := clk.After(time.Second)
+	long := clk.After(time.Minute)
+	c.Assert(clk.Waiters(), gc.Equals, 2)
+
+	clk.Advance(30 * time.Second)
+	c.Assert(<-short, gc.Equals, epoch.Add(30*time.Second))
+	select {
+	case <-long:
+		c.Fatalf("long waiter notified early")
+	default:
+	}
+	c.Assert(clk.Waiters(), gc.Equals, 1)
+
+	clk.Advance(30 * time.Second)
+	c.Assert(<-long, gc.Equals, epoch.Add(time.Minute))
+	c.Assert(clk.Waiters(), gc.Equals, 0)
+}
+
+func (*testclockSuite) TestAfterZero(c *gc.C) {
+	clk := testclock.New(epoch)
+	c.Assert(<-clk.After(0), gc.Equals, epoch)
+}
+
+func (*testclockSuite) TestWaitAdvance(c *gc.C) {
+	clk := testclock.New(epoch)
+	result := make(chan time.Time)
+	go func() {
+		result <- <-clk.After(time.Second)
+	}()
+	err := clk.WaitAdvance(time.Second, 5*time.Second, 1)
+	c.Assert(err, gc.IsNil)
+	c.Assert(<-result, gc.Equals, epoch.Add(time.Second))
+
+	err = clk.WaitAdvance(time.Second, 10*time.Millisecond, 1)
+	c.Assert(err, gc.ErrorMatches, "got 0 waiters, want 1")
+}
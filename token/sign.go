@@ -0,0 +1,136 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/juju/errors"
+)
+
+// Signer signs tokens.
+type Signer interface {
+	// Algorithm returns the JWS name of the signing algorithm.
+	Algorithm() string
+
+	// KeyID returns an identifier for the signing key, recorded in
+	// tokens so that verifiers can choose between keys when they
+	// are rotated. It may be empty.
+	KeyID() string
+
+	// Sign returns the signature of data.
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier verifies token signatures.
+type Verifier interface {
+	// Algorithm returns the JWS name of the signing algorithm.
+	Algorithm() string
+
+	// Verify returns an error with the cause ErrSignature if sig is
+	// not a valid signature of data.
+	Verify(data, sig []byte) error
+}
+
+// minHMACKeySize is the smallest HMAC key accepted: anything shorter
+// than the hash output weakens the signature.
+const minHMACKeySize = 32
+
+// HMAC signs and verifies tokens with HMAC-SHA256 ("HS256").
+type HMAC struct {
+	key   []byte
+	keyID string
+}
+
+// NewHMAC returns an HMAC signer and verifier using the given key,
+// which must be at least 32 bytes long.
+func NewHMAC(key []byte, keyID string) (*HMAC, error) {
+	if len(key) < minHMACKeySize {
+		return nil, errors.NotValidf("HMAC key shorter than %d bytes", minHMACKeySize)
+	}
+	return &HMAC{key: append([]byte(nil), key...), keyID: keyID}, nil
+}
+
+// Algorithm implements Signer and Verifier.
+func (h *HMAC) Algorithm() string {
+	return "HS256"
+}
+
+// KeyID implements Signer.
+func (h *HMAC) KeyID() string {
+	return h.keyID
+}
+
+// Sign implements Signer.
+func (h *HMAC) Sign(data []byte) ([]byte, error) {
+	m := hmac.New(sha256.New, h.key)
+	m.Write(data)
+	return m.Sum(nil), nil
+}
+
+// Verify implements Verifier.
+func (h *HMAC) Verify(data, sig []byte) error {
+	want, _ := h.Sign(data)
+	if !hmac.Equal(want, sig) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// Ed25519Signer signs tokens with Ed25519 ("EdDSA").
+type Ed25519Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewEd25519Signer returns a signer using the given private key.
+func NewEd25519Signer(key ed25519.PrivateKey, keyID string) (*Ed25519Signer, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.NotValidf("Ed25519 private key of %d bytes", len(key))
+	}
+	return &Ed25519Signer{key: key, keyID: keyID}, nil
+}
+
+// Algorithm implements Signer.
+func (s *Ed25519Signer) Algorithm() string {
+	return "EdDSA"
+}
+
+// KeyID implements Signer.
+func (s *Ed25519Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign implements Signer.
+func (s *Ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, data), nil
+}
+
+// Ed25519Verifier verifies tokens signed with Ed25519.
+type Ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+// NewEd25519Verifier returns a verifier using the given public key.
+func NewEd25519Verifier(key ed25519.PublicKey) (*Ed25519Verifier, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.NotValidf("Ed25519 public key of %d bytes", len(key))
+	}
+	return &Ed25519Verifier{key: key}, nil
+}
+
+// Algorithm implements Verifier.
+func (v *Ed25519Verifier) Algorithm() string {
+	return "EdDSA"
+}
+
+// Verify implements Verifier.
+func (v *Ed25519Verifier) Verify(data, sig []byte) error {
+	if !ed25519.Verify(v.key, data, sig) {
+		return ErrSignature
+	}
+	return nil
+}
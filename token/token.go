@@ -0,0 +1,277 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package token mints and verifies compact signed tokens for
+// service-to-service authentication.
+//
+// Tokens use the JWS compact serialization of a JSON claims set, so
+// they are valid JWTs, but only the small subset that is needed is
+// supported: HMAC-SHA256 and Ed25519 signatures, and the expiry,
+// not-before, issuer and audience claims, plus any custom claims. A
+// verifier accepts exactly one algorithm, fixed when it is created, so
+// a token cannot choose how it is verified.
+package token
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/utils/clock"
+)
+
+var (
+	// ErrSignature is the cause of errors returned for tokens whose
+	// signature does not verify.
+	ErrSignature = errors.New("invalid token signature")
+
+	// ErrExpired is the cause of errors returned for tokens that
+	// have expired.
+	ErrExpired = errors.New("token expired")
+
+	// ErrNotYetValid is the cause of errors returned for tokens
+	// used before their not-before time.
+	ErrNotYetValid = errors.New("token not valid yet")
+)
+
+// Claims holds the claims made by a token.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+
+	// Custom holds any other claims. Its values must be
+	// marshalable as JSON; after verification they hold the
+	// values decoded by encoding/json.
+	Custom map[string]interface{}
+}
+
+// registered holds the names of the registered claims, which are held
+// in the fields of Claims rather than in Custom.
+var registered = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true,
+	"nbf": true, "iat": true, "jti": true,
+}
+
+func (c *Claims) marshal() ([]byte, error) {
+	m := make(map[string]interface{})
+	for k, v := range c.Custom {
+		if registered[k] {
+			return nil, errors.Errorf("custom claim %q conflicts with registered claim", k)
+		}
+		m[k] = v
+	}
+	setString := func(k, v string) {
+		if v != "" {
+			m[k] = v
+		}
+	}
+	setTime := func(k string, t time.Time) {
+		if !t.IsZero() {
+			m[k] = t.Unix()
+		}
+	}
+	setString("iss", c.Issuer)
+	setString("sub", c.Subject)
+	setString("jti", c.ID)
+	switch len(c.Audience) {
+	case 0:
+	case 1:
+		m["aud"] = c.Audience[0]
+	default:
+		m["aud"] = c.Audience
+	}
+	setTime("exp", c.ExpiresAt)
+	setTime("nbf", c.NotBefore)
+	setTime("iat", c.IssuedAt)
+	data, err := json.Marshal(m)
+	return data, errors.Trace(err)
+}
+
+func (c *Claims) unmarshal(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.Trace(err)
+	}
+	var err error
+	str := func(k string, dst *string) {
+		if v, ok := raw[k]; ok && err == nil {
+			if e := json.Unmarshal(v, dst); e != nil {
+				err = errors.Errorf("claim %q must be a string", k)
+			}
+		}
+	}
+	tm := func(k string, dst *time.Time) {
+		if v, ok := raw[k]; ok && err == nil {
+			var secs float64
+			if e := json.Unmarshal(v, &secs); e != nil {
+				err = errors.Errorf("claim %q must be a number", k)
+				return
+			}
+			*dst = time.Unix(int64(secs), 0)
+		}
+	}
+	str("iss", &c.Issuer)
+	str("sub", &c.Subject)
+	str("jti", &c.ID)
+	tm("exp", &c.ExpiresAt)
+	tm("nbf", &c.NotBefore)
+	tm("iat", &c.IssuedAt)
+	if v, ok := raw["aud"]; ok && err == nil {
+		var one string
+		if json.Unmarshal(v, &one) == nil {
+			c.Audience = []string{one}
+		} else if json.Unmarshal(v, &c.Audience) != nil {
+			err = errors.Errorf(`claim "aud" must be a string or an array of strings`)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for k, v := range raw {
+		if registered[k] {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(v, &value); err != nil {
+			return errors.Trace(err)
+		}
+		if c.Custom == nil {
+			c.Custom = make(map[string]interface{})
+		}
+		c.Custom[k] = value
+	}
+	return nil
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// Mint returns a token holding the given claims, signed by s.
+func Mint(s Signer, claims Claims) (string, error) {
+	h, err := json.Marshal(header{Algorithm: s.Algorithm(), Type: "JWT", KeyID: s.KeyID()})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	payload, err := claims.marshal()
+	if err != nil {
+		return "", errors.Annotate(err, "cannot mint token")
+	}
+	signed := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+	sig, err := s.Sign([]byte(signed))
+	if err != nil {
+		return "", errors.Annotate(err, "cannot sign token")
+	}
+	return signed + "." + encoding.EncodeToString(sig), nil
+}
+
+// Validator verifies tokens.
+type Validator struct {
+	// Verifier verifies token signatures. Only tokens signed with
+	// its algorithm are accepted.
+	Verifier Verifier
+
+	// Issuer, if not empty, must match the token's issuer.
+	Issuer string
+
+	// Audience, if not empty, must be one of the token's
+	// audiences.
+	Audience string
+
+	// RequireExpiry causes tokens without an expiry time to be
+	// rejected.
+	RequireExpiry bool
+
+	// Leeway allows for clock skew between the minting and
+	// verifying hosts when checking expiry and not-before times.
+	Leeway time.Duration
+
+	// Clock provides the current time. If nil, clock.WallClock is
+	// used.
+	Clock clock.Clock
+}
+
+// Verify verifies the token's signature and claims and returns the
+// claims.
+func (v *Validator) Verify(token string) (*Claims, error) {
+	claims, err := v.verify(token)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot verify token")
+	}
+	return claims, nil
+}
+
+func (v *Validator) verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.NotValidf("token format")
+	}
+	hdata, err1 := encoding.DecodeString(parts[0])
+	payload, err2 := encoding.DecodeString(parts[1])
+	sig, err3 := encoding.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, errors.NotValidf("token encoding")
+	}
+	var h header
+	if err := json.Unmarshal(hdata, &h); err != nil {
+		return nil, errors.NotValidf("token header")
+	}
+	// Pin the algorithm: the verifier decides how the token is
+	// checked, never the token itself.
+	if h.Algorithm != v.Verifier.Algorithm() {
+		return nil, errors.Errorf("unexpected signing algorithm %q", h.Algorithm)
+	}
+	if err := v.Verifier.Verify([]byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, errors.Trace(err)
+	}
+	var claims Claims
+	if err := claims.unmarshal(payload); err != nil {
+		return nil, errors.Annotate(err, "invalid claims")
+	}
+	if err := v.check(&claims); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &claims, nil
+}
+
+func (v *Validator) check(claims *Claims) error {
+	clk := v.Clock
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	now := clk.Now()
+	if claims.ExpiresAt.IsZero() {
+		if v.RequireExpiry {
+			return errors.New("token has no expiry time")
+		}
+	} else if !now.Before(claims.ExpiresAt.Add(v.Leeway)) {
+		return ErrExpired
+	}
+	if !claims.NotBefore.IsZero() && now.Add(v.Leeway).Before(claims.NotBefore) {
+		return ErrNotYetValid
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return errors.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if v.Audience != "" {
+		for _, aud := range claims.Audience {
+			if aud == v.Audience {
+				return nil
+			}
+		}
+		return errors.Errorf("token not intended for audience %q", v.Audience)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package token_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/testing/testclock"
+	"github.com/juju/utils/token"
+)
+
+type tokenSuite struct {
+	testing.IsolationSuite
+	clock *testclock.Clock
+	hmac  *token.HMAC
+}
+
+var _ = gc.Suite(&tokenSuite{})
+
+func (s *tokenSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.clock = testclock.New(time.Unix(1500000000, 0))
+	var err error
+	s.hmac, err = token.NewHMAC([]byte("0123456789abcdef0123456789abcdef"), "k1")
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *tokenSuite) mint(c *gc.C, signer token.Signer, claims token.Claims) string {
+	t, err := token.Mint(signer, claims)
+	c.Assert(err, gc.IsNil)
+	return t
+}
+
+func (s *tokenSuite) TestRoundTrip(c *gc.C) {
+	now := s.clock.Now()
+	t := s.mint(c, s.hmac, token.Claims{
+		Issuer:    "controller",
+		Subject:   "machine-0",
+		Audience:  []string{"api"},
+		ExpiresAt: now.Add(time.Minute),
+		IssuedAt:  now,
+		ID:        "abc",
+		Custom:    map[string]interface{}{"role": "admin", "n": 3},
+	})
+	c.Assert(strings.Count(t, "."), gc.Equals, 2)
+	v := &token.Validator{Verifier: s.hmac, Issuer: "controller", Audience: "api", Clock: s.clock}
+	claims, err := v.Verify(t)
+	c.Assert(err, gc.IsNil)
+	c.Assert(claims, jc.DeepEquals, &token.Claims{
+		Issuer:    "controller",
+		Subject:   "machine-0",
+		Audience:  []string{"api"},
+		ExpiresAt: now.Add(time.Minute),
+		IssuedAt:  now,
+		ID:        "abc",
+		Custom:    map[string]interface{}{"role": "admin", "n": 3.0},
+	})
+}
+
+func (s *tokenSuite) TestEd25519(c *gc.C) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, gc.IsNil)
+	signer, err := token.NewEd25519Signer(priv, "")
+	c.Assert(err, gc.IsNil)
+	verifier, err := token.NewEd25519Verifier(pub)
+	c.Assert(err, gc.IsNil)
+	t := s.mint(c, signer, token.Claims{Subject: "unit-1", Audience: []string{"a", "b"}})
+
+	v := &token.Validator{Verifier: verifier, Audience: "b", Clock: s.clock}
+	claims, err := v.Verify(t)
+	c.Assert(err, gc.IsNil)
+	c.Assert(claims.Subject, gc.Equals, "unit-1")
+
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, gc.IsNil)
+	other, err := token.NewEd25519Verifier(otherPub)
+	c.Assert(err, gc.IsNil)
+	_, err = (&token.Validator{Verifier: other}).Verify(t)
+	c.Assert(errors.Cause(err), gc.Equals, token.ErrSignature)
+}
+
+func (s *tokenSuite) TestAlgorithmPinning(c *gc.C) {
+	t := s.mint(c, s.hmac, token.Claims{Subject: "x"})
+	parts := strings.Split(t, ".")
+	enc := base64.RawURLEncoding
+
+	// An unsigned token claiming "none" is rejected.
+	none := enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	_, err := (&token.Validator{Verifier: s.hmac}).Verify(none)
+	c.Assert(err, gc.ErrorMatches, `cannot verify token: unexpected signing algorithm "none"`)
+
+	// So is an HMAC token presented to an Ed25519 verifier.
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, gc.IsNil)
+	verifier, err := token.NewEd25519Verifier(pub)
+	c.Assert(err, gc.IsNil)
+	_, err = (&token.Validator{Verifier: verifier}).Verify(t)
+	c.Assert(err, gc.ErrorMatches, `cannot verify token: unexpected signing algorithm "HS256"`)
+}
+
+func (s *tokenSuite) TestTampering(c *gc.C) {
+	t := s.mint(c, s.hmac, token.Claims{Subject: "user"})
+	parts := strings.Split(t, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`))
+	_, err := (&token.Validator{Verifier: s.hmac}).Verify(strings.Join(parts, "."))
+	c.Assert(errors.Cause(err), gc.Equals, token.ErrSignature)
+
+	for _, bad := range []string{"", "a.b", "a.b.c.d", "!!.!!.!!"} {
+		_, err := (&token.Validator{Verifier: s.hmac}).Verify(bad)
+		c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	}
+}
+
+func (s *tokenSuite) TestExpiry(c *gc.C) {
+	now := s.clock.Now()
+	t := s.mint(c, s.hmac, token.Claims{ExpiresAt: now.Add(time.Minute), NotBefore: now.Add(10 * time.Second)})
+	v := &token.Validator{Verifier: s.hmac, Clock: s.clock}
+	_, err := v.Verify(t)
+	c.Assert(errors.Cause(err), gc.Equals, token.ErrNotYetValid)
+
+	v.Leeway = 10 * time.Second
+	_, err = v.Verify(t)
+	c.Assert(err, gc.IsNil)
+
+	s.clock.Advance(65 * time.Second)
+	_, err = v.Verify(t)
+	c.Assert(err, gc.IsNil)
+	s.clock.Advance(5 * time.Second)
+	_, err = v.Verify(t)
+	c.Assert(errors.Cause(err), gc.Equals, token.ErrExpired)
+	c.Assert(err, gc.ErrorMatches, "cannot verify token: token expired")
+
+	v.RequireExpiry = true
+	_, err = v.Verify(s.mint(c, s.hmac, token.Claims{}))
+	c.Assert(err, gc.ErrorMatches, "cannot verify token: token has no expiry time")
+}
+
+func (s *tokenSuite) TestClaimsChecks(c *gc.C) {
+	t := s.mint(c, s.hmac, token.Claims{Issuer: "a", Audience: []string{"x"}})
+	_, err := (&token.Validator{Verifier: s.hmac, Issuer: "b"}).Verify(t)
+	c.Assert(err, gc.ErrorMatches, `cannot verify token: unexpected issuer "a"`)
+	_, err = (&token.Validator{Verifier: s.hmac, Audience: "y"}).Verify(t)
+	c.Assert(err, gc.ErrorMatches, `cannot verify token: token not intended for audience "y"`)
+
+	_, err = token.Mint(s.hmac, token.Claims{Custom: map[string]interface{}{"exp": 1}})
+	c.Assert(err, gc.ErrorMatches, `cannot mint token: custom claim "exp" conflicts with registered claim`)
+}
+
+func (s *tokenSuite) TestKeyValidation(c *gc.C) {
+	_, err := token.NewHMAC([]byte("short"), "")
+	c.Assert(err, gc.ErrorMatches, "HMAC key shorter than 32 bytes not valid")
+	_, err = token.NewEd25519Signer(nil, "")
+	c.Assert(err, gc.ErrorMatches, "Ed25519 private key of 0 bytes not valid")
+}
@@ -15,6 +15,8 @@ import (
 	"unicode"
 
 	goyaml "gopkg.in/yaml.v1"
+
+	"github.com/juju/utils/compress"
 )
 
 // WriteYaml marshals obj as yaml and then writes it to a file, atomically,
@@ -89,10 +91,16 @@ func CommandString(args ...string) string {
 	return buf.String()
 }
 
-// Gzip compresses the given data.
+// Gzip compresses the given data. The gzip header records no file
+// name, modification time or operating system, so the same data always
+// compresses to the same bytes.
 func Gzip(data []byte) []byte {
 	var buf bytes.Buffer
-	w := gzip.NewWriter(&buf)
+	w, err := compress.NewWriter(&buf, compress.Gzip, compress.DefaultCompression)
+	if err != nil {
+		// The format and level are known to be valid.
+		panic(err)
+	}
 	if _, err := w.Write(data); err != nil {
 		// Compression should never fail unless it fails
 		// to write to the underlying writer, which is a bytes.Buffer
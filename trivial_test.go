@@ -5,6 +5,7 @@ package utils_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -46,6 +47,16 @@ func (*utilsSuite) TestCompression(c *gc.C) {
 	c.Assert(data1, gc.DeepEquals, data)
 }
 
+func (*utilsSuite) TestGzipStableHeader(c *gc.C) {
+	cdata := utils.Gzip([]byte("hello"))
+	c.Assert(utils.Gzip([]byte("hello")), gc.DeepEquals, cdata)
+	r, err := gzip.NewReader(bytes.NewReader(cdata))
+	c.Assert(err, gc.IsNil)
+	c.Assert(r.Header.Name, gc.Equals, "")
+	c.Assert(r.Header.ModTime.IsZero(), gc.Equals, true)
+	c.Assert(r.Header.OS, gc.Equals, byte(255))
+}
+
 func (*utilsSuite) TestCommandString(c *gc.C) {
 	type test struct {
 		args     []string
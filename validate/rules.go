@@ -0,0 +1,126 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Rule checks a single field value, returning an error describing why
+// it is not valid. The rules provided by this package, other than
+// Required, accept zero values, so that optional fields can be
+// constrained only when they are set.
+type Rule func(value interface{}) error
+
+// Required returns a rule that rejects zero values.
+func Required() Rule {
+	return func(value interface{}) error {
+		if isZero(value) {
+			return fmt.Errorf("value required")
+		}
+		return nil
+	}
+}
+
+// Range returns a rule that requires a numeric value to lie between min
+// and max inclusive.
+func Range(min, max float64) Rule {
+	return func(value interface{}) error {
+		if isZero(value) {
+			return nil
+		}
+		f, ok := toFloat(value)
+		if !ok {
+			return fmt.Errorf("cannot check range of %T", value)
+		}
+		if f < min || f > max {
+			return fmt.Errorf("value %v out of range [%v, %v]", value, min, max)
+		}
+		return nil
+	}
+}
+
+// Matches returns a rule that requires a string value to match the
+// given regular expression. It panics if the expression cannot be
+// compiled.
+func Matches(pattern string) Rule {
+	re := regexp.MustCompile(pattern)
+	return func(value interface{}) error {
+		if isZero(value) {
+			return nil
+		}
+		s, ok := value.(string)
+		if !ok {
+			v := reflect.ValueOf(value)
+			if v.Kind() != reflect.String {
+				return fmt.Errorf("cannot match %T", value)
+			}
+			s = v.String()
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("value %q does not match %q", s, pattern)
+		}
+		return nil
+	}
+}
+
+// OneOf returns a rule that requires the value to equal one of the
+// given values.
+func OneOf(values ...interface{}) Rule {
+	return func(value interface{}) error {
+		if isZero(value) {
+			return nil
+		}
+		for _, allowed := range values {
+			if reflect.DeepEqual(value, allowed) {
+				return nil
+			}
+		}
+		allowed := make([]string, len(values))
+		for i, v := range values {
+			allowed[i] = formatValue(v)
+		}
+		return fmt.Errorf("value %s not one of %s", formatValue(value), strings.Join(allowed, ", "))
+	}
+}
+
+// Func returns a rule that calls f on non-zero values.
+func Func(f func(value interface{}) error) Rule {
+	return func(value interface{}) error {
+		if isZero(value) {
+			return nil
+		}
+		return f(value)
+	}
+}
+
+func isZero(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	return reflect.ValueOf(value).IsZero()
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func formatValue(v interface{}) string {
+	if reflect.ValueOf(v).Kind() == reflect.String {
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,242 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package validate checks struct values against rules registered for
+// their types, reporting every violation found rather than just the
+// first.
+//
+// Rules are registered once per type, usually from an init function:
+//
+//	func init() {
+//		validate.Register(Options{}, validate.Rules{
+//			"Name":    {validate.Required()},
+//			"Retries": {validate.Range(0, 10)},
+//			"Mode":    {validate.OneOf("fast", "safe")},
+//		})
+//	}
+//
+// and values are checked with validate.Struct, or with validate.Fields
+// to check only the fields of the value itself.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Rules maps the names of the exported fields of a struct type to the
+// rules that apply to them.
+type Rules map[string][]Rule
+
+// Violation describes a single failed rule.
+type Violation struct {
+	// Field holds the path of the field that failed validation, for
+	// example "Options.Servers[1].Port". It is empty if the violation
+	// applies to the value as a whole.
+	Field string
+
+	// Message describes the violation.
+	Message string
+}
+
+// String returns the field path and message.
+func (v Violation) String() string {
+	if v.Field == "" {
+		return v.Message
+	}
+	return v.Field + ": " + v.Message
+}
+
+// Errors holds all the violations found by Struct.
+type Errors []Violation
+
+// Error implements error.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.String()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validator may be implemented by types that need checks spanning
+// several fields. Struct calls Validate on every value it visits that
+// implements it, after applying any registered rules.
+type Validator interface {
+	Validate() error
+}
+
+var (
+	mu    sync.RWMutex
+	rules = make(map[reflect.Type]map[int][]Rule)
+)
+
+// Register records the rules for the struct type of prototype, which
+// may be a struct value or a pointer to one. Any rules previously
+// registered for the type are replaced. An error is returned if a rule
+// names a field that does not exist or is not exported.
+func Register(prototype interface{}, r Rules) error {
+	t := reflect.TypeOf(prototype)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot register rules for %T: not a struct", prototype)
+	}
+	byIndex := make(map[int][]Rule)
+	for name, fieldRules := range r {
+		f, ok := t.FieldByName(name)
+		if !ok || len(f.Index) != 1 {
+			return fmt.Errorf("cannot register rules for %s: field %q not found", t, name)
+		}
+		if f.PkgPath != "" {
+			return fmt.Errorf("cannot register rules for %s: field %q not exported", t, name)
+		}
+		byIndex[f.Index[0]] = fieldRules
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	rules[t] = byIndex
+	return nil
+}
+
+// Unregister removes any rules registered for the struct type of
+// prototype.
+func Unregister(prototype interface{}) {
+	t := reflect.TypeOf(prototype)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	delete(rules, t)
+}
+
+func rulesFor(t reflect.Type) map[int][]Rule {
+	mu.RLock()
+	defer mu.RUnlock()
+	return rules[t]
+}
+
+// Struct checks v, which should be a struct or a pointer to one,
+// against the registered rules. Exported struct fields, pointers,
+// slices, arrays and maps are traversed so that nested values are
+// checked too. If any rule fails, the returned error is of type Errors
+// and holds every violation found.
+func Struct(v interface{}) error {
+	c := &checker{seen: make(map[uintptr]bool)}
+	c.check(reflect.ValueOf(v), "")
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return c.errs
+}
+
+// Fields checks the fields of v, which should be a struct or a pointer
+// to one, against the rules registered for its type. Unlike Struct, it
+// does not traverse the field values or call Validate, so values that
+// v merely refers to are never inspected. If any rule fails, the
+// returned error is of type Errors and holds every violation found.
+func Fields(v interface{}) error {
+	c := &checker{seen: make(map[uintptr]bool), shallow: true}
+	c.check(reflect.ValueOf(v), "")
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return c.errs
+}
+
+type checker struct {
+	errs Errors
+	seen map[uintptr]bool
+
+	// shallow holds whether only the fields of the top level struct
+	// are checked.
+	shallow bool
+}
+
+func (c *checker) add(path, msg string) {
+	c.errs = append(c.errs, Violation{Field: path, Message: msg})
+}
+
+func (c *checker) check(v reflect.Value, path string) {
+	if !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || c.seen[v.Pointer()] {
+			return
+		}
+		c.seen[v.Pointer()] = true
+		c.check(v.Elem(), path)
+		if !c.shallow {
+			c.validator(v, path)
+		}
+		return
+	case reflect.Interface:
+		c.check(v.Elem(), path)
+		return
+	case reflect.Slice, reflect.Array:
+		if c.shallow {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			c.check(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+		return
+	case reflect.Map:
+		if c.shallow {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			c.check(v.MapIndex(k), fmt.Sprintf("%s[%v]", path, k.Interface()))
+		}
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+	t := v.Type()
+	fieldRules := rulesFor(t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fieldPath := f.Name
+		if path != "" {
+			fieldPath = path + "." + f.Name
+		}
+		fv := v.Field(i)
+		for _, rule := range fieldRules[i] {
+			if err := rule(fv.Interface()); err != nil {
+				c.add(fieldPath, err.Error())
+			}
+		}
+		if !c.shallow {
+			c.check(fv, fieldPath)
+		}
+	}
+	if !c.shallow {
+		c.validator(v, path)
+	}
+}
+
+// validator calls Validate on v if it implements Validator. Pointers
+// are checked for pointer receivers; structs only for value receivers,
+// so that each value is validated once.
+func (c *checker) validator(v reflect.Value, path string) {
+	if v.Kind() == reflect.Ptr {
+		if _, ok := v.Elem().Interface().(Validator); ok {
+			return
+		}
+	}
+	if val, ok := v.Interface().(Validator); ok {
+		if err := val.Validate(); err != nil {
+			c.add(path, err.Error())
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package validate_test
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/validate"
+)
+
+type validateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&validateSuite{})
+
+type server struct {
+	Host string
+	Port int
+}
+
+type options struct {
+	Name    string
+	Mode    string
+	Retries int
+	Timeout time.Duration
+	Servers []server
+	Extra   map[string]*server
+	hidden  string
+}
+
+type ranged struct {
+	Low, High int
+}
+
+func (r ranged) Validate() error {
+	if r.Low > r.High {
+		return fmt.Errorf("low %d greater than high %d", r.Low, r.High)
+	}
+	return nil
+}
+
+func (s *validateSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	err := validate.Register(options{}, validate.Rules{
+		"Name":    {validate.Required(), validate.Matches(`^[a-z]+$`)},
+		"Mode":    {validate.OneOf("fast", "safe")},
+		"Retries": {validate.Range(0, 5)},
+		"Timeout": {validate.Range(float64(time.Second), float64(time.Minute))},
+	})
+	c.Assert(err, gc.IsNil)
+	err = validate.Register(&server{}, validate.Rules{
+		"Host": {validate.Required()},
+		"Port": {validate.Required(), validate.Range(1, 65535)},
+	})
+	c.Assert(err, gc.IsNil)
+	s.AddCleanup(func(*gc.C) {
+		validate.Unregister(options{})
+		validate.Unregister(server{})
+	})
+}
+
+func (*validateSuite) TestValid(c *gc.C) {
+	err := validate.Struct(&options{
+		Name:    "test",
+		Mode:    "fast",
+		Timeout: 10 * time.Second,
+		Servers: []server{{"localhost", 80}},
+	})
+	c.Assert(err, gc.IsNil)
+
+	// Optional fields are only constrained when set.
+	err = validate.Struct(options{Name: "test"})
+	c.Assert(err, gc.IsNil)
+}
+
+func (*validateSuite) TestAllViolations(c *gc.C) {
+	err := validate.Struct(&options{
+		Name:    "Not Valid",
+		Mode:    "slow",
+		Retries: 6,
+		Timeout: time.Millisecond,
+		Servers: []server{{"localhost", 80}, {"", 70000}},
+		Extra:   map[string]*server{"backup": {Host: "backup"}},
+	})
+	c.Assert(err, gc.FitsTypeOf, validate.Errors{})
+	c.Assert(err.(validate.Errors), jc.DeepEquals, validate.Errors{
+		{"Name", `value "Not Valid" does not match "^[a-z]+$"`},
+		{"Mode", `value "slow" not one of "fast", "safe"`},
+		{"Retries", "value 6 out of range [0, 5]"},
+		{"Timeout", "value 1ms out of range [1e+09, 6e+10]"},
+		{"Servers[1].Host", "value required"},
+		{"Servers[1].Port", "value 70000 out of range [1, 65535]"},
+		{"Extra[backup].Port", "value required"},
+	})
+	c.Assert(err, gc.ErrorMatches, `Name: value "Not Valid" does not match .*; Mode: .*; Extra\[backup\].Port: value required`)
+}
+
+func (*validateSuite) TestFields(c *gc.C) {
+	type limits struct {
+		Options options
+		Memory  *ranged
+	}
+	err := validate.Fields(&options{
+		Name:    "Not Valid",
+		Mode:    "fast",
+		Servers: []server{{"", 70000}},
+	})
+	c.Assert(err, gc.FitsTypeOf, validate.Errors{})
+	c.Assert(err.(validate.Errors), jc.DeepEquals, validate.Errors{
+		{"Name", `value "Not Valid" does not match "^[a-z]+$"`},
+	})
+
+	// Neither nested values nor Validate methods are checked.
+	err = validate.Fields(limits{
+		Options: options{Mode: "slow"},
+		Memory:  &ranged{Low: 5, High: 3},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(validate.Fields(ranged{Low: 2, High: 1}), gc.IsNil)
+}
+
+func (*validateSuite) TestFunc(c *gc.C) {
+	type named struct {
+		Name string
+	}
+	err := validate.Register(named{}, validate.Rules{
+		"Name": {validate.Func(func(v interface{}) error {
+			if strings.HasPrefix(v.(string), "-") {
+				return fmt.Errorf("value must not start with a dash")
+			}
+			return nil
+		})},
+	})
+	c.Assert(err, gc.IsNil)
+	defer validate.Unregister(named{})
+
+	c.Assert(validate.Struct(named{"ok"}), gc.IsNil)
+	c.Assert(validate.Struct(named{"-x"}), gc.ErrorMatches, "Name: value must not start with a dash")
+}
+
+func (*validateSuite) TestValidator(c *gc.C) {
+	type limits struct {
+		CPU    ranged
+		Memory *ranged
+	}
+	err := validate.Struct(limits{
+		CPU:    ranged{Low: 2, High: 1},
+		Memory: &ranged{Low: 5, High: 3},
+	})
+	c.Assert(err, gc.ErrorMatches, "CPU: low 2 greater than high 1; Memory: low 5 greater than high 3")
+
+	err = validate.Struct(ranged{Low: 2, High: 1})
+	c.Assert(err, gc.ErrorMatches, "low 2 greater than high 1")
+}
+
+func (*validateSuite) TestCycle(c *gc.C) {
+	type node struct {
+		Next *node
+	}
+	n := &node{}
+	n.Next = n
+	c.Assert(validate.Struct(n), gc.IsNil)
+}
+
+func (*validateSuite) TestRegisterErrors(c *gc.C) {
+	err := validate.Register(3, nil)
+	c.Assert(err, gc.ErrorMatches, "cannot register rules for int: not a struct")
+	err = validate.Register(options{}, validate.Rules{"Missing": {validate.Required()}})
+	c.Assert(err, gc.ErrorMatches, `cannot register rules for validate_test.options: field "Missing" not found`)
+	err = validate.Register(options{}, validate.Rules{"hidden": {validate.Required()}})
+	c.Assert(err, gc.ErrorMatches, `cannot register rules for validate_test.options: field "hidden" not exported`)
+}
+
+func (*validateSuite) TestRuleTypeErrors(c *gc.C) {
+	c.Assert(validate.Range(0, 1)("x"), gc.ErrorMatches, "cannot check range of string")
+	c.Assert(validate.Matches(".")(3), gc.ErrorMatches, "cannot match int")
+}
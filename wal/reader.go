@@ -0,0 +1,95 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package wal
+
+import (
+	"io"
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// Reader iterates over the records of a log. A reader sees records
+// appended after it was created. It is not safe for concurrent use.
+type Reader struct {
+	log  *Log
+	pos  Position
+	file *os.File
+}
+
+// NewReader returns a reader that starts at the given position, which
+// should be the position of a record or the end of the log.
+func (l *Log) NewReader(from Position) *Reader {
+	return &Reader{log: l, pos: from}
+}
+
+// Position returns the position of the next record to be read.
+func (r *Reader) Position() Position {
+	return r.pos
+}
+
+// Next returns the next record and its position. It returns io.EOF
+// when there are no more records; it may be called again later to read
+// records appended in the meantime.
+func (r *Reader) Next() (Position, []byte, error) {
+	for {
+		if start := r.log.Start(); r.pos.Before(start) {
+			// The segment has been truncated away.
+			r.closeFile()
+			r.pos = start
+		}
+		end := r.log.End()
+		if !r.pos.Before(end) {
+			return Position{}, nil, io.EOF
+		}
+		if r.file == nil {
+			f, err := os.Open(r.log.path(r.pos.Segment))
+			if err != nil {
+				return Position{}, nil, errors.Annotate(err, "cannot read log")
+			}
+			r.file = f
+		}
+		// Only the segment being appended to may hold a record
+		// that is still being written; earlier ones are complete.
+		size := end.Offset
+		if r.pos.Segment != end.Segment {
+			fi, err := r.file.Stat()
+			if err != nil {
+				return Position{}, nil, errors.Annotate(err, "cannot read log")
+			}
+			size = fi.Size()
+		}
+		data, err := readRecordAt(r.file, r.pos.Offset, size)
+		if err == nil {
+			pos := r.pos
+			r.pos.Offset += headerSize + int64(len(data))
+			return pos, data, nil
+		}
+		if err != io.EOF && errors.Cause(err) != ErrCorrupt && err != io.ErrUnexpectedEOF {
+			return Position{}, nil, errors.Annotate(err, "cannot read log")
+		}
+		if err != io.EOF {
+			logger.Warningf("skipping rest of segment %d after offset %d: %v", r.pos.Segment, r.pos.Offset, err)
+		}
+		next, ok := r.log.nextSegment(r.pos.Segment)
+		if !ok {
+			return Position{}, nil, io.EOF
+		}
+		r.closeFile()
+		r.pos = Position{Segment: next}
+	}
+}
+
+// Close releases the resources held by the reader.
+func (r *Reader) Close() error {
+	r.closeFile()
+	return nil
+}
+
+func (r *Reader) closeFile() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package wal
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// syncDirectory flushes the entries of dir to stable storage, so that
+// segments created or removed in it stay so after a crash.
+func syncDirectory(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	return errors.Trace(f.Sync())
+}
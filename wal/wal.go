@@ -0,0 +1,496 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package wal implements a write-ahead log: an append-only sequence of
+// records stored in a directory of segment files.
+//
+// Each record is framed with its length and a CRC-32C checksum. When a
+// log is opened, a record torn by a crash at the end of the last
+// segment is detected and discarded, so Append followed by a
+// successful sync guarantees the record will be replayed and that no
+// partial record ever is. A damaged record followed by others cannot
+// have been torn, so the log is not opened rather than losing them. Once the state derived from a prefix of the
+// log has been checkpointed elsewhere, TruncateBefore removes the
+// segments holding it.
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("juju.utils.wal")
+
+// syncFile and syncDir flush a segment file and the entries of the log
+// directory to stable storage. They are variables so that tests can
+// make them fail.
+var (
+	syncFile = (*os.File).Sync
+	syncDir  = syncDirectory
+)
+
+// SyncPolicy specifies when appended records are flushed to stable
+// storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways flushes after every append.
+	SyncAlways SyncPolicy = iota
+
+	// SyncBatch flushes after every Options.SyncEvery appends.
+	SyncBatch
+
+	// SyncNever leaves flushing to the operating system and to
+	// explicit calls to Log.Sync.
+	SyncNever
+)
+
+const (
+	defaultSegmentSize = 16 * 1024 * 1024
+	defaultSyncEvery   = 100
+	segmentSuffix      = ".wal"
+	headerSize         = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is the cause of errors returned when a record does not
+// match its checksum.
+var ErrCorrupt = errors.New("corrupt record")
+
+// Options holds the options for a log.
+type Options struct {
+	// SegmentSize holds the size in bytes beyond which a new segment
+	// is started. If zero, 16MiB is used.
+	SegmentSize int64
+
+	// Sync holds the sync policy.
+	Sync SyncPolicy
+
+	// SyncEvery holds the number of appends between flushes when Sync
+	// is SyncBatch. If zero, 100 is used.
+	SyncEvery int
+}
+
+// Position identifies a record in the log by its segment and the
+// offset of the record within the segment.
+type Position struct {
+	Segment uint64
+	Offset  int64
+}
+
+// String returns the position in the form "segment:offset".
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Segment, p.Offset)
+}
+
+// Before reports whether p comes before q in the log.
+func (p Position) Before(q Position) bool {
+	return p.Segment < q.Segment || (p.Segment == q.Segment && p.Offset < q.Offset)
+}
+
+// SegmentInfo describes a segment file.
+type SegmentInfo struct {
+	Segment uint64
+	Size    int64
+	ModTime time.Time
+}
+
+// Log is a write-ahead log. Its methods may be called concurrently,
+// but a log directory must only be opened once at a time.
+type Log struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	closed   bool
+	segments []uint64
+	w        *os.File
+	wsize    int64
+	unsynced int
+}
+
+// Open opens the log in dir, creating it if necessary.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.SyncEvery <= 0 {
+		opts.SyncEvery = defaultSyncEvery
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Annotate(err, "cannot create log")
+	}
+	l := &Log{dir: dir, opts: opts}
+	if err := l.recover(); err != nil {
+		if l.w != nil {
+			l.w.Close()
+		}
+		return nil, errors.Annotatef(err, "cannot open log %q", dir)
+	}
+	return l, nil
+}
+
+// recover opens the last segment for appending, discarding any torn
+// record at its end.
+func (l *Log) recover() error {
+	segments, err := listSegments(l.dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	created := len(segments) == 0
+	if created {
+		segments = []uint64{1}
+	}
+	l.segments = segments
+	last := segments[len(segments)-1]
+	l.w, err = os.OpenFile(l.path(last), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if created {
+		if err := syncDir(l.dir); err != nil {
+			return errors.Annotate(err, "cannot sync log directory")
+		}
+	}
+	info, err := l.w.Stat()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	end, err := validEnd(l.w, info.Size())
+	if err != nil {
+		return errors.Annotatef(err, "segment %d", last)
+	}
+	if end != info.Size() {
+		logger.Warningf("discarding incomplete record at end of segment %d of %q", last, l.dir)
+		if err := l.w.Truncate(end); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if _, err := l.w.Seek(end, 0); err != nil {
+		return errors.Trace(err)
+	}
+	l.wsize = end
+	return nil
+}
+
+// validEnd returns the offset following the last valid record in f,
+// which holds size bytes. Only the final record may be incomplete or
+// fail its checksum, as only the last write can have been torn by a
+// crash; an error with the cause ErrCorrupt is returned for a damaged
+// record that is followed by further data.
+func validEnd(f *os.File, size int64) (int64, error) {
+	var offset int64
+	for {
+		data, err := readRecordAt(f, offset, size)
+		switch {
+		case err == nil:
+			offset += headerSize + int64(len(data))
+			continue
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			return offset, nil
+		case err != ErrCorrupt:
+			return 0, errors.Trace(err)
+		}
+		var header [headerSize]byte
+		if _, err := f.ReadAt(header[:], offset); err != nil {
+			return 0, errors.Trace(err)
+		}
+		if offset+headerSize+int64(binary.LittleEndian.Uint32(header[0:])) == size {
+			return offset, nil
+		}
+		return 0, errors.Annotatef(ErrCorrupt, "record at offset %d", offset)
+	}
+}
+
+// Append appends a record to the log and returns its position. If the
+// sync policy requires the record to be synced and the sync fails, the
+// record is removed again and an error returned. As the state of the
+// file on disk is unknown after a failed sync, a record that Append
+// failed to add may nonetheless be replayed after a crash.
+func (l *Log) Append(data []byte) (Position, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return Position{}, errors.New("log closed")
+	}
+	rec := frame(data)
+	if l.wsize > 0 && l.wsize+int64(len(rec)) > l.opts.SegmentSize {
+		if err := l.rotate(); err != nil {
+			return Position{}, errors.Annotate(err, "cannot start new segment")
+		}
+	}
+	pos := Position{Segment: l.segments[len(l.segments)-1], Offset: l.wsize}
+	n, err := l.w.Write(rec)
+	if err != nil {
+		// Remove any partial record so that it does not hide
+		// later ones.
+		l.truncate(pos.Offset)
+		return Position{}, errors.Annotate(err, "cannot append record")
+	}
+	l.wsize += int64(n)
+	l.unsynced++
+	if l.opts.Sync == SyncAlways || (l.opts.Sync == SyncBatch && l.unsynced >= l.opts.SyncEvery) {
+		if err := l.sync(); err != nil {
+			// The record has not been acknowledged, so it must
+			// not be replayed.
+			l.truncate(pos.Offset)
+			return Position{}, errors.Trace(err)
+		}
+	}
+	return pos, nil
+}
+
+// truncate discards the end of the current segment from offset.
+func (l *Log) truncate(offset int64) {
+	l.w.Truncate(offset)
+	l.w.Seek(offset, 0)
+	l.wsize = offset
+}
+
+// Rotate starts a new segment, so that earlier records can be removed
+// with TruncateBefore once they are no longer needed. It does nothing
+// if the current segment is empty.
+func (l *Log) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errors.New("log closed")
+	}
+	if l.wsize == 0 {
+		return nil
+	}
+	return errors.Trace(l.rotate())
+}
+
+func (l *Log) rotate() error {
+	if err := l.sync(); err != nil {
+		return errors.Trace(err)
+	}
+	seq := l.segments[len(l.segments)-1] + 1
+	w, err := os.OpenFile(l.path(seq), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// Records acknowledged in the new segment would be lost along
+	// with it if its directory entry were not synced.
+	if err := syncDir(l.dir); err != nil {
+		w.Close()
+		os.Remove(l.path(seq))
+		return errors.Annotate(err, "cannot sync log directory")
+	}
+	l.w.Close()
+	l.w = w
+	l.wsize = 0
+	l.segments = append(l.segments, seq)
+	return nil
+}
+
+// Sync flushes appended records to stable storage.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errors.New("log closed")
+	}
+	return l.sync()
+}
+
+func (l *Log) sync() error {
+	if l.unsynced == 0 {
+		return nil
+	}
+	if err := syncFile(l.w); err != nil {
+		return errors.Annotate(err, "cannot sync log")
+	}
+	l.unsynced = 0
+	return nil
+}
+
+// Start returns the position of the first record in the log.
+func (l *Log) Start() Position {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Position{Segment: l.segments[0]}
+}
+
+// End returns the position that the next record will be appended at,
+// unless a new segment is started first.
+func (l *Log) End() Position {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.end()
+}
+
+func (l *Log) end() Position {
+	return Position{Segment: l.segments[len(l.segments)-1], Offset: l.wsize}
+}
+
+// Segments returns information on the segments of the log, oldest
+// first.
+func (l *Log) Segments() ([]SegmentInfo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	infos := make([]SegmentInfo, 0, len(l.segments))
+	for _, seq := range l.segments {
+		fi, err := os.Stat(l.path(seq))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		infos = append(infos, SegmentInfo{Segment: seq, Size: fi.Size(), ModTime: fi.ModTime()})
+	}
+	return infos, nil
+}
+
+// TruncateBefore removes the segments that come entirely before pos.
+// The segment being appended to is never removed.
+func (l *Log) TruncateBefore(pos Position) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return errors.New("log closed")
+	}
+	removed := false
+	for len(l.segments) > 1 && l.segments[0] < pos.Segment {
+		if err := os.Remove(l.path(l.segments[0])); err != nil && !os.IsNotExist(err) {
+			return errors.Annotate(err, "cannot remove segment")
+		}
+		l.segments = l.segments[1:]
+		removed = true
+	}
+	if removed {
+		if err := syncDir(l.dir); err != nil {
+			return errors.Annotate(err, "cannot sync log directory")
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the log. Readers obtained from the log
+// must not be used afterwards.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	err := l.sync()
+	l.w.Close()
+	return errors.Trace(err)
+}
+
+// Replay calls f with each record from the given position onwards,
+// stopping if f returns an error.
+func (l *Log) Replay(from Position, f func(pos Position, data []byte) error) error {
+	r := l.NewReader(from)
+	defer r.Close()
+	for {
+		pos, data, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := f(pos, data); err != nil {
+			return err
+		}
+	}
+}
+
+// nextSegment returns the first segment after seq.
+func (l *Log) nextSegment(seq uint64) (uint64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.segments {
+		if s > seq {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func (l *Log) path(seq uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%016x%s", seq, segmentSuffix))
+}
+
+// listSegments returns the sequence numbers of the segments in dir in
+// increasing order.
+func listSegments(dir string) ([]uint64, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var seqs []uint64
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 16, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Sort(uint64s(seqs))
+	return seqs, nil
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// frame returns data framed as a record: a four byte length, a four
+// byte CRC-32C of the data, then the data.
+func frame(data []byte) []byte {
+	rec := make([]byte, headerSize+len(data))
+	binary.LittleEndian.PutUint32(rec[0:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(rec[4:], crc32.Checksum(data, crcTable))
+	copy(rec[headerSize:], data)
+	return rec
+}
+
+// readRecordAt reads the record at offset in r, which holds size bytes.
+// It returns io.EOF if there is no record at offset, and
+// io.ErrUnexpectedEOF if the record is incomplete.
+func readRecordAt(r io.ReaderAt, offset, size int64) ([]byte, error) {
+	if offset >= size {
+		return nil, io.EOF
+	}
+	var header [headerSize]byte
+	if offset+headerSize > size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return nil, errors.Trace(err)
+	}
+	n := int64(binary.LittleEndian.Uint32(header[0:]))
+	if offset+headerSize+n > size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, n)
+	if _, err := r.ReadAt(data, offset+headerSize); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if crc32.Checksum(data, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
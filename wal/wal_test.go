@@ -0,0 +1,277 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package wal_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/wal"
+)
+
+type walSuite struct {
+	testing.IsolationSuite
+	dir string
+}
+
+var _ = gc.Suite(&walSuite{})
+
+func (s *walSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir = c.MkDir()
+}
+
+func (s *walSuite) open(c *gc.C, opts wal.Options) *wal.Log {
+	l, err := wal.Open(s.dir, opts)
+	c.Assert(err, gc.IsNil)
+	return l
+}
+
+func replay(c *gc.C, l *wal.Log, from wal.Position) []string {
+	var records []string
+	err := l.Replay(from, func(pos wal.Position, data []byte) error {
+		records = append(records, string(data))
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	return records
+}
+
+func (s *walSuite) TestAppendReplay(c *gc.C) {
+	l := s.open(c, wal.Options{})
+	var positions []wal.Position
+	for i := 0; i < 3; i++ {
+		pos, err := l.Append([]byte(fmt.Sprint("record ", i)))
+		c.Assert(err, gc.IsNil)
+		positions = append(positions, pos)
+	}
+	c.Assert(positions[0], gc.Equals, wal.Position{Segment: 1, Offset: 0})
+	c.Assert(positions[0].Before(positions[1]), jc.IsTrue)
+	c.Assert(replay(c, l, l.Start()), jc.DeepEquals, []string{"record 0", "record 1", "record 2"})
+	c.Assert(replay(c, l, positions[2]), jc.DeepEquals, []string{"record 2"})
+	c.Assert(l.Close(), gc.IsNil)
+
+	l = s.open(c, wal.Options{})
+	defer l.Close()
+	c.Assert(replay(c, l, l.Start()), gc.HasLen, 3)
+	_, err := l.Append([]byte("record 3"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(replay(c, l, positions[2]), jc.DeepEquals, []string{"record 2", "record 3"})
+}
+
+func (s *walSuite) TestTornRecord(c *gc.C) {
+	l := s.open(c, wal.Options{})
+	_, err := l.Append([]byte("complete"))
+	c.Assert(err, gc.IsNil)
+	end := l.End()
+	c.Assert(l.Close(), gc.IsNil)
+
+	segs, err := filepath.Glob(filepath.Join(s.dir, "*.wal"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(segs, gc.HasLen, 1)
+	f, err := os.OpenFile(segs[0], os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, gc.IsNil)
+	f.Write([]byte{100, 0, 0, 0, 1, 2, 3, 4, 5})
+	f.Close()
+
+	l = s.open(c, wal.Options{})
+	defer l.Close()
+	c.Assert(l.End(), gc.Equals, end)
+	_, err = l.Append([]byte("after"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(replay(c, l, l.Start()), jc.DeepEquals, []string{"complete", "after"})
+}
+
+func (s *walSuite) TestTornFinalChecksum(c *gc.C) {
+	l := s.open(c, wal.Options{})
+	_, err := l.Append([]byte("complete"))
+	c.Assert(err, gc.IsNil)
+	end := l.End()
+	_, err = l.Append([]byte("torn"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.Close(), gc.IsNil)
+	s.flipByte(c, 0)
+
+	l = s.open(c, wal.Options{})
+	defer l.Close()
+	c.Assert(l.End(), gc.Equals, end)
+	c.Assert(replay(c, l, l.Start()), jc.DeepEquals, []string{"complete"})
+}
+
+func (s *walSuite) TestCorruptRecordNotDiscarded(c *gc.C) {
+	l := s.open(c, wal.Options{})
+	_, err := l.Append([]byte("damaged"))
+	c.Assert(err, gc.IsNil)
+	_, err = l.Append([]byte("intact"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.Close(), gc.IsNil)
+	path := s.flipByte(c, 8+len("intact"))
+	info, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+
+	_, err = wal.Open(s.dir, wal.Options{})
+	c.Assert(err, gc.ErrorMatches, `cannot open log .*: segment 1: record at offset 0: corrupt record`)
+	after, err := os.Stat(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(after.Size(), gc.Equals, info.Size())
+}
+
+// flipByte inverts the byte fromEnd bytes before the last byte of the only
+// segment in the log, and returns the path of the segment.
+func (s *walSuite) flipByte(c *gc.C, fromEnd int) string {
+	segs, err := filepath.Glob(filepath.Join(s.dir, "*.wal"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(segs, gc.HasLen, 1)
+	f, err := os.OpenFile(segs[0], os.O_RDWR, 0)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	info, err := f.Stat()
+	c.Assert(err, gc.IsNil)
+	b := make([]byte, 1)
+	offset := info.Size() - int64(fromEnd) - 1
+	_, err = f.ReadAt(b, offset)
+	c.Assert(err, gc.IsNil)
+	b[0] ^= 0xff
+	_, err = f.WriteAt(b, offset)
+	c.Assert(err, gc.IsNil)
+	return segs[0]
+}
+
+func (s *walSuite) TestSegmentsAndTruncate(c *gc.C) {
+	l := s.open(c, wal.Options{SegmentSize: 40, Sync: wal.SyncNever})
+	defer l.Close()
+	var positions []wal.Position
+	for i := 0; i < 10; i++ {
+		pos, err := l.Append([]byte(fmt.Sprint("record ", i)))
+		c.Assert(err, gc.IsNil)
+		positions = append(positions, pos)
+	}
+	segs, err := l.Segments()
+	c.Assert(err, gc.IsNil)
+	c.Assert(len(segs) > 2, jc.IsTrue)
+	c.Assert(replay(c, l, l.Start()), gc.HasLen, 10)
+
+	// Checkpoint at record 5.
+	c.Assert(l.TruncateBefore(positions[5]), gc.IsNil)
+	c.Assert(l.Start(), gc.Equals, wal.Position{Segment: positions[5].Segment})
+	records := replay(c, l, l.Start())
+	c.Assert(records[len(records)-1], gc.Equals, "record 9")
+	c.Assert(len(records) < 10, jc.IsTrue)
+
+	// The active segment is never removed.
+	c.Assert(l.TruncateBefore(wal.Position{Segment: 1000}), gc.IsNil)
+	segs, err = l.Segments()
+	c.Assert(err, gc.IsNil)
+	c.Assert(segs, gc.HasLen, 1)
+}
+
+func (s *walSuite) TestRotate(c *gc.C) {
+	l := s.open(c, wal.Options{})
+	defer l.Close()
+	c.Assert(l.Rotate(), gc.IsNil)
+	c.Assert(l.End(), gc.Equals, wal.Position{Segment: 1})
+	_, err := l.Append([]byte("a"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.Rotate(), gc.IsNil)
+	c.Assert(l.End(), gc.Equals, wal.Position{Segment: 2})
+}
+
+func (s *walSuite) TestDirectorySynced(c *gc.C) {
+	var synced int
+	s.PatchValue(wal.SyncDir, func(dir string) error {
+		c.Check(dir, gc.Equals, s.dir)
+		synced++
+		return nil
+	})
+	l := s.open(c, wal.Options{})
+	defer l.Close()
+	c.Assert(synced, gc.Equals, 1)
+
+	_, err := l.Append([]byte("a"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.Rotate(), gc.IsNil)
+	c.Assert(synced, gc.Equals, 2)
+
+	c.Assert(l.TruncateBefore(l.End()), gc.IsNil)
+	c.Assert(synced, gc.Equals, 3)
+}
+
+func (s *walSuite) TestRotateDirectorySyncFailure(c *gc.C) {
+	l := s.open(c, wal.Options{})
+	defer l.Close()
+	_, err := l.Append([]byte("a"))
+	c.Assert(err, gc.IsNil)
+	s.PatchValue(wal.SyncDir, func(dir string) error {
+		return errors.New("no sync for you")
+	})
+	c.Assert(l.Rotate(), gc.ErrorMatches, "cannot sync log directory: no sync for you")
+	c.Assert(l.End().Segment, gc.Equals, uint64(1))
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(files, gc.HasLen, 1)
+}
+
+func (s *walSuite) TestSyncFailureRemovesRecord(c *gc.C) {
+	l := s.open(c, wal.Options{Sync: wal.SyncAlways})
+	defer l.Close()
+	_, err := l.Append([]byte("a"))
+	c.Assert(err, gc.IsNil)
+	end := l.End()
+
+	fail := true
+	sync := *wal.SyncFile
+	s.PatchValue(wal.SyncFile, func(f *os.File) error {
+		if fail {
+			return errors.New("no sync for you")
+		}
+		return sync(f)
+	})
+	_, err = l.Append([]byte("b"))
+	c.Assert(err, gc.ErrorMatches, "cannot sync log: no sync for you")
+	c.Assert(l.End(), gc.Equals, end)
+
+	fail = false
+	_, err = l.Append([]byte("c"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(replay(c, l, l.Start()), jc.DeepEquals, []string{"a", "c"})
+}
+
+func (s *walSuite) TestReaderFollowsAppends(c *gc.C) {
+	l := s.open(c, wal.Options{SegmentSize: 32})
+	defer l.Close()
+	r := l.NewReader(l.Start())
+	defer r.Close()
+	_, _, err := r.Next()
+	c.Assert(err, gc.Equals, io.EOF)
+
+	for i := 0; i < 5; i++ {
+		_, err := l.Append([]byte(fmt.Sprint("record ", i)))
+		c.Assert(err, gc.IsNil)
+		_, data, err := r.Next()
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(data), gc.Equals, fmt.Sprint("record ", i))
+	}
+	_, _, err = r.Next()
+	c.Assert(err, gc.Equals, io.EOF)
+	c.Assert(r.Position(), gc.Equals, l.End())
+}
+
+func (s *walSuite) TestSyncBatch(c *gc.C) {
+	l := s.open(c, wal.Options{Sync: wal.SyncBatch, SyncEvery: 2})
+	for i := 0; i < 3; i++ {
+		_, err := l.Append([]byte("x"))
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(l.Sync(), gc.IsNil)
+	c.Assert(l.Close(), gc.IsNil)
+	_, err := l.Append([]byte("x"))
+	c.Assert(err, gc.ErrorMatches, "log closed")
+}
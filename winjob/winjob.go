@@ -0,0 +1,24 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// Package winjob manages Windows Job Objects, which group a process
+// and all of its descendants so that they can be limited and
+// terminated together. On other platforms all operations return an
+// error satisfying errors.IsNotSupported.
+package winjob
+
+// Limits holds the resource limits applied to all processes in a job.
+// Zero values mean no limit.
+type Limits struct {
+	// JobMemory limits the total committed memory, in bytes, of all
+	// processes in the job.
+	JobMemory uint64
+
+	// ProcessMemory limits the committed memory, in bytes, of each
+	// process in the job.
+	ProcessMemory uint64
+
+	// CPURate limits the CPU time available to the job as a
+	// percentage (1-100) of the total available on the machine.
+	CPURate int
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package winjob
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// Job represents a Windows Job Object. Jobs cannot be created on this
+// platform.
+type Job struct{}
+
+// New always returns a not supported error on this platform.
+func New(limits Limits) (*Job, error) {
+	return nil, errors.NotSupportedf("job objects")
+}
+
+// Assign always returns a not supported error on this platform.
+func (job *Job) Assign(p *os.Process) error {
+	return errors.NotSupportedf("job objects")
+}
+
+// Terminate always returns a not supported error on this platform.
+func (job *Job) Terminate(exitCode uint32) error {
+	return errors.NotSupportedf("job objects")
+}
+
+// Close does nothing on this platform.
+func (job *Job) Close() error {
+	return nil
+}
@@ -0,0 +1,27 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+// +build !windows
+
+package winjob_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/winjob"
+)
+
+type winjobSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&winjobSuite{})
+
+func (*winjobSuite) TestNotSupported(c *gc.C) {
+	job, err := winjob.New(winjob.Limits{})
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+	c.Assert(job, gc.IsNil)
+}
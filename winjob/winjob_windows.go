@@ -0,0 +1,177 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winjob
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/juju/errors"
+)
+
+//sys createJobObject(attrs *syscall.SecurityAttributes, name *uint16) (handle syscall.Handle, err error) = CreateJobObjectW
+//sys setInformationJobObject(job syscall.Handle, class uint32, info uintptr, length uint32) (err error) = SetInformationJobObject
+//sys assignProcessToJobObject(job syscall.Handle, process syscall.Handle) (err error) = AssignProcessToJobObject
+//sys terminateJobObject(job syscall.Handle, exitCode uint32) (err error) = TerminateJobObject
+
+const (
+	classExtendedLimitInformation  = 9
+	classCpuRateControlInformation = 15
+
+	jobObjectLimitProcessMemory  = 0x00000100
+	jobObjectLimitJobMemory      = 0x00000200
+	jobObjectLimitKillOnJobClose = 0x00002000
+
+	jobObjectCpuRateControlEnable  = 0x1
+	jobObjectCpuRateControlHardCap = 0x4
+
+	processSetQuota = 0x0100
+)
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type ioCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+type jobObjectExtendedLimitInformation struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                ioCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+type jobObjectCpuRateControlInformation struct {
+	ControlFlags uint32
+	CpuRate      uint32
+}
+
+// Job represents a Windows Job Object. All processes in the job are
+// terminated when the job is closed.
+type Job struct {
+	mu     sync.Mutex
+	handle syscall.Handle
+}
+
+// New creates a new anonymous job with the given limits. Processes
+// assigned to the job are killed when it is closed.
+func New(limits Limits) (*Job, error) {
+	handle, err := createJobObject(nil, nil)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot create job object")
+	}
+	job := &Job{handle: handle}
+	if err := job.setLimits(limits); err != nil {
+		job.Close()
+		return nil, errors.Trace(err)
+	}
+	return job, nil
+}
+
+func (job *Job) setLimits(limits Limits) error {
+	var info jobObjectExtendedLimitInformation
+	info.BasicLimitInformation.LimitFlags = jobObjectLimitKillOnJobClose
+	if limits.JobMemory > 0 {
+		info.BasicLimitInformation.LimitFlags |= jobObjectLimitJobMemory
+		info.JobMemoryLimit = uintptr(limits.JobMemory)
+	}
+	if limits.ProcessMemory > 0 {
+		info.BasicLimitInformation.LimitFlags |= jobObjectLimitProcessMemory
+		info.ProcessMemoryLimit = uintptr(limits.ProcessMemory)
+	}
+	err := setInformationJobObject(
+		job.handle,
+		classExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+	)
+	if err != nil {
+		return errors.Annotate(err, "cannot set job limits")
+	}
+	if limits.CPURate <= 0 {
+		return nil
+	}
+	if limits.CPURate > 100 {
+		return errors.NotValidf("CPU rate %d%%", limits.CPURate)
+	}
+	cpu := jobObjectCpuRateControlInformation{
+		ControlFlags: jobObjectCpuRateControlEnable | jobObjectCpuRateControlHardCap,
+		// The rate is expressed in hundredths of a percent.
+		CpuRate: uint32(limits.CPURate * 100),
+	}
+	err = setInformationJobObject(
+		job.handle,
+		classCpuRateControlInformation,
+		uintptr(unsafe.Pointer(&cpu)),
+		uint32(unsafe.Sizeof(cpu)),
+	)
+	if err != nil {
+		return errors.Annotate(err, "cannot set job CPU rate")
+	}
+	return nil
+}
+
+// Assign adds the given process to the job. Any processes it starts
+// afterwards also belong to the job.
+func (job *Job) Assign(p *os.Process) error {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.handle == 0 {
+		return errors.New("job is closed")
+	}
+	process, err := syscall.OpenProcess(processSetQuota|syscall.PROCESS_TERMINATE, false, uint32(p.Pid))
+	if err != nil {
+		return errors.Annotatef(err, "cannot open process %d", p.Pid)
+	}
+	defer syscall.CloseHandle(process)
+	if err := assignProcessToJobObject(job.handle, process); err != nil {
+		return errors.Annotatef(err, "cannot assign process %d to job", p.Pid)
+	}
+	return nil
+}
+
+// Terminate kills all processes in the job, which exit with the given
+// exit code. The job remains open.
+func (job *Job) Terminate(exitCode uint32) error {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.handle == 0 {
+		return errors.New("job is closed")
+	}
+	if err := terminateJobObject(job.handle, exitCode); err != nil {
+		return errors.Annotate(err, "cannot terminate job")
+	}
+	return nil
+}
+
+// Close releases the job, killing any processes still running in it.
+func (job *Job) Close() error {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.handle == 0 {
+		return nil
+	}
+	err := syscall.CloseHandle(job.handle)
+	job.handle = 0
+	return errors.Trace(err)
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package winjob_test
+
+import (
+	"os/exec"
+
+	"github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/winjob"
+)
+
+type winjobSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&winjobSuite{})
+
+func startSleeper(c *gc.C) *exec.Cmd {
+	cmd := exec.Command("powershell.exe", "-noprofile", "-command", "Start-Sleep 30")
+	err := cmd.Start()
+	c.Assert(err, gc.IsNil)
+	return cmd
+}
+
+func (*winjobSuite) TestTerminate(c *gc.C) {
+	job, err := winjob.New(winjob.Limits{
+		JobMemory: 512 * 1024 * 1024,
+		CPURate:   50,
+	})
+	c.Assert(err, gc.IsNil)
+	defer job.Close()
+
+	cmd := startSleeper(c)
+	err = job.Assign(cmd.Process)
+	c.Assert(err, gc.IsNil)
+	err = job.Terminate(42)
+	c.Assert(err, gc.IsNil)
+	err = cmd.Wait()
+	c.Assert(err, gc.ErrorMatches, "exit status 42")
+}
+
+func (*winjobSuite) TestCloseKillsProcesses(c *gc.C) {
+	job, err := winjob.New(winjob.Limits{})
+	c.Assert(err, gc.IsNil)
+
+	cmd := startSleeper(c)
+	err = job.Assign(cmd.Process)
+	c.Assert(err, gc.IsNil)
+	err = job.Close()
+	c.Assert(err, gc.IsNil)
+	err = cmd.Wait()
+	c.Assert(err, gc.NotNil)
+
+	err = job.Assign(cmd.Process)
+	c.Assert(err, gc.ErrorMatches, "job is closed")
+}
+
+func (*winjobSuite) TestInvalidCPURate(c *gc.C) {
+	_, err := winjob.New(winjob.Limits{CPURate: 101})
+	c.Assert(err, gc.ErrorMatches, "CPU rate 101% not valid")
+}
@@ -0,0 +1,149 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package zip
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Options holds options for ZipFiles.
+type Options struct {
+	// Reproducible causes the archive to depend only on the names,
+	// contents, modes and link targets of the files, so that the same
+	// files always produce a byte-identical archive. Entries are
+	// written in name order within each directory and in fileList,
+	// and every entry is given the modification time ModTime.
+	Reproducible bool
+
+	// ModTime holds the modification time recorded for every entry
+	// when Reproducible is set. If it is zero, 1980-01-01, the
+	// earliest time a zip file can record, is used.
+	ModTime time.Time
+}
+
+// ZipFiles writes a zip archive to target holding the files,
+// directories and symbolic links listed in fileList and everything
+// below them. strip is removed from the beginning of each path to
+// form the name under which it is stored. Symbolic links are stored
+// as links, and are not followed.
+func ZipFiles(fileList []string, target io.Writer, strip string, opts Options) (err error) {
+	zw := &zipWriter{
+		zipw:         zip.NewWriter(target),
+		strip:        strip,
+		reproducible: opts.Reproducible,
+		modTime:      opts.ModTime,
+	}
+	if zw.modTime.IsZero() {
+		zw.modTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		if closeErr := zw.zipw.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing zip writer: %v", closeErr)
+		}
+	}()
+	if opts.Reproducible {
+		fileList = append([]string(nil), fileList...)
+		sort.Slice(fileList, func(i, j int) bool {
+			return zw.name(fileList[i]) < zw.name(fileList[j])
+		})
+	}
+	for _, ent := range fileList {
+		if err := zw.write(ent); err != nil {
+			return fmt.Errorf("cannot add %q to zip file: %v", ent, err)
+		}
+	}
+	return nil
+}
+
+type zipWriter struct {
+	zipw         *zip.Writer
+	strip        string
+	reproducible bool
+	modTime      time.Time
+}
+
+// name returns the name under which fileName is stored.
+func (zw *zipWriter) name(fileName string) string {
+	return filepath.ToSlash(strings.TrimPrefix(fileName, zw.strip))
+}
+
+// write adds fileName, and anything below it, to the archive.
+func (zw *zipWriter) write(fileName string) error {
+	info, err := os.Lstat(fileName)
+	if err != nil {
+		return err
+	}
+	h, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	h.Name = zw.name(fileName)
+	h.Method = zip.Deflate
+	if zw.reproducible {
+		h.Modified = zw.modTime.UTC()
+	}
+	switch mode := info.Mode(); mode & os.ModeType {
+	case os.ModeDir:
+		h.Name += "/"
+		h.Method = zip.Store
+		if _, err := zw.zipw.CreateHeader(h); err != nil {
+			return err
+		}
+		return zw.writeDir(fileName)
+	case os.ModeSymlink:
+		target, err := os.Readlink(fileName)
+		if err != nil {
+			return err
+		}
+		w, err := zw.zipw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, target)
+		return err
+	case 0:
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w, err := zw.zipw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		return err
+	default:
+		return fmt.Errorf("cannot archive file with mode %v", mode)
+	}
+}
+
+// writeDir adds the contents of the directory dir to the archive.
+func (zw *zipWriter) writeDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if zw.reproducible {
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if err := zw.write(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENCE file for details.
+
+package zip_test
+
+import (
+	stdzip "archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	ft "github.com/juju/testing/filetesting"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/utils/zip"
+)
+
+type CreateSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&CreateSuite{})
+
+var createEntries = ft.Entries{
+	ft.Dir{"top", 0755},
+	ft.File{"top/b-file", "some content", 0644},
+	ft.File{"top/a-file", "other content", 0600},
+	ft.Dir{"top/sub", 0750},
+	ft.Symlink{"top/sub/link", "../a-file"},
+	ft.File{"top/sub/exe", "#!/bin/sh", 0755},
+}
+
+func (s *CreateSuite) createZip(c *gc.C, opts zip.Options) (string, []byte) {
+	dir := c.MkDir()
+	createEntries.Create(c, dir)
+	var buf bytes.Buffer
+	err := zip.ZipFiles([]string{filepath.Join(dir, "top")}, &buf, dir+"/", opts)
+	c.Assert(err, gc.IsNil)
+	return dir, buf.Bytes()
+}
+
+func (s *CreateSuite) TestRoundTrip(c *gc.C) {
+	_, data := s.createZip(c, zip.Options{})
+	reader, err := stdzip.NewReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, gc.IsNil)
+	target := c.MkDir()
+	err = zip.ExtractAll(reader, target)
+	c.Assert(err, gc.IsNil)
+	createEntries.Check(c, target)
+}
+
+func (s *CreateSuite) TestReproducible(c *gc.C) {
+	modTime := time.Date(2015, 6, 7, 8, 9, 10, 0, time.UTC)
+	opts := zip.Options{
+		Reproducible: true,
+		ModTime:      modTime,
+	}
+	dir, first := s.createZip(c, opts)
+
+	// Files created later in a different directory produce the
+	// same archive.
+	later := time.Now().Add(time.Hour)
+	err := os.Chtimes(filepath.Join(dir, "top", "a-file"), later, later)
+	c.Assert(err, gc.IsNil)
+	_, second := s.createZip(c, opts)
+	c.Assert(second, jc.DeepEquals, first)
+
+	reader, err := stdzip.NewReader(bytes.NewReader(first), int64(len(first)))
+	c.Assert(err, gc.IsNil)
+	var names []string
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+		c.Check(f.Modified.Equal(modTime), jc.IsTrue)
+	}
+	c.Assert(names, jc.DeepEquals, []string{
+		"top/",
+		"top/a-file",
+		"top/b-file",
+		"top/sub/",
+		"top/sub/exe",
+		"top/sub/link",
+	})
+}